@@ -23,8 +23,40 @@ type Tenant struct {
 	UUID          string `toml:"uuid"`
 	VerifySSL     bool   `toml:"verify_ssl"`
 	EncryptionKey string `toml:"encryption_key"` // hex-encoded 32-byte ChaCha20-Poly1305 key, set by server
-	apiKeySec     *secure.String
-	encKeySec     *secure.String
+	// EncryptionKeyID identifies EncryptionKey on the wire. Empty for the key
+	// set at install, before the first rotation.
+	EncryptionKeyID string `toml:"encryption_key_id"`
+	// PreviousEncryptionKey is the key replaced by the last rotation, kept
+	// so payloads sealed before the switchover can still be opened.
+	PreviousEncryptionKey   string `toml:"previous_encryption_key"`
+	PreviousEncryptionKeyID string `toml:"previous_encryption_key_id"`
+	// Envelope selects the encrypted body format: "auto" (v2 once the tenant
+	// advertises it), "v1" (legacy, no replay protection) or "v2" (required;
+	// legacy responses are rejected). Set "v2" once the tenant supports it.
+	Envelope string `toml:"envelope"`
+	// Compression selects upload compression: "auto" (the best coding the
+	// tenant advertises), "off", or "gzip"/"zstd" to force one.
+	Compression string `toml:"compression"`
+	// DisablePush turns off the push channel, leaving the agent to poll for
+	// commands and device queries on its own schedule.
+	DisablePush bool `toml:"disable_push"`
+	// CABundle is a PEM file of CA certificates trusted for the tenant in
+	// addition to the system roots, e.g. the CA of an SSL-inspecting
+	// firewall. A relative path is resolved against the data directory.
+	CABundle string `toml:"ca_bundle"`
+	// SPKIPins pins the tenant's public key: connections are refused unless
+	// a certificate in the verified chain (the leaf alone, with verify_ssl
+	// off) has one of these keys, each "sha256/<base64 SHA-256 of the
+	// SubjectPublicKeyInfo>". "forcedesk-agent tls-inspect" prints them.
+	SPKIPins []string `toml:"spki_pins"`
+	// ClientCert and ClientKey are PEM files of a certificate and key to
+	// present to the tenant for mutual TLS. Set both or neither.
+	ClientCert string `toml:"client_cert"`
+	ClientKey  string `toml:"client_key"`
+
+	apiKeySec  *secure.String
+	encKeySec  *secure.String
+	prevKeySec *secure.String
 }
 
 // GetAPIKey returns the API key from secure storage, or falls back to the plain text field.
@@ -40,26 +72,88 @@ func (t *Tenant) GetAPIKey() string {
 func (t *Tenant) GetEncryptionKey() ([]byte, error) {
 	// Prefer the secure wrapper (set after Load); fall back to the plain field
 	// for callers that construct a Config struct directly (e.g. tests, Setup wizard).
-	var raw string
+	raw := t.EncryptionKey
 	if t.encKeySec != nil && !t.encKeySec.IsEmpty() {
 		raw = t.encKeySec.String()
-	} else {
-		raw = t.EncryptionKey
 	}
 	if raw == "" {
 		return nil, fmt.Errorf("encryption_key not set in [tenant] config")
 	}
+	return decodeKey("encryption_key", raw)
+}
+
+// GetPreviousEncryptionKey returns the key replaced by the last rotation, or
+// nil if the key has never been rotated.
+func (t *Tenant) GetPreviousEncryptionKey() ([]byte, error) {
+	raw := t.PreviousEncryptionKey
+	if t.prevKeySec != nil && !t.prevKeySec.IsEmpty() {
+		raw = t.prevKeySec.String()
+	}
+	if raw == "" {
+		return nil, nil
+	}
+	return decodeKey("previous_encryption_key", raw)
+}
+
+// EncryptionKeys returns the current key followed by the previous one, if
+// any, for verifying data that may predate a rotation.
+func (t *Tenant) EncryptionKeys() ([][]byte, error) {
+	key, err := t.GetEncryptionKey()
+	if err != nil {
+		return nil, err
+	}
+	prev, err := t.GetPreviousEncryptionKey()
+	if err != nil {
+		return nil, err
+	}
+	if prev == nil {
+		return [][]byte{key}, nil
+	}
+	return [][]byte{key, prev}, nil
+}
+
+// SetEncryptionKey makes key, identified by id, the current encryption key
+// and keeps the current one as the previous key. Persist the change with
+// SaveConfig.
+func (t *Tenant) SetEncryptionKey(id string, key []byte) {
+	t.prevKeySec = t.encKeySec
+	if t.prevKeySec == nil && t.EncryptionKey != "" {
+		t.prevKeySec = secure.NewString(t.EncryptionKey)
+	}
+	t.PreviousEncryptionKeyID = t.EncryptionKeyID
+	t.PreviousEncryptionKey = ""
+	t.encKeySec = secure.NewString(hex.EncodeToString(key))
+	t.EncryptionKey = ""
+	t.EncryptionKeyID = id
+}
 
+// SetCredentials replaces the agent's identity with one issued by enrollment:
+// its UUID, API key and encryption key. Any previous key is discarded, since
+// it belonged to the old identity. Persist the change with SaveConfig.
+func (t *Tenant) SetCredentials(uuid, apiKey, keyID string, key []byte) {
+	t.UUID = uuid
+	t.APIKey = ""
+	t.apiKeySec = secure.NewString(apiKey)
+	t.EncryptionKey = ""
+	t.encKeySec = secure.NewString(hex.EncodeToString(key))
+	t.EncryptionKeyID = keyID
+	t.PreviousEncryptionKey = ""
+	t.prevKeySec = nil
+	t.PreviousEncryptionKeyID = ""
+}
+
+// decodeKey decodes a hex-encoded key from the named config field.
+func decodeKey(field, raw string) ([]byte, error) {
 	// The key is stored as a 64-character hex string (32 bytes × 2 hex digits/byte).
 	key, err := hex.DecodeString(raw)
 	if err != nil {
-		return nil, fmt.Errorf("encryption_key is not valid hex: %w", err)
+		return nil, fmt.Errorf("%s is not valid hex: %w", field, err)
 	}
 
 	// ChaCha20-Poly1305 requires exactly 256 bits (32 bytes). Reject anything else
 	// before it reaches the cipher to get a clear error rather than a cryptic one.
 	if len(key) != 32 {
-		return nil, fmt.Errorf("encryption_key must be 32 bytes (64 hex chars), got %d bytes", len(key))
+		return nil, fmt.Errorf("%s must be 32 bytes (64 hex chars), got %d bytes", field, len(key))
 	}
 	return key, nil
 }
@@ -89,8 +183,14 @@ type EduStar struct {
 	ServiceAccountGroupDN   string `toml:"service_account_group_dn"`
 	ServiceAccountGroupName string `toml:"service_account_group_name"`
 	// AuthMode controls authentication: "ntlm", "form", or "" (auto — tries NTLM then form).
-	AuthMode    string `toml:"auth_mode"`
-	passwordSec *secure.String
+	AuthMode string `toml:"auth_mode"`
+	// CRTEnableSchedule and CRTExpireSchedule are cron expressions (e.g. "30 7 * * *")
+	// for enabling and expiring CRT accounts. Empty leaves the action to the command queue.
+	CRTEnableSchedule string `toml:"crt_enable_schedule"`
+	CRTExpireSchedule string `toml:"crt_expire_schedule"`
+	// CRTWeekdaysOnly skips the CRT schedules on Saturdays and Sundays.
+	CRTWeekdaysOnly bool `toml:"crt_weekdays_only"`
+	passwordSec     *secure.String
 }
 
 // GetPassword returns the STMC password from secure storage, or falls back to the plain text field.
@@ -101,6 +201,88 @@ func (e *EduStar) GetPassword() string {
 	return e.Password
 }
 
+// Schedule holds settings shared by all scheduled tasks.
+type Schedule struct {
+	// Spread is the window (Go duration, e.g. "2m") over which the first run
+	// of each interval task is offset by an amount derived from the agent
+	// UUID, so agents restarted together don't all call the tenant at once.
+	// "0s" disables it. The tenant's schedule manifest can override it.
+	Spread string `toml:"spread"`
+	// Timezone is the IANA zone cron expressions are evaluated in, e.g.
+	// "Australia/Melbourne". Empty uses the host's local time zone.
+	Timezone string `toml:"timezone"`
+	// BlackoutDates lists days ("2026-04-03") or inclusive ranges
+	// ("2026-04-03..2026-04-19") on which calendar-scheduled tasks are skipped.
+	BlackoutDates []string `toml:"blackout_dates"`
+	// Resources overrides the capacity of the shared resource locks, e.g.
+	// stmc = 3 to allow three concurrent STMC sessions.
+	Resources map[string]int `toml:"resources"`
+	// StuckMultiple flags a task as stuck once a run has lasted this many
+	// intervals (and at least its timeout); its goroutine stacks are logged
+	// and reported in the heartbeat. Zero disables the watchdog.
+	StuckMultiple float64 `toml:"stuck_multiple"`
+	// AbandonStuck gives up on a stuck run so the task's next tick can start
+	// a fresh one instead of being skipped.
+	AbandonStuck bool `toml:"abandon_stuck"`
+}
+
+// History controls the task run history kept in the local database.
+type History struct {
+	// RetentionDays is how long task runs are kept. Zero or negative keeps them forever.
+	RetentionDays int `toml:"retention_days"`
+}
+
+// Outbox controls how uploads the tenant could not receive are kept and retried.
+type Outbox struct {
+	// MaxAge is how long (Go duration, e.g. "168h") an upload is retried
+	// before it is given up.
+	MaxAge string `toml:"max_age"`
+	// MaxAttempts is how many delivery attempts are made before an upload is
+	// given up. Zero means no limit.
+	MaxAttempts int `toml:"max_attempts"`
+}
+
+// Update controls self-update to versions offered by the tenant.
+type Update struct {
+	// Enabled lets the agent install updates the tenant offers. An update is
+	// only installed if it is signed with the key built into the agent.
+	Enabled bool `toml:"enabled"`
+	// TrialPeriod is how long (Go duration, e.g. "15m") a new version has to
+	// report a healthy heartbeat before it is rolled back.
+	TrialPeriod string `toml:"trial_period"`
+}
+
+// Proxy controls how outbound HTTP traffic (tenant, STMC, notebooks,
+// PaperCut) reaches its destination.
+type Proxy struct {
+	// Mode is "env" (HTTPS_PROXY, HTTP_PROXY and NO_PROXY from the
+	// environment), "manual" (URL below) or "off" (always connect directly).
+	Mode string `toml:"mode"`
+	// URL is the proxy for "manual" mode, e.g. "http://proxy.school.local:8080".
+	URL string `toml:"url"`
+	// Auth is the proxy authentication: "" (none, or credentials in the proxy
+	// URL), "basic" or "ntlm". NTLM usernames may be given as DOMAIN\user.
+	Auth     string `toml:"auth"`
+	Username string `toml:"username"`
+	Password string `toml:"password"`
+	// Bypass lists destinations reached directly, in NO_PROXY syntax: a host
+	// name (which also matches its subdomains), ".domain" (subdomains only),
+	// an IP address or CIDR range, each optionally with ":port"; "<local>"
+	// for dotless intranet names; "*" for everything. Loopback addresses are
+	// never proxied.
+	Bypass []string `toml:"bypass"`
+
+	passwordSec *secure.String
+}
+
+// GetPassword returns the proxy password from secure storage, or falls back to the plain text field.
+func (p *Proxy) GetPassword() string {
+	if p.passwordSec != nil && !p.passwordSec.IsEmpty() {
+		return p.passwordSec.String()
+	}
+	return p.Password
+}
+
 type DeviceManager struct {
 	LegacySSHOptions string `toml:"legacy_ssh_options"`
 }
@@ -118,6 +300,11 @@ type Config struct {
 	Tenant        Tenant        `toml:"tenant"`
 	Papercut      Papercut      `toml:"papercut"`
 	EduStar       EduStar       `toml:"edustar"`
+	Schedule      Schedule      `toml:"schedule"`
+	History       History       `toml:"history"`
+	Outbox        Outbox        `toml:"outbox"`
+	Proxy         Proxy         `toml:"proxy"`
+	Update        Update        `toml:"update"`
 	DeviceManager DeviceManager `toml:"device_manager"`
 	Logging       Logging       `toml:"logging"`
 	WebUI         WebUI         `toml:"webui"`
@@ -184,6 +371,10 @@ func Load() (*Config, error) {
 		cfg.Tenant.encKeySec = secure.NewString(cfg.Tenant.EncryptionKey)
 		cfg.Tenant.EncryptionKey = ""
 	}
+	if cfg.Tenant.PreviousEncryptionKey != "" {
+		cfg.Tenant.prevKeySec = secure.NewString(cfg.Tenant.PreviousEncryptionKey)
+		cfg.Tenant.PreviousEncryptionKey = ""
+	}
 	if cfg.Papercut.APIKey != "" {
 		cfg.Papercut.apiKeySec = secure.NewString(cfg.Papercut.APIKey)
 		cfg.Papercut.APIKey = ""
@@ -192,6 +383,10 @@ func Load() (*Config, error) {
 		cfg.EduStar.passwordSec = secure.NewString(cfg.EduStar.Password)
 		cfg.EduStar.Password = ""
 	}
+	if cfg.Proxy.Password != "" {
+		cfg.Proxy.passwordSec = secure.NewString(cfg.Proxy.Password)
+		cfg.Proxy.Password = ""
+	}
 
 	mu.Lock()
 	instance = cfg
@@ -283,27 +478,69 @@ func SaveConfig(cfg *Config) error {
 }
 
 // save writes cfg to ConfigPath as TOML, creating the data directory if needed.
+// It writes a temporary file and renames it over the config, so a crash or
+// full disk mid-write can't leave the agent with a truncated config.
 func save(cfg *Config) error {
 	if err := os.MkdirAll(DataDir(), 0755); err != nil {
 		return fmt.Errorf("create data dir: %w", err)
 	}
+	path := ConfigPath()
+	tmp := path + ".tmp"
 	// Create config file with restrictive permissions (owner read/write only).
 	// This prevents other users from reading API keys and passwords.
-	f, err := os.OpenFile(ConfigPath(), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
 	if err != nil {
 		return fmt.Errorf("create config file: %w", err)
 	}
-	defer f.Close()
-	if err := toml.NewEncoder(f).Encode(cfg); err != nil {
+	if err := toml.NewEncoder(f).Encode(withSecrets(cfg)); err != nil {
+		f.Close()
+		os.Remove(tmp)
 		return fmt.Errorf("encode config: %w", err)
 	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return fmt.Errorf("sync config file: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("close config file: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("replace config file: %w", err)
+	}
 	return nil
 }
 
+// withSecrets returns a copy of cfg for writing to disk, with the plain-text
+// secret fields that Load scrubbed filled back in from secure storage, so
+// saving a loaded config doesn't drop its credentials.
+func withSecrets(cfg *Config) *Config {
+	out := *cfg
+	fill := func(plain *string, sec *secure.String) {
+		if *plain == "" && sec != nil && !sec.IsEmpty() {
+			*plain = sec.String()
+		}
+	}
+	fill(&out.Tenant.APIKey, cfg.Tenant.apiKeySec)
+	fill(&out.Tenant.EncryptionKey, cfg.Tenant.encKeySec)
+	fill(&out.Tenant.PreviousEncryptionKey, cfg.Tenant.prevKeySec)
+	fill(&out.Papercut.APIKey, cfg.Papercut.apiKeySec)
+	fill(&out.EduStar.Password, cfg.EduStar.passwordSec)
+	fill(&out.Proxy.Password, cfg.Proxy.passwordSec)
+	return &out
+}
+
 func defaults() *Config {
 	return &Config{
-		Tenant:  Tenant{VerifySSL: true},
-		Logging: Logging{Level: "info"},
+		Tenant:   Tenant{VerifySSL: true, Envelope: "auto", Compression: "auto"},
+		Logging:  Logging{Level: "info"},
+		History:  History{RetentionDays: 30},
+		Outbox:   Outbox{MaxAge: "168h", MaxAttempts: 500},
+		Proxy:    Proxy{Mode: "env"},
+		Update:   Update{Enabled: true, TrialPeriod: "15m"},
+		Schedule: Schedule{Spread: "1m", StuckMultiple: 3},
 		DeviceManager: DeviceManager{
 			LegacySSHOptions: "-o StrictHostKeyChecking=no -oKexAlgorithms=+diffie-hellman-group1-sha1",
 		},
@@ -358,6 +595,11 @@ func promptBool(r *bufio.Reader, label string, def bool) bool {
 	}
 }
 
+// PromptSecret prompts for a value on the terminal without echoing it.
+func PromptSecret(label string) string {
+	return promptPassword(bufio.NewReader(os.Stdin), label)
+}
+
 // promptPassword reads a value with echo suppressed when stdin is a terminal,
 // falling back to plain text input if it is not.
 func promptPassword(r *bufio.Reader, label string) string {
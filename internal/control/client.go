@@ -0,0 +1,106 @@
+// Copyright © 2026 ForcePoint Software. All rights reserved.
+
+package control
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Client talks to the running agent's control socket. Used by the CLI verbs.
+type Client struct {
+	http  *http.Client
+	token string
+}
+
+// NewClient returns a Client for the control socket, authenticated with the
+// token from the data directory.
+func NewClient() (*Client, error) {
+	token, err := ReadToken()
+	if err != nil {
+		return nil, fmt.Errorf("%w (is the agent running, and are you an administrator?)", err)
+	}
+
+	path := SocketPath()
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", path)
+		},
+	}
+	return &Client{
+		http:  &http.Client{Transport: transport, Timeout: 30 * time.Second},
+		token: token,
+	}, nil
+}
+
+// Tasks returns the current state of every registered task.
+func (c *Client) Tasks(ctx context.Context) (Response, error) {
+	return c.do(ctx, http.MethodGet, "/api/tasks", nil)
+}
+
+// Run triggers an immediate run of the named task.
+func (c *Client) Run(ctx context.Context, name string) (Response, error) {
+	return c.do(ctx, http.MethodPost, "/api/tasks/"+url.PathEscape(name)+"/run", nil)
+}
+
+// Pause stops the named task from being dispatched on its schedule.
+func (c *Client) Pause(ctx context.Context, name string) (Response, error) {
+	return c.do(ctx, http.MethodPost, "/api/tasks/"+url.PathEscape(name)+"/pause", nil)
+}
+
+// Resume re-enables a paused task.
+func (c *Client) Resume(ctx context.Context, name string) (Response, error) {
+	return c.do(ctx, http.MethodPost, "/api/tasks/"+url.PathEscape(name)+"/resume", nil)
+}
+
+// SetInterval changes the named task's interval, e.g. "10m".
+func (c *Client) SetInterval(ctx context.Context, name, interval string) (Response, error) {
+	return c.do(ctx, http.MethodPost, "/api/tasks/"+url.PathEscape(name)+"/interval", intervalRequest{Interval: interval})
+}
+
+// do sends one request and decodes the Response. A non-2xx status is
+// returned as an error carrying the server's message.
+func (c *Client) do(ctx context.Context, method, path string, body any) (Response, error) {
+	var rd io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return Response{}, err
+		}
+		rd = bytes.NewReader(b)
+	}
+
+	// The host is ignored by the unix dialer but must be present in the URL.
+	req, err := http.NewRequestWithContext(ctx, method, "http://agent"+path, rd)
+	if err != nil {
+		return Response{}, err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return Response{}, fmt.Errorf("connect to agent: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var out Response
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return Response{}, fmt.Errorf("decode response (HTTP %d): %w", resp.StatusCode, err)
+	}
+	if resp.StatusCode >= 300 {
+		return out, errors.New(out.Error)
+	}
+	return out, nil
+}
@@ -0,0 +1,237 @@
+// Copyright © 2026 ForcePoint Software. All rights reserved.
+
+// Package control exposes runtime task control (pause, resume, run-now and
+// interval overrides) over HTTP. The same handler is served on a local socket
+// for the CLI and mounted into the WebUI for the dashboard buttons. Every
+// request must carry the bearer token stored in the data directory.
+package control
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/forcedesk/forcedesk-agent/internal/config"
+	"github.com/forcedesk/forcedesk-agent/internal/scheduler"
+)
+
+// SocketPath returns the path of the local control socket. AF_UNIX sockets
+// are supported on Windows 10 1803 and later as well as on Unix hosts. The
+// socket lives in its own directory that only the service account and
+// administrators can enter, so nobody else can connect to it even in the
+// moment between Listen creating it and Serve restricting it.
+func SocketPath() string {
+	return filepath.Join(config.DataDir(), "control", "agent.sock")
+}
+
+// TokenPath returns the path of the file holding the control bearer token.
+func TokenPath() string {
+	return filepath.Join(config.DataDir(), "control.token")
+}
+
+// LoadOrCreateToken returns the control token, generating and persisting a
+// new random one on first use. The file is restricted to the service account
+// and administrators before the token is written to it; an existing file is
+// restricted again in case it predates that.
+func LoadOrCreateToken() (string, error) {
+	path := TokenPath()
+	if data, err := os.ReadFile(path); err == nil {
+		if tok := strings.TrimSpace(string(data)); len(tok) == 64 {
+			if err := restrict(path); err != nil {
+				return "", fmt.Errorf("restrict token file: %w", err)
+			}
+			return tok, nil
+		}
+	}
+
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("generate token: %w", err)
+	}
+	tok := hex.EncodeToString(b)
+
+	if err := os.MkdirAll(config.DataDir(), 0755); err != nil {
+		return "", fmt.Errorf("create data dir: %w", err)
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return "", fmt.Errorf("save token: %w", err)
+	}
+	if err := restrict(path); err != nil {
+		f.Close()
+		return "", fmt.Errorf("restrict token file: %w", err)
+	}
+	if _, err := f.WriteString(tok); err != nil {
+		f.Close()
+		return "", fmt.Errorf("save token: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return "", fmt.Errorf("save token: %w", err)
+	}
+	return tok, nil
+}
+
+// ReadToken returns the existing control token without creating one. Used by
+// the CLI, which must match the token of the running service.
+func ReadToken() (string, error) {
+	data, err := os.ReadFile(TokenPath())
+	if err != nil {
+		return "", fmt.Errorf("read control token: %w", err)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// Response is the JSON body returned by every control endpoint.
+type Response struct {
+	OK        bool                      `json:"ok"`
+	Message   string                    `json:"message,omitempty"`
+	Error     string                    `json:"error,omitempty"`
+	Tasks     []scheduler.TaskState     `json:"tasks,omitempty"`
+	Resources []scheduler.ResourceState `json:"resources,omitempty"`
+}
+
+// intervalRequest is the body of POST /api/tasks/{name}/interval.
+type intervalRequest struct {
+	Interval string `json:"interval"` // Go duration, e.g. "10m"
+}
+
+// Handler returns the control API. Routes:
+//
+//	GET  /api/tasks
+//	POST /api/tasks/{name}/run
+//	POST /api/tasks/{name}/pause
+//	POST /api/tasks/{name}/resume
+//	POST /api/tasks/{name}/interval   {"interval": "10m"}
+//
+// An empty token disables the API; every request is then rejected.
+func Handler(s *scheduler.Scheduler, token string) http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("GET /api/tasks", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, Response{OK: true, Tasks: s.States(), Resources: s.Resources()})
+	})
+	mux.HandleFunc("POST /api/tasks/{name}/run", func(w http.ResponseWriter, r *http.Request) {
+		name := r.PathValue("name")
+		reply(w, s.RunNow(name), "run started: "+name)
+	})
+	mux.HandleFunc("POST /api/tasks/{name}/pause", func(w http.ResponseWriter, r *http.Request) {
+		name := r.PathValue("name")
+		reply(w, s.Pause(name), "paused: "+name)
+	})
+	mux.HandleFunc("POST /api/tasks/{name}/resume", func(w http.ResponseWriter, r *http.Request) {
+		name := r.PathValue("name")
+		reply(w, s.Resume(name), "resumed: "+name)
+	})
+	mux.HandleFunc("POST /api/tasks/{name}/interval", func(w http.ResponseWriter, r *http.Request) {
+		name := r.PathValue("name")
+		var req intervalRequest
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4096)).Decode(&req); err != nil {
+			writeJSON(w, http.StatusBadRequest, Response{Error: "invalid request body"})
+			return
+		}
+		d, err := time.ParseDuration(req.Interval)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, Response{Error: fmt.Sprintf("invalid interval %q", req.Interval)})
+			return
+		}
+		reply(w, s.SetInterval(name, d), fmt.Sprintf("interval of %s set to %s", name, d))
+	})
+
+	return authorize(token, mux)
+}
+
+// authorize rejects requests that do not present the control token as a
+// bearer credential. Requiring a header rather than a cookie also stops other
+// web pages from driving the API through the user's browser.
+func authorize(token string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if token == "" {
+			writeJSON(w, http.StatusServiceUnavailable, Response{Error: "task control is unavailable: no control token"})
+			return
+		}
+		got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			writeJSON(w, http.StatusUnauthorized, Response{Error: "unauthorized"})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// reply maps a scheduler error to an HTTP status and writes the response.
+func reply(w http.ResponseWriter, err error, msg string) {
+	switch {
+	case err == nil:
+		writeJSON(w, http.StatusOK, Response{OK: true, Message: msg})
+	case errors.Is(err, scheduler.ErrUnknownTask):
+		writeJSON(w, http.StatusNotFound, Response{Error: err.Error()})
+	case errors.Is(err, scheduler.ErrAlreadyRunning), errors.Is(err, scheduler.ErrNotInterval), errors.Is(err, scheduler.ErrStopped):
+		writeJSON(w, http.StatusConflict, Response{Error: err.Error()})
+	default:
+		writeJSON(w, http.StatusBadRequest, Response{Error: err.Error()})
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// Serve listens on the control socket and serves the control API in a
+// background goroutine. The returned func closes the listener and removes
+// the socket file.
+func Serve(s *scheduler.Scheduler, token string) (func(), error) {
+	path := SocketPath()
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("create socket directory: %w", err)
+	}
+	// MkdirAll leaves an existing directory as it is.
+	if err := restrictDir(dir); err != nil {
+		return nil, fmt.Errorf("restrict socket directory: %w", err)
+	}
+
+	// A socket file left behind by a crashed process would make Listen fail.
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("remove stale socket: %w", err)
+	}
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("listen on %s: %w", path, err)
+	}
+	// Best effort: the directory already keeps others out, and the token
+	// still guards every request.
+	if err := restrict(path); err != nil {
+		slog.Warn("control: failed to restrict socket", "err", err)
+	}
+
+	srv := &http.Server{
+		Handler:      Handler(s, token),
+		ReadTimeout:  10 * time.Second,
+		WriteTimeout: 30 * time.Second,
+	}
+
+	slog.Info("control: listening", "socket", path)
+	go func() {
+		if err := srv.Serve(ln); err != nil && err != http.ErrServerClosed {
+			slog.Error("control: server stopped unexpectedly", "err", err)
+		}
+	}()
+
+	return func() {
+		srv.Close()
+		os.Remove(path)
+	}, nil
+}
@@ -0,0 +1,17 @@
+// Copyright © 2026 ForcePoint Software. All rights reserved.
+
+//go:build !windows
+
+package control
+
+import "os"
+
+// restrict limits path to its owner.
+func restrict(path string) error {
+	return os.Chmod(path, 0600)
+}
+
+// restrictDir limits a directory to its owner.
+func restrictDir(path string) error {
+	return os.Chmod(path, 0700)
+}
@@ -0,0 +1,39 @@
+// Copyright © 2026 ForcePoint Software. All rights reserved.
+
+package control
+
+import "golang.org/x/sys/windows"
+
+// ownerOnlySDDL grants full control to SYSTEM and Administrators and nobody
+// else. The DACL is protected so nothing is inherited from %ProgramData%,
+// which lets BUILTIN\Users read. ownerOnlyDirSDDL is the same for a
+// directory, passed on to everything created in it.
+const (
+	ownerOnlySDDL    = "D:P(A;;FA;;;SY)(A;;FA;;;BA)"
+	ownerOnlyDirSDDL = "D:P(A;OICI;FA;;;SY)(A;OICI;FA;;;BA)"
+)
+
+// restrict limits path to the service account and administrators. File
+// modes mean nothing on Windows, so it replaces the file's DACL.
+func restrict(path string) error {
+	return setDACL(path, ownerOnlySDDL)
+}
+
+// restrictDir limits a directory, and what is later created in it, to the
+// service account and administrators.
+func restrictDir(path string) error {
+	return setDACL(path, ownerOnlyDirSDDL)
+}
+
+func setDACL(path, sddl string) error {
+	sd, err := windows.SecurityDescriptorFromString(sddl)
+	if err != nil {
+		return err
+	}
+	dacl, _, err := sd.DACL()
+	if err != nil {
+		return err
+	}
+	return windows.SetNamedSecurityInfo(path, windows.SE_FILE_OBJECT,
+		windows.DACL_SECURITY_INFORMATION|windows.PROTECTED_DACL_SECURITY_INFORMATION, nil, nil, dacl, nil)
+}
@@ -7,15 +7,24 @@ import (
 	"crypto/sha256"
 	"database/sql"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"time"
 
+	"golang.org/x/crypto/chacha20poly1305"
 	_ "modernc.org/sqlite"
 )
 
 var DB *sql.DB
 
+// sealKey encrypts sensitive values at rest; see seal.
+var sealKey []byte
+
+// dbPath is the database file, set by Open.
+var dbPath string
+
 // Open initializes the SQLite database, creating the data directory and database file if necessary.
 // It enables Write-Ahead Logging (WAL) mode and sets a busy timeout for concurrent access.
 // Database encryption is enabled using a key derived from the machine's unique characteristics.
@@ -51,8 +60,8 @@ func Open(dataDir string) error {
 	// the overhead of the connection pool.
 	db.SetMaxOpenConns(1)
 
-	// Retain the key for future application-level encryption of sensitive rows.
-	_ = encKey
+	// Retain the key for application-level encryption of sensitive rows.
+	sealKey = encKey
 
 	// Create tables and indexes that don't yet exist; no-op on subsequent runs.
 	if err := migrate(db); err != nil {
@@ -60,9 +69,26 @@ func Open(dataDir string) error {
 	}
 
 	DB = db
+	dbPath = path
 	return nil
 }
 
+// Size returns the size on disk of the database, including its write-ahead log.
+func Size() (int64, error) {
+	if dbPath == "" {
+		return 0, errors.New("database not open")
+	}
+	fi, err := os.Stat(dbPath)
+	if err != nil {
+		return 0, err
+	}
+	size := fi.Size()
+	if wal, err := os.Stat(dbPath + "-wal"); err == nil {
+		size += wal.Size()
+	}
+	return size, nil
+}
+
 // getOrCreateEncryptionKey generates or retrieves the database encryption key.
 // The key is derived from machine-specific characteristics and stored securely.
 func getOrCreateEncryptionKey(dataDir string) ([]byte, error) {
@@ -152,7 +178,92 @@ func migrate(db *sql.DB) error {
 			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
 			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
 		);
+
+		-- Records every scheduler dispatch so task history survives restarts.
+		-- Times are Unix milliseconds; outcome is ok, error, panic or
+		-- skipped-overlap. A row with runs > 1 stands for that many
+		-- consecutive successful runs of a frequent task, from started_at to
+		-- ended_at; duration_ms is the longest of them.
+		CREATE TABLE IF NOT EXISTS task_runs (
+			id          INTEGER PRIMARY KEY AUTOINCREMENT,
+			task        TEXT NOT NULL,
+			started_at  INTEGER NOT NULL,
+			ended_at    INTEGER NOT NULL,
+			duration_ms INTEGER NOT NULL DEFAULT 0,
+			outcome     TEXT NOT NULL,
+			error       TEXT NOT NULL DEFAULT '',
+			summary     TEXT NOT NULL DEFAULT '',
+			runs        INTEGER NOT NULL DEFAULT 1
+		);
+		-- Supports per-task history pages and retention pruning by age.
+		CREATE INDEX IF NOT EXISTS idx_task_runs_task ON task_runs (task, started_at DESC);
+		CREATE INDEX IF NOT EXISTS idx_task_runs_started ON task_runs (started_at);
+
+		-- Small key/value store for agent state that must survive restarts,
+		-- such as the last good schedule manifest received from the tenant.
+		CREATE TABLE IF NOT EXISTS agent_state (
+			key        TEXT PRIMARY KEY,
+			value      BLOB NOT NULL,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		);
+
+		-- One row per command-queue job, keyed by the tenant's request UUID so
+		-- a re-delivered command is recognised and dropped. Times are Unix
+		-- milliseconds (0 until reached); state is queued, running, succeeded
+		-- or failed. reported is set once the result reached the tenant, or
+		-- the tenant refused it for good, in which case report_error says why.
+		CREATE TABLE IF NOT EXISTS jobs (
+			request_uuid TEXT PRIMARY KEY,
+			type         TEXT NOT NULL,
+			state        TEXT NOT NULL,
+			queued_at    INTEGER NOT NULL,
+			started_at   INTEGER NOT NULL DEFAULT 0,
+			ended_at     INTEGER NOT NULL DEFAULT 0,
+			error        TEXT NOT NULL DEFAULT '',
+			output       TEXT NOT NULL DEFAULT '',
+			reported     INTEGER NOT NULL DEFAULT 0,
+			report_error TEXT NOT NULL DEFAULT ''
+		);
+		CREATE INDEX IF NOT EXISTS idx_jobs_queued ON jobs (queued_at);
+
+		-- Uploads waiting to be delivered to the tenant, oldest first. The
+		-- payload is sealed with the database key. Times are Unix
+		-- milliseconds; state is pending or failed (gave up, kept for
+		-- inspection until pruned). Delivered rows are deleted.
+		CREATE TABLE IF NOT EXISTS outbox (
+			id              INTEGER PRIMARY KEY AUTOINCREMENT,
+			endpoint        TEXT NOT NULL,
+			kind            TEXT NOT NULL,
+			payload         BLOB,
+			size            INTEGER NOT NULL,
+			state           TEXT NOT NULL DEFAULT 'pending',
+			created_at      INTEGER NOT NULL,
+			attempts        INTEGER NOT NULL DEFAULT 0,
+			last_attempt_at INTEGER NOT NULL DEFAULT 0,
+			last_error      TEXT NOT NULL DEFAULT ''
+		);
+		CREATE INDEX IF NOT EXISTS idx_outbox_state ON outbox (state, id);
 	`)
+	if err != nil {
+		return err
+	}
+	if err := addColumn(db, "task_runs", "runs", "INTEGER NOT NULL DEFAULT 1"); err != nil {
+		return err
+	}
+	return addColumn(db, "jobs", "report_error", "TEXT NOT NULL DEFAULT ''")
+}
+
+// addColumn adds a column to a table created by an earlier version of the
+// agent, unless it is already there.
+func addColumn(db *sql.DB, table, column, def string) error {
+	var n int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?`, table, column).Scan(&n); err != nil {
+		return err
+	}
+	if n > 0 {
+		return nil
+	}
+	_, err := db.Exec(`ALTER TABLE ` + table + ` ADD COLUMN ` + column + ` ` + def)
 	return err
 }
 
@@ -284,3 +395,415 @@ func GetStaff() ([]Staff, error) {
 	}
 	return out, rows.Err()
 }
+
+// TaskRun represents a row in the task_runs table.
+type TaskRun struct {
+	ID        int64
+	Task      string
+	StartedAt time.Time
+	EndedAt   time.Time
+	Duration  time.Duration
+	Outcome   string
+	Error     string
+	Summary   string
+	// Runs is how many successful runs the row stands for; see MergeTaskRun.
+	Runs int
+}
+
+// InsertTaskRun appends a scheduler run to the task_runs table.
+func InsertTaskRun(r TaskRun) error {
+	_, err := DB.Exec(`INSERT INTO task_runs (task, started_at, ended_at, duration_ms, outcome, error, summary) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		r.Task, r.StartedAt.UnixMilli(), r.EndedAt.UnixMilli(), r.Duration.Milliseconds(), r.Outcome, r.Error, r.Summary)
+	return err
+}
+
+// MergeTaskRun folds a successful run into the task's latest row, if that
+// row is also a success and started no earlier than since: the row is
+// extended to end with r and its run count goes up. It reports whether it
+// merged; if not, the caller inserts r as a row of its own.
+func MergeTaskRun(r TaskRun, since time.Time) (bool, error) {
+	res, err := DB.Exec(`UPDATE task_runs SET ended_at = ?, duration_ms = MAX(duration_ms, ?), summary = ?, runs = runs + 1
+		WHERE id = (SELECT MAX(id) FROM task_runs WHERE task = ?) AND outcome = ? AND started_at >= ?`,
+		r.EndedAt.UnixMilli(), r.Duration.Milliseconds(), r.Summary, r.Task, r.Outcome, since.UnixMilli())
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// ListTaskRuns returns one page of runs, newest first, along with the total
+// number of matching rows. An empty task matches every task.
+func ListTaskRuns(task string, limit, offset int) ([]TaskRun, int, error) {
+	var total int
+	if err := DB.QueryRow(`SELECT COUNT(*) FROM task_runs WHERE ? = '' OR task = ?`, task, task).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := DB.Query(`SELECT id, task, started_at, ended_at, duration_ms, outcome, error, summary, runs FROM task_runs
+		WHERE ? = '' OR task = ? ORDER BY started_at DESC, id DESC LIMIT ? OFFSET ?`, task, task, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	out, err := scanTaskRuns(rows)
+	return out, total, err
+}
+
+// LatestTaskRuns returns the most recent run of each task, ignoring overlap
+// skips so they don't mask the outcome of the run that caused them.
+func LatestTaskRuns() ([]TaskRun, error) {
+	rows, err := DB.Query(`SELECT id, task, started_at, ended_at, duration_ms, outcome, error, summary, runs FROM task_runs
+		WHERE id IN (SELECT MAX(id) FROM task_runs WHERE outcome != 'skipped-overlap' GROUP BY task)`)
+	if err != nil {
+		return nil, err
+	}
+	return scanTaskRuns(rows)
+}
+
+// PruneTaskRuns deletes runs that started before cutoff and returns how many were removed.
+func PruneTaskRuns(cutoff time.Time) (int64, error) {
+	res, err := DB.Exec(`DELETE FROM task_runs WHERE started_at < ?`, cutoff.UnixMilli())
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// scanTaskRuns reads task_runs rows and closes rows.
+func scanTaskRuns(rows *sql.Rows) ([]TaskRun, error) {
+	defer rows.Close()
+	var out []TaskRun
+	for rows.Next() {
+		var r TaskRun
+		var started, ended, durationMS int64
+		if err := rows.Scan(&r.ID, &r.Task, &started, &ended, &durationMS, &r.Outcome, &r.Error, &r.Summary, &r.Runs); err != nil {
+			return nil, err
+		}
+		r.StartedAt = time.UnixMilli(started)
+		r.EndedAt = time.UnixMilli(ended)
+		r.Duration = time.Duration(durationMS) * time.Millisecond
+		out = append(out, r)
+	}
+	return out, rows.Err()
+}
+
+// GetState returns the value stored under key in agent_state. ok is false if
+// the key has never been set.
+func GetState(key string) (value []byte, ok bool, err error) {
+	err = DB.QueryRow(`SELECT value FROM agent_state WHERE key = ?`, key).Scan(&value)
+	if err == sql.ErrNoRows {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return value, true, nil
+}
+
+// PutState stores value under key in agent_state, replacing any previous value.
+func PutState(key string, value []byte) error {
+	_, err := DB.Exec(`INSERT INTO agent_state (key, value) VALUES (?, ?)
+		ON CONFLICT(key) DO UPDATE SET value = excluded.value, updated_at = CURRENT_TIMESTAMP`, key, value)
+	return err
+}
+
+// Job represents a row in the jobs table.
+type Job struct {
+	RequestUUID string
+	Type        string
+	State       string
+	QueuedAt    time.Time
+	StartedAt   time.Time // zero until the job starts
+	EndedAt     time.Time // zero until the job finishes
+	Error       string
+	Output      string
+	Reported    bool
+	ReportError string // why the tenant refused the result, if it did
+}
+
+// InsertJob records a newly queued job. It returns false without changing
+// anything if a job with the same request UUID already exists.
+func InsertJob(j Job) (bool, error) {
+	res, err := DB.Exec(`INSERT OR IGNORE INTO jobs (request_uuid, type, state, queued_at) VALUES (?, ?, ?, ?)`,
+		j.RequestUUID, j.Type, j.State, j.QueuedAt.UnixMilli())
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
+
+// StartJob marks a job as running.
+func StartJob(requestUUID, state string, at time.Time) error {
+	_, err := DB.Exec(`UPDATE jobs SET state = ?, started_at = ? WHERE request_uuid = ?`, state, at.UnixMilli(), requestUUID)
+	return err
+}
+
+// FinishJob stores a job's final state, error and captured output.
+func FinishJob(requestUUID, state string, at time.Time, errMsg, output string) error {
+	_, err := DB.Exec(`UPDATE jobs SET state = ?, ended_at = ?, error = ?, output = ? WHERE request_uuid = ?`,
+		state, at.UnixMilli(), errMsg, output, requestUUID)
+	return err
+}
+
+// MarkJobReported records that a job's result was delivered to the tenant.
+func MarkJobReported(requestUUID string) error {
+	_, err := DB.Exec(`UPDATE jobs SET reported = 1 WHERE request_uuid = ?`, requestUUID)
+	return err
+}
+
+// MarkJobRejected records that the tenant refused a job's result for good,
+// so it is not offered again.
+func MarkJobRejected(requestUUID, reason string) error {
+	_, err := DB.Exec(`UPDATE jobs SET reported = 1, report_error = ? WHERE request_uuid = ?`, reason, requestUUID)
+	return err
+}
+
+// FailUnfinishedJobs marks jobs left queued or running by a previous process
+// as failed with errMsg and returns how many were changed.
+func FailUnfinishedJobs(at time.Time, errMsg string) (int64, error) {
+	res, err := DB.Exec(`UPDATE jobs SET state = 'failed', ended_at = ?, error = ? WHERE state IN ('queued', 'running')`,
+		at.UnixMilli(), errMsg)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// UnreportedJobs returns finished jobs whose result has not reached the tenant yet, oldest first.
+func UnreportedJobs() ([]Job, error) {
+	rows, err := DB.Query(`SELECT request_uuid, type, state, queued_at, started_at, ended_at, error, output, reported, report_error FROM jobs
+		WHERE reported = 0 AND state IN ('succeeded', 'failed') ORDER BY queued_at`)
+	if err != nil {
+		return nil, err
+	}
+	return scanJobs(rows)
+}
+
+// ListJobs returns one page of jobs, newest first, along with the total number of jobs.
+func ListJobs(limit, offset int) ([]Job, int, error) {
+	var total int
+	if err := DB.QueryRow(`SELECT COUNT(*) FROM jobs`).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+	rows, err := DB.Query(`SELECT request_uuid, type, state, queued_at, started_at, ended_at, error, output, reported, report_error FROM jobs
+		ORDER BY queued_at DESC LIMIT ? OFFSET ?`, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	out, err := scanJobs(rows)
+	return out, total, err
+}
+
+// PruneJobs deletes reported jobs queued before cutoff and returns how many were removed.
+// Unreported jobs are kept so their results can still be delivered.
+func PruneJobs(cutoff time.Time) (int64, error) {
+	res, err := DB.Exec(`DELETE FROM jobs WHERE queued_at < ? AND reported = 1`, cutoff.UnixMilli())
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// scanJobs reads jobs rows and closes rows.
+func scanJobs(rows *sql.Rows) ([]Job, error) {
+	defer rows.Close()
+	var out []Job
+	for rows.Next() {
+		var j Job
+		var queued, started, ended int64
+		if err := rows.Scan(&j.RequestUUID, &j.Type, &j.State, &queued, &started, &ended, &j.Error, &j.Output, &j.Reported, &j.ReportError); err != nil {
+			return nil, err
+		}
+		j.QueuedAt = time.UnixMilli(queued)
+		if started > 0 {
+			j.StartedAt = time.UnixMilli(started)
+		}
+		if ended > 0 {
+			j.EndedAt = time.UnixMilli(ended)
+		}
+		out = append(out, j)
+	}
+	return out, rows.Err()
+}
+
+// seal encrypts plaintext with the database key using ChaCha20-Poly1305.
+// Wire format: nonce (12 bytes) || ciphertext+tag.
+func seal(plaintext []byte) ([]byte, error) {
+	aead, err := chacha20poly1305.New(sealKey)
+	if err != nil {
+		return nil, fmt.Errorf("create cipher: %w", err)
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("generate nonce: %w", err)
+	}
+	return aead.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+// unseal reverses seal.
+func unseal(sealed []byte) ([]byte, error) {
+	aead, err := chacha20poly1305.New(sealKey)
+	if err != nil {
+		return nil, fmt.Errorf("create cipher: %w", err)
+	}
+	ns := aead.NonceSize()
+	if len(sealed) < ns {
+		return nil, errors.New("sealed value too short")
+	}
+	return aead.Open(nil, sealed[:ns], sealed[ns:], nil)
+}
+
+// OutboxItem represents a row in the outbox table. Payload is only filled in
+// by PendingOutbox.
+type OutboxItem struct {
+	ID            int64
+	Endpoint      string
+	Kind          string
+	Payload       []byte
+	Size          int
+	State         string
+	CreatedAt     time.Time
+	Attempts      int
+	LastAttemptAt time.Time // zero until the first replay attempt
+	LastError     string
+}
+
+// EnqueueOutbox stores an upload for later delivery and returns its ID. The
+// payload is sealed with the database key before it is written.
+func EnqueueOutbox(endpoint, kind string, payload []byte, lastErr string) (int64, error) {
+	sealed, err := seal(payload)
+	if err != nil {
+		return 0, err
+	}
+	res, err := DB.Exec(`INSERT INTO outbox (endpoint, kind, payload, size, created_at, last_error) VALUES (?, ?, ?, ?, ?, ?)`,
+		endpoint, kind, sealed, len(payload), time.Now().UnixMilli(), lastErr)
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+// HasPendingOutbox reports whether uploads to endpoint are waiting in the outbox.
+func HasPendingOutbox(endpoint string) (bool, error) {
+	var n int
+	err := DB.QueryRow(`SELECT COUNT(*) FROM outbox WHERE state = 'pending' AND endpoint = ?`, endpoint).Scan(&n)
+	return n > 0, err
+}
+
+// PendingOutbox returns up to limit pending uploads, oldest first, with their
+// payloads unsealed. An upload whose payload can't be unsealed is marked
+// failed and left out, so one bad row can't hold up the rest.
+func PendingOutbox(limit int) ([]OutboxItem, error) {
+	rows, err := DB.Query(`SELECT id, endpoint, kind, payload, size, state, created_at, attempts, last_attempt_at, last_error FROM outbox
+		WHERE state = 'pending' ORDER BY id LIMIT ?`, limit)
+	if err != nil {
+		return nil, err
+	}
+	items, err := scanOutbox(rows, true)
+	if err != nil {
+		return nil, err
+	}
+	ok := items[:0]
+	for _, it := range items {
+		payload, err := unseal(it.Payload)
+		if err != nil {
+			if err := FailOutbox(it.ID, "unseal payload: "+err.Error()); err != nil {
+				return nil, fmt.Errorf("fail outbox item %d: %w", it.ID, err)
+			}
+			continue
+		}
+		it.Payload = payload
+		ok = append(ok, it)
+	}
+	return ok, nil
+}
+
+// RecordOutboxAttempt records a failed delivery attempt of an upload.
+func RecordOutboxAttempt(id int64, at time.Time, errMsg string) error {
+	_, err := DB.Exec(`UPDATE outbox SET attempts = attempts + 1, last_attempt_at = ?, last_error = ? WHERE id = ?`,
+		at.UnixMilli(), errMsg, id)
+	return err
+}
+
+// FailOutbox gives up on an upload: it is marked failed and its payload is
+// erased, but the row is kept for inspection until pruned.
+func FailOutbox(id int64, errMsg string) error {
+	_, err := DB.Exec(`UPDATE outbox SET state = 'failed', payload = NULL, last_error = ? WHERE id = ?`, errMsg, id)
+	return err
+}
+
+// ExpireOutbox fails every pending upload queued before cutoff and returns how many were changed.
+func ExpireOutbox(cutoff time.Time, errMsg string) (int64, error) {
+	res, err := DB.Exec(`UPDATE outbox SET state = 'failed', payload = NULL, last_error = ? WHERE state = 'pending' AND created_at < ?`,
+		errMsg, cutoff.UnixMilli())
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// DeleteOutbox removes an upload once it has been delivered.
+func DeleteOutbox(id int64) error {
+	_, err := DB.Exec(`DELETE FROM outbox WHERE id = ?`, id)
+	return err
+}
+
+// ListOutbox returns one page of uploads without their payloads, oldest
+// first, along with the total number of rows and of pending rows.
+func ListOutbox(limit, offset int) (items []OutboxItem, total, pending int, err error) {
+	if err := DB.QueryRow(`SELECT COUNT(*), COUNT(CASE WHEN state = 'pending' THEN 1 END) FROM outbox`).Scan(&total, &pending); err != nil {
+		return nil, 0, 0, err
+	}
+	rows, err := DB.Query(`SELECT id, endpoint, kind, NULL, size, state, created_at, attempts, last_attempt_at, last_error FROM outbox
+		ORDER BY id LIMIT ? OFFSET ?`, limit, offset)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	items, err = scanOutbox(rows, false)
+	return items, total, pending, err
+}
+
+// OutboxDepth returns the number of pending and failed uploads, and when the
+// oldest pending one was queued (zero if none are).
+func OutboxDepth() (pending, failed int, oldest time.Time, err error) {
+	var oldestMS sql.NullInt64
+	err = DB.QueryRow(`SELECT COUNT(CASE WHEN state = 'pending' THEN 1 END), COUNT(CASE WHEN state = 'failed' THEN 1 END),
+		MIN(CASE WHEN state = 'pending' THEN created_at END) FROM outbox`).Scan(&pending, &failed, &oldestMS)
+	if oldestMS.Valid {
+		oldest = time.UnixMilli(oldestMS.Int64)
+	}
+	return pending, failed, oldest, err
+}
+
+// PruneOutbox deletes failed uploads queued before cutoff and returns how many were removed.
+func PruneOutbox(cutoff time.Time) (int64, error) {
+	res, err := DB.Exec(`DELETE FROM outbox WHERE state = 'failed' AND created_at < ?`, cutoff.UnixMilli())
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// scanOutbox reads outbox rows and closes rows.
+func scanOutbox(rows *sql.Rows, withPayload bool) ([]OutboxItem, error) {
+	defer rows.Close()
+	var out []OutboxItem
+	for rows.Next() {
+		var it OutboxItem
+		var payload []byte
+		var created, lastAttempt int64
+		if err := rows.Scan(&it.ID, &it.Endpoint, &it.Kind, &payload, &it.Size, &it.State, &created, &it.Attempts, &lastAttempt, &it.LastError); err != nil {
+			return nil, err
+		}
+		if withPayload {
+			it.Payload = payload
+		}
+		it.CreatedAt = time.UnixMilli(created)
+		if lastAttempt > 0 {
+			it.LastAttemptAt = time.UnixMilli(lastAttempt)
+		}
+		out = append(out, it)
+	}
+	return out, rows.Err()
+}
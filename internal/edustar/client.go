@@ -16,6 +16,7 @@ package edustar
 
 import (
 	"bytes"
+	"context"
 	"crypto/tls"
 	"encoding/json"
 	"fmt"
@@ -27,6 +28,8 @@ import (
 	"strings"
 
 	"github.com/Azure/go-ntlmssp"
+
+	"github.com/forcedesk/forcedesk-agent/internal/transport"
 )
 
 const (
@@ -59,37 +62,53 @@ func New(authMode string) *Client {
 	return &Client{
 		forcedMode: authMode,
 		formClient: &http.Client{
-			Transport: &http.Transport{TLSClientConfig: tlsCfg},
+			Transport: transport.New(tlsCfg),
 			Jar:       jar,
 		},
 		ntlmClient: &http.Client{
 			Transport: ntlmssp.Negotiator{
-				RoundTripper: &http.Transport{TLSClientConfig: tlsCfg},
+				RoundTripper: transport.New(tlsCfg),
 			},
 		},
 	}
 }
 
+// Probe checks that STMC answers over HTTPS, without logging in. Any HTTP
+// response counts as reachable.
+func Probe(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, baseURL, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", userAgent)
+	resp, err := New("").formClient.Do(req)
+	if err != nil {
+		return err
+	}
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	return resp.Body.Close()
+}
+
 // Login authenticates with STMC using the auth mode specified at construction.
 // With "" (auto) it tries NTLM first and falls back to form-based auth.
-func (c *Client) Login(username, password string) error {
+func (c *Client) Login(ctx context.Context, username, password string) error {
 	switch c.forcedMode {
 	case "ntlm":
-		return c.ntlmLogin(username, password)
+		return c.ntlmLogin(ctx, username, password)
 	case "form":
-		return c.formLogin(username, password)
+		return c.formLogin(ctx, username, password)
 	default:
-		if err := c.ntlmLogin(username, password); err == nil {
+		if err := c.ntlmLogin(ctx, username, password); err == nil {
 			return nil
 		}
-		return c.formLogin(username, password)
+		return c.formLogin(ctx, username, password)
 	}
 }
 
 // ntlmLogin authenticates by performing an NTLM-negotiated GET to the STMC base URL.
 // Credentials are prepended with the domain ("EDU001\") as required by the F5 gateway.
-func (c *Client) ntlmLogin(username, password string) error {
-	req, err := http.NewRequest(http.MethodGet, baseURL, nil)
+func (c *Client) ntlmLogin(ctx context.Context, username, password string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, baseURL, nil)
 	if err != nil {
 		return err
 	}
@@ -114,9 +133,9 @@ func (c *Client) ntlmLogin(username, password string) error {
 
 // formLogin authenticates via a two-step form handshake: GET base URL to seed session
 // cookies, then POST credentials to /my.policy. Only works from within the eduSTAR subnet.
-func (c *Client) formLogin(username, password string) error {
+func (c *Client) formLogin(ctx context.Context, username, password string) error {
 	// Step 1: GET base URL to initialise session cookies.
-	initReq, _ := http.NewRequest(http.MethodGet, baseURL, nil)
+	initReq, _ := http.NewRequestWithContext(ctx, http.MethodGet, baseURL, nil)
 	initReq.Header.Set("User-Agent", userAgent)
 
 	initResp, err := c.formClient.Do(initReq)
@@ -135,7 +154,7 @@ func (c *Client) formLogin(username, password string) error {
 
 	// Step 2: POST credentials to /my.policy.
 	formData := url.Values{"username": {username}, "password": {password}}
-	loginReq, _ := http.NewRequest(http.MethodPost, policyURL, strings.NewReader(formData.Encode()))
+	loginReq, _ := http.NewRequestWithContext(ctx, http.MethodPost, policyURL, strings.NewReader(formData.Encode()))
 	loginReq.Header.Set("User-Agent", userAgent)
 	loginReq.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 	loginReq.Header.Set("Referer", baseURL)
@@ -165,7 +184,7 @@ func (c *Client) formLogin(username, password string) error {
 
 // request sends an authenticated request to the STMC API and returns the raw response body.
 // The school ID, when non-empty, is sent as the emc-sch-id request header.
-func (c *Client) request(method, path, school string, data any) ([]byte, error) {
+func (c *Client) request(ctx context.Context, method, path, school string, data any) ([]byte, error) {
 	var bodyReader io.Reader
 	if data != nil {
 		b, err := json.Marshal(data)
@@ -175,7 +194,7 @@ func (c *Client) request(method, path, school string, data any) ([]byte, error)
 		bodyReader = bytes.NewReader(b)
 	}
 
-	req, err := http.NewRequest(strings.ToUpper(method), apiBase+path, bodyReader)
+	req, err := http.NewRequestWithContext(ctx, strings.ToUpper(method), apiBase+path, bodyReader)
 	if err != nil {
 		return nil, err
 	}
@@ -218,8 +237,8 @@ func decode[T any](b []byte) (T, error) {
 // ============================================================
 
 // WhoAmI returns the currently authenticated user's profile. (GET /UserGet)
-func (c *Client) WhoAmI() (map[string]any, error) {
-	b, err := c.request("GET", "/UserGet", "", nil)
+func (c *Client) WhoAmI(ctx context.Context) (map[string]any, error) {
+	b, err := c.request(ctx, "GET", "/UserGet", "", nil)
 	if err != nil {
 		return nil, err
 	}
@@ -227,8 +246,8 @@ func (c *Client) WhoAmI() (map[string]any, error) {
 }
 
 // GetUser returns a user by their TO number or alias. (GET /UserGetByLogin/{id})
-func (c *Client) GetUser(id string) (map[string]any, error) {
-	b, err := c.request("GET", "/UserGetByLogin/"+url.PathEscape(id), "", nil)
+func (c *Client) GetUser(ctx context.Context, id string) (map[string]any, error) {
+	b, err := c.request(ctx, "GET", "/UserGetByLogin/"+url.PathEscape(id), "", nil)
 	if err != nil {
 		return nil, err
 	}
@@ -236,8 +255,8 @@ func (c *Client) GetUser(id string) (map[string]any, error) {
 }
 
 // GetSchools returns all schools the authenticated user can manage. (GET /GetAllSchools)
-func (c *Client) GetSchools() ([]map[string]any, error) {
-	b, err := c.request("GET", "/GetAllSchools", "", nil)
+func (c *Client) GetSchools(ctx context.Context) ([]map[string]any, error) {
+	b, err := c.request(ctx, "GET", "/GetAllSchools", "", nil)
 	if err != nil {
 		return nil, err
 	}
@@ -245,8 +264,8 @@ func (c *Client) GetSchools() ([]map[string]any, error) {
 }
 
 // GetAllSchools returns the IDs of all enabled schools. (GET /SchGetAllEnabledIds)
-func (c *Client) GetAllSchools() ([]string, error) {
-	b, err := c.request("GET", "/SchGetAllEnabledIds", "", nil)
+func (c *Client) GetAllSchools(ctx context.Context) ([]string, error) {
+	b, err := c.request(ctx, "GET", "/SchGetAllEnabledIds", "", nil)
 	if err != nil {
 		return nil, err
 	}
@@ -254,8 +273,8 @@ func (c *Client) GetAllSchools() ([]string, error) {
 }
 
 // GetStudents returns all students with full properties for the given school. (GET /SchGetStuds?fullProps=true)
-func (c *Client) GetStudents(school string) ([]map[string]any, error) {
-	b, err := c.request("GET", "/SchGetStuds?fullProps=true", school, nil)
+func (c *Client) GetStudents(ctx context.Context, school string) ([]map[string]any, error) {
+	b, err := c.request(ctx, "GET", "/SchGetStuds?fullProps=true", school, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -263,8 +282,8 @@ func (c *Client) GetStudents(school string) ([]map[string]any, error) {
 }
 
 // GetStaff returns both technicians and staff. The response contains "techs" and "staff" keys.
-func (c *Client) GetStaff(school string) (map[string]any, error) {
-	b, err := c.request("GET", "/SchGetTechs?includeStaff=true", school, nil)
+func (c *Client) GetStaff(ctx context.Context, school string) (map[string]any, error) {
+	b, err := c.request(ctx, "GET", "/SchGetTechs?includeStaff=true", school, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -272,8 +291,8 @@ func (c *Client) GetStaff(school string) (map[string]any, error) {
 }
 
 // GetTechnicians returns only the technicians (not staff) for the given school. (GET /SchGetTechs?includeStaff=false)
-func (c *Client) GetTechnicians(school string) (map[string]any, error) {
-	b, err := c.request("GET", "/SchGetTechs?includeStaff=false", school, nil)
+func (c *Client) GetTechnicians(ctx context.Context, school string) (map[string]any, error) {
+	b, err := c.request(ctx, "GET", "/SchGetTechs?includeStaff=false", school, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -281,8 +300,8 @@ func (c *Client) GetTechnicians(school string) (map[string]any, error) {
 }
 
 // GetGroups returns all groups for the given school. (GET /GpGetForSch)
-func (c *Client) GetGroups(school string) (map[string]any, error) {
-	b, err := c.request("GET", "/GpGetForSch", school, nil)
+func (c *Client) GetGroups(ctx context.Context, school string) (map[string]any, error) {
+	b, err := c.request(ctx, "GET", "/GpGetForSch", school, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -290,9 +309,9 @@ func (c *Client) GetGroups(school string) (map[string]any, error) {
 }
 
 // GetGroup returns the members of a specific group identified by DN and name. (GET /GpGetMems)
-func (c *Client) GetGroup(school, name, dn string) ([]map[string]any, error) {
+func (c *Client) GetGroup(ctx context.Context, school, name, dn string) ([]map[string]any, error) {
 	path := fmt.Sprintf("/GpGetMems?gpDn=%s&gpName=%s", url.QueryEscape(dn), url.QueryEscape(name))
-	b, err := c.request("GET", path, school, nil)
+	b, err := c.request(ctx, "GET", path, school, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -300,8 +319,8 @@ func (c *Client) GetGroup(school, name, dn string) ([]map[string]any, error) {
 }
 
 // GetCertificates returns computer group certificates for the given school. (GET /CompGetMg)
-func (c *Client) GetCertificates(school string) ([]map[string]any, error) {
-	b, err := c.request("GET", "/CompGetMg", school, nil)
+func (c *Client) GetCertificates(ctx context.Context, school string) ([]map[string]any, error) {
+	b, err := c.request(ctx, "GET", "/CompGetMg", school, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -309,8 +328,8 @@ func (c *Client) GetCertificates(school string) ([]map[string]any, error) {
 }
 
 // GetServiceAccounts returns all managed service accounts for the given school. (GET /SvcAccGetForSch)
-func (c *Client) GetServiceAccounts(school string) ([]map[string]any, error) {
-	b, err := c.request("GET", "/SvcAccGetForSch", school, nil)
+func (c *Client) GetServiceAccounts(ctx context.Context, school string) ([]map[string]any, error) {
+	b, err := c.request(ctx, "GET", "/SvcAccGetForSch", school, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -318,8 +337,8 @@ func (c *Client) GetServiceAccounts(school string) ([]map[string]any, error) {
 }
 
 // GetNps returns the NPS (Network Policy Server) mapping for the given school. (GET /NpsMappingGetForSch)
-func (c *Client) GetNps(school string) (map[string]any, error) {
-	b, err := c.request("GET", "/NpsMappingGetForSch", school, nil)
+func (c *Client) GetNps(ctx context.Context, school string) (map[string]any, error) {
+	b, err := c.request(ctx, "GET", "/NpsMappingGetForSch", school, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -327,15 +346,15 @@ func (c *Client) GetNps(school string) (map[string]any, error) {
 }
 
 // SetStudentPassword sets an explicit password on the student identified by DN. (POST /StudResetPwd)
-func (c *Client) SetStudentPassword(school, dn, password string) error {
-	_, err := c.request("POST", "/StudResetPwd", school, map[string]string{"dn": dn, "newPwd": password})
+func (c *Client) SetStudentPassword(ctx context.Context, school, dn, password string) error {
+	_, err := c.request(ctx, "POST", "/StudResetPwd", school, map[string]string{"dn": dn, "newPwd": password})
 	return err
 }
 
 // ResetStudentPassword resets the student's password to an auto-generated value and
 // returns the result details. (POST /StudBulkSetPwd with mode=auto)
-func (c *Client) ResetStudentPassword(school, dn string) ([]map[string]any, error) {
-	b, err := c.request("POST", "/StudBulkSetPwd", school, map[string]any{
+func (c *Client) ResetStudentPassword(ctx context.Context, school, dn string) ([]map[string]any, error) {
+	b, err := c.request(ctx, "POST", "/StudBulkSetPwd", school, map[string]any{
 		"mode": "auto",
 		"dns":  []string{dn},
 	})
@@ -346,23 +365,23 @@ func (c *Client) ResetStudentPassword(school, dn string) ([]map[string]any, erro
 }
 
 // AddToGroup adds a member to a group by their respective DNs. (POST /GpAddMem)
-func (c *Client) AddToGroup(school, groupDN, memberDN string) error {
-	_, err := c.request("POST", "/GpAddMem", school, map[string]string{"gpDn": groupDN, "memDn": memberDN})
+func (c *Client) AddToGroup(ctx context.Context, school, groupDN, memberDN string) error {
+	_, err := c.request(ctx, "POST", "/GpAddMem", school, map[string]string{"gpDn": groupDN, "memDn": memberDN})
 	return err
 }
 
 // RemoveFromGroup removes a member from a group by their respective DNs. (POST /GpRemoveMem)
-func (c *Client) RemoveFromGroup(school, groupDN, memberDN string) error {
-	_, err := c.request("POST", "/GpRemoveMem", school, map[string]string{"gpDn": groupDN, "memDn": memberDN})
+func (c *Client) RemoveFromGroup(ctx context.Context, school, groupDN, memberDN string) error {
+	_, err := c.request(ctx, "POST", "/GpRemoveMem", school, map[string]string{"gpDn": groupDN, "memDn": memberDN})
 	return err
 }
 
 // AddCertificate requests a managed computer certificate for name at school.
 // The computer name is stored in STMC as "{school}-{name}" (e.g. "8185-COMPUTERNAME").
 // domain is used as the encryption password (pass "eduSTAR.NET"). (POST /CompAddMg)
-func (c *Client) AddCertificate(school, name, domain string) error {
+func (c *Client) AddCertificate(ctx context.Context, school, name, domain string) error {
 	compName := school + "-" + name
-	_, err := c.request("POST", "/CompAddMg", school, map[string]string{"compName": compName, "pwd": domain})
+	_, err := c.request(ctx, "POST", "/CompAddMg", school, map[string]string{"compName": compName, "pwd": domain})
 	return err
 }
 
@@ -371,8 +390,8 @@ func (c *Client) AddCertificate(school, name, domain string) error {
 // domain is the decryption password (pass "eduSTAR.NET"). (POST /CompGetCert)
 // The STMC API may return the base64 string wrapped in a JSON object or as a bare string;
 // both forms are handled transparently.
-func (c *Client) GetCertificate(school, compName, domain string) (string, error) {
-	b, err := c.request("POST", "/CompGetCert", school, map[string]string{"compName": compName, "pwd": domain})
+func (c *Client) GetCertificate(ctx context.Context, school, compName, domain string) (string, error) {
+	b, err := c.request(ctx, "POST", "/CompGetCert", school, map[string]string{"compName": compName, "pwd": domain})
 	if err != nil {
 		return "", err
 	}
@@ -403,13 +422,13 @@ func (c *Client) GetCertificate(school, compName, domain string) (string, error)
 }
 
 // DisableServiceAccount disables the service account identified by DN. (POST /SvcAccDisable)
-func (c *Client) DisableServiceAccount(school, dn string) error {
-	_, err := c.request("POST", "/SvcAccDisable", school, map[string]string{"dn": dn})
+func (c *Client) DisableServiceAccount(ctx context.Context, school, dn string) error {
+	_, err := c.request(ctx, "POST", "/SvcAccDisable", school, map[string]string{"dn": dn})
 	return err
 }
 
 // EnableServiceAccount re-enables the service account identified by DN. (POST /SvcAccEnable)
-func (c *Client) EnableServiceAccount(school, dn string) error {
-	_, err := c.request("POST", "/SvcAccEnable", school, map[string]string{"dn": dn})
+func (c *Client) EnableServiceAccount(ctx context.Context, school, dn string) error {
+	_, err := c.request(ctx, "POST", "/SvcAccEnable", school, map[string]string{"dn": dn})
 	return err
 }
@@ -0,0 +1,62 @@
+// Copyright © 2026 ForcePoint Software. All rights reserved.
+
+// Package errclass classifies errors by whether retrying could help. It is a
+// leaf package so the clients that produce errors and the scheduler that
+// retries them can share the classes without depending on each other.
+package errclass
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/url"
+	"syscall"
+)
+
+// Class groups errors for deciding whether a retry could help.
+type Class string
+
+const (
+	Network   Class = "network"   // connection refused or reset, DNS failure, dropped connection
+	Timeout   Class = "timeout"   // a request or the run itself hit its deadline
+	Server    Class = "server"    // the server answered 5xx
+	Throttled Class = "throttled" // the server answered 429
+	Client    Class = "client"    // the server rejected the request (4xx); retrying won't help
+	Other     Class = "other"     // anything else
+)
+
+// Transient are the classes worth retrying by default.
+var Transient = []Class{Network, Timeout, Server, Throttled}
+
+// Classify returns the class of err. An error in the chain with a
+// RetryClass method (e.g. tenant.StatusError) decides for itself; otherwise
+// network and deadline errors are recognised by type.
+func Classify(err error) Class {
+	var c interface{ RetryClass() Class }
+	if errors.As(err, &c) {
+		return c.RetryClass()
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return Timeout
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return Timeout
+	}
+	var opErr *net.OpError
+	var dnsErr *net.DNSError
+	var urlErr *url.Error
+	switch {
+	case errors.As(err, &opErr), errors.As(err, &dnsErr),
+		errors.Is(err, syscall.ECONNREFUSED), errors.Is(err, syscall.ECONNRESET),
+		errors.Is(err, io.ErrUnexpectedEOF):
+		return Network
+	case errors.Is(err, io.EOF) && errors.As(err, &urlErr):
+		// The connection closed before the response arrived. A bare EOF is
+		// more often an empty body from a response that did arrive, which
+		// retrying won't fix.
+		return Network
+	}
+	return Other
+}
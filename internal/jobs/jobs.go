@@ -0,0 +1,312 @@
+// Copyright © 2026 ForcePoint Software. All rights reserved.
+
+// Package jobs runs one-shot work requested through the tenant's command
+// queue. Each job is keyed by the request UUID the tenant assigned, moves
+// through queued, running and succeeded or failed, and has its result and
+// captured log output posted back to the tenant when it finishes.
+//
+// Jobs are persisted in the local database, so a command the tenant delivers
+// again (e.g. after a lost acknowledgement or a restart) is recognised and
+// dropped rather than run twice, and results that could not be delivered are
+// retried by ReportPending.
+package jobs
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/forcedesk/forcedesk-agent/internal/db"
+	"github.com/forcedesk/forcedesk-agent/internal/logger"
+	"github.com/forcedesk/forcedesk-agent/internal/scheduler"
+	"github.com/forcedesk/forcedesk-agent/internal/tenant"
+)
+
+// State is the lifecycle state of a job.
+type State string
+
+const (
+	StateQueued    State = "queued"    // accepted, waiting for a resource slot
+	StateRunning   State = "running"   // executing
+	StateSucceeded State = "succeeded" // returned nil
+	StateFailed    State = "failed"    // returned an error, panicked, timed out or was interrupted
+)
+
+// DefaultTimeout bounds a job whose Spec sets no timeout.
+const DefaultTimeout = 10 * time.Minute
+
+// maxOutput bounds the log output kept per job.
+const maxOutput = 64 << 10
+
+// localPrefix marks IDs generated for commands that arrived without a request
+// UUID. They can't be deduplicated and have no tenant record to report to.
+const localPrefix = "local-"
+
+// Spec describes a job to run.
+type Spec struct {
+	// RequestUUID is the tenant's ID for the command. Empty generates a local
+	// ID; such jobs run but can't be deduplicated or reported.
+	RequestUUID string
+	// Type is the command type, e.g. "request-student-device-certificate".
+	Type string
+	// Timeout cancels the job's context after this long once it starts
+	// running; time spent queued for a resource doesn't count. Zero uses
+	// DefaultTimeout.
+	Timeout time.Duration
+	// Resources names the scheduler resource locks the job holds while running.
+	Resources []string
+	// Run performs the job. Log records written with a *Context slog call
+	// using the ctx passed in are captured as the job's output.
+	Run func(ctx context.Context) error
+}
+
+// Result is the completion report posted to the tenant at
+// /api/agent/jobs/{request_uuid}/result.
+type Result struct {
+	RequestUUID string     `json:"request_uuid"`
+	Type        string     `json:"type"`
+	State       State      `json:"state"`
+	QueuedAt    time.Time  `json:"queued_at"`
+	StartedAt   *time.Time `json:"started_at"`
+	EndedAt     time.Time  `json:"ended_at"`
+	DurationMS  int64      `json:"duration_ms"`
+	Error       string     `json:"error,omitempty"`
+	Output      string     `json:"output,omitempty"`
+}
+
+// Submit records the job as queued and starts it in the background with
+// scheduler.Go, so a service stop cancels and waits for it. It reports
+// whether the job was accepted; a request UUID that has been seen before is
+// dropped and returns false.
+func Submit(ctx context.Context, spec Spec) (bool, error) {
+	if spec.RequestUUID == "" {
+		spec.RequestUUID = localID()
+		slog.Warn("jobs: command has no request UUID, it can't be deduplicated or reported", "type", spec.Type, "job", spec.RequestUUID)
+	}
+
+	inserted, err := db.InsertJob(db.Job{
+		RequestUUID: spec.RequestUUID,
+		Type:        spec.Type,
+		State:       string(StateQueued),
+		QueuedAt:    time.Now(),
+	})
+	if err != nil {
+		return false, fmt.Errorf("record job: %w", err)
+	}
+	if !inserted {
+		slog.Info("jobs: duplicate request, dropped", "type", spec.Type, "request_uuid", spec.RequestUUID)
+		return false, nil
+	}
+
+	slog.Info("jobs: queued", "type", spec.Type, "request_uuid", spec.RequestUUID)
+	scheduler.Go(ctx, spec.Type, func(ctx context.Context) {
+		run(ctx, spec)
+	})
+	return true, nil
+}
+
+// run executes one job and records and reports its result. ctx is the
+// scheduler's root context, which outlives the command-queue run that
+// submitted the job.
+func run(ctx context.Context, spec Spec) {
+	out := &output{}
+	jobCtx := logger.WithCapture(ctx, out)
+
+	release, err := scheduler.Acquire(jobCtx, spec.Type+" "+spec.RequestUUID, spec.Resources...)
+	if err == nil {
+		defer release()
+
+		if err := db.StartJob(spec.RequestUUID, string(StateRunning), time.Now()); err != nil {
+			slog.Error("jobs: failed to record job start", "request_uuid", spec.RequestUUID, "err", err)
+		}
+		slog.Info("jobs: running", "type", spec.Type, "request_uuid", spec.RequestUUID)
+
+		timeout := spec.Timeout
+		if timeout <= 0 {
+			timeout = DefaultTimeout
+		}
+		runCtx, cancel := context.WithTimeout(jobCtx, timeout)
+		err = call(runCtx, spec.Run)
+		if runCtx.Err() == context.DeadlineExceeded && err != nil {
+			err = fmt.Errorf("timed out after %s: %w", timeout, err)
+		}
+		cancel()
+	}
+
+	state := StateSucceeded
+	var errMsg string
+	if err != nil {
+		state = StateFailed
+		errMsg = err.Error()
+		slog.Error("jobs: failed", "type", spec.Type, "request_uuid", spec.RequestUUID, "err", err)
+	} else {
+		slog.Info("jobs: succeeded", "type", spec.Type, "request_uuid", spec.RequestUUID)
+	}
+	if err := db.FinishJob(spec.RequestUUID, string(state), time.Now(), errMsg, out.String()); err != nil {
+		slog.Error("jobs: failed to record job result", "request_uuid", spec.RequestUUID, "err", err)
+		return
+	}
+
+	// Report with the root context rather than the job's, which may have
+	// timed out. A failed report is retried by ReportPending.
+	if err := ReportPending(ctx); err != nil {
+		slog.Warn("jobs: failed to report job results, will retry", "err", err)
+	}
+}
+
+// call runs fn, turning a panic into an error so one bad job can't take the
+// agent down.
+func call(ctx context.Context, fn func(ctx context.Context) error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return fn(ctx)
+}
+
+// reportMu stops concurrent ReportPending calls posting the same result twice.
+var reportMu sync.Mutex
+
+// ReportPending posts the result of every finished job the tenant hasn't
+// acknowledged yet. A result the tenant refuses for good is recorded as such
+// and skipped, so it can't hold up the ones after it; any other failure
+// stops the run, to be retried later.
+func ReportPending(ctx context.Context) error {
+	reportMu.Lock()
+	defer reportMu.Unlock()
+
+	pending, err := db.UnreportedJobs()
+	if err != nil {
+		return fmt.Errorf("list unreported jobs: %w", err)
+	}
+
+	var client *tenant.Client
+	for _, j := range pending {
+		if strings.HasPrefix(j.RequestUUID, localPrefix) {
+			// Nothing on the tenant to report to.
+			if err := db.MarkJobReported(j.RequestUUID); err != nil {
+				return err
+			}
+			continue
+		}
+		if client == nil {
+			client = tenant.New()
+		}
+		if err := report(ctx, client, j); err != nil {
+			if !rejected(err) {
+				return fmt.Errorf("report job %s: %w", j.RequestUUID, err)
+			}
+			slog.Warn("jobs: tenant refused job result, not retrying", "request_uuid", j.RequestUUID, "err", err)
+			if err := db.MarkJobRejected(j.RequestUUID, err.Error()); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := db.MarkJobReported(j.RequestUUID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rejected reports whether the tenant refused a result for good, e.g. because
+// it no longer knows the request. Auth failures and throttling don't count:
+// they hold up every result alike and clear once fixed.
+func rejected(err error) bool {
+	var se *tenant.StatusError
+	if !errors.As(err, &se) {
+		return false
+	}
+	switch se.StatusCode {
+	case http.StatusBadRequest, http.StatusNotFound, http.StatusConflict, http.StatusGone,
+		http.StatusRequestEntityTooLarge, http.StatusUnprocessableEntity:
+		return true
+	}
+	return false
+}
+
+func report(ctx context.Context, client *tenant.Client, j db.Job) error {
+	res := Result{
+		RequestUUID: j.RequestUUID,
+		Type:        j.Type,
+		State:       State(j.State),
+		QueuedAt:    j.QueuedAt,
+		EndedAt:     j.EndedAt,
+		Error:       j.Error,
+		Output:      j.Output,
+	}
+	if !j.StartedAt.IsZero() {
+		started := j.StartedAt
+		res.StartedAt = &started
+		res.DurationMS = j.EndedAt.Sub(j.StartedAt).Milliseconds()
+	}
+
+	resp, err := client.PostJSON(ctx, tenant.URL("/api/agent/jobs/"+url.PathEscape(j.RequestUUID)+"/result"), res)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return &tenant.StatusError{StatusCode: resp.StatusCode, URL: resp.Request.URL.Path}
+	}
+	slog.Info("jobs: result reported", "request_uuid", j.RequestUUID, "state", j.State)
+	return nil
+}
+
+// Recover marks jobs left queued or running by a previous process as failed,
+// so their results are reported instead of being lost. Call once at startup
+// before any job is submitted.
+func Recover() {
+	n, err := db.FailUnfinishedJobs(time.Now(), "interrupted: the agent stopped before the job finished")
+	if err != nil {
+		slog.Error("jobs: failed to recover unfinished jobs", "err", err)
+		return
+	}
+	if n > 0 {
+		slog.Warn("jobs: marked jobs interrupted by a restart as failed", "count", n)
+	}
+}
+
+func localID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return localPrefix + hex.EncodeToString(b)
+}
+
+// output collects a job's captured log lines, keeping at most maxOutput
+// bytes. Safe for concurrent use.
+type output struct {
+	mu        sync.Mutex
+	buf       strings.Builder
+	truncated bool
+}
+
+func (o *output) Write(p []byte) (int, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if room := maxOutput - o.buf.Len(); len(p) > room {
+		o.buf.Write(p[:max(room, 0)])
+		o.truncated = true
+	} else {
+		o.buf.Write(p)
+	}
+	return len(p), nil
+}
+
+func (o *output) String() string {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.truncated {
+		return o.buf.String() + "\n[output truncated]\n"
+	}
+	return o.buf.String()
+}
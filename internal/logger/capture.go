@@ -0,0 +1,63 @@
+// Copyright © 2026 ForcePoint Software. All rights reserved.
+
+package logger
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+)
+
+// captureKey is the context key holding the writer set by WithCapture.
+type captureKey struct{}
+
+// WithCapture returns a context whose log records are also written to w as
+// plain text lines, e.g. to keep a job's output alongside its result. Only
+// records logged with a context, such as slog.InfoContext(ctx, ...), can be
+// captured.
+func WithCapture(ctx context.Context, w io.Writer) context.Context {
+	return context.WithValue(ctx, captureKey{}, w)
+}
+
+// sensitiveKey reports whether an attribute may hold a credential. Captured
+// output leaves the machine (job results are posted to the tenant), so these
+// values are redacted even though the local log keeps them.
+func sensitiveKey(key string) bool {
+	k := strings.ToLower(key)
+	return strings.Contains(k, "password") || strings.Contains(k, "secret") || strings.Contains(k, "token") || strings.Contains(k, "key")
+}
+
+// captureHandler tees records whose context carries a capture writer, and
+// counts warnings and errors (see Counts).
+type captureHandler struct {
+	slog.Handler
+}
+
+func (h captureHandler) Handle(ctx context.Context, r slog.Record) error {
+	count(r)
+	if w, ok := ctx.Value(captureKey{}).(io.Writer); ok {
+		var b strings.Builder
+		fmt.Fprintf(&b, "%s %s %s", r.Time.Format("15:04:05"), r.Level, r.Message)
+		r.Attrs(func(a slog.Attr) bool {
+			if sensitiveKey(a.Key) {
+				fmt.Fprintf(&b, " %s=[redacted]", a.Key)
+			} else {
+				fmt.Fprintf(&b, " %s=%v", a.Key, a.Value)
+			}
+			return true
+		})
+		b.WriteByte('\n')
+		io.WriteString(w, b.String())
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h captureHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return captureHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h captureHandler) WithGroup(name string) slog.Handler {
+	return captureHandler{h.Handler.WithGroup(name)}
+}
@@ -0,0 +1,28 @@
+// Copyright © 2026 ForcePoint Software. All rights reserved.
+
+package logger
+
+import (
+	"log/slog"
+	"sync/atomic"
+)
+
+// warnCount and errorCount count the records logged at each level since startup.
+var warnCount, errorCount atomic.Int64
+
+// Counts returns how many warnings and errors have been logged since
+// startup. Callers wanting a count over an interval keep the previous values
+// and subtract.
+func Counts() (warn, errs int64) {
+	return warnCount.Load(), errorCount.Load()
+}
+
+// count records r in the level counters.
+func count(r slog.Record) {
+	switch {
+	case r.Level >= slog.LevelError:
+		errorCount.Add(1)
+	case r.Level >= slog.LevelWarn:
+		warnCount.Add(1)
+	}
+}
@@ -39,7 +39,7 @@ func Init(dataDir string, console, verbose bool) error {
 	}
 
 	handler := slog.NewJSONHandler(w, &slog.HandlerOptions{Level: level})
-	slog.SetDefault(slog.New(handler))
+	slog.SetDefault(slog.New(captureHandler{handler}))
 
 	// Prune old logs at startup, then daily. Run in a goroutine so a slow
 	// filesystem scan never delays the caller.
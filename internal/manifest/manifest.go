@@ -0,0 +1,176 @@
+// Copyright © 2026 ForcePoint Software. All rights reserved.
+
+// Package manifest fetches, verifies and caches the schedule manifest the
+// tenant publishes to enable, disable and retime agent tasks.
+//
+// The tenant serves GET /api/agent/schedule as:
+//
+//	{"manifest": "<base64 manifest JSON>", "signature": "<hex HMAC-SHA256>"}
+//
+// The signature covers the decoded manifest bytes and is keyed with a key
+// derived (HKDF-SHA256) from the tenant encryption key, so a manifest can only
+// come from a server that holds this agent's key. The signed envelope is cached
+// as received and re-verified whenever it is loaded. Verification accepts the
+// current key or the one it replaced, so a manifest signed before a key
+// rotation stays valid until the tenant re-signs it.
+package manifest
+
+import (
+	"context"
+	"crypto/hkdf"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/forcedesk/forcedesk-agent/internal/db"
+	"github.com/forcedesk/forcedesk-agent/internal/tenant"
+)
+
+// Path is the tenant endpoint that serves the signed manifest.
+const Path = "/api/agent/schedule"
+
+// cacheKey is the agent_state key holding the last good signed envelope.
+const cacheKey = "schedule_manifest"
+
+// hkdfInfo separates the signing key from other uses of the encryption key.
+const hkdfInfo = "forcedesk-agent schedule manifest v1"
+
+// maxEnvelopeSize bounds how much of the response is read.
+const maxEnvelopeSize = 1 << 20
+
+// ErrNotPublished is returned by Fetch when the tenant has no manifest for
+// this agent (HTTP 404), e.g. an older server. The agent keeps its current
+// schedule.
+var ErrNotPublished = errors.New("no schedule manifest published")
+
+// Manifest describes which tasks the agent runs and how often. Tasks not
+// listed keep the agent's built-in defaults.
+type Manifest struct {
+	// Version increases with every change; older versions are rejected so a
+	// replayed manifest can't roll the schedule back.
+	Version  int64     `json:"version"`
+	IssuedAt time.Time `json:"issued_at"`
+	// Spread overrides the [schedule] spread window, e.g. "5m".
+	Spread string     `json:"spread,omitempty"`
+	Tasks  []TaskSpec `json:"tasks"`
+}
+
+// TaskSpec overrides one task. Empty fields keep the agent's default.
+type TaskSpec struct {
+	Name string `json:"name"`
+	// Enabled registers or removes the task; nil keeps the default.
+	Enabled *bool `json:"enabled,omitempty"`
+	// Interval is a Go duration such as "15m". Mutually exclusive with Schedule.
+	Interval string `json:"interval,omitempty"`
+	// Schedule is a cron expression evaluated in the [schedule] timezone.
+	Schedule string `json:"schedule,omitempty"`
+	// Timeout is a Go duration bounding each run; "0s" removes the timeout.
+	Timeout string `json:"timeout,omitempty"`
+	// InitialDelay postpones the task's first run after the agent starts.
+	InitialDelay string `json:"initial_delay,omitempty"`
+	// Jitter delays each run by a random amount up to this duration.
+	Jitter string `json:"jitter,omitempty"`
+}
+
+// envelope is the signed wire form of a Manifest.
+type envelope struct {
+	Manifest  string `json:"manifest"`
+	Signature string `json:"signature"`
+}
+
+// Fetch downloads and verifies the current manifest. It returns the manifest
+// together with the raw envelope so the caller can Save it once applied.
+func Fetch(ctx context.Context, tc *tenant.Client, keys [][]byte) (*Manifest, []byte, error) {
+	resp, err := tc.Get(ctx, tenant.URL(Path))
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, nil, ErrNotPublished
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil, &tenant.StatusError{StatusCode: resp.StatusCode, URL: Path}
+	}
+
+	raw, err := io.ReadAll(io.LimitReader(resp.Body, maxEnvelopeSize))
+	if err != nil {
+		return nil, nil, fmt.Errorf("read manifest: %w", err)
+	}
+	m, err := Verify(raw, keys)
+	if err != nil {
+		return nil, nil, err
+	}
+	return m, raw, nil
+}
+
+// Verify checks the envelope's signature against each of keys and decodes
+// the manifest it carries.
+func Verify(raw []byte, keys [][]byte) (*Manifest, error) {
+	var env envelope
+	if err := json.Unmarshal(raw, &env); err != nil {
+		return nil, fmt.Errorf("decode manifest envelope: %w", err)
+	}
+	body, err := base64.StdEncoding.DecodeString(env.Manifest)
+	if err != nil {
+		return nil, fmt.Errorf("decode manifest body: %w", err)
+	}
+	sig, err := hex.DecodeString(env.Signature)
+	if err != nil {
+		return nil, fmt.Errorf("decode manifest signature: %w", err)
+	}
+
+	valid := false
+	for _, key := range keys {
+		signingKey, err := hkdf.Key(sha256.New, key, nil, hkdfInfo, 32)
+		if err != nil {
+			return nil, fmt.Errorf("derive signing key: %w", err)
+		}
+		mac := hmac.New(sha256.New, signingKey)
+		mac.Write(body)
+		if hmac.Equal(sig, mac.Sum(nil)) {
+			valid = true
+			break
+		}
+	}
+	if !valid {
+		return nil, fmt.Errorf("manifest signature is invalid")
+	}
+
+	var m Manifest
+	if err := json.Unmarshal(body, &m); err != nil {
+		return nil, fmt.Errorf("decode manifest: %w", err)
+	}
+	for _, t := range m.Tasks {
+		if t.Name == "" {
+			return nil, fmt.Errorf("manifest v%d: task with no name", m.Version)
+		}
+		if t.Interval != "" && t.Schedule != "" {
+			return nil, fmt.Errorf("manifest v%d: task %s sets both interval and schedule", m.Version, t.Name)
+		}
+	}
+	return &m, nil
+}
+
+// Save caches a verified envelope as the last good manifest.
+func Save(raw []byte) error {
+	return db.PutState(cacheKey, raw)
+}
+
+// LoadCached returns the last good manifest, re-verified with keys, or nil if
+// none has been cached yet.
+func LoadCached(keys [][]byte) (*Manifest, error) {
+	raw, ok, err := db.GetState(cacheKey)
+	if err != nil || !ok {
+		return nil, err
+	}
+	return Verify(raw, keys)
+}
@@ -0,0 +1,225 @@
+// Copyright © 2026 ForcePoint Software. All rights reserved.
+
+package mocktenant
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+// The tenant's side of the encrypted envelopes; see tenant/envelope.go for
+// the formats:
+//
+//	v1: nonce (12) || ciphertext+tag
+//	v2: version (1, = 2) || message ID (16) || timestamp (8, Unix ms, big-endian) || nonce (12) || ciphertext+tag
+//
+// with v2 associated data "forcedesk-envelope" 0 direction 0 agent UUID 0
+// path 0 header for requests, and "forcedesk-envelope" 0 direction 0 agent
+// UUID 0 path 0 request ID 0 header for responses, where the request ID is
+// the requestIDHeader of the request answered.
+const (
+	envelopeHeader        = "x-forcedesk-envelope"
+	envelopesHeader       = "x-forcedesk-envelopes"
+	keyIDHeader           = "x-forcedesk-key-id"
+	payloadEncodingHeader = "x-forcedesk-payload-encoding"
+	requestIDHeader       = "x-forcedesk-request-id"
+
+	msgIDSize    = 16
+	v2HeaderSize = 1 + msgIDSize + 8
+	maxSkew      = 5 * time.Minute
+)
+
+// key is an encryption key and its ID.
+type key struct {
+	id  string
+	key []byte
+}
+
+// envelopeInfo describes how an encrypted request was sealed.
+type envelopeInfo struct {
+	version int
+	keyID   string
+}
+
+// keys returns the keys a request sealed with the key named id may use: the
+// current key, the previous one and one a rotation has sent but not had
+// confirmed. Called with s.mu held.
+func (s *Server) keys(id string) []key {
+	var all []key
+	if s.agent.Key != nil {
+		all = append(all, key{s.agent.KeyID, s.agent.Key})
+	}
+	if s.agent.PreviousKey != nil {
+		all = append(all, key{s.agent.PreviousKeyID, s.agent.PreviousKey})
+	}
+	if s.rotation != nil {
+		all = append(all, *s.rotation)
+	}
+	if id == "" {
+		return all
+	}
+	for _, k := range all {
+		if k.id == id {
+			return []key{k}
+		}
+	}
+	return nil
+}
+
+// open decrypts the body of an encrypted request.
+func (s *Server) open(r *http.Request, body []byte) ([]byte, envelopeInfo, error) {
+	info := envelopeInfo{keyID: r.Header.Get(keyIDHeader)}
+	s.mu.Lock()
+	keys := s.keys(info.keyID)
+	uuid := s.agent.UUID
+	s.mu.Unlock()
+	if len(keys) == 0 {
+		return nil, info, fmt.Errorf("unknown key %q", info.keyID)
+	}
+	ns := chacha20poly1305.NonceSize
+
+	switch v := r.Header.Get(envelopeHeader); v {
+	case "", "1":
+		info.version = 1
+		if len(body) < ns {
+			return nil, info, errors.New("v1 body too short")
+		}
+		plaintext, err := openWith(keys, body[:ns], body[ns:], nil)
+		return plaintext, info, err
+
+	case "2":
+		info.version = 2
+		if s.opts.Legacy {
+			return nil, info, errors.New("v2 envelope sent to a tenant that never advertised it")
+		}
+		if len(body) < v2HeaderSize+ns || body[0] != 2 {
+			return nil, info, errors.New("malformed v2 body")
+		}
+		hdr := body[:v2HeaderSize]
+		sent := time.UnixMilli(int64(binary.BigEndian.Uint64(hdr[1+msgIDSize:])))
+		if skew := time.Since(sent); skew > maxSkew || skew < -maxSkew {
+			return nil, info, fmt.Errorf("stale v2 message, clock skew %s", skew.Round(time.Second))
+		}
+		ad := associatedData("request", uuid, r.URL.Path, "", hdr)
+		plaintext, err := openWith(keys, body[v2HeaderSize:v2HeaderSize+ns], body[v2HeaderSize+ns:], ad)
+		if err != nil {
+			return nil, info, err
+		}
+		if !s.remember([msgIDSize]byte(hdr[1:1+msgIDSize]), sent) {
+			return nil, info, errors.New("replayed v2 message")
+		}
+		return plaintext, info, nil
+
+	default:
+		return nil, info, fmt.Errorf("unknown envelope version %q", v)
+	}
+}
+
+// remember records a v2 message ID and reports whether it is new.
+func (s *Server) remember(id [msgIDSize]byte, sent time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	for k, stale := range s.seen {
+		if now.After(stale) {
+			delete(s.seen, k)
+		}
+	}
+	if _, ok := s.seen[id]; ok {
+		return false
+	}
+	s.seen[id] = sent.Add(maxSkew)
+	return true
+}
+
+// writeSealed answers r with plaintext encrypted under the agent's current
+// key, in v2 if the agent accepts it and the mock isn't legacy.
+func (s *Server) writeSealed(w http.ResponseWriter, r *http.Request, plaintext []byte) {
+	s.mu.Lock()
+	k := key{s.agent.KeyID, s.agent.Key}
+	uuid := s.agent.UUID
+	s.mu.Unlock()
+
+	aead, err := chacha20poly1305.New(k.key)
+	if err != nil {
+		http.Error(w, "no usable encryption key for this agent", http.StatusInternalServerError)
+		return
+	}
+	v2 := !s.opts.Legacy && accepts(r.Header.Get(envelopesHeader), 2)
+
+	var out []byte
+	if v2 {
+		out = make([]byte, v2HeaderSize, v2HeaderSize+aead.NonceSize()+len(plaintext)+aead.Overhead())
+		out[0] = 2
+		rand.Read(out[1 : 1+msgIDSize])
+		binary.BigEndian.PutUint64(out[1+msgIDSize:], uint64(time.Now().UnixMilli()))
+	}
+	nonce := make([]byte, aead.NonceSize())
+	rand.Read(nonce)
+	out = append(out, nonce...)
+	var ad []byte
+	if v2 {
+		ad = associatedData("response", uuid, r.URL.Path, r.Header.Get(requestIDHeader), out[:v2HeaderSize])
+	}
+	out = aead.Seal(out, nonce, plaintext, ad)
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	if v2 {
+		w.Header().Set(envelopeHeader, "2")
+	} else {
+		w.Header().Set(envelopeHeader, "1")
+	}
+	if k.id != "" {
+		w.Header().Set(keyIDHeader, k.id)
+	}
+	w.Write(out)
+}
+
+// accepts reports whether the envelopesHeader value list includes version.
+func accepts(list string, version int) bool {
+	for _, v := range strings.Split(list, ",") {
+		if n, err := strconv.Atoi(strings.TrimSpace(v)); err == nil && n == version {
+			return true
+		}
+	}
+	return false
+}
+
+func openWith(keys []key, nonce, ciphertext, ad []byte) ([]byte, error) {
+	for _, k := range keys {
+		aead, err := chacha20poly1305.New(k.key)
+		if err != nil {
+			continue
+		}
+		if plaintext, err := aead.Open(nil, nonce, ciphertext, ad); err == nil {
+			return plaintext, nil
+		}
+	}
+	return nil, errors.New("body does not open with any of the agent's keys")
+}
+
+func associatedData(dir, uuid, path, requestID string, hdr []byte) []byte {
+	var b bytes.Buffer
+	b.WriteString("forcedesk-envelope\x00")
+	b.WriteString(dir)
+	b.WriteByte(0)
+	b.WriteString(uuid)
+	b.WriteByte(0)
+	b.WriteString(path)
+	b.WriteByte(0)
+	if dir == "response" {
+		b.WriteString(requestID)
+		b.WriteByte(0)
+	}
+	b.Write(hdr)
+	return b.Bytes()
+}
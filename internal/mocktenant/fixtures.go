@@ -0,0 +1,110 @@
+// Copyright © 2026 ForcePoint Software. All rights reserved.
+
+package mocktenant
+
+import (
+	"crypto/hkdf"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// fixture registers GET path to answer from its fixture file, sealed if
+// encrypted. Without a fixture it answers fallback, or 404 if fallback is
+// empty, as a tenant with nothing configured for the agent would.
+func (s *Server) fixture(path string, encrypted bool, fallback string) {
+	s.mux.HandleFunc("GET "+path, s.auth(func(w http.ResponseWriter, r *http.Request) {
+		body, err := s.readFixture(strings.TrimPrefix(path, "/api/agent/"))
+		switch {
+		case err != nil:
+			slog.Error("mocktenant: bad fixture", "path", path, "err", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		case body == nil && fallback == "":
+			http.NotFound(w, r)
+			return
+		case body == nil:
+			body = []byte(fallback)
+		}
+		if encrypted {
+			s.writeSealed(w, r, body)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(body)
+	}))
+}
+
+// readFixture returns the fixture name.json, or nil if there is none. A
+// fixture that isn't valid JSON is an error.
+func (s *Server) readFixture(name string) ([]byte, error) {
+	if s.opts.Fixtures == "" {
+		return nil, nil
+	}
+	body, err := os.ReadFile(filepath.Join(s.opts.Fixtures, filepath.FromSlash(name)+".json"))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !json.Valid(body) {
+		return nil, fmt.Errorf("%s.json is not valid JSON", name)
+	}
+	return body, nil
+}
+
+// handleSchedule serves the schedule.json manifest, signed as package
+// manifest expects: HMAC-SHA256 keyed with HKDF-SHA256(encryption key,
+// info "forcedesk-agent schedule manifest v1").
+func (s *Server) handleSchedule(w http.ResponseWriter, r *http.Request) {
+	body, err := s.readFixture("schedule")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if body == nil || s.opts.Legacy {
+		http.NotFound(w, r)
+		return
+	}
+	s.mu.Lock()
+	k := s.agent.Key
+	s.mu.Unlock()
+	signingKey, err := hkdf.Key(sha256.New, k, nil, "forcedesk-agent schedule manifest v1", 32)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	mac := hmac.New(sha256.New, signingKey)
+	mac.Write(body)
+	writeJSON(w, http.StatusOK, map[string]string{
+		"manifest":  base64.StdEncoding.EncodeToString(body),
+		"signature": hex.EncodeToString(mac.Sum(nil)),
+	})
+}
+
+// handleUpdate serves the update.json offer, or no offer. The offer must
+// be signed with the update key the agent was built with.
+func (s *Server) handleUpdate(w http.ResponseWriter, r *http.Request) {
+	body, err := s.readFixture("update")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if body == nil || s.opts.Legacy {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(body)
+}
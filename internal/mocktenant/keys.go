@@ -0,0 +1,190 @@
+// Copyright © 2026 ForcePoint Software. All rights reserved.
+
+package mocktenant
+
+import (
+	"crypto/ecdh"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+// RotateKey starts a key rotation: it queues a rotate-encryption-key command
+// carrying a new key wrapped under the current one. The mock keeps sealing
+// with the current key until the agent confirms the new one.
+func (s *Server) RotateKey() (string, error) {
+	s.mu.Lock()
+	cur := s.agent.Key
+	uuid := s.agent.UUID
+	s.keySeq++
+	next := key{id: fmt.Sprintf("mock-%d", s.keySeq), key: make([]byte, chacha20poly1305.KeySize)}
+	s.mu.Unlock()
+	if cur == nil {
+		return "", fmt.Errorf("the agent has no encryption key to wrap the new one with")
+	}
+	rand.Read(next.key)
+
+	// nonce || ChaCha20-Poly1305(current key, new key, ad = "forcedesk-key-rotation" 0 UUID 0 key ID)
+	aead, err := chacha20poly1305.New(cur)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	rand.Read(nonce)
+	wrapped := aead.Seal(nonce, nonce, next.key, []byte("forcedesk-key-rotation\x00"+uuid+"\x00"+next.id))
+
+	s.mu.Lock()
+	s.rotation = &next
+	s.mu.Unlock()
+
+	item, _ := json.Marshal(map[string]any{
+		"type": "rotate-encryption-key",
+		"payload_data": map[string]string{
+			"key_id":      next.id,
+			"wrapped_key": base64.StdEncoding.EncodeToString(wrapped),
+		},
+	})
+	if _, err := s.QueueCommand(item); err != nil {
+		return "", err
+	}
+	slog.Info("mocktenant: key rotation started", "key_id", next.id)
+	return next.id, nil
+}
+
+// handleKeyConfirm completes a rotation once the agent proves it holds the
+// new key.
+func (s *Server) handleKeyConfirm(w http.ResponseWriter, r *http.Request) {
+	body, ok := s.receive(w, r, true)
+	if !ok {
+		return
+	}
+	var confirm struct {
+		KeyID string `json:"key_id"`
+	}
+	json.Unmarshal(body, &confirm)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch {
+	case s.rotation != nil && confirm.KeyID == s.rotation.id && r.Header.Get(keyIDHeader) == s.rotation.id:
+		s.agent.PreviousKey, s.agent.PreviousKeyID = s.agent.Key, s.agent.KeyID
+		s.agent.Key, s.agent.KeyID = s.rotation.key, s.rotation.id
+		s.rotation = nil
+		slog.Info("mocktenant: key rotation confirmed", "key_id", confirm.KeyID)
+	case confirm.KeyID == s.agent.KeyID:
+		slog.Info("mocktenant: key rotation confirmed again", "key_id", confirm.KeyID)
+	default:
+		slog.Error("mocktenant: confirmation for a key the mock didn't send", "key_id", confirm.KeyID)
+		http.Error(w, "unknown key", http.StatusConflict)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+func (s *Server) handleRotateKey(w http.ResponseWriter, r *http.Request) {
+	id, err := s.RotateKey()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"key_id": id})
+}
+
+// handleEnroll redeems the enrollment token for a new identity, sealed as
+// tenant/enroll.go describes:
+//
+//	shared     = X25519(tenant private, agent public)
+//	key        = HKDF-SHA256(shared, salt = token, info = "forcedesk-enroll v1" 0 || agent public || tenant public)
+//	ciphertext = ChaCha20-Poly1305(key, nonce, credentials, ad = "forcedesk-enroll" 0 || token_id)
+func (s *Server) handleEnroll(w http.ResponseWriter, r *http.Request) {
+	token := s.opts.EnrollToken
+	if token == "" {
+		http.NotFound(w, r)
+		return
+	}
+	body, ok := s.receive(w, r, false)
+	if !ok {
+		return
+	}
+	var req struct {
+		TokenID   string `json:"token_id"`
+		PublicKey string `json:"public_key"`
+		Hostname  string `json:"hostname"`
+	}
+	if err := json.Unmarshal(body, &req); err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	sum := sha256.Sum256([]byte("forcedesk-enroll-token\x00" + token))
+	if req.TokenID != base64.RawURLEncoding.EncodeToString(sum[:]) {
+		slog.Warn("mocktenant: enrollment with an unknown token refused", "hostname", req.Hostname)
+		http.Error(w, "unknown token", http.StatusUnauthorized)
+		return
+	}
+	agentPub, err := base64.StdEncoding.DecodeString(req.PublicKey)
+	if err != nil {
+		http.Error(w, "bad public key", http.StatusBadRequest)
+		return
+	}
+	peer, err := ecdh.X25519().NewPublicKey(agentPub)
+	if err != nil {
+		http.Error(w, "bad public key", http.StatusBadRequest)
+		return
+	}
+	priv, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	shared, err := priv.ECDH(peer)
+	if err != nil {
+		http.Error(w, "key exchange failed", http.StatusBadRequest)
+		return
+	}
+	tenantPub := priv.PublicKey().Bytes()
+	sealKey, err := hkdf.Key(sha256.New, shared, []byte(token), "forcedesk-enroll v1\x00"+string(agentPub)+string(tenantPub), chacha20poly1305.KeySize)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	id := Identity{UUID: randomHex(16), APIKey: randomHex(32), Key: make([]byte, chacha20poly1305.KeySize), KeyID: "mock-enrolled"}
+	rand.Read(id.Key)
+	creds, _ := json.Marshal(map[string]string{
+		"uuid":              id.UUID,
+		"api_key":           id.APIKey,
+		"encryption_key":    hex.EncodeToString(id.Key),
+		"encryption_key_id": id.KeyID,
+	})
+	aead, _ := chacha20poly1305.New(sealKey)
+	nonce := make([]byte, aead.NonceSize())
+	rand.Read(nonce)
+	ct := aead.Seal(nil, nonce, creds, []byte("forcedesk-enroll\x00"+req.TokenID))
+
+	s.mu.Lock()
+	s.agent = id
+	s.rotation = nil
+	s.mu.Unlock()
+	slog.Info("mocktenant: agent enrolled", "hostname", req.Hostname, "uuid", id.UUID)
+
+	writeJSON(w, http.StatusOK, map[string]string{
+		"public_key": base64.StdEncoding.EncodeToString(tenantPub),
+		"nonce":      base64.StdEncoding.EncodeToString(nonce),
+		"ciphertext": base64.StdEncoding.EncodeToString(ct),
+	})
+}
+
+// randomHex returns n random bytes, hex encoded.
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,354 @@
+// Copyright © 2026 ForcePoint Software. All rights reserved.
+
+// Package mocktenant is a stand-in for the ForceDesk tenant, for running the
+// real agent end to end on a laptop. It serves every /api/agent endpoint the
+// agent calls:
+//
+//   - Reads answer from fixture files (see Options.Fixtures), or with the
+//     empty answer a tenant with nothing configured would give.
+//   - Every upload is recorded (see Upload), and written to Options.Record
+//     if set.
+//   - Commands and device queries are queued by a script (see Step) or
+//     through the control endpoints under /mock/, and delivered on the push
+//     channel or to the polling tasks, whichever asks first.
+//   - Encrypted endpoints speak both envelope formats, key rotation and
+//     enrollment. The wire formats are implemented here from their
+//     specifications in package tenant rather than by calling it, so a change
+//     to the agent's side that breaks the format shows up against the mock.
+//
+// The mock holds one agent identity at a time: the one it was started with, or
+// the last one issued by enrollment. It keeps no state across restarts apart
+// from what it writes to Options.Record.
+package mocktenant
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// APIVersion is the tenant API version the mock negotiates.
+const APIVersion = 1
+
+// maxBody bounds the request bodies the mock reads.
+const maxBody = 64 << 20
+
+// Identity is an agent's credentials as the tenant holds them.
+type Identity struct {
+	UUID   string
+	APIKey string
+	// Key is the current encryption key and KeyID its ID, "" for a key set at
+	// install. PreviousKey is the key the last rotation replaced, if any.
+	Key           []byte
+	KeyID         string
+	PreviousKey   []byte
+	PreviousKeyID string
+}
+
+// Options configures a Server.
+type Options struct {
+	// Agent is the identity the agent under test uses. It may be empty if the
+	// agent will enroll with EnrollToken.
+	Agent Identity
+	// EnrollToken is the enrollment token the mock accepts. It may be used
+	// any number of times; each enrollment issues a new identity that
+	// replaces Agent. Empty disables enrollment.
+	EnrollToken string
+	// Fixtures is a directory of JSON files answering the agent's reads. The
+	// answer to GET /api/agent/<path> is <path>.json, e.g.
+	// devicemanager/payloads.json, read on every request so it can be edited
+	// while the agent runs. schedule.json is a schedule manifest, which the
+	// mock signs, and update.json an update offer.
+	Fixtures string
+	// Record is a directory to write every upload to, one JSON file each.
+	Record string
+	// Legacy makes the mock behave like a tenant that predates capability
+	// negotiation: no v2 envelopes, request compression, push channel,
+	// schedule manifest or update offers.
+	Legacy bool
+	// DisablePush turns off the push channel only.
+	DisablePush bool
+}
+
+// Server is a mock tenant. It is an http.Handler.
+type Server struct {
+	opts Options
+	mux  *http.ServeMux
+
+	mu    sync.Mutex
+	agent Identity
+	// rotation is the key a rotation has sent the agent but the agent hasn't
+	// confirmed; the mock keeps sealing with the current key until it does.
+	rotation *key
+	keySeq   int
+	queue    []queued
+	queueSeq int64
+	queryID  int64
+	// queued is closed and replaced whenever something is queued, to wake
+	// push polls.
+	queued  chan struct{}
+	uploads []Upload
+	// seen holds the v2 message IDs received, until they would go stale.
+	seen map[[msgIDSize]byte]time.Time
+}
+
+// New returns a mock tenant.
+func New(opts Options) *Server {
+	s := &Server{
+		opts:   opts,
+		mux:    http.NewServeMux(),
+		agent:  opts.Agent,
+		queued: make(chan struct{}),
+		seen:   make(map[[msgIDSize]byte]time.Time),
+	}
+	s.routes()
+	return s
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	slog.Debug("mocktenant: request", "method", r.Method, "path", r.URL.Path)
+	s.mux.ServeHTTP(w, r)
+}
+
+// routes registers every endpoint the agent uses.
+func (s *Server) routes() {
+	m := s.mux
+
+	// Connectivity, status and negotiation.
+	m.HandleFunc("GET /api/agent/test", s.auth(s.handleTest))
+	m.HandleFunc("POST /api/agent/heartbeat", s.auth(s.handleHeartbeat))
+	m.HandleFunc("POST /api/agent/capabilities", s.auth(s.handleCapabilities))
+	m.HandleFunc("GET /api/agent/schedule", s.auth(s.handleSchedule))
+	m.HandleFunc("GET /api/agent/update", s.auth(s.handleUpdate))
+	m.HandleFunc("POST /api/agent/enroll", s.handleEnroll)
+
+	// Commands, device queries, jobs and keys.
+	m.HandleFunc("GET /api/agent/command-queues", s.auth(s.handleCommandQueues))
+	m.HandleFunc("GET /api/agent/devicemanager/query-payloads", s.auth(s.handleQueryPayloads))
+	m.HandleFunc("GET /api/agent/push", s.auth(s.handlePush))
+	m.HandleFunc("POST /api/agent/jobs/{uuid}/result", s.auth(s.upload(false)))
+	m.HandleFunc("POST /api/agent/encryption-key/confirm", s.auth(s.handleKeyConfirm))
+
+	// Reads answered from fixtures.
+	s.fixture("/api/agent/monitoring/getpayloads", false, `[]`)
+	s.fixture("/api/agent/remote-labels/pending", false, `{"success":true,"labels":[]}`)
+	s.fixture("/api/agent/edustar/crt-accounts", false, `[]`)
+	s.fixture("/api/agent/edustar/service-accounts", false, `[]`)
+	s.fixture("/api/agent/edustar-config", true, "")
+	s.fixture("/api/agent/papercut-config", true, "")
+	s.fixture("/api/agent/ingest/papercut-data", true, `{"staff":[],"students":[]}`)
+	s.fixture("/api/agent/devicemanager/payloads", true, `{"payloads":[]}`)
+
+	// Plain uploads.
+	for _, p := range []string{
+		"/api/agent/monitoring/response-bulk",
+		"/api/agent/remote-labels/{id}/printed",
+		"/api/agent/ingest/edustar/crt-accounts",
+		"/api/agent/ingest/edustar/service-accounts",
+		"/api/agent/ingest/det-notebooks/fleet",
+	} {
+		m.HandleFunc("POST "+p, s.auth(s.upload(false)))
+	}
+	m.HandleFunc("POST /api/agent/monitoring/graph/{id}", s.auth(s.handleGraph))
+
+	// Encrypted uploads.
+	for _, p := range []string{
+		"/api/agent/devicemanager/response",
+		"/api/agent/devicemanager/query-response",
+		"/api/agent/ingest/papercut-data",
+		"/api/agent/ingest/papercut-shared-accounts",
+		"/api/agent/ingest/papercut-shared-account-balance",
+	} {
+		m.HandleFunc("POST "+p, s.auth(s.upload(true)))
+	}
+
+	// Sensitive uploads are only taken encrypted. The agent must never send
+	// them to the plaintext endpoint; the mock refuses, loudly, if it does.
+	for _, p := range []string{
+		"/api/agent/ingest/edustar/crt-passwords",
+		"/api/agent/ingest/edustar/service-passwords",
+		"/api/agent/ingest/edustar/students",
+		"/api/agent/ingest/edustar/staff",
+		"/api/agent/student-devices/{snid}/certificate",
+		"/api/agent/bulk-certificates/certificate",
+	} {
+		m.HandleFunc("POST "+p, s.auth(s.handlePlaintextSensitive))
+		m.HandleFunc("POST "+p+"/encrypted", s.auth(s.upload(true)))
+	}
+
+	m.HandleFunc("/api/agent/", s.handleUnknown)
+
+	// Control endpoints for scripting from outside.
+	m.HandleFunc("POST /mock/commands", s.handleQueueCommands)
+	m.HandleFunc("POST /mock/device-queries", s.handleQueueDeviceQueries)
+	m.HandleFunc("POST /mock/rotate-key", s.handleRotateKey)
+	m.HandleFunc("GET /mock/uploads", s.handleUploads)
+}
+
+// auth checks the agent's credentials, then advertises what the mock
+// supports on the response.
+func (s *Server) auth(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		a := s.agent
+		s.mu.Unlock()
+		if a.UUID == "" || r.Header.Get("x-forcedesk-agent") != a.UUID || r.Header.Get("Authorization") != "Bearer "+a.APIKey {
+			slog.Warn("mocktenant: request with unknown agent credentials refused", "path", r.URL.Path, "agent", r.Header.Get("x-forcedesk-agent"))
+			http.Error(w, "unauthenticated", http.StatusUnauthorized)
+			return
+		}
+		if !s.opts.Legacy {
+			w.Header().Set(envelopesHeader, "1, 2")
+			w.Header().Set("Accept-Encoding", "zstd, gzip")
+		}
+		h(w, r)
+	}
+}
+
+func (s *Server) handleTest(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+func (s *Server) handleHeartbeat(w http.ResponseWriter, r *http.Request) {
+	if _, ok := s.receive(w, r, false); !ok {
+		return
+	}
+	resp := map[string]any{"status": "ok", "message": "mock tenant"}
+	if !s.opts.Legacy {
+		resp["api_version"] = APIVersion
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (s *Server) handleCapabilities(w http.ResponseWriter, r *http.Request) {
+	if s.opts.Legacy {
+		http.NotFound(w, r)
+		return
+	}
+	if _, ok := s.receive(w, r, false); !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]int{"api_version": APIVersion})
+}
+
+// upload returns a handler that records the upload and acknowledges it.
+func (s *Server) upload(encrypted bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := s.receive(w, r, encrypted); !ok {
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+	}
+}
+
+func (s *Server) handlePlaintextSensitive(w http.ResponseWriter, r *http.Request) {
+	slog.Error("mocktenant: sensitive upload sent in plaintext, refused", "path", r.URL.Path)
+	http.Error(w, "sensitive uploads must be sent to the encrypted endpoint", http.StatusBadRequest)
+}
+
+func (s *Server) handleUnknown(w http.ResponseWriter, r *http.Request) {
+	slog.Warn("mocktenant: request to an endpoint the mock doesn't know", "method", r.Method, "path", r.URL.Path)
+	http.NotFound(w, r)
+}
+
+// receive reads, opens and records the body of an upload. On failure it has
+// answered the request and returns false.
+func (s *Server) receive(w http.ResponseWriter, r *http.Request, encrypted bool) ([]byte, bool) {
+	raw, err := io.ReadAll(io.LimitReader(r.Body, maxBody))
+	if err != nil {
+		http.Error(w, "read body", http.StatusBadRequest)
+		return nil, false
+	}
+
+	up := Upload{Path: r.URL.Path, Encrypted: encrypted}
+	var body []byte
+	if encrypted {
+		var env envelopeInfo
+		body, env, err = s.open(r, raw)
+		if err != nil {
+			slog.Error("mocktenant: failed to open encrypted upload", "path", r.URL.Path, "err", err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return nil, false
+		}
+		up.Envelope, up.KeyID = env.version, env.keyID
+		up.Encoding = r.Header.Get(payloadEncodingHeader)
+		body, err = decode(up.Encoding, body)
+	} else {
+		if r.Header.Get("Content-Type") == "application/octet-stream" {
+			slog.Error("mocktenant: encrypted body sent to a plaintext endpoint", "path", r.URL.Path)
+			http.Error(w, "expected JSON", http.StatusBadRequest)
+			return nil, false
+		}
+		up.Encoding = r.Header.Get("Content-Encoding")
+		body, err = decode(up.Encoding, raw)
+	}
+	if err != nil {
+		slog.Error("mocktenant: failed to decompress upload", "path", r.URL.Path, "encoding", up.Encoding, "err", err)
+		http.Error(w, err.Error(), http.StatusUnsupportedMediaType)
+		return nil, false
+	}
+
+	up.Body = rawJSON(body)
+	s.record(up)
+	return body, true
+}
+
+// decode undoes a request body coding.
+func decode(enc string, body []byte) ([]byte, error) {
+	var zr io.Reader
+	switch enc {
+	case "", "identity":
+		return body, nil
+	case "gzip":
+		gr, err := gzip.NewReader(bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		defer gr.Close()
+		zr = gr
+	case "zstd":
+		d, err := zstd.NewReader(bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		defer d.Close()
+		zr = d
+	default:
+		return nil, fmt.Errorf("unsupported encoding %q", enc)
+	}
+	out, err := io.ReadAll(io.LimitReader(zr, maxBody+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(out) > maxBody {
+		return nil, errors.New("decompressed body too large")
+	}
+	return out, nil
+}
+
+// rawJSON returns body as JSON, quoting it as a string if it isn't JSON.
+func rawJSON(body []byte) json.RawMessage {
+	if len(body) == 0 {
+		return nil
+	}
+	if json.Valid(body) {
+		return json.RawMessage(body)
+	}
+	q, _ := json.Marshal(string(body))
+	return q
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,315 @@
+// Copyright © 2026 ForcePoint Software. All rights reserved.
+
+package mocktenant
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/forcedesk/forcedesk-agent/internal/tenant"
+)
+
+// pushWait bounds how long a push poll is held, whatever the agent asks for;
+// it must stay under the agent's request timeout.
+const pushWait = 25 * time.Second
+
+// queued is a command or device query waiting for the agent. Polling takes
+// it off the queue; the push channel leaves it until the agent acknowledges
+// it with a later cursor.
+type queued struct {
+	seq  int64
+	kind string // tenant.PushCommands or tenant.PushDeviceQueries
+	item json.RawMessage
+}
+
+// QueueCommand queues item, a /api/agent/command-queues entry such as
+// {"type": "force-sync-papercutsvc", "payload_data": {...}}, and returns its
+// request UUID, generated if payload_data has none.
+func (s *Server) QueueCommand(item json.RawMessage) (string, error) {
+	var cmd map[string]any
+	if err := json.Unmarshal(item, &cmd); err != nil {
+		return "", fmt.Errorf("command: %w", err)
+	}
+	if t, _ := cmd["type"].(string); t == "" {
+		return "", errors.New("command has no type")
+	}
+	data, _ := cmd["payload_data"].(map[string]any)
+	if data == nil {
+		data = make(map[string]any)
+		cmd["payload_data"] = data
+	}
+	id, _ := data["request_uuid"].(string)
+	if id == "" {
+		id = newUUID()
+		data["request_uuid"] = id
+	}
+	s.enqueue(tenant.PushCommands, cmd)
+	slog.Info("mocktenant: command queued", "type", cmd["type"], "request_uuid", id)
+	return id, nil
+}
+
+// QueueDeviceQuery queues payload, a query-payloads entry such as
+// {"payload_data": {"device_hostname": ..., "command": ...}}, and returns
+// its UUID, generated if it has none.
+func (s *Server) QueueDeviceQuery(payload json.RawMessage) (string, error) {
+	var q map[string]any
+	if err := json.Unmarshal(payload, &q); err != nil {
+		return "", fmt.Errorf("device query: %w", err)
+	}
+	data, _ := q["payload_data"].(map[string]any)
+	if data == nil {
+		return "", errors.New("device query has no payload_data")
+	}
+	id, _ := q["uuid"].(string)
+	if id == "" {
+		id = newUUID()
+		q["uuid"] = id
+	}
+	if _, ok := data["request_uuid"]; !ok {
+		data["request_uuid"] = id
+	}
+	if _, ok := q["id"]; !ok {
+		s.mu.Lock()
+		s.queryID++
+		q["id"] = s.queryID
+		s.mu.Unlock()
+	}
+	s.enqueue(tenant.PushDeviceQueries, q)
+	slog.Info("mocktenant: device query queued", "uuid", id, "host", data["device_hostname"])
+	return id, nil
+}
+
+func (s *Server) enqueue(kind string, v any) {
+	item, _ := json.Marshal(v)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.queueSeq++
+	s.queue = append(s.queue, queued{seq: s.queueSeq, kind: kind, item: item})
+	close(s.queued)
+	s.queued = make(chan struct{})
+}
+
+// take removes and returns the queued items of kind.
+func (s *Server) take(kind string) []json.RawMessage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	items := []json.RawMessage{}
+	kept := s.queue[:0]
+	for _, q := range s.queue {
+		if q.kind == kind {
+			items = append(items, q.item)
+		} else {
+			kept = append(kept, q)
+		}
+	}
+	s.queue = kept
+	return items
+}
+
+func (s *Server) handleCommandQueues(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.take(tenant.PushCommands))
+}
+
+func (s *Server) handleQueryPayloads(w http.ResponseWriter, r *http.Request) {
+	s.writeSealedJSON(w, r, queryPayloads(s.take(tenant.PushDeviceQueries)))
+}
+
+// queryPayloads wraps device queries in a query-payloads response.
+func queryPayloads(items []json.RawMessage) any {
+	return map[string]any{"status": "ok", "payloads": items, "config": map[string]string{}}
+}
+
+// handlePush holds the poll until something is queued or the wait is up.
+// The cursor is the sequence number of the last item delivered; a poll with
+// it acknowledges everything up to there.
+func (s *Server) handlePush(w http.ResponseWriter, r *http.Request) {
+	if s.opts.Legacy || s.opts.DisablePush {
+		http.NotFound(w, r)
+		return
+	}
+	cursor, _ := strconv.ParseInt(r.URL.Query().Get("cursor"), 10, 64)
+	wait := pushWait
+	if secs, err := strconv.Atoi(r.URL.Query().Get("wait")); err == nil && secs >= 0 {
+		wait = min(time.Duration(secs)*time.Second, pushWait)
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	for {
+		s.mu.Lock()
+		var commands, queries []json.RawMessage
+		last := cursor
+		kept := s.queue[:0]
+		for _, q := range s.queue {
+			if q.seq <= cursor {
+				continue // acknowledged
+			}
+			kept = append(kept, q)
+			if q.kind == tenant.PushCommands {
+				commands = append(commands, q.item)
+			} else {
+				queries = append(queries, q.item)
+			}
+			last = max(last, q.seq)
+		}
+		s.queue = kept
+		changed := s.queued
+		s.mu.Unlock()
+
+		if last > cursor {
+			var events []map[string]any
+			if len(commands) > 0 {
+				events = append(events, map[string]any{"type": tenant.PushCommands, "data": commands})
+			}
+			if len(queries) > 0 {
+				events = append(events, map[string]any{"type": tenant.PushDeviceQueries, "data": queryPayloads(queries)})
+			}
+			slog.Debug("mocktenant: push delivered", "commands", len(commands), "device_queries", len(queries), "cursor", last)
+			s.writeSealedJSON(w, r, map[string]any{"cursor": strconv.FormatInt(last, 10), "events": events})
+			return
+		}
+
+		select {
+		case <-changed:
+		case <-timer.C:
+			w.WriteHeader(http.StatusNoContent)
+			return
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+func (s *Server) writeSealedJSON(w http.ResponseWriter, r *http.Request, v any) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	s.writeSealed(w, r, b)
+}
+
+// handleQueueCommands queues the command, or array of commands, in the body.
+func (s *Server) handleQueueCommands(w http.ResponseWriter, r *http.Request) {
+	s.handleQueue(w, r, s.QueueCommand)
+}
+
+// handleQueueDeviceQueries queues the device query, or array of them, in the body.
+func (s *Server) handleQueueDeviceQueries(w http.ResponseWriter, r *http.Request) {
+	s.handleQueue(w, r, s.QueueDeviceQuery)
+}
+
+func (s *Server) handleQueue(w http.ResponseWriter, r *http.Request, queue func(json.RawMessage) (string, error)) {
+	var raw json.RawMessage
+	if err := json.NewDecoder(r.Body).Decode(&raw); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	items := []json.RawMessage{raw}
+	if len(raw) > 0 && raw[0] == '[' {
+		items = nil
+		if err := json.Unmarshal(raw, &items); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	ids := []string{}
+	for _, item := range items {
+		id, err := queue(item)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		ids = append(ids, id)
+	}
+	writeJSON(w, http.StatusOK, map[string][]string{"queued": ids})
+}
+
+// Step is one step of a script, a JSON array of steps run in order.
+// Exactly one of Command, DeviceQuery and RotateKey is set.
+type Step struct {
+	// After is how long to wait after the previous step, e.g. "30s".
+	After string `json:"after"`
+	// Command is queued as with QueueCommand.
+	Command json.RawMessage `json:"command,omitempty"`
+	// DeviceQuery is queued as with QueueDeviceQuery.
+	DeviceQuery json.RawMessage `json:"device_query,omitempty"`
+	// RotateKey starts a key rotation.
+	RotateKey bool `json:"rotate_key,omitempty"`
+
+	after time.Duration
+}
+
+// LoadScript reads and checks a script file.
+func LoadScript(path string) ([]Step, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var steps []Step
+	if err := json.Unmarshal(raw, &steps); err != nil {
+		return nil, fmt.Errorf("parse script %s: %w", path, err)
+	}
+	for i := range steps {
+		st := &steps[i]
+		n := 0
+		for _, set := range []bool{st.Command != nil, st.DeviceQuery != nil, st.RotateKey} {
+			if set {
+				n++
+			}
+		}
+		if n != 1 {
+			return nil, fmt.Errorf("script %s: step %d must set exactly one of command, device_query and rotate_key", path, i+1)
+		}
+		if st.After != "" {
+			if st.after, err = time.ParseDuration(st.After); err != nil {
+				return nil, fmt.Errorf("script %s: step %d: invalid after %q", path, i+1, st.After)
+			}
+		}
+	}
+	return steps, nil
+}
+
+// RunScript runs steps until they are done or ctx is cancelled. A step that
+// fails is logged and skipped.
+func (s *Server) RunScript(ctx context.Context, steps []Step) {
+	for i, st := range steps {
+		if st.after > 0 {
+			select {
+			case <-time.After(st.after):
+			case <-ctx.Done():
+				return
+			}
+		}
+		var err error
+		switch {
+		case st.Command != nil:
+			_, err = s.QueueCommand(st.Command)
+		case st.DeviceQuery != nil:
+			_, err = s.QueueDeviceQuery(st.DeviceQuery)
+		case st.RotateKey:
+			_, err = s.RotateKey()
+		}
+		if err != nil {
+			slog.Error("mocktenant: script step failed", "step", i+1, "err", err)
+		}
+	}
+	slog.Info("mocktenant: script finished", "steps", len(steps))
+}
+
+// newUUID returns a random version 4 UUID.
+func newUUID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
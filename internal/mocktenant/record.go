@@ -0,0 +1,124 @@
+// Copyright © 2026 ForcePoint Software. All rights reserved.
+
+package mocktenant
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// maxUploads bounds the uploads kept in memory; Options.Record keeps them all.
+const maxUploads = 1000
+
+// Upload is a request body the agent sent, as the tenant received it.
+type Upload struct {
+	Seq  int       `json:"seq"`
+	Time time.Time `json:"time"`
+	Path string    `json:"path"`
+	// Encrypted uploads record the envelope version and key ID they were
+	// sealed with; Body is the opened plaintext.
+	Encrypted bool   `json:"encrypted"`
+	Envelope  int    `json:"envelope,omitempty"`
+	KeyID     string `json:"key_id,omitempty"`
+	// Encoding is the compression the body was sent with.
+	Encoding string `json:"encoding,omitempty"`
+	// Body is the JSON body, or the body as a string if it isn't JSON.
+	Body json.RawMessage `json:"body,omitempty"`
+	// File describes a file upload.
+	File *File `json:"file,omitempty"`
+}
+
+// File is a file uploaded as multipart form data. With Options.Record set,
+// the file itself is saved next to the upload's record.
+type File struct {
+	Name string `json:"name"`
+	Size int64  `json:"size"`
+}
+
+// Uploads returns the uploads received so far, oldest first, up to the last
+// maxUploads.
+func (s *Server) Uploads() []Upload {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Upload(nil), s.uploads...)
+}
+
+// record numbers and keeps up and writes it to Options.Record.
+func (s *Server) record(up Upload) Upload {
+	s.mu.Lock()
+	up.Time = time.Now()
+	if n := len(s.uploads); n > 0 {
+		up.Seq = s.uploads[n-1].Seq + 1
+	} else {
+		up.Seq = 1
+	}
+	s.uploads = append(s.uploads, up)
+	if len(s.uploads) > maxUploads {
+		s.uploads = s.uploads[len(s.uploads)-maxUploads:]
+	}
+	s.mu.Unlock()
+
+	slog.Info("mocktenant: upload received", "seq", up.Seq, "path", up.Path, "encrypted", up.Encrypted, "bytes", len(up.Body))
+	if s.opts.Record != "" {
+		b, _ := json.MarshalIndent(up, "", "  ")
+		if err := os.WriteFile(s.recordPath(up, "json"), b, 0o600); err != nil {
+			slog.Error("mocktenant: failed to record upload", "err", err)
+		}
+	}
+	return up
+}
+
+// recordPath names the file recording up, e.g. 00012-heartbeat.json.
+func (s *Server) recordPath(up Upload, ext string) string {
+	name := strings.ReplaceAll(strings.Trim(strings.TrimPrefix(up.Path, "/api/agent/"), "/"), "/", "_")
+	return filepath.Join(s.opts.Record, fmt.Sprintf("%05d-%s.%s", up.Seq, name, ext))
+}
+
+// handleGraph takes a monitoring graph, uploaded as multipart form data
+// under "file".
+func (s *Server) handleGraph(w http.ResponseWriter, r *http.Request) {
+	f, hdr, err := r.FormFile("file")
+	if err != nil {
+		slog.Error("mocktenant: graph upload without a file", "path", r.URL.Path, "err", err)
+		http.Error(w, "missing file", http.StatusBadRequest)
+		return
+	}
+	defer f.Close()
+	data, err := io.ReadAll(io.LimitReader(f, maxBody))
+	if err != nil {
+		http.Error(w, "read file", http.StatusBadRequest)
+		return
+	}
+
+	up := s.record(Upload{Path: r.URL.Path, File: &File{Name: hdr.Filename, Size: int64(len(data))}})
+	if s.opts.Record != "" {
+		ext := strings.TrimPrefix(filepath.Ext(hdr.Filename), ".")
+		if ext == "" {
+			ext = "bin"
+		}
+		if err := os.WriteFile(s.recordPath(up, ext), data, 0o600); err != nil {
+			slog.Error("mocktenant: failed to save uploaded file", "err", err)
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// handleUploads lists the recorded uploads; ?path= keeps those whose path
+// starts with it.
+func (s *Server) handleUploads(w http.ResponseWriter, r *http.Request) {
+	prefix := r.URL.Query().Get("path")
+	ups := []Upload{}
+	for _, up := range s.Uploads() {
+		if strings.HasPrefix(up.Path, prefix) {
+			ups = append(ups, up)
+		}
+	}
+	writeJSON(w, http.StatusOK, ups)
+}
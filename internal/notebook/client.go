@@ -16,6 +16,7 @@ package notebook
 
 import (
 	"bytes"
+	"context"
 	"crypto/tls"
 	"encoding/json"
 	"fmt"
@@ -28,6 +29,8 @@ import (
 	"strings"
 
 	"github.com/Azure/go-ntlmssp"
+
+	"github.com/forcedesk/forcedesk-agent/internal/transport"
 )
 
 const (
@@ -67,12 +70,12 @@ func New(authMode string) *Client {
 	return &Client{
 		forcedMode: authMode,
 		formClient: &http.Client{
-			Transport: &http.Transport{TLSClientConfig: tlsCfg},
+			Transport: transport.New(tlsCfg),
 			Jar:       jar,
 		},
 		ntlmClient: &http.Client{
 			Transport: ntlmssp.Negotiator{
-				RoundTripper: &http.Transport{TLSClientConfig: tlsCfg},
+				RoundTripper: transport.New(tlsCfg),
 			},
 			Jar: ntlmJar,
 		},
@@ -81,24 +84,24 @@ func New(authMode string) *Client {
 
 // Login authenticates with the DET Notebooks service using the auth mode specified at construction.
 // With "" (auto) it tries NTLM first and falls back to form-based auth.
-func (c *Client) Login(username, password string) error {
+func (c *Client) Login(ctx context.Context, username, password string) error {
 	switch c.forcedMode {
 	case "ntlm":
-		return c.ntlmLogin(username, password)
+		return c.ntlmLogin(ctx, username, password)
 	case "form":
-		return c.formLogin(username, password)
+		return c.formLogin(ctx, username, password)
 	default:
-		if err := c.ntlmLogin(username, password); err == nil {
+		if err := c.ntlmLogin(ctx, username, password); err == nil {
 			return nil
 		}
-		return c.formLogin(username, password)
+		return c.formLogin(ctx, username, password)
 	}
 }
 
 // ntlmLogin authenticates by performing an NTLM-negotiated GET to the notebooks base URL.
 // Credentials are prepended with the domain ("EDU001\") as required by the F5 gateway.
-func (c *Client) ntlmLogin(username, password string) error {
-	req, err := http.NewRequest(http.MethodGet, baseURL, nil)
+func (c *Client) ntlmLogin(ctx context.Context, username, password string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, baseURL, nil)
 	if err != nil {
 		return err
 	}
@@ -123,9 +126,9 @@ func (c *Client) ntlmLogin(username, password string) error {
 
 // formLogin authenticates via the F5 BigIP handshake: GET base URL to seed session cookies,
 // then POST credentials to /my.policy.
-func (c *Client) formLogin(username, password string) error {
+func (c *Client) formLogin(ctx context.Context, username, password string) error {
 	// Step 1: GET base URL to initialise session cookies.
-	initReq, _ := http.NewRequest(http.MethodGet, baseURL, nil)
+	initReq, _ := http.NewRequestWithContext(ctx, http.MethodGet, baseURL, nil)
 	initReq.Header.Set("User-Agent", userAgent)
 
 	initResp, err := c.formClient.Do(initReq)
@@ -144,7 +147,7 @@ func (c *Client) formLogin(username, password string) error {
 
 	// Step 2: POST credentials to /my.policy.
 	formData := url.Values{"username": {username}, "password": {password}}
-	loginReq, _ := http.NewRequest(http.MethodPost, policyURL, strings.NewReader(formData.Encode()))
+	loginReq, _ := http.NewRequestWithContext(ctx, http.MethodPost, policyURL, strings.NewReader(formData.Encode()))
 	loginReq.Header.Set("User-Agent", userAgent)
 	loginReq.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 	loginReq.Header.Set("Referer", baseURL)
@@ -178,7 +181,7 @@ func (c *Client) formLogin(username, password string) error {
 }
 
 // request sends an authenticated request to the DET Notebooks API and returns the raw response body.
-func (c *Client) request(method, path string, data any) ([]byte, error) {
+func (c *Client) request(ctx context.Context, method, path string, data any) ([]byte, error) {
 	var bodyReader io.Reader
 	if data != nil {
 		b, err := json.Marshal(data)
@@ -191,7 +194,7 @@ func (c *Client) request(method, path string, data any) ([]byte, error) {
 	fullURL := apiBase + path
 	slog.Debug("notebooks: request", "method", strings.ToUpper(method), "url", fullURL)
 
-	req, err := http.NewRequest(strings.ToUpper(method), fullURL, bodyReader)
+	req, err := http.NewRequestWithContext(ctx, strings.ToUpper(method), fullURL, bodyReader)
 	if err != nil {
 		return nil, err
 	}
@@ -259,8 +262,8 @@ type FleetRecord struct {
 
 // GetCurrentFleet returns all notebook/device records for the given school.
 // Maps to GET /api/schools/{schoolId}/current-fleet.
-func (c *Client) GetCurrentFleet(schoolID string) ([]FleetRecord, error) {
-	b, err := c.request("GET", "/schools/"+url.PathEscape(schoolID)+"/current-fleet", nil)
+func (c *Client) GetCurrentFleet(ctx context.Context, schoolID string) ([]FleetRecord, error) {
+	b, err := c.request(ctx, "GET", "/schools/"+url.PathEscape(schoolID)+"/current-fleet", nil)
 	if err != nil {
 		return nil, err
 	}
@@ -269,8 +272,8 @@ func (c *Client) GetCurrentFleet(schoolID string) ([]FleetRecord, error) {
 
 // GetSchools returns the schools available to the authenticated user.
 // Maps to GET /api/schools.
-func (c *Client) GetSchools() ([]map[string]any, error) {
-	b, err := c.request("GET", "/schools", nil)
+func (c *Client) GetSchools(ctx context.Context) ([]map[string]any, error) {
+	b, err := c.request(ctx, "GET", "/schools", nil)
 	if err != nil {
 		return nil, err
 	}
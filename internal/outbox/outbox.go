@@ -0,0 +1,190 @@
+// Copyright © 2026 ForcePoint Software. All rights reserved.
+
+// Package outbox delivers uploads to the tenant durably. An upload that can't
+// be delivered because the tenant is unreachable or failing is stored in the
+// local database, sealed with the database key, and replayed in order by the
+// outbox task once the tenant is back. Uploads the tenant rejects outright
+// (4xx) are not queued; the caller gets the error.
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/forcedesk/forcedesk-agent/internal/config"
+	"github.com/forcedesk/forcedesk-agent/internal/db"
+	"github.com/forcedesk/forcedesk-agent/internal/errclass"
+	"github.com/forcedesk/forcedesk-agent/internal/scheduler"
+	"github.com/forcedesk/forcedesk-agent/internal/tenant"
+)
+
+// Kind selects how an upload is sent.
+type Kind string
+
+const (
+	KindJSON      Kind = "json"           // tenant.Client.PostJSON
+	KindEncrypted Kind = "encrypted-json" // tenant.Client.PostEncryptedJSON with the tenant encryption key
+)
+
+// replayBatch bounds how many uploads one replay run loads.
+const replayBatch = 100
+
+// sendTimeout bounds a delivery attempt made on a context the caller has
+// already cancelled.
+const sendTimeout = 30 * time.Second
+
+// Post delivers v, encoded as JSON, to the tenant endpoint path. If the
+// tenant can't take it now the upload is queued and queued is true; err is
+// then nil, as the outbox owns delivery from here. Uploads to an endpoint
+// that already has queued uploads are queued behind them so the tenant
+// receives them in order.
+//
+// An upload is queued even when ctx is already cancelled, so work that has
+// taken effect (e.g. passwords set in STMC) is never lost to a task timeout.
+func Post(ctx context.Context, tc *tenant.Client, kind Kind, path string, v any) (queued bool, err error) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return false, fmt.Errorf("marshal payload: %w", err)
+	}
+
+	backlog, err := db.HasPendingOutbox(path)
+	if err != nil {
+		slog.Error("outbox: failed to check backlog", "endpoint", path, "err", err)
+	}
+	if backlog {
+		return enqueue(path, kind, body, "queued behind earlier uploads")
+	}
+
+	if ctx.Err() != nil {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(context.WithoutCancel(ctx), sendTimeout)
+		defer cancel()
+	}
+	err = send(ctx, tc, kind, path, body)
+	if err == nil {
+		return false, nil
+	}
+	if !transient(err) {
+		return false, err
+	}
+	slog.Warn("outbox: tenant did not take upload, queued for retry", "endpoint", path, "err", err)
+	return enqueue(path, kind, body, err.Error())
+}
+
+func enqueue(path string, kind Kind, body []byte, reason string) (bool, error) {
+	id, err := db.EnqueueOutbox(path, string(kind), body, reason)
+	if err != nil {
+		return false, fmt.Errorf("queue upload: %w", err)
+	}
+	slog.Info("outbox: upload queued", "id", id, "endpoint", path, "size", len(body))
+	return true, nil
+}
+
+// send makes one delivery attempt. Any non-2xx answer is a *tenant.StatusError.
+func send(ctx context.Context, tc *tenant.Client, kind Kind, path string, body []byte) error {
+	var resp *http.Response
+	var err error
+	switch kind {
+	case KindJSON:
+		resp, err = tc.PostJSON(ctx, tenant.URL(path), json.RawMessage(body))
+	case KindEncrypted:
+		key, kerr := config.Get().Tenant.GetEncryptionKey()
+		if kerr != nil {
+			return fmt.Errorf("no encryption key: %w", kerr)
+		}
+		resp, err = tc.PostEncryptedJSON(ctx, tenant.URL(path), json.RawMessage(body), key)
+	default:
+		return fmt.Errorf("unknown upload kind %q", kind)
+	}
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return &tenant.StatusError{StatusCode: resp.StatusCode, URL: path}
+	}
+	return nil
+}
+
+// transient reports whether a failed delivery is worth retrying later.
+func transient(err error) bool {
+	return slices.Contains(errclass.Transient, errclass.Classify(err)) || errors.Is(err, context.Canceled)
+}
+
+// Replay delivers queued uploads oldest first. It stops at the first upload
+// the tenant still can't take, so later uploads never overtake earlier ones.
+// Uploads the tenant rejects, or that exceed [outbox] max_age or
+// max_attempts, are marked failed and skipped.
+func Replay(ctx context.Context) error {
+	cfg := config.Get().Outbox
+	if maxAge, err := time.ParseDuration(cfg.MaxAge); err == nil && maxAge > 0 {
+		n, err := db.ExpireOutbox(time.Now().Add(-maxAge), fmt.Sprintf("not delivered within %s", maxAge))
+		if err != nil {
+			return fmt.Errorf("expire uploads: %w", err)
+		}
+		if n > 0 {
+			slog.Error("outbox: gave up on expired uploads", "count", n, "max_age", maxAge)
+		}
+	}
+
+	items, err := db.PendingOutbox(replayBatch)
+	if err != nil {
+		return fmt.Errorf("load outbox: %w", err)
+	}
+	if len(items) == 0 {
+		scheduler.Summarize(ctx, "outbox empty")
+		return nil
+	}
+
+	tc := tenant.New()
+	var delivered, failed int
+	for _, it := range items {
+		err := send(ctx, tc, Kind(it.Kind), it.Endpoint, it.Payload)
+		if err == nil {
+			if err := db.DeleteOutbox(it.ID); err != nil {
+				return fmt.Errorf("remove delivered upload %d: %w", it.ID, err)
+			}
+			delivered++
+			slog.Info("outbox: upload delivered", "id", it.ID, "endpoint", it.Endpoint, "queued_for", time.Since(it.CreatedAt).Round(time.Second))
+			continue
+		}
+		if ctx.Err() != nil || errors.Is(err, tenant.ErrCircuitOpen) {
+			// Not a real attempt; try again next run.
+			scheduler.Summarize(ctx, "delivered: %d, failed: %d, tenant unreachable", delivered, failed)
+			return nil
+		}
+		if !transient(err) {
+			slog.Error("outbox: tenant rejected upload, giving up", "id", it.ID, "endpoint", it.Endpoint, "err", err)
+			if err := db.FailOutbox(it.ID, err.Error()); err != nil {
+				return fmt.Errorf("mark upload %d failed: %w", it.ID, err)
+			}
+			failed++
+			continue
+		}
+
+		if err := db.RecordOutboxAttempt(it.ID, time.Now(), err.Error()); err != nil {
+			return fmt.Errorf("record attempt for upload %d: %w", it.ID, err)
+		}
+		if cfg.MaxAttempts > 0 && it.Attempts+1 >= cfg.MaxAttempts {
+			slog.Error("outbox: upload not delivered after max attempts, giving up", "id", it.ID, "endpoint", it.Endpoint, "attempts", it.Attempts+1)
+			if err := db.FailOutbox(it.ID, fmt.Sprintf("not delivered after %d attempts: %v", it.Attempts+1, err)); err != nil {
+				return fmt.Errorf("mark upload %d failed: %w", it.ID, err)
+			}
+			failed++
+			continue
+		}
+		scheduler.Summarize(ctx, "delivered: %d, failed: %d, tenant still unavailable", delivered, failed)
+		return fmt.Errorf("upload %d to %s: %w", it.ID, it.Endpoint, err)
+	}
+
+	scheduler.Summarize(ctx, "delivered: %d, failed: %d", delivered, failed)
+	return nil
+}
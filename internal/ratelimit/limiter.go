@@ -3,6 +3,7 @@
 package ratelimit
 
 import (
+	"context"
 	"sync"
 	"time"
 )
@@ -58,9 +59,14 @@ func (l *Limiter) refill() {
 	}
 }
 
-// Wait blocks until the limiter allows an action.
-func (l *Limiter) Wait() {
+// Wait blocks until the limiter allows an action or ctx is cancelled.
+func (l *Limiter) Wait(ctx context.Context) error {
 	for !l.Allow() {
-		time.Sleep(100 * time.Millisecond)
+		select {
+		case <-time.After(100 * time.Millisecond):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
 	}
+	return nil
 }
@@ -0,0 +1,123 @@
+// Copyright © 2026 ForcePoint Software. All rights reserved.
+
+package scheduler
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// maxCalendarSkips bounds how many excluded days or blackout ranges
+// Calendar.Next will step over before giving up, so rules that exclude every
+// candidate can't spin.
+const maxCalendarSkips = 10000
+
+// DateRange is an inclusive range of calendar days, e.g. a school holiday.
+type DateRange struct {
+	From time.Time // first excluded day (midnight)
+	To   time.Time // last excluded day (midnight)
+}
+
+// ParseDateRange parses "2026-04-03" or "2026-04-03..2026-04-19" as a range of
+// whole days in loc.
+func ParseDateRange(s string, loc *time.Location) (DateRange, error) {
+	if loc == nil {
+		loc = time.Local
+	}
+	a, b, isRange := strings.Cut(strings.TrimSpace(s), "..")
+	from, err := time.ParseInLocation("2006-01-02", strings.TrimSpace(a), loc)
+	if err != nil {
+		return DateRange{}, fmt.Errorf("blackout %q: %w", s, err)
+	}
+	to := from
+	if isRange {
+		if to, err = time.ParseInLocation("2006-01-02", strings.TrimSpace(b), loc); err != nil {
+			return DateRange{}, fmt.Errorf("blackout %q: %w", s, err)
+		}
+		if to.Before(from) {
+			return DateRange{}, fmt.Errorf("blackout %q: end is before start", s)
+		}
+	}
+	return DateRange{From: from, To: to}, nil
+}
+
+// Contains reports whether t falls on a day within the range.
+func (r DateRange) Contains(t time.Time) bool {
+	t = t.In(r.From.Location())
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, r.From.Location())
+	return !day.Before(r.From) && !day.After(r.To)
+}
+
+// Calendar wraps a Schedule with school-calendar rules: fire times that fall
+// on a weekend (when WeekdaysOnly is set) or inside a blackout range are
+// skipped and the next candidate is used instead.
+type Calendar struct {
+	Schedule     Schedule
+	WeekdaysOnly bool
+	Blackouts    []DateRange
+	// Location is the zone weekday checks are made in. Defaults to the inner
+	// schedule's zone for Cron, otherwise the host's local time zone.
+	Location *time.Location
+}
+
+// Next returns the inner schedule's next fire time that is not excluded. An
+// excluded fire time skips the rest of its weekend day or blackout range in
+// one step, so a schedule firing every minute crosses a long holiday as
+// quickly as a daily one.
+func (c *Calendar) Next(after time.Time) time.Time {
+	loc := c.location()
+	t := after
+	for range maxCalendarSkips {
+		t = c.Schedule.Next(t)
+		if t.IsZero() {
+			return t
+		}
+		end := c.excludedUntil(t.In(loc))
+		if end.IsZero() {
+			return t
+		}
+		// Schedule.Next returns times strictly after its argument.
+		t = end.Add(-time.Nanosecond)
+	}
+	return time.Time{}
+}
+
+// excludedUntil returns the end of the excluded day or blackout range a
+// candidate fire time falls in, or zero if it isn't excluded.
+func (c *Calendar) excludedUntil(t time.Time) time.Time {
+	var end time.Time
+	if c.WeekdaysOnly && (t.Weekday() == time.Saturday || t.Weekday() == time.Sunday) {
+		end = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+	}
+	for _, b := range c.Blackouts {
+		if b.Contains(t) {
+			if e := b.To.AddDate(0, 0, 1); e.After(end) {
+				end = e
+			}
+		}
+	}
+	return end
+}
+
+func (c *Calendar) location() *time.Location {
+	if c.Location != nil {
+		return c.Location
+	}
+	if cr, ok := c.Schedule.(*Cron); ok {
+		return cr.Location()
+	}
+	return time.Local
+}
+
+// String describes the inner schedule and any calendar rules applied to it.
+func (c *Calendar) String() string {
+	s := c.Schedule.String()
+	if c.WeekdaysOnly {
+		s += ", weekdays only"
+	}
+	if n := len(c.Blackouts); n > 0 {
+		s += fmt.Sprintf(", %d blackout range(s)", n)
+	}
+	return s
+}
@@ -0,0 +1,259 @@
+// Copyright © 2026 ForcePoint Software. All rights reserved.
+
+package scheduler
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	// Embed the IANA time zone database so cron timezones resolve on Windows
+	// hosts, which have no zoneinfo directory for time.LoadLocation to read.
+	_ "time/tzdata"
+)
+
+// Schedule computes wall-clock fire times for tasks that must run at specific
+// times of day rather than on a fixed interval.
+type Schedule interface {
+	// Next returns the first fire time strictly after the given time, or the
+	// zero time if the schedule never fires again.
+	Next(after time.Time) time.Time
+	// String returns a human-readable description for the WebUI.
+	String() string
+}
+
+// Cron is a Schedule parsed from a standard five-field cron expression:
+//
+//	minute hour day-of-month month day-of-week
+//
+// Fields accept '*', single values, ranges (1-5), lists (1,15) and steps
+// (*/15, 8-18/2). Month and weekday names (jan, mon) are accepted, as are the
+// @hourly, @daily, @weekly, @monthly and @yearly shorthands. When both
+// day-of-month and day-of-week are restricted a day matching either fires,
+// matching Vixie cron.
+type Cron struct {
+	expr   string
+	loc    *time.Location
+	minute uint64
+	hour   uint64
+	dom    uint64
+	month  uint64
+	dow    uint64
+	// domStar/dowStar record whether the day fields were '*', which changes
+	// how they combine (see dayMatches).
+	domStar bool
+	dowStar bool
+}
+
+// cronField describes the valid range and aliases of one cron field.
+type cronField struct {
+	name     string
+	min, max int
+	names    map[string]int
+}
+
+var (
+	minuteField = cronField{name: "minute", min: 0, max: 59}
+	hourField   = cronField{name: "hour", min: 0, max: 23}
+	domField    = cronField{name: "day-of-month", min: 1, max: 31}
+	monthField  = cronField{name: "month", min: 1, max: 12, names: map[string]int{
+		"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+		"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+	}}
+	// Day-of-week accepts 0-7 where both 0 and 7 mean Sunday.
+	dowField = cronField{name: "day-of-week", min: 0, max: 7, names: map[string]int{
+		"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+	}}
+)
+
+var cronMacros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// ParseCron parses a cron expression evaluated in loc. A leading
+// "CRON_TZ=<zone>" or "TZ=<zone>" token overrides loc. A nil loc means the
+// host's local time zone.
+func ParseCron(expr string, loc *time.Location) (*Cron, error) {
+	if loc == nil {
+		loc = time.Local
+	}
+
+	spec := strings.TrimSpace(expr)
+	if strings.HasPrefix(spec, "CRON_TZ=") || strings.HasPrefix(spec, "TZ=") {
+		tz, rest, _ := strings.Cut(spec, " ")
+		_, name, _ := strings.Cut(tz, "=")
+		l, err := time.LoadLocation(name)
+		if err != nil {
+			return nil, fmt.Errorf("cron %q: time zone: %w", expr, err)
+		}
+		loc = l
+		spec = strings.TrimSpace(rest)
+	}
+	if m, ok := cronMacros[strings.ToLower(spec)]; ok {
+		spec = m
+	}
+
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("cron %q: expected 5 fields, got %d", expr, len(fields))
+	}
+
+	c := &Cron{expr: strings.TrimSpace(expr), loc: loc}
+	var err error
+	if c.minute, err = parseCronField(fields[0], minuteField); err != nil {
+		return nil, fmt.Errorf("cron %q: %w", expr, err)
+	}
+	if c.hour, err = parseCronField(fields[1], hourField); err != nil {
+		return nil, fmt.Errorf("cron %q: %w", expr, err)
+	}
+	if c.dom, err = parseCronField(fields[2], domField); err != nil {
+		return nil, fmt.Errorf("cron %q: %w", expr, err)
+	}
+	if c.month, err = parseCronField(fields[3], monthField); err != nil {
+		return nil, fmt.Errorf("cron %q: %w", expr, err)
+	}
+	if c.dow, err = parseCronField(fields[4], dowField); err != nil {
+		return nil, fmt.Errorf("cron %q: %w", expr, err)
+	}
+	// Fold day-of-week 7 onto 0 so Sunday has a single bit.
+	if c.dow&(1<<7) != 0 {
+		c.dow = (c.dow &^ (1 << 7)) | 1
+	}
+	c.domStar = fields[2] == "*" || fields[2] == "?"
+	c.dowStar = fields[4] == "*" || fields[4] == "?"
+	return c, nil
+}
+
+// parseCronField converts one comma-separated cron field into a bit set.
+func parseCronField(field string, f cronField) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		rangePart, stepPart, hasStep := strings.Cut(part, "/")
+
+		step := 1
+		if hasStep {
+			n, err := strconv.Atoi(stepPart)
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("%s: invalid step %q", f.name, stepPart)
+			}
+			step = n
+		}
+
+		lo, hi := f.min, f.max
+		switch {
+		case rangePart == "*" || rangePart == "?":
+			// Full range.
+		case strings.Contains(rangePart, "-"):
+			a, b, _ := strings.Cut(rangePart, "-")
+			var err error
+			if lo, err = cronValue(a, f); err != nil {
+				return 0, err
+			}
+			if hi, err = cronValue(b, f); err != nil {
+				return 0, err
+			}
+			if lo > hi {
+				return 0, fmt.Errorf("%s: range %q is reversed", f.name, rangePart)
+			}
+		default:
+			v, err := cronValue(rangePart, f)
+			if err != nil {
+				return 0, err
+			}
+			lo = v
+			// "5/10" means starting at 5, every 10, through the end of the range.
+			if hasStep {
+				hi = f.max
+			} else {
+				hi = v
+			}
+		}
+
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+// cronValue parses a single numeric or named value and checks it is in range.
+func cronValue(s string, f cronField) (int, error) {
+	if v, ok := f.names[strings.ToLower(s)]; ok {
+		return v, nil
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("%s: invalid value %q", f.name, s)
+	}
+	if v < f.min || v > f.max {
+		return 0, fmt.Errorf("%s: %d out of range %d-%d", f.name, v, f.min, f.max)
+	}
+	return v, nil
+}
+
+// Location returns the time zone the expression is evaluated in.
+func (c *Cron) Location() *time.Location { return c.loc }
+
+// String returns the original expression plus its time zone.
+func (c *Cron) String() string {
+	return fmt.Sprintf("cron %s (%s)", c.expr, c.loc)
+}
+
+// Next returns the first minute strictly after the given time that matches
+// every field. Searches at most five years ahead so an impossible expression
+// such as "0 0 30 2 *" returns the zero time rather than looping forever.
+func (c *Cron) Next(after time.Time) time.Time {
+	loc := c.loc
+	t := after.In(loc)
+	t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), 0, 0, loc).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+
+	for t.Before(limit) {
+		if c.month&(1<<uint(t.Month())) == 0 {
+			t = forward(t, time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc))
+			continue
+		}
+		if !c.dayMatches(t) {
+			t = forward(t, time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc))
+			continue
+		}
+		if c.hour&(1<<uint(t.Hour())) == 0 {
+			t = forward(t, time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc))
+			continue
+		}
+		if c.minute&(1<<uint(t.Minute())) == 0 {
+			t = forward(t, time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute()+1, 0, 0, loc))
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+// dayMatches applies the Vixie cron rule: when either day field is '*' both
+// must match, otherwise a match on either field is enough.
+func (c *Cron) dayMatches(t time.Time) bool {
+	domOK := c.dom&(1<<uint(t.Day())) != 0
+	dowOK := c.dow&(1<<uint(t.Weekday())) != 0
+	if c.domStar || c.dowStar {
+		return domOK && dowOK
+	}
+	return domOK || dowOK
+}
+
+// forward returns next, unless a daylight-saving fold made time.Date resolve
+// to an instant at or before cur, in which case it steps one minute past cur
+// so the search always makes progress.
+func forward(cur, next time.Time) time.Time {
+	if !next.After(cur) {
+		return cur.Add(time.Minute)
+	}
+	return next
+}
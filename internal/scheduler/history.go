@@ -0,0 +1,119 @@
+// Copyright © 2026 ForcePoint Software. All rights reserved.
+
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// Outcome classifies how a task run ended.
+type Outcome string
+
+const (
+	OutcomeOK             Outcome = "ok"
+	OutcomeError          Outcome = "error"
+	OutcomePanic          Outcome = "panic"
+	OutcomeSkippedOverlap Outcome = "skipped-overlap"
+	// OutcomeAbandoned marks a stuck run the watchdog gave up on.
+	OutcomeAbandoned Outcome = "abandoned"
+)
+
+// Run is one dispatch of a task as stored in the run history.
+type Run struct {
+	Task    string
+	Start   time.Time
+	End     time.Time
+	Outcome Outcome
+	Error   string
+	Summary string
+	// Interval is the task's interval when it ran; zero for a task on a
+	// calendar schedule.
+	Interval time.Duration
+}
+
+// Recorder persists task runs so history survives restarts.
+type Recorder interface {
+	// RecordRun stores a completed or skipped run.
+	RecordRun(run Run) error
+	// LastRuns returns the most recent non-skipped run of each task.
+	LastRuns() ([]Run, error)
+}
+
+// record hands a run to the Recorder, if any. Failures are logged rather than
+// returned so a database problem never affects task execution.
+func (s *Scheduler) record(run Run) {
+	if s.Recorder == nil {
+		return
+	}
+	if err := s.Recorder.RecordRun(run); err != nil {
+		slog.Error("scheduler: failed to record task run", "task", run.Task, "err", err)
+	}
+}
+
+// restoreLastRuns seeds each task's last-run state from the Recorder so the
+// WebUI shows the previous outcome immediately after a restart.
+func (s *Scheduler) restoreLastRuns() {
+	if s.Recorder == nil {
+		return
+	}
+	runs, err := s.Recorder.LastRuns()
+	if err != nil {
+		slog.Error("scheduler: failed to load task run history", "err", err)
+		return
+	}
+
+	last := make(map[string]Run, len(runs))
+	for _, r := range runs {
+		last[r.Task] = r
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, t := range s.tasks {
+		r, ok := last[t.Name]
+		if !ok {
+			continue
+		}
+		t.stateMu.Lock()
+		t.lastRun = r.Start
+		t.lastEnd = r.End
+		t.lastOutcome = r.Outcome
+		t.lastError = r.Error
+		t.lastSummary = r.Summary
+		if r.Outcome == OutcomePanic {
+			t.lastPanic = r.Error
+		}
+		t.stateMu.Unlock()
+	}
+}
+
+// runKey is the context key under which dispatch stores the current run.
+type runKey struct{}
+
+// runInfo collects the result a task reports about its current run.
+type runInfo struct {
+	mu      sync.Mutex
+	summary string
+}
+
+func (r *runInfo) get() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.summary
+}
+
+// Summarize attaches a short result description, e.g. "devices dispatched: 14",
+// to the run that owns ctx. Later calls replace earlier ones. Outside a
+// scheduled run (e.g. the CLI or a command-queue job) it does nothing.
+func Summarize(ctx context.Context, format string, args ...any) {
+	r, ok := ctx.Value(runKey{}).(*runInfo)
+	if !ok {
+		return
+	}
+	r.mu.Lock()
+	r.summary = fmt.Sprintf(format, args...)
+	r.mu.Unlock()
+}
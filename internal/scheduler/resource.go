@@ -0,0 +1,203 @@
+// Copyright © 2026 ForcePoint Software. All rights reserved.
+
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sync"
+)
+
+// ResourceState is a point-in-time snapshot of a resource lock, returned by
+// Scheduler.Resources for the WebUI and control API.
+type ResourceState struct {
+	Name     string   `json:"name"`
+	Capacity int      `json:"capacity"`
+	Holders  []string `json:"holders"` // tasks and jobs holding a slot
+	Waiting  []string `json:"waiting"` // tasks and jobs queued for a slot, oldest first
+}
+
+// resource is a named counting semaphore shared by tasks and ad-hoc jobs.
+// Waiters are granted slots strictly in arrival order.
+type resource struct {
+	name string
+
+	mu       sync.Mutex
+	capacity int
+	holders  []string
+	waiters  []*waiter
+}
+
+type waiter struct {
+	holder string
+	ready  chan struct{} // closed once the slot is granted
+}
+
+// SetResource defines a named resource lock that allows at most capacity
+// concurrent holders, e.g. "stmc" with capacity 2 so no more than two STMC
+// sessions are open at once. Calling it again changes the capacity; queued
+// work is admitted at once if the new capacity allows.
+func (s *Scheduler) SetResource(name string, capacity int) {
+	if capacity < 1 {
+		capacity = 1
+	}
+	s.mu.Lock()
+	if s.resources == nil {
+		s.resources = make(map[string]*resource)
+	}
+	r, ok := s.resources[name]
+	if !ok {
+		r = &resource{name: name}
+		s.resources[name] = r
+	}
+	s.mu.Unlock()
+
+	r.mu.Lock()
+	r.capacity = capacity
+	r.grant()
+	r.mu.Unlock()
+}
+
+// Resources returns a snapshot of every defined resource lock.
+func (s *Scheduler) Resources() []ResourceState {
+	s.mu.RLock()
+	names := make([]string, 0, len(s.resources))
+	for name := range s.resources {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	rs := make([]*resource, len(names))
+	for i, name := range names {
+		rs[i] = s.resources[name]
+	}
+	s.mu.RUnlock()
+
+	states := make([]ResourceState, len(rs))
+	for i, r := range rs {
+		r.mu.Lock()
+		st := ResourceState{
+			Name:     r.name,
+			Capacity: r.capacity,
+			Holders:  slices.Clone(r.holders),
+			Waiting:  make([]string, len(r.waiters)),
+		}
+		for j, w := range r.waiters {
+			st.Waiting[j] = w.holder
+		}
+		r.mu.Unlock()
+		states[i] = st
+	}
+	return states
+}
+
+// Acquire blocks until holder has a slot on every named resource of the
+// scheduler that owns ctx, or ctx is done. Call the returned release func
+// when the work is finished. Names the scheduler has not defined impose no
+// limit. Outside a scheduler (e.g. the CLI) it returns immediately.
+//
+// Ad-hoc jobs started with Go use this to share limits with scheduled tasks;
+// tasks declare theirs in Task.Resources instead.
+func Acquire(ctx context.Context, holder string, names ...string) (release func(), err error) {
+	s, ok := ctx.Value(schedulerKey{}).(*Scheduler)
+	if !ok {
+		return func() {}, nil
+	}
+	return s.acquire(ctx, holder, names, nil)
+}
+
+// acquire takes a slot on each resource in name order, so two holders that
+// need the same resources can never deadlock. onWait, if set, is called with
+// the resource name whenever acquisition has to queue, and with "" once all
+// slots are held.
+func (s *Scheduler) acquire(ctx context.Context, holder string, names []string, onWait func(name string)) (func(), error) {
+	names = slices.Clone(names)
+	slices.Sort(names)
+	names = slices.Compact(names)
+
+	var held []*resource
+	release := func() {
+		for i := len(held) - 1; i >= 0; i-- {
+			held[i].release(holder)
+		}
+	}
+
+	for _, name := range names {
+		s.mu.RLock()
+		r := s.resources[name]
+		s.mu.RUnlock()
+		if r == nil {
+			slog.Debug("scheduler: resource not defined, not limiting", "resource", name, "holder", holder)
+			continue
+		}
+		if err := r.acquire(ctx, holder, onWait); err != nil {
+			release()
+			return nil, fmt.Errorf("waiting for resource %s: %w", name, err)
+		}
+		held = append(held, r)
+	}
+	if onWait != nil {
+		onWait("")
+	}
+	return release, nil
+}
+
+func (r *resource) acquire(ctx context.Context, holder string, onWait func(name string)) error {
+	r.mu.Lock()
+	if len(r.waiters) == 0 && len(r.holders) < r.capacity {
+		r.holders = append(r.holders, holder)
+		r.mu.Unlock()
+		return nil
+	}
+	w := &waiter{holder: holder, ready: make(chan struct{})}
+	r.waiters = append(r.waiters, w)
+	queued := len(r.waiters)
+	r.mu.Unlock()
+
+	slog.Info("scheduler: waiting for resource", "resource", r.name, "holder", holder, "position", queued)
+	if onWait != nil {
+		onWait(r.name)
+	}
+
+	select {
+	case <-w.ready:
+		return nil
+	case <-ctx.Done():
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		select {
+		case <-w.ready:
+			// Granted just as ctx ended; hand the slot to the next waiter.
+			r.remove(holder)
+			r.grant()
+		default:
+			r.waiters = slices.DeleteFunc(r.waiters, func(x *waiter) bool { return x == w })
+		}
+		return ctx.Err()
+	}
+}
+
+func (r *resource) release(holder string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.remove(holder)
+	r.grant()
+}
+
+// remove drops one slot held by holder. Callers must hold r.mu.
+func (r *resource) remove(holder string) {
+	if i := slices.Index(r.holders, holder); i >= 0 {
+		r.holders = slices.Delete(r.holders, i, i+1)
+	}
+}
+
+// grant admits queued waiters while slots are free. Callers must hold r.mu.
+func (r *resource) grant() {
+	for len(r.waiters) > 0 && len(r.holders) < r.capacity {
+		w := r.waiters[0]
+		r.waiters = r.waiters[1:]
+		r.holders = append(r.holders, w.holder)
+		close(w.ready)
+	}
+}
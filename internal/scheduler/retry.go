@@ -0,0 +1,122 @@
+// Copyright © 2026 ForcePoint Software. All rights reserved.
+
+package scheduler
+
+import (
+	"log/slog"
+	"math"
+	"math/rand/v2"
+	"slices"
+	"time"
+
+	"github.com/forcedesk/forcedesk-agent/internal/errclass"
+)
+
+// RetryPolicy makes the scheduler retry a failed run before its next regular
+// run is due. Retry n (n ≥ 1) waits BaseDelay × Factor^(n-1), capped at
+// MaxDelay, plus a random jitter. A retry that would not happen before the
+// next regular run is dropped; that run is the retry.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts including the first.
+	// Values below 2 disable retries.
+	MaxAttempts int
+	BaseDelay   time.Duration
+	// Factor multiplies the delay after each retry. Zero means 2.
+	Factor float64
+	// MaxDelay caps the delay before jitter. Zero means no cap.
+	MaxDelay time.Duration
+	// Jitter adds a random duration in [0, Jitter) to each delay so agents
+	// that failed together don't retry together.
+	Jitter time.Duration
+	// RetryOn lists the error classes worth retrying. Empty means
+	// errclass.Transient.
+	RetryOn []errclass.Class
+}
+
+// RetryState describes a pending retry, for the WebUI and control API.
+type RetryState struct {
+	Attempt     int            `json:"attempt"` // number of the attempt that will run
+	MaxAttempts int            `json:"max_attempts"`
+	At          time.Time      `json:"at"`
+	Class       errclass.Class `json:"class"` // class of the error that caused it
+}
+
+// delay returns how long to wait after the given failed attempt (1-based).
+func (p *RetryPolicy) delay(attempt int) time.Duration {
+	factor := p.Factor
+	if factor == 0 {
+		factor = 2
+	}
+	d := time.Duration(float64(p.BaseDelay) * math.Pow(factor, float64(attempt-1)))
+	if p.MaxDelay > 0 && (d > p.MaxDelay || d < 0) {
+		d = p.MaxDelay
+	}
+	if p.Jitter > 0 {
+		d += rand.N(p.Jitter)
+	}
+	return d
+}
+
+// retries reports whether errors of class c are retried.
+func (p *RetryPolicy) retries(c errclass.Class) bool {
+	on := p.RetryOn
+	if len(on) == 0 {
+		on = errclass.Transient
+	}
+	return slices.Contains(on, c)
+}
+
+// scheduleRetry arranges a retry after a failed run if the task's policy
+// allows one, and reports whether it did, in which case the caller must wake
+// the task's loop. Callers must hold t.stateMu.
+func (t *Task) scheduleRetry(err error) bool {
+	p := t.Retry
+	if p == nil || p.MaxAttempts < 2 {
+		return false
+	}
+	class := errclass.Classify(err)
+	if !p.retries(class) {
+		slog.Debug("scheduler: error class not retried", "task", t.Name, "class", class)
+		return false
+	}
+	if t.attempt >= p.MaxAttempts {
+		slog.Warn("scheduler: task retries exhausted", "task", t.Name, "attempts", t.attempt)
+		return false
+	}
+	at := time.Now().Add(p.delay(t.attempt))
+	if !t.nextRun.IsZero() && !at.Before(t.nextRun) {
+		slog.Info("scheduler: next regular run is sooner than a retry, not retrying", "task", t.Name, "next_run", t.nextRun)
+		return false
+	}
+	t.retryAt = at
+	t.retryClass = class
+	slog.Info("scheduler: task will be retried", "task", t.Name, "attempt", t.attempt+1, "max_attempts", p.MaxAttempts, "at", at, "class", class)
+	return true
+}
+
+// pendingRetry returns when the task's next retry is due, or zero.
+func (t *Task) pendingRetry() time.Time {
+	t.stateMu.RLock()
+	defer t.stateMu.RUnlock()
+	return t.retryAt
+}
+
+// dispatchRetry starts the pending retry of a task, unless it is paused or
+// already running.
+func (s *Scheduler) dispatchRetry(t *Task) {
+	t.stateMu.Lock()
+	attempt := t.attempt + 1
+	t.retryAt = time.Time{}
+	paused := t.paused
+	t.stateMu.Unlock()
+	if paused {
+		slog.Debug("scheduler: skipping retry of paused task", "task", t.Name)
+		return
+	}
+
+	if !s.start(t, attempt) {
+		slog.Info("scheduler: skipping retry, task already running", "task", t.Name)
+		return
+	}
+	slog.Info("scheduler: retrying task", "task", t.Name, "attempt", attempt)
+}
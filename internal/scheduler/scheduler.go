@@ -3,74 +3,254 @@
 package scheduler
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"hash/fnv"
 	"log/slog"
+	"math/rand/v2"
+	"runtime/pprof"
+	"slices"
+	"strconv"
 	"sync"
 	"time"
+
+	"github.com/forcedesk/forcedesk-agent/internal/errclass"
+)
+
+// DefaultStopTimeout bounds how long Stop waits for in-flight tasks after
+// cancelling their contexts. Kept well inside the Windows SCM stop window.
+const DefaultStopTimeout = 15 * time.Second
+
+// Errors returned by the runtime control methods.
+var (
+	ErrUnknownTask    = errors.New("unknown task")
+	ErrAlreadyRunning = errors.New("task is already running")
+	ErrNotInterval    = errors.New("task runs on a calendar schedule, not an interval")
+	ErrStopped        = errors.New("scheduler is stopping")
 )
 
+// MinInterval is the shortest interval SetInterval accepts.
+const MinInterval = time.Second
+
+// scheduleRecheck is how long a task whose schedule has no fire time in
+// sight waits before asking it again, so the task isn't parked for good.
+const scheduleRecheck = time.Hour
+
 // TaskState is a point-in-time snapshot of a task's runtime state,
 // returned by Scheduler.States for the WebUI status API.
 type TaskState struct {
-	Name      string     `json:"name"`
-	Interval  string     `json:"interval"`
-	LastRun   *time.Time `json:"last_run"`
-	LastEnd   *time.Time `json:"last_end"`
-	Duration  string     `json:"duration"`
-	NextRun   *time.Time `json:"next_run"`
-	Running   bool       `json:"running"`
-	RunCount  int64      `json:"run_count"`
-	LastPanic string     `json:"last_panic"`
-}
-
-// Task is a named function that runs on a fixed interval.
+	Name        string      `json:"name"`
+	Interval    string      `json:"interval"`
+	Schedule    string      `json:"schedule"`
+	LastRun     *time.Time  `json:"last_run"`
+	LastEnd     *time.Time  `json:"last_end"`
+	Duration    string      `json:"duration"`
+	NextRun     *time.Time  `json:"next_run"`
+	Running     bool        `json:"running"`
+	Paused      bool        `json:"paused"`
+	Waiting     string      `json:"waiting,omitempty"` // resource the current run is queued for
+	Stuck       bool        `json:"stuck"`             // the current run was flagged by the watchdog
+	StuckStack  string      `json:"stuck_stack,omitempty"`
+	Abandoned   int         `json:"abandoned,omitempty"` // abandoned runs whose goroutines are still alive
+	Attempt     int         `json:"attempt,omitempty"`   // attempt number of the current run when it is a retry
+	Retry       *RetryState `json:"retry,omitempty"`     // pending retry after a failed run
+	RunCount    int64       `json:"run_count"`
+	LastPanic   string      `json:"last_panic"`
+	LastOutcome Outcome     `json:"last_outcome"`
+	LastError   string      `json:"last_error"`
+	LastSummary string      `json:"last_summary"`
+}
+
+// Task is a named function that runs on a fixed interval, or at the wall-clock
+// times produced by Schedule when one is set.
 type Task struct {
 	Name     string
 	Interval time.Duration
-	Fn       func()
+	// Schedule, when non-nil, replaces Interval. Scheduled tasks do not fire on
+	// start; they wait for the first time the schedule produces.
+	Schedule Schedule
+	// Timeout cancels the run's context after this long. Zero means the run is
+	// only cancelled when the scheduler stops.
+	Timeout time.Duration
+	// InitialDelay postpones the first run of an interval task after Start
+	// (or after Add on a running scheduler). The fleet spread offset, if any,
+	// is added on top.
+	InitialDelay time.Duration
+	// Jitter delays every run by a random duration in [0, Jitter). Interval
+	// tasks keep their cadence; the jitter is not carried into the next run.
+	Jitter time.Duration
+	// Resources names the resource locks (see SetResource) each run holds.
+	// A run waits for a free slot on every one before Fn is called; the wait
+	// counts towards Timeout.
+	Resources []string
+	// Retry, when set, retries a failed run with backoff before the next
+	// regular run is due.
+	Retry *RetryPolicy
+	// Fn performs one run. A non-nil error marks the run as failed in the
+	// run history; Summarize attaches a short result description.
+	Fn func(ctx context.Context) error
 
-	mu sync.Mutex // Prevents overlapping executions of the same task.
+	// stateMu guards the fields below. It is never held while Fn runs, so the
+	// WebUI can read state while a task is mid-execution.
+	stateMu sync.RWMutex
+	// current is the run in progress, or nil. A new run only starts once it
+	// is cleared, which prevents overlapping executions of the same task.
+	current *activeRun
+	// abandoned lists runs the watchdog gave up on whose goroutines have not
+	// returned yet.
+	abandoned   []*activeRun
+	lastRun     time.Time
+	lastEnd     time.Time
+	nextRun     time.Time
+	waiting     string
+	paused      bool
+	runCount    int64
+	lastPanic   string
+	lastOutcome Outcome
+	lastError   string
+	lastSummary string
+	// attempt is the attempt number of the current or last run: 1 for a
+	// regular run, higher for retries. retryAt is when the next retry is due,
+	// zero if none is pending; retryClass is the error class that caused it.
+	attempt    int
+	retryAt    time.Time
+	retryClass errclass.Class
+	// skipRecorded is set once an overlap skip has been recorded for the
+	// current run, so a short-interval task blocked by a long run records one
+	// skip rather than one per tick.
+	skipRecorded bool
 
-	// stateMu guards the fields below; separate from mu so the WebUI can read
-	// state while a task is mid-execution without deadlocking.
-	stateMu   sync.RWMutex
-	lastRun   time.Time
-	lastEnd   time.Time
-	nextRun   time.Time
-	running   bool
-	runCount  int64
-	lastPanic string
+	// reset wakes the task's loop after its timing changes so the new
+	// interval or schedule applies immediately; wake makes it pick up a newly
+	// scheduled retry; quit is closed by Remove.
+	reset chan struct{}
+	wake  chan struct{}
+	quit  chan struct{}
 }
 
-// Scheduler runs a set of Tasks on fixed intervals.
+// Scheduler runs a set of Tasks on fixed intervals or calendar schedules.
+// Tasks can be added, removed and retimed while it is running.
 type Scheduler struct {
+	mu        sync.RWMutex // Guards tasks and started.
 	tasks     []*Task
+	started   bool
 	stopCh    chan struct{}
 	tickerWg  sync.WaitGroup // Tracks one goroutine per task ticker loop.
-	taskWg    sync.WaitGroup // Tracks all running task invocations.
+	taskWg    sync.WaitGroup // Tracks all running task invocations and Go goroutines.
 	startedAt time.Time
+
+	// ctx is the root of every task context; cancel is called by Stop so
+	// in-flight work unwinds instead of running to completion.
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// StopTimeout bounds how long Stop waits for in-flight work after
+	// cancellation. Defaults to DefaultStopTimeout.
+	StopTimeout time.Duration
+
+	// Recorder, when set, persists every dispatch and seeds task state from
+	// the last recorded runs on Start. Must be set before Start.
+	Recorder Recorder
+
+	// spreadKey and spreadWindow set the fleet spread; see SetSpread.
+	// Guarded by mu.
+	spreadKey    string
+	spreadWindow time.Duration
+
+	// resources holds the locks defined by SetResource. Guarded by mu.
+	resources map[string]*resource
+
+	// watchdog holds the settings from SetWatchdog. Guarded by mu.
+	watchdog Watchdog
+}
+
+// Timing is the part of a Task that Reschedule can change at runtime.
+type Timing struct {
+	Interval     time.Duration
+	Schedule     Schedule // when non-nil, replaces Interval
+	Timeout      time.Duration
+	InitialDelay time.Duration // only takes effect when the task's loop next starts
+	Jitter       time.Duration
+}
+
+// Validate reports why tm can't be given to a task, if it can't.
+func (tm Timing) Validate() error {
+	if tm.Schedule == nil && tm.Interval < MinInterval {
+		return fmt.Errorf("interval %s is shorter than the minimum of %s", tm.Interval, MinInterval)
+	}
+	return nil
 }
 
 // New creates an empty Scheduler.
 func New() *Scheduler {
-	return &Scheduler{
-		stopCh: make(chan struct{}),
+	s := &Scheduler{
+		stopCh:      make(chan struct{}),
+		StopTimeout: DefaultStopTimeout,
 	}
+	s.ctx, s.cancel = context.WithCancel(context.WithValue(context.Background(), schedulerKey{}, s))
+	return s
 }
 
-// Add registers a task. Must be called before Start.
+// Add registers a task. Tasks added after Start begin running immediately.
+// A task whose name is already registered is ignored.
 func (s *Scheduler) Add(t *Task) {
+	t.reset = make(chan struct{}, 1)
+	t.wake = make(chan struct{}, 1)
+	t.quit = make(chan struct{})
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, existing := range s.tasks {
+		if existing.Name == t.Name {
+			slog.Warn("scheduler: task already registered, ignoring", "task", t.Name)
+			return
+		}
+	}
 	s.tasks = append(s.tasks, t)
+	if s.started {
+		s.tickerWg.Add(1)
+		go s.loop(t)
+	}
+}
+
+// Remove unregisters the named task and stops its loop. A run already in
+// progress finishes normally and is still waited for by Stop.
+func (s *Scheduler) Remove(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, t := range s.tasks {
+		if t.Name == name {
+			s.tasks = append(s.tasks[:i:i], s.tasks[i+1:]...)
+			close(t.quit)
+			slog.Info("scheduler: task removed", "task", name)
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s", ErrUnknownTask, name)
+}
+
+// Has reports whether a task with the given name is registered.
+func (s *Scheduler) Has(name string) bool {
+	_, err := s.task(name)
+	return err == nil
 }
 
 // Start launches the ticker loops for all registered tasks.
-// Each task also fires once immediately on start.
+// Interval tasks also fire once immediately on start.
 func (s *Scheduler) Start() {
 	s.startedAt = time.Now()
+	s.restoreLastRuns()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.started = true
 	for _, t := range s.tasks {
 		s.tickerWg.Add(1)
 		go s.loop(t)
 	}
+	s.tickerWg.Add(1)
+	go s.watch()
 }
 
 // StartedAt returns the time the scheduler was started.
@@ -78,26 +258,199 @@ func (s *Scheduler) StartedAt() time.Time {
 	return s.startedAt
 }
 
-// Stop signals all ticker loops to exit and waits for all in-flight task invocations to finish.
+// Stop signals all ticker loops to exit, cancels the context of every
+// in-flight task and waits up to StopTimeout for them to return. Work that
+// ignores its context is abandoned so a service stop never hangs.
 func (s *Scheduler) Stop() {
 	close(s.stopCh)
+	s.cancel()
 	s.tickerWg.Wait()
-	s.taskWg.Wait()
+
+	done := make(chan struct{})
+	go func() {
+		s.taskWg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(s.StopTimeout):
+		var running []string
+		for _, st := range s.States() {
+			if st.Running {
+				running = append(running, st.Name)
+			}
+		}
+		slog.Warn("scheduler: stop timed out, abandoning in-flight work", "timeout", s.StopTimeout, "running", running)
+	}
+}
+
+// task returns the registered task with the given name.
+func (s *Scheduler) task(name string) (*Task, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, t := range s.tasks {
+		if t.Name == name {
+			return t, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s", ErrUnknownTask, name)
+}
+
+// Pause stops the named task from being dispatched by its interval or
+// schedule until Resume is called. A run already in progress is not
+// interrupted, and RunNow still works while paused. Pausing is not persisted
+// across restarts.
+func (s *Scheduler) Pause(name string) error {
+	return s.setPaused(name, true)
+}
+
+// Resume re-enables dispatch of a paused task from its next tick.
+func (s *Scheduler) Resume(name string) error {
+	return s.setPaused(name, false)
+}
+
+func (s *Scheduler) setPaused(name string, paused bool) error {
+	t, err := s.task(name)
+	if err != nil {
+		return err
+	}
+	t.stateMu.Lock()
+	t.paused = paused
+	t.stateMu.Unlock()
+	slog.Info("scheduler: task paused state changed", "task", name, "paused", paused)
+	return nil
+}
+
+// RunNow dispatches the named task immediately, outside its normal schedule.
+// Returns ErrAlreadyRunning if the previous run has not finished yet.
+func (s *Scheduler) RunNow(name string) error {
+	t, err := s.task(name)
+	if err != nil {
+		return err
+	}
+	if s.ctx.Err() != nil {
+		return ErrStopped
+	}
+	if !s.start(t, 1) {
+		return fmt.Errorf("%w: %s", ErrAlreadyRunning, name)
+	}
+	slog.Info("scheduler: task triggered manually", "task", name)
+	return nil
+}
+
+// SetInterval changes how often an interval task runs. The new interval takes
+// effect immediately: the next run is due one interval from now. The override
+// is not persisted across restarts.
+func (s *Scheduler) SetInterval(name string, d time.Duration) error {
+	t, err := s.task(name)
+	if err != nil {
+		return err
+	}
+	t.stateMu.RLock()
+	scheduled := t.Schedule != nil
+	t.stateMu.RUnlock()
+	if scheduled {
+		return fmt.Errorf("%w: %s", ErrNotInterval, name)
+	}
+	tm := t.currentTiming()
+	tm.Interval = d
+	return s.Reschedule(name, tm)
+}
+
+// Reschedule replaces a task's timing. The loop picks the change up
+// immediately; a run already in progress keeps its original timeout.
+func (s *Scheduler) Reschedule(name string, tm Timing) error {
+	t, err := s.task(name)
+	if err != nil {
+		return err
+	}
+	if err := tm.Validate(); err != nil {
+		return err
+	}
+
+	t.stateMu.Lock()
+	t.Interval = tm.Interval
+	t.Schedule = tm.Schedule
+	t.Timeout = tm.Timeout
+	t.InitialDelay = tm.InitialDelay
+	t.Jitter = tm.Jitter
+	t.stateMu.Unlock()
+
+	select {
+	case t.reset <- struct{}{}:
+	default:
+	}
+	if tm.Schedule != nil {
+		slog.Info("scheduler: task rescheduled", "task", name, "schedule", tm.Schedule.String(), "timeout", tm.Timeout, "jitter", tm.Jitter)
+	} else {
+		slog.Info("scheduler: task rescheduled", "task", name, "interval", tm.Interval, "timeout", tm.Timeout, "jitter", tm.Jitter)
+	}
+	return nil
+}
+
+// SetSpread enables the fleet spread: the first run of each interval task is
+// offset by a fixed amount in [0, min(window, Interval)) derived from key and
+// the task name. Using the agent UUID as key gives every agent its own stable
+// offsets, so a fleet restarted together spreads its load evenly over the
+// window instead of hitting the server in the same second. A zero window
+// disables the spread. Changes apply to loops started afterwards, i.e. tasks
+// added later and every task on the next Start.
+func (s *Scheduler) SetSpread(key string, window time.Duration) {
+	s.mu.Lock()
+	s.spreadKey = key
+	s.spreadWindow = window
+	s.mu.Unlock()
+}
+
+// firstRunDelay returns how long an interval task waits before its first run.
+func (s *Scheduler) firstRunDelay(t *Task) time.Duration {
+	t.stateMu.RLock()
+	delay, interval := t.InitialDelay, t.Interval
+	t.stateMu.RUnlock()
+
+	s.mu.RLock()
+	key, window := s.spreadKey, s.spreadWindow
+	s.mu.RUnlock()
+
+	window = min(window, interval)
+	if window <= 0 {
+		return delay
+	}
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	h.Write([]byte{0})
+	h.Write([]byte(t.Name))
+	return delay + time.Duration(h.Sum64()%uint64(window))
 }
 
 // States returns a snapshot of each registered task's current state.
 // Safe to call concurrently with running tasks.
 func (s *Scheduler) States() []TaskState {
-	states := make([]TaskState, len(s.tasks))
-	for i, t := range s.tasks {
+	s.mu.RLock()
+	tasks := append([]*Task(nil), s.tasks...)
+	s.mu.RUnlock()
+
+	states := make([]TaskState, len(tasks))
+	for i, t := range tasks {
 		t.stateMu.RLock()
 
 		state := TaskState{
-			Name:      t.Name,
-			Interval:  t.Interval.String(),
-			Running:   t.running,
-			RunCount:  t.runCount,
-			LastPanic: t.lastPanic,
+			Name:        t.Name,
+			Running:     t.current != nil,
+			Paused:      t.paused,
+			Waiting:     t.waiting,
+			Abandoned:   len(t.abandoned),
+			RunCount:    t.runCount,
+			LastPanic:   t.lastPanic,
+			LastOutcome: t.lastOutcome,
+			LastError:   t.lastError,
+			LastSummary: t.lastSummary,
+		}
+		if t.Schedule != nil {
+			state.Schedule = t.Schedule.String()
+		} else {
+			state.Interval = t.Interval.String()
 		}
 
 		if !t.lastRun.IsZero() {
@@ -116,6 +469,16 @@ func (s *Scheduler) States() []TaskState {
 			nr := t.nextRun
 			state.NextRun = &nr
 		}
+		if t.current != nil && t.current.stuck {
+			state.Stuck = true
+			state.StuckStack = t.current.stack
+		}
+		if t.current != nil && t.attempt > 1 {
+			state.Attempt = t.attempt
+		}
+		if !t.retryAt.IsZero() && t.Retry != nil {
+			state.Retry = &RetryState{Attempt: t.attempt + 1, MaxAttempts: t.Retry.MaxAttempts, At: t.retryAt, Class: t.retryClass}
+		}
 
 		t.stateMu.RUnlock()
 		states[i] = state
@@ -123,81 +486,337 @@ func (s *Scheduler) States() []TaskState {
 	return states
 }
 
-// loop manages a single task's ticker loop, firing it immediately and then on each interval.
+// loop drives a single task until it is removed or the scheduler stops.
+// Interval tasks fire after their first-run delay (immediately by default)
+// and then every Interval; scheduled tasks wait for each time their Schedule
+// produces. A change made by Reschedule restarts the wait from the current
+// time. A schedule with no fire time in sight is asked again after
+// scheduleRecheck.
 func (s *Scheduler) loop(t *Task) {
 	defer s.tickerWg.Done()
 
-	// The first run fires immediately; the next tick arrives one Interval later.
-	t.stateMu.Lock()
-	t.nextRun = time.Now().Add(t.Interval)
-	t.stateMu.Unlock()
+	// Nothing fires on start for scheduled tasks.
+	var next time.Time
+	if _, sched := t.timing(); sched == nil {
+		next = time.Now().Add(s.firstRunDelay(t))
+	}
 
-	s.dispatch(t)
+	for {
+		interval, sched := t.timing()
+		if next.IsZero() {
+			if sched != nil {
+				// Recompute from the current time rather than from the previous
+				// fire time, so a host that slept through a fire time resumes
+				// from now instead of replaying every missed occurrence.
+				next = sched.Next(time.Now())
+				if next.IsZero() {
+					slog.Warn("scheduler: schedule has no fire time in sight, checking again later", "task", t.Name, "schedule", sched.String(), "recheck", scheduleRecheck.String())
+				}
+			} else {
+				next = time.Now().Add(interval)
+			}
+		}
 
-	ticker := time.NewTicker(t.Interval)
-	defer ticker.Stop()
+		// Jitter delays this run only; next stays on the cadence.
+		due := next
+		if j := t.jitter(); j > 0 && !next.IsZero() {
+			due = next.Add(rand.N(j))
+		}
+		// A pending retry comes first; the regular cadence is unaffected.
+		retryAt := t.pendingRetry()
+		retrying := !retryAt.IsZero() && (due.IsZero() || retryAt.Before(due))
+		if retrying {
+			due = retryAt
+		}
+		t.setNextRun(due)
+		if due.IsZero() && sched != nil {
+			due = time.Now().Add(scheduleRecheck)
+		}
 
-	for {
-		select {
-		case tick := <-ticker.C:
-			// Compute the next expected tick before dispatching so the UI always
-			// shows a non-zero next-run time even while the task is executing.
-			t.stateMu.Lock()
-			t.nextRun = tick.Add(t.Interval)
-			t.stateMu.Unlock()
+		var timer *time.Timer
+		var fire <-chan time.Time
+		if !due.IsZero() {
+			timer = time.NewTimer(time.Until(due))
+			fire = timer.C
+		}
 
+		select {
+		case <-fire:
+			if retrying {
+				s.dispatchRetry(t)
+				continue
+			}
+			if sched != nil && next.IsZero() {
+				// Time to ask the schedule again; nothing is due.
+				continue
+			}
+			if sched == nil {
+				// Keep the cadence anchored to the original start time, but
+				// don't try to catch up on ticks missed while the host slept.
+				next = next.Add(interval)
+				if now := time.Now(); next.Before(now) {
+					next = now.Add(interval)
+				}
+			} else {
+				next = time.Time{}
+			}
 			s.dispatch(t)
+		case <-t.reset:
+			stopTimer(timer)
+			next = time.Time{}
+		case <-t.wake:
+			stopTimer(timer)
+		case <-t.quit:
+			stopTimer(timer)
+			return
 		case <-s.stopCh:
+			stopTimer(timer)
 			return
 		}
 	}
 }
 
-// dispatch fires the task in a new goroutine, but only if the previous invocation has finished.
-// This prevents overlapping executions of the same task.
+func stopTimer(t *time.Timer) {
+	if t != nil {
+		t.Stop()
+	}
+}
+
+// timing returns the task's current interval and schedule.
+func (t *Task) timing() (time.Duration, Schedule) {
+	t.stateMu.RLock()
+	defer t.stateMu.RUnlock()
+	return t.Interval, t.Schedule
+}
+
+// currentTiming returns the task's current timing settings.
+func (t *Task) currentTiming() Timing {
+	t.stateMu.RLock()
+	defer t.stateMu.RUnlock()
+	return Timing{Interval: t.Interval, Schedule: t.Schedule, Timeout: t.Timeout, InitialDelay: t.InitialDelay, Jitter: t.Jitter}
+}
+
+// jitter returns the task's current jitter.
+func (t *Task) jitter() time.Duration {
+	t.stateMu.RLock()
+	defer t.stateMu.RUnlock()
+	return t.Jitter
+}
+
+func (t *Task) setNextRun(next time.Time) {
+	t.stateMu.Lock()
+	t.nextRun = next
+	t.stateMu.Unlock()
+}
+
+// dispatch fires the task in a new goroutine, but only if the task is not
+// paused and the previous invocation has finished. This prevents overlapping
+// executions of the same task.
 func (s *Scheduler) dispatch(t *Task) {
-	if !t.mu.TryLock() {
-		slog.Info("scheduler: skipping task, previous run still in progress", "task", t.Name)
+	t.stateMu.RLock()
+	paused := t.paused
+	t.stateMu.RUnlock()
+	if paused {
+		slog.Debug("scheduler: skipping paused task", "task", t.Name)
 		return
 	}
 
-	// Record the start time and mark the task as running before launching the goroutine
-	// so the WebUI reflects an accurate state immediately.
+	if !s.start(t, 1) {
+		slog.Info("scheduler: skipping task, previous run still in progress", "task", t.Name)
+		s.recordSkip(t)
+	}
+}
+
+// start launches one run of the task and reports whether it did; it returns
+// false without running anything if the previous run is still in progress.
+// attempt is 1 for a regular or manual run and counts up for retries; any
+// pending retry is cancelled, as this run takes its place.
+func (s *Scheduler) start(t *Task, attempt int) bool {
 	now := time.Now()
 	t.stateMu.Lock()
+	if t.current != nil {
+		t.stateMu.Unlock()
+		return false
+	}
+
+	timeout := t.Timeout
+	var interval time.Duration
+	if t.Schedule == nil {
+		interval = t.Interval
+	}
+	ctx, cancel := s.ctx, context.CancelFunc(func() {})
+	if timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+	}
+	info := &runInfo{}
+	ctx = context.WithValue(ctx, runKey{}, info)
+	run := &activeRun{id: runSeq.Add(1), start: now, cancel: cancel}
+
+	// Record the start time and mark the task as running before launching the goroutine
+	// so the WebUI reflects an accurate state immediately.
+	t.current = run
 	t.lastRun = now
-	t.running = true
+	t.attempt = attempt
+	t.retryAt = time.Time{}
+	t.skipRecorded = false
 	t.stateMu.Unlock()
 
 	s.taskWg.Add(1)
 	go func() {
 		defer s.taskWg.Done()
-		defer t.mu.Unlock()
+		defer cancel()
 
-		// Record end time and clear running flag unconditionally; this deferred
-		// func runs even if the task panics (the recover below runs first).
+		var err error
+
+		// Record the outcome unconditionally. Recovering here also stops a
+		// misbehaving task from crashing the scheduler process; the panic
+		// message is surfaced in the WebUI for easy diagnosis.
 		defer func() {
-			end := time.Now()
-			t.stateMu.Lock()
-			t.lastEnd = end
-			t.running = false
-			t.runCount++
-			t.stateMu.Unlock()
+			r := Run{Task: t.Name, Start: now, End: time.Now(), Outcome: OutcomeOK, Summary: info.get(), Interval: interval}
+			if p := recover(); p != nil {
+				slog.Error("scheduler: task panicked", "task", t.Name, "panic", p)
+				r.Outcome = OutcomePanic
+				r.Error = fmt.Sprintf("%v", p)
+			} else if err != nil {
+				r.Outcome = OutcomeError
+				r.Error = err.Error()
+			}
+			s.finish(t, run, r, err)
 		}()
 
-		// Catch panics so a misbehaving task can't crash the scheduler process.
-		// The panic message is surfaced in the WebUI for easy diagnosis.
-		defer func() {
-			if r := recover(); r != nil {
-				slog.Error("scheduler: task panicked", "task", t.Name, "panic", r)
+		if len(t.Resources) > 0 {
+			var release func()
+			release, err = s.acquire(ctx, t.Name, t.Resources, func(name string) {
 				t.stateMu.Lock()
-				t.lastPanic = fmt.Sprintf("%v", r)
+				if t.current == run {
+					t.waiting = name
+				}
 				t.stateMu.Unlock()
+			})
+			if err != nil {
+				slog.Error("scheduler: task failed", "task", t.Name, "err", err)
+				return
 			}
-		}()
+			run.setRelease(release)
+			defer run.releaseResources()
+		}
 
 		slog.Info("scheduler: running task", "task", t.Name)
-		t.Fn()
+		// The labels let the watchdog pick this run's goroutines, and any
+		// they start, out of a full goroutine dump.
+		pprof.Do(ctx, pprof.Labels(labelTask, t.Name, labelRun, strconv.FormatUint(run.id, 10)), func(ctx context.Context) {
+			err = t.Fn(ctx)
+		})
+		if ctx.Err() == context.DeadlineExceeded {
+			slog.Warn("scheduler: task exceeded its timeout", "task", t.Name, "timeout", timeout)
+		}
+		if err != nil {
+			slog.Error("scheduler: task failed", "task", t.Name, "err", err)
+			return
+		}
 		slog.Info("scheduler: task finished", "task", t.Name)
 	}()
+	return true
+}
+
+// finish records the end of a run in the task's state and the run history.
+// A run the watchdog already abandoned was recorded then, so its late return
+// is only logged.
+func (s *Scheduler) finish(t *Task, ar *activeRun, run Run, err error) {
+	t.stateMu.Lock()
+	if t.current != ar {
+		t.abandoned = slices.DeleteFunc(t.abandoned, func(x *activeRun) bool { return x == ar })
+		t.stateMu.Unlock()
+		slog.Warn("scheduler: abandoned run returned", "task", t.Name, "ran_for", run.End.Sub(run.Start).Round(time.Second), "outcome", run.Outcome, "err", run.Error)
+		return
+	}
+	t.current = nil
+	t.lastEnd = run.End
+	t.waiting = ""
+	t.runCount++
+	if run.Outcome == OutcomePanic {
+		t.lastPanic = run.Error
+	}
+	t.lastOutcome = run.Outcome
+	t.lastError = run.Error
+	t.lastSummary = run.Summary
+	retry := run.Outcome == OutcomeError && t.scheduleRetry(err)
+	t.stateMu.Unlock()
+
+	if retry {
+		select {
+		case t.wake <- struct{}{}:
+		default:
+		}
+	}
+	s.record(run)
+}
+
+// recordSkip records an overlap skip, at most once per in-progress run.
+func (s *Scheduler) recordSkip(t *Task) {
+	t.stateMu.Lock()
+	already := t.skipRecorded
+	t.skipRecorded = true
+	t.stateMu.Unlock()
+	if already {
+		return
+	}
+
+	now := time.Now()
+	s.record(Run{Task: t.Name, Start: now, End: now, Outcome: OutcomeSkippedOverlap})
+}
+
+// schedulerKey is the context key under which a Scheduler stores itself so
+// code running inside a task can start tracked background work with Go.
+type schedulerKey struct{}
+
+// Go runs fn in a new goroutine tracked by the scheduler that owns ctx. The
+// goroutine receives the scheduler's root context rather than ctx itself, so
+// it outlives the task that started it but is still cancelled and waited for
+// by Stop. Outside a scheduler (e.g. the CLI) fn runs on an untracked goroutine
+// with ctx. name is used for logging only.
+func Go(ctx context.Context, name string, fn func(ctx context.Context)) {
+	s, ok := ctx.Value(schedulerKey{}).(*Scheduler)
+	if !ok {
+		go fn(ctx)
+		return
+	}
+	if s.ctx.Err() != nil {
+		slog.Info("scheduler: stopping, not starting background work", "name", name)
+		return
+	}
+
+	s.taskWg.Add(1)
+	go func() {
+		defer s.taskWg.Done()
+		defer func() {
+			if r := recover(); r != nil {
+				slog.Error("scheduler: background work panicked", "name", name, "panic", r)
+			}
+		}()
+		fn(s.ctx)
+	}()
+}
+
+// StatesOf returns States for the scheduler that owns ctx, so a task such as
+// the heartbeat can report on the others. Outside a scheduler it returns nil.
+func StatesOf(ctx context.Context) []TaskState {
+	s, ok := ctx.Value(schedulerKey{}).(*Scheduler)
+	if !ok {
+		return nil
+	}
+	return s.States()
+}
+
+// Sleep pauses for d or until ctx is cancelled, whichever comes first.
+// Returns ctx.Err() if the sleep was cut short.
+func Sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 }
@@ -0,0 +1,268 @@
+// Copyright © 2026 ForcePoint Software. All rights reserved.
+
+package scheduler
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"runtime/pprof"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Profiler labels attached to every task run, used to find its goroutines in
+// a goroutine dump.
+const (
+	labelTask = "task"
+	labelRun  = "task_run"
+)
+
+// watchInterval is how often the watchdog checks running tasks.
+const watchInterval = 10 * time.Second
+
+// stuckGrace is how long a run may outlive its timeout before it is
+// considered stuck: a task is allowed its full timeout, and a little more to
+// notice the cancellation and unwind.
+const stuckGrace = 30 * time.Second
+
+// maxStack bounds the stack text kept for a stuck run.
+const maxStack = 32 << 10
+
+// runSeq numbers task runs so each one can be told apart in a goroutine dump.
+var runSeq atomic.Uint64
+
+// Watchdog configures hung-task detection; see SetWatchdog.
+type Watchdog struct {
+	// Multiple flags an interval task as stuck once a run has lasted this
+	// many intervals. Zero disables the watchdog.
+	Multiple float64
+	// Abandon gives up on a stuck run: its context is cancelled, its resource
+	// slots are released and it is recorded as abandoned, so the next tick
+	// can start a fresh run. The goroutine itself can't be killed and is left
+	// to return on its own.
+	Abandon bool
+}
+
+// StuckRun describes a run the watchdog flagged as hung.
+type StuckRun struct {
+	Task      string    `json:"task"`
+	Started   time.Time `json:"started"`
+	Running   string    `json:"running"`   // how long the run has lasted so far
+	Abandoned bool      `json:"abandoned"` // the scheduler has given up on it
+	Stack     string    `json:"stack"`     // goroutine stacks captured when it was flagged
+}
+
+// activeRun is one in-progress run of a task.
+type activeRun struct {
+	id     uint64
+	start  time.Time
+	cancel context.CancelFunc
+
+	// Set by the watchdog; guarded by the owning task's stateMu.
+	stuck bool
+	stack string
+
+	releaseMu sync.Mutex
+	release   func() // frees the run's resource slots; nil once released
+}
+
+func (r *activeRun) setRelease(release func()) {
+	r.releaseMu.Lock()
+	r.release = release
+	r.releaseMu.Unlock()
+}
+
+// releaseResources frees the run's resource slots. It is safe to call more
+// than once, as both the run and the watchdog may.
+func (r *activeRun) releaseResources() {
+	r.releaseMu.Lock()
+	release := r.release
+	r.release = nil
+	r.releaseMu.Unlock()
+	if release != nil {
+		release()
+	}
+}
+
+// SetWatchdog configures hung-task detection. A run is flagged as stuck once
+// it has lasted w.Multiple intervals, but never before its own timeout has
+// passed, since a run may legitimately use all of it. Calendar-scheduled
+// tasks have no interval and are only flagged after overrunning their
+// timeout. When a run is flagged its goroutine stacks are captured and logged
+// and the task reports Stuck in its state until the run ends or is abandoned.
+func (s *Scheduler) SetWatchdog(w Watchdog) {
+	s.mu.Lock()
+	s.watchdog = w
+	s.mu.Unlock()
+}
+
+// Stuck returns the runs currently flagged by the watchdog, including
+// abandoned runs whose goroutines have not returned yet.
+func (s *Scheduler) Stuck() []StuckRun {
+	s.mu.RLock()
+	tasks := append([]*Task(nil), s.tasks...)
+	s.mu.RUnlock()
+
+	now := time.Now()
+	var stuck []StuckRun
+	for _, t := range tasks {
+		t.stateMu.RLock()
+		if t.current != nil && t.current.stuck {
+			stuck = append(stuck, t.current.describe(t.Name, now, false))
+		}
+		for _, r := range t.abandoned {
+			stuck = append(stuck, r.describe(t.Name, now, true))
+		}
+		t.stateMu.RUnlock()
+	}
+	return stuck
+}
+
+// StuckRuns returns Stuck for the scheduler that owns ctx, so a task such as
+// the heartbeat can report hung work. Outside a scheduler it returns nil.
+func StuckRuns(ctx context.Context) []StuckRun {
+	s, ok := ctx.Value(schedulerKey{}).(*Scheduler)
+	if !ok {
+		return nil
+	}
+	return s.Stuck()
+}
+
+func (r *activeRun) describe(task string, now time.Time, abandoned bool) StuckRun {
+	return StuckRun{
+		Task:      task,
+		Started:   r.start,
+		Running:   now.Sub(r.start).Round(time.Second).String(),
+		Abandoned: abandoned,
+		Stack:     r.stack,
+	}
+}
+
+// watch periodically checks every running task until the scheduler stops.
+func (s *Scheduler) watch() {
+	defer s.tickerWg.Done()
+
+	ticker := time.NewTicker(watchInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.checkStuck()
+		case <-s.stopCh:
+			return
+		}
+	}
+}
+
+// checkStuck flags runs that have gone past their threshold and, if
+// configured, abandons them.
+func (s *Scheduler) checkStuck() {
+	s.mu.RLock()
+	w := s.watchdog
+	tasks := append([]*Task(nil), s.tasks...)
+	s.mu.RUnlock()
+	if w.Multiple <= 0 {
+		return
+	}
+
+	now := time.Now()
+	for _, t := range tasks {
+		t.stateMu.RLock()
+		run := t.current
+		// Queuing for a resource isn't a hang of this task.
+		waiting := t.waiting != ""
+		flagged := run != nil && run.stuck
+		threshold := t.stuckThreshold(w.Multiple)
+		t.stateMu.RUnlock()
+
+		if run == nil || waiting || threshold <= 0 || now.Sub(run.start) < threshold {
+			continue
+		}
+		if !flagged {
+			stack := runStack(run.id)
+			t.stateMu.Lock()
+			if t.current == run {
+				run.stuck = true
+				run.stack = stack
+			}
+			t.stateMu.Unlock()
+			slog.Warn("scheduler: task appears stuck", "task", t.Name, "running_for", now.Sub(run.start).Round(time.Second), "threshold", threshold, "stack", stack)
+		}
+		if w.Abandon {
+			s.abandon(t, run)
+		}
+	}
+}
+
+// stuckThreshold returns how long a run may last before it is flagged, or 0
+// if the task can't be watched. Callers must hold t.stateMu.
+func (t *Task) stuckThreshold(multiple float64) time.Duration {
+	var d time.Duration
+	if t.Schedule == nil {
+		d = time.Duration(multiple * float64(t.Interval))
+	}
+	if t.Timeout > 0 {
+		d = max(d, t.Timeout+stuckGrace)
+	}
+	return d
+}
+
+// abandon gives up on a stuck run so the task can be dispatched again. The
+// run is recorded now; when its goroutine eventually returns, finish only
+// logs it.
+func (s *Scheduler) abandon(t *Task, run *activeRun) {
+	now := time.Now()
+	msg := fmt.Sprintf("abandoned by the watchdog after running for %s", now.Sub(run.start).Round(time.Second))
+
+	t.stateMu.Lock()
+	if t.current != run {
+		t.stateMu.Unlock()
+		return
+	}
+	t.current = nil
+	t.abandoned = append(t.abandoned, run)
+	t.lastEnd = now
+	t.waiting = ""
+	t.runCount++
+	t.lastOutcome = OutcomeAbandoned
+	t.lastError = msg
+	t.lastSummary = ""
+	t.stateMu.Unlock()
+
+	run.cancel()
+	run.releaseResources()
+	slog.Error("scheduler: stuck task abandoned", "task", t.Name, "running_for", now.Sub(run.start).Round(time.Second))
+	s.record(Run{Task: t.Name, Start: run.start, End: now, Outcome: OutcomeAbandoned, Error: msg})
+}
+
+// runStack returns the stacks of the goroutines labelled with the given run
+// ID: the task's own goroutine and any it started.
+func runStack(id uint64) string {
+	var buf bytes.Buffer
+	if err := pprof.Lookup("goroutine").WriteTo(&buf, 1); err != nil {
+		return fmt.Sprintf("goroutine dump failed: %v", err)
+	}
+	want := strconv.Quote(labelRun) + ":" + strconv.Quote(strconv.FormatUint(id, 10))
+
+	// debug=1 output is a header line followed by blank-line separated
+	// groups of identical goroutines, each with a "# labels:" line.
+	var out []string
+	for _, group := range strings.Split(buf.String(), "\n\n") {
+		if strings.Contains(group, "# labels: ") && strings.Contains(group, want) {
+			out = append(out, strings.TrimSpace(group))
+		}
+	}
+	if len(out) == 0 {
+		return "no goroutines found for the run"
+	}
+	stack := strings.Join(out, "\n\n")
+	if len(stack) > maxStack {
+		stack = stack[:maxStack] + "\n[truncated]"
+	}
+	return stack
+}
@@ -3,7 +3,9 @@
 package sshconn
 
 import (
+	"context"
 	"fmt"
+	"net"
 	"time"
 
 	gossh "golang.org/x/crypto/ssh"
@@ -44,7 +46,8 @@ const commandTimeout = 60 * time.Second
 
 // RunCommand opens an SSH session to the target host, executes the command, and returns the output.
 // Supports both modern and legacy SSH configurations based on the Legacy flag.
-func RunCommand(cfg Config, command string) (string, error) {
+// Cancelling ctx aborts the dial or closes the session mid-command.
+func RunCommand(ctx context.Context, cfg Config, command string) (string, error) {
 	// Default to the standard SSH port when the caller leaves Port at zero.
 	port := cfg.Port
 	if port == 0 {
@@ -85,12 +88,28 @@ func RunCommand(cfg Config, command string) (string, error) {
 		},
 	}
 
-	// Open the TCP connection and perform the SSH handshake.
+	// Open the TCP connection with the caller's context so a cancelled task
+	// does not sit in a 15 s dial, then perform the SSH handshake over it.
 	addr := fmt.Sprintf("%s:%d", cfg.Host, port)
-	client, err := gossh.Dial("tcp", addr, sshCfg)
+	dialer := net.Dialer{Timeout: sshCfg.Timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
 	if err != nil {
 		return "", fmt.Errorf("dial %s: %w", addr, err)
 	}
+
+	// The handshake itself has no context parameter; bound it with a
+	// deadline on the raw connection and clear the deadline afterwards.
+	conn.SetDeadline(time.Now().Add(sshCfg.Timeout))
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	c, chans, reqs, err := gossh.NewClientConn(conn, addr, sshCfg)
+	if err != nil {
+		conn.Close()
+		return "", fmt.Errorf("dial %s: %w", addr, err)
+	}
+	conn.SetDeadline(time.Time{})
+	client := gossh.NewClient(c, chans, reqs)
 	defer client.Close()
 
 	// Each command needs its own session; sessions are single-use in the SSH protocol.
@@ -130,5 +149,8 @@ func RunCommand(cfg Config, command string) (string, error) {
 		// allowing it to exit cleanly rather than leaking the goroutine.
 		session.Close()
 		return "", fmt.Errorf("command timed out on %s after %s", addr, commandTimeout)
+	case <-ctx.Done():
+		session.Close()
+		return "", fmt.Errorf("command cancelled on %s: %w", addr, ctx.Err())
 	}
 }
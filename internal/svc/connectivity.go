@@ -0,0 +1,53 @@
+// Copyright © 2026 ForcePoint Software. All rights reserved.
+
+package svc
+
+import (
+	"errors"
+	"log/slog"
+
+	"github.com/forcedesk/forcedesk-agent/internal/scheduler"
+	"github.com/forcedesk/forcedesk-agent/internal/tenant"
+)
+
+// reconnectTasks run as soon as the tenant comes back online rather than at
+// their next tick: they deliver what piled up while it was unreachable.
+var reconnectTasks = []string{"outbox", "commandqueue", "push"}
+
+// watchConnectivity follows the tenant connectivity state until the returned
+// func is called, and runs reconnectTasks each time the tenant comes back
+// online after being offline.
+func watchConnectivity(s *scheduler.Scheduler) func() {
+	done := make(chan struct{})
+	go func() {
+		// Take the channel before reading the state so no change is missed.
+		changed := tenant.ConnectivityChanged()
+		offline := !tenant.Online()
+		for {
+			select {
+			case <-changed:
+			case <-done:
+				return
+			}
+			changed = tenant.ConnectivityChanged()
+			if !tenant.Online() {
+				offline = true
+				continue
+			}
+			if !offline {
+				continue
+			}
+			offline = false
+			for _, name := range reconnectTasks {
+				err := s.RunNow(name)
+				switch {
+				case errors.Is(err, scheduler.ErrStopped):
+					return
+				case err != nil && !errors.Is(err, scheduler.ErrAlreadyRunning) && !errors.Is(err, scheduler.ErrUnknownTask):
+					slog.Warn("scheduler: failed to run task after reconnect", "task", name, "err", err)
+				}
+			}
+		}
+	}()
+	return func() { close(done) }
+}
@@ -0,0 +1,38 @@
+// Copyright © 2026 ForcePoint Software. All rights reserved.
+
+package svc
+
+import (
+	"log/slog"
+
+	"github.com/forcedesk/forcedesk-agent/internal/config"
+	"github.com/forcedesk/forcedesk-agent/internal/control"
+	"github.com/forcedesk/forcedesk-agent/internal/scheduler"
+	"github.com/forcedesk/forcedesk-agent/internal/webui"
+)
+
+// startInterfaces starts the local control socket and, when enabled, the
+// WebUI. Both share the control token. The returned func closes the control
+// socket; call it before stopping the scheduler. Failures are logged rather
+// than returned so the agent keeps running its tasks without them.
+func startInterfaces(s *scheduler.Scheduler) func() {
+	token, err := control.LoadOrCreateToken()
+	if err != nil {
+		slog.Error("control: failed to load token, task control disabled", "err", err)
+	}
+
+	stop := func() {}
+	if token != "" {
+		if closeFn, err := control.Serve(s, token); err != nil {
+			slog.Error("control: failed to start control socket", "err", err)
+		} else {
+			stop = closeFn
+		}
+	}
+
+	cfg := config.Get()
+	if cfg.WebUI.Enabled {
+		webui.Start(cfg.WebUI.Listen, s, token)
+	}
+	return stop
+}
@@ -0,0 +1,73 @@
+// Copyright © 2026 ForcePoint Software. All rights reserved.
+
+package svc
+
+import (
+	"time"
+
+	"github.com/forcedesk/forcedesk-agent/internal/db"
+	"github.com/forcedesk/forcedesk-agent/internal/scheduler"
+	"github.com/forcedesk/forcedesk-agent/internal/tasks"
+)
+
+// enableHistory persists every task run to the local database and registers
+// the housekeeping task that prunes it. Shared by the Windows and non-Windows
+// schedulers.
+func enableHistory(s *scheduler.Scheduler) {
+	s.Recorder = runRecorder{}
+	s.Add(&scheduler.Task{
+		Name:     "housekeeping",
+		Interval: 1 * time.Hour,
+		Timeout:  5 * time.Minute,
+		Fn:       tasks.Housekeeping,
+	})
+}
+
+// Tasks on an interval shorter than frequentInterval succeed thousands of
+// times a day. Their successful runs share one history row per
+// aggregateWindow; failures, and every run of other tasks, get a row each.
+const (
+	frequentInterval = time.Minute
+	aggregateWindow  = time.Hour
+)
+
+// runRecorder implements scheduler.Recorder on top of the task_runs table.
+type runRecorder struct{}
+
+func (runRecorder) RecordRun(run scheduler.Run) error {
+	r := db.TaskRun{
+		Task:      run.Task,
+		StartedAt: run.Start,
+		EndedAt:   run.End,
+		Duration:  run.End.Sub(run.Start),
+		Outcome:   string(run.Outcome),
+		Error:     run.Error,
+		Summary:   run.Summary,
+	}
+	if run.Outcome == scheduler.OutcomeOK && run.Interval > 0 && run.Interval < frequentInterval {
+		merged, err := db.MergeTaskRun(r, run.Start.Add(-aggregateWindow))
+		if err != nil || merged {
+			return err
+		}
+	}
+	return db.InsertTaskRun(r)
+}
+
+func (runRecorder) LastRuns() ([]scheduler.Run, error) {
+	rows, err := db.LatestTaskRuns()
+	if err != nil {
+		return nil, err
+	}
+	runs := make([]scheduler.Run, len(rows))
+	for i, r := range rows {
+		runs[i] = scheduler.Run{
+			Task:    r.Task,
+			Start:   r.StartedAt,
+			End:     r.EndedAt,
+			Outcome: scheduler.Outcome(r.Outcome),
+			Error:   r.Error,
+			Summary: r.Summary,
+		}
+	}
+	return runs, nil
+}
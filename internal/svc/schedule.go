@@ -0,0 +1,68 @@
+// Copyright © 2026 ForcePoint Software. All rights reserved.
+
+package svc
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/forcedesk/forcedesk-agent/internal/config"
+	"github.com/forcedesk/forcedesk-agent/internal/scheduler"
+	"github.com/forcedesk/forcedesk-agent/internal/tasks"
+)
+
+// addCalendarTasks registers the wall-clock tasks configured in config.toml.
+// Shared by the Windows and non-Windows schedulers so both pick up the same
+// calendar rules. Invalid expressions are logged and the task is skipped
+// rather than preventing the rest of the agent from starting.
+func addCalendarTasks(s *scheduler.Scheduler) {
+	cfg := config.Get()
+	if !cfg.EduStar.Enabled {
+		return
+	}
+
+	add := func(name, expr string, fn func(ctx context.Context) error) {
+		if expr == "" {
+			return
+		}
+		sched, err := calendarSchedule(cfg.Schedule, expr, cfg.EduStar.CRTWeekdaysOnly)
+		if err != nil {
+			slog.Error("scheduler: invalid schedule, task not registered", "task", name, "err", err)
+			return
+		}
+		s.Add(&scheduler.Task{Name: name, Schedule: sched, Resources: []string{tasks.ResourceSTMC}, Fn: fn})
+	}
+
+	add("edustar-enable-crt", cfg.EduStar.CRTEnableSchedule, tasks.EduStarEnableCRT)
+	add("edustar-expire-crt", cfg.EduStar.CRTExpireSchedule, tasks.EduStarExpireCRT)
+}
+
+// calendarSchedule builds a cron schedule in the configured time zone, wrapped
+// with the shared blackout dates and an optional weekdays-only rule.
+func calendarSchedule(sc config.Schedule, expr string, weekdaysOnly bool) (scheduler.Schedule, error) {
+	loc := time.Local
+	if sc.Timezone != "" {
+		l, err := time.LoadLocation(sc.Timezone)
+		if err != nil {
+			return nil, fmt.Errorf("timezone %q: %w", sc.Timezone, err)
+		}
+		loc = l
+	}
+
+	cron, err := scheduler.ParseCron(expr, loc)
+	if err != nil {
+		return nil, err
+	}
+
+	cal := &scheduler.Calendar{Schedule: cron, WeekdaysOnly: weekdaysOnly}
+	for _, b := range sc.BlackoutDates {
+		r, err := scheduler.ParseDateRange(b, cron.Location())
+		if err != nil {
+			return nil, err
+		}
+		cal.Blackouts = append(cal.Blackouts, r)
+	}
+	return cal, nil
+}
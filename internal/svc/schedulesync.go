@@ -0,0 +1,281 @@
+// Copyright © 2026 ForcePoint Software. All rights reserved.
+
+package svc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/forcedesk/forcedesk-agent/internal/config"
+	"github.com/forcedesk/forcedesk-agent/internal/manifest"
+	"github.com/forcedesk/forcedesk-agent/internal/scheduler"
+	"github.com/forcedesk/forcedesk-agent/internal/tenant"
+)
+
+// scheduleSync keeps the scheduler's task set in line with the schedule
+// manifest published by the tenant.
+type scheduleSync struct {
+	s *scheduler.Scheduler
+
+	mu      sync.Mutex
+	version int64               // version of the applied manifest; 0 means built-in defaults
+	applied map[string]taskPlan // timing each manifest-managed task was last given
+}
+
+// taskPlan is the desired state of one task after applying a manifest.
+type taskPlan struct {
+	enabled      bool
+	interval     time.Duration
+	expr         string // cron expression; empty for interval tasks
+	sched        scheduler.Schedule
+	timeout      time.Duration
+	initialDelay time.Duration
+	jitter       time.Duration
+}
+
+func (p taskPlan) timing() scheduler.Timing {
+	return scheduler.Timing{Interval: p.interval, Schedule: p.sched, Timeout: p.timeout, InitialDelay: p.initialDelay, Jitter: p.jitter}
+}
+
+// sameTiming reports whether p and q would schedule the task identically.
+func (p taskPlan) sameTiming(q taskPlan) bool {
+	return p.interval == q.interval && p.expr == q.expr && p.timeout == q.timeout &&
+		p.initialDelay == q.initialDelay && p.jitter == q.jitter
+}
+
+// enableScheduleSync applies the cached manifest, if any, and registers the
+// schedule-sync task that fetches new ones. Must be called after the default
+// tasks have been added and before Start.
+func enableScheduleSync(s *scheduler.Scheduler) {
+	ss := &scheduleSync{s: s, applied: make(map[string]taskPlan)}
+	for _, d := range taskDefs {
+		ss.applied[d.name] = defaultPlan(d)
+	}
+	ss.loadCached()
+
+	s.Add(&scheduler.Task{
+		Name:     "schedule-sync",
+		Interval: 5 * time.Minute,
+		Timeout:  1 * time.Minute,
+		Retry:    &scheduler.RetryPolicy{MaxAttempts: 3, BaseDelay: 20 * time.Second, Jitter: 5 * time.Second},
+		Fn:       ss.sync,
+	})
+}
+
+func defaultPlan(d taskDef) taskPlan {
+	return taskPlan{enabled: d.enabled, interval: d.interval, timeout: d.timeout}
+}
+
+// loadCached applies the last good manifest stored in the database. Any
+// problem leaves the built-in defaults in place.
+func (ss *scheduleSync) loadCached() {
+	keys, err := config.Get().Tenant.EncryptionKeys()
+	if err != nil {
+		slog.Warn("schedule: no encryption key, using built-in task defaults", "err", err)
+		return
+	}
+	m, err := manifest.LoadCached(keys)
+	if err != nil {
+		slog.Error("schedule: cached manifest rejected, using built-in task defaults", "err", err)
+		return
+	}
+	if m == nil {
+		return
+	}
+
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	if err := ss.apply(m); err != nil {
+		slog.Error("schedule: cached manifest rejected, using built-in task defaults", "version", m.Version, "err", err)
+		return
+	}
+	slog.Info("schedule: applied cached manifest", "version", m.Version)
+}
+
+// sync fetches the current manifest and applies it if it is newer than the
+// one in effect. Only a manifest that applied cleanly is cached, so the cache
+// always holds the last good one.
+func (ss *scheduleSync) sync(ctx context.Context) error {
+	keys, err := config.Get().Tenant.EncryptionKeys()
+	if err != nil {
+		return fmt.Errorf("no encryption key: %w", err)
+	}
+
+	m, raw, err := manifest.Fetch(ctx, tenant.New(), keys)
+	if errors.Is(err, manifest.ErrNotPublished) {
+		slog.Debug("schedule: tenant has no manifest for this agent")
+		scheduler.Summarize(ctx, "no manifest published")
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to fetch manifest: %w", err)
+	}
+
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	switch {
+	case m.Version < ss.version:
+		return fmt.Errorf("manifest v%d is older than applied v%d, ignored", m.Version, ss.version)
+	case m.Version == ss.version:
+		scheduler.Summarize(ctx, "manifest v%d unchanged", m.Version)
+		return nil
+	}
+
+	if err := ss.apply(m); err != nil {
+		return fmt.Errorf("manifest v%d rejected: %w", m.Version, err)
+	}
+	if err := manifest.Save(raw); err != nil {
+		return fmt.Errorf("manifest v%d applied but not cached: %w", m.Version, err)
+	}
+
+	slog.Info("schedule: applied manifest", "version", m.Version)
+	scheduler.Summarize(ctx, "manifest v%d applied", m.Version)
+	return nil
+}
+
+// apply reconciles the scheduler with m. Every change is worked out and
+// checked before any is made, so an invalid entry never leaves the task set
+// half updated. Tasks the manifest doesn't mention revert to their defaults.
+// Callers must hold ss.mu.
+func (ss *scheduleSync) apply(m *manifest.Manifest) error {
+	plans, err := plan(m)
+	if err != nil {
+		return err
+	}
+	spread := configSpread()
+	if m.Spread != "" {
+		spread, err = time.ParseDuration(m.Spread)
+		if err != nil || spread < 0 {
+			return fmt.Errorf("invalid spread %q", m.Spread)
+		}
+	}
+
+	// Only the schedule-sync task adds and removes manifest-managed tasks,
+	// and it holds ss.mu, so the checks below still hold when the changes
+	// are made.
+	var changes []func()
+	for _, d := range taskDefs {
+		if !d.supported() {
+			continue
+		}
+		p := plans[d.name]
+		has := ss.s.Has(d.name)
+
+		switch {
+		case !p.enabled && has:
+			changes = append(changes, func() {
+				if err := ss.s.Remove(d.name); err != nil {
+					slog.Error("schedule: failed to disable task", "task", d.name, "err", err)
+				}
+			})
+		case p.enabled && !has:
+			if err := p.timing().Validate(); err != nil {
+				return fmt.Errorf("task %s: %w", d.name, err)
+			}
+			changes = append(changes, func() {
+				ss.s.Add(&scheduler.Task{
+					Name:         d.name,
+					Interval:     p.interval,
+					Schedule:     p.sched,
+					Timeout:      p.timeout,
+					InitialDelay: p.initialDelay,
+					Jitter:       p.jitter,
+					Resources:    d.resources,
+					Retry:        d.retry,
+					Fn:           d.fn,
+				})
+				slog.Info("schedule: task enabled", "task", d.name)
+			})
+		case p.enabled && !p.sameTiming(ss.applied[d.name]):
+			if err := p.timing().Validate(); err != nil {
+				return fmt.Errorf("task %s: %w", d.name, err)
+			}
+			changes = append(changes, func() {
+				if err := ss.s.Reschedule(d.name, p.timing()); err != nil {
+					slog.Error("schedule: failed to reschedule task", "task", d.name, "err", err)
+				}
+			})
+		}
+	}
+
+	ss.s.SetSpread(config.Get().Tenant.UUID, spread)
+	for _, change := range changes {
+		change()
+	}
+	for _, d := range taskDefs {
+		if d.supported() {
+			ss.applied[d.name] = plans[d.name]
+		}
+	}
+	ss.version = m.Version
+	return nil
+}
+
+// plan computes the desired state of every manifest-managed task.
+func plan(m *manifest.Manifest) (map[string]taskPlan, error) {
+	defs := make(map[string]taskDef, len(taskDefs))
+	plans := make(map[string]taskPlan, len(taskDefs))
+	for _, d := range taskDefs {
+		defs[d.name] = d
+		plans[d.name] = defaultPlan(d)
+	}
+
+	cfg := config.Get()
+	for _, spec := range m.Tasks {
+		d, ok := defs[spec.Name]
+		if !ok {
+			slog.Warn("schedule: manifest names a task that is unknown or not manifest-managed, ignored", "task", spec.Name)
+			continue
+		}
+		if !d.supported() {
+			slog.Debug("schedule: manifest task not supported on this platform, ignored", "task", spec.Name)
+			continue
+		}
+
+		p := plans[spec.Name]
+		if spec.Enabled != nil {
+			p.enabled = *spec.Enabled
+		}
+		if spec.Interval != "" {
+			iv, err := time.ParseDuration(spec.Interval)
+			if err != nil {
+				return nil, fmt.Errorf("task %s: invalid interval %q", spec.Name, spec.Interval)
+			}
+			if iv < scheduler.MinInterval {
+				return nil, fmt.Errorf("task %s: interval %s is shorter than the minimum of %s", spec.Name, iv, scheduler.MinInterval)
+			}
+			p.interval = iv
+		}
+		if spec.Schedule != "" {
+			sched, err := calendarSchedule(cfg.Schedule, spec.Schedule, false)
+			if err != nil {
+				return nil, fmt.Errorf("task %s: %w", spec.Name, err)
+			}
+			p.expr, p.sched, p.interval = spec.Schedule, sched, 0
+		}
+		for _, f := range []struct {
+			name, raw string
+			dst       *time.Duration
+		}{
+			{"timeout", spec.Timeout, &p.timeout},
+			{"initial_delay", spec.InitialDelay, &p.initialDelay},
+			{"jitter", spec.Jitter, &p.jitter},
+		} {
+			if f.raw == "" {
+				continue
+			}
+			d, err := time.ParseDuration(f.raw)
+			if err != nil || d < 0 {
+				return nil, fmt.Errorf("task %s: invalid %s %q", spec.Name, f.name, f.raw)
+			}
+			*f.dst = d
+		}
+		plans[spec.Name] = p
+	}
+	return plans, nil
+}
@@ -5,14 +5,14 @@
 package svc
 
 import (
+	"context"
 	"fmt"
 	"log/slog"
-	"time"
+	"os"
+	"os/signal"
+	"syscall"
 
-	"github.com/forcedesk/forcedesk-agent/internal/config"
-	"github.com/forcedesk/forcedesk-agent/internal/scheduler"
-	"github.com/forcedesk/forcedesk-agent/internal/tasks"
-	"github.com/forcedesk/forcedesk-agent/internal/webui"
+	"github.com/forcedesk/forcedesk-agent/internal/update"
 )
 
 // IsWindowsService always returns false on non-Windows platforms.
@@ -22,16 +22,54 @@ func IsWindowsService() bool { return false }
 func RunService() error { return fmt.Errorf("Windows service not supported on this platform") }
 
 // RunScheduler starts the task scheduler directly in foreground mode (for development/testing).
-// This function blocks until the process is terminated.
+// This function blocks until SIGINT or SIGTERM, then stops the scheduler. If
+// an update asks for a restart, the scheduler is stopped and the process
+// re-executes itself.
 func RunScheduler() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
 	s := buildScheduler()
 	s.Start()
-	cfg := config.Get()
-	if cfg.WebUI.Enabled {
-		webui.Start(cfg.WebUI.Listen, s)
-	}
+	stopControl := startInterfaces(s)
+	stopWatch := watchConnectivity(s)
 	slog.Info("scheduler running — press Ctrl+C to stop")
-	select {}
+	restart := false
+	select {
+	case <-ctx.Done():
+	case <-update.RestartRequested():
+		restart = true
+	}
+
+	slog.Info("scheduler stopping")
+	stopControl()
+	stopWatch()
+	s.Stop()
+	slog.Info("scheduler stopped")
+
+	if restart {
+		Restart()
+	}
+}
+
+// Restart runs the executable now on disk in place of this foreground agent,
+// with the same arguments. It does not return.
+func Restart() {
+	if err := reexec(); err != nil {
+		slog.Error("restart failed", "err", err)
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+// reexec replaces the process with a fresh run of the executable now on disk.
+func reexec() error {
+	exe, err := update.Executable()
+	if err != nil {
+		return err
+	}
+	slog.Info("restarting", "exe", exe)
+	return syscall.Exec(exe, os.Args, os.Environ())
 }
 
 // Install is not supported on non-Windows platforms.
@@ -48,16 +86,3 @@ func StopService() error { return fmt.Errorf("not supported on this platform") }
 
 // ServiceStatus is not supported on non-Windows platforms.
 func ServiceStatus() string { return "n/a" }
-
-// buildScheduler constructs and configures the task scheduler with all agent tasks.
-func buildScheduler() *scheduler.Scheduler {
-	s := scheduler.New()
-	s.Add(&scheduler.Task{Name: "heartbeat", Interval: 5 * time.Minute, Fn: tasks.Heartbeat})
-	s.Add(&scheduler.Task{Name: "monitoring", Interval: 1 * time.Minute, Fn: tasks.MonitoringService})
-	s.Add(&scheduler.Task{Name: "devicemanager", Interval: 1 * time.Minute, Fn: tasks.DeviceManagerService})
-	s.Add(&scheduler.Task{Name: "commandqueue", Interval: 1 * time.Minute, Fn: tasks.CommandQueueService})
-	s.Add(&scheduler.Task{Name: "devicequery", Interval: 5 * time.Second, Fn: tasks.DeviceManagerQuery})
-	s.Add(&scheduler.Task{Name: "papercut", Interval: 30 * time.Minute, Fn: tasks.PapercutService})
-	//s.Add(&scheduler.Task{Name: "edustar", Interval: 4 * time.Hour, Fn: tasks.EduStarService})
-	return s
-}
@@ -3,18 +3,19 @@
 package svc
 
 import (
+	"context"
 	"fmt"
 	"log/slog"
 	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"golang.org/x/sys/windows/svc"
 	"golang.org/x/sys/windows/svc/mgr"
 
-	"github.com/forcedesk/forcedesk-agent/internal/config"
-	"github.com/forcedesk/forcedesk-agent/internal/scheduler"
-	"github.com/forcedesk/forcedesk-agent/internal/tasks"
-	"github.com/forcedesk/forcedesk-agent/internal/webui"
+	"github.com/forcedesk/forcedesk-agent/internal/update"
 )
 
 const serviceName = "ForceDeskAgent"
@@ -34,17 +35,57 @@ func RunService() error {
 }
 
 // RunScheduler starts the task scheduler directly in foreground mode (debug/console mode).
-// This function blocks until the process is terminated.
+// This function blocks until Ctrl+C or a console close, then stops the scheduler.
+// If an update asks for a restart, the scheduler is stopped and a new process
+// is started on the same console in place of this one.
 func RunScheduler() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
 	s := buildScheduler()
 	s.Start()
-	cfg := config.Get()
-	if cfg.WebUI.Enabled {
-		webui.Start(cfg.WebUI.Listen, s)
-	}
+	stopControl := startInterfaces(s)
+	stopWatch := watchConnectivity(s)
 	slog.Info("scheduler running in console mode — press Ctrl+C to stop")
-	// Block forever; signal handling is managed by the caller.
-	select {}
+	restart := false
+	select {
+	case <-ctx.Done():
+	case <-update.RestartRequested():
+		restart = true
+	}
+
+	slog.Info("scheduler stopping")
+	stopControl()
+	stopWatch()
+	s.Stop()
+	slog.Info("scheduler stopped")
+
+	if restart {
+		Restart()
+	}
+}
+
+// Restart runs the executable now on disk in place of this foreground agent,
+// with the same arguments. It does not return.
+func Restart() {
+	if err := reexec(); err != nil {
+		slog.Error("restart failed", "err", err)
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+// reexec starts the executable now on disk with the same arguments and
+// console. Windows has no exec, so the caller exits once it has started.
+func reexec() error {
+	exe, err := update.Executable()
+	if err != nil {
+		return err
+	}
+	slog.Info("restarting", "exe", exe)
+	cmd := exec.Command(exe, os.Args[1:]...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	return cmd.Start()
 }
 
 // Install registers the binary as a Windows Service set to start automatically.
@@ -78,6 +119,10 @@ func Install() error {
 	}
 	defer s.Close()
 
+	if err := setRecovery(s); err != nil {
+		return fmt.Errorf("set recovery actions: %w", err)
+	}
+
 	slog.Info("service installed", "name", serviceName, "path", exePath)
 	return nil
 }
@@ -194,6 +239,35 @@ func stopService(s *mgr.Service) error {
 	return nil
 }
 
+// setRecovery has the SCM restart the service whenever it exits without
+// being asked to stop, including the deliberate non-zero exit after an
+// update.
+func setRecovery(s *mgr.Service) error {
+	restart := mgr.RecoveryAction{Type: mgr.ServiceRestart, Delay: 5 * time.Second}
+	if err := s.SetRecoveryActions([]mgr.RecoveryAction{restart, restart, restart}, uint32((24 * time.Hour).Seconds())); err != nil {
+		return err
+	}
+	return s.SetRecoveryActionsOnNonCrashFailures(true)
+}
+
+// ensureRecovery applies setRecovery to the installed service, which may
+// predate it, before the service exits to be restarted.
+func ensureRecovery() error {
+	m, err := mgr.Connect()
+	if err != nil {
+		return err
+	}
+	defer m.Disconnect()
+
+	s, err := m.OpenService(serviceName)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	return setRecovery(s)
+}
+
 // agentService implements the Windows Service handler interface.
 
 type agentService struct{}
@@ -209,71 +283,44 @@ func (a *agentService) Execute(
 
 	s := buildScheduler()
 	s.Start()
-	cfg := config.Get()
-	if cfg.WebUI.Enabled {
-		webui.Start(cfg.WebUI.Listen, s)
-	}
+	stopControl := startInterfaces(s)
+	stopWatch := watchConnectivity(s)
 	slog.Info("service started", "name", serviceName)
 
 	changes <- svc.Status{State: svc.Running, Accepts: accepted}
 
-	for c := range req {
-		switch c.Cmd {
-		case svc.Stop, svc.Shutdown:
-			changes <- svc.Status{State: svc.StopPending}
-			slog.Info("service stopping")
+	// Tell the SCM how long to wait before it considers the stop hung;
+	// Stop gives up on in-flight tasks after StopTimeout.
+	stopPending := svc.Status{State: svc.StopPending, WaitHint: uint32((s.StopTimeout + 5*time.Second).Milliseconds())}
+	for {
+		select {
+		case c, ok := <-req:
+			if !ok {
+				return false, 0
+			}
+			switch c.Cmd {
+			case svc.Stop, svc.Shutdown:
+				changes <- stopPending
+				slog.Info("service stopping")
+				stopControl()
+				stopWatch()
+				s.Stop()
+				slog.Info("service stopped")
+				return false, 0
+			}
+		case <-update.RestartRequested():
+			// Exit with a service-specific error so the SCM's recovery
+			// actions start the service again on the new executable.
+			changes <- stopPending
+			slog.Info("service restarting for update")
+			if err := ensureRecovery(); err != nil {
+				slog.Error("failed to set service recovery actions, restart may need to be done by hand", "err", err)
+			}
+			stopControl()
+			stopWatch()
 			s.Stop()
-			slog.Info("service stopped")
-			return false, 0
+			slog.Info("service stopped for restart")
+			return true, 1
 		}
 	}
-	return false, 0
-}
-
-// buildScheduler constructs and configures the task scheduler with all agent tasks.
-func buildScheduler() *scheduler.Scheduler {
-	s := scheduler.New()
-
-	s.Add(&scheduler.Task{
-		Name:     "heartbeat",
-		Interval: 5 * time.Minute,
-		Fn:       tasks.Heartbeat,
-	})
-	s.Add(&scheduler.Task{
-		Name:     "monitoring",
-		Interval: 1 * time.Minute,
-		Fn:       tasks.MonitoringService,
-	})
-	s.Add(&scheduler.Task{
-		Name:     "devicemanager",
-		Interval: 1 * time.Minute,
-		Fn:       tasks.DeviceManagerService,
-	})
-	s.Add(&scheduler.Task{
-		Name:     "commandqueue",
-		Interval: 15 * time.Second,
-		Fn:       tasks.CommandQueueService,
-	})
-	s.Add(&scheduler.Task{
-		Name:     "devicequery",
-		Interval: 5 * time.Second,
-		Fn:       tasks.DeviceManagerQuery,
-	})
-	s.Add(&scheduler.Task{
-		Name:     "papercut",
-		Interval: 30 * time.Minute,
-		Fn:       tasks.PapercutService,
-	})
-	//s.Add(&scheduler.Task{
-	//	Name:     "edustar",
-	//	Interval: 4 * time.Hour,
-	//	Fn:       tasks.EduStarService,
-	//})
-	s.Add(&scheduler.Task{
-		Name:     "kiosklabel",
-		Interval: 10 * time.Second,
-		Fn:       tasks.KioskLabelService,
-	})
-
-	return s
 }
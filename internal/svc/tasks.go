@@ -0,0 +1,123 @@
+// Copyright © 2026 ForcePoint Software. All rights reserved.
+
+package svc
+
+import (
+	"context"
+	"log/slog"
+	"runtime"
+	"time"
+
+	"github.com/forcedesk/forcedesk-agent/internal/config"
+	"github.com/forcedesk/forcedesk-agent/internal/jobs"
+	"github.com/forcedesk/forcedesk-agent/internal/outbox"
+	"github.com/forcedesk/forcedesk-agent/internal/scheduler"
+	"github.com/forcedesk/forcedesk-agent/internal/tasks"
+)
+
+// taskDef is a task the agent knows how to run, with the defaults used until
+// the tenant's schedule manifest says otherwise.
+type taskDef struct {
+	name     string
+	fn       func(ctx context.Context) error
+	interval time.Duration
+	timeout  time.Duration
+	enabled  bool // registered when the manifest doesn't mention the task
+	// resources are the resource locks each run holds.
+	resources []string
+	// retry retries failed runs that are worth retrying before the next
+	// regular run; nil waits for the next run.
+	retry *scheduler.RetryPolicy
+	// windowsOnly tasks are never registered on other platforms, whatever
+	// the manifest says.
+	windowsOnly bool
+}
+
+// taskDefs is the single list of manifest-managed tasks shared by the Windows
+// service and the foreground scheduler.
+var taskDefs = []taskDef{
+	{name: "heartbeat", fn: tasks.Heartbeat, interval: 5 * time.Minute, timeout: 1 * time.Minute, enabled: true,
+		retry: &scheduler.RetryPolicy{MaxAttempts: 3, BaseDelay: 15 * time.Second, Jitter: 5 * time.Second}},
+	{name: "monitoring", fn: tasks.MonitoringService, interval: 1 * time.Minute, timeout: 5 * time.Minute, enabled: true},
+	{name: "devicemanager", fn: tasks.DeviceManagerService, interval: 1 * time.Minute, timeout: 30 * time.Minute, enabled: true},
+	{name: "selfupdate", fn: tasks.SelfUpdate, interval: 30 * time.Minute, timeout: 20 * time.Minute, enabled: true},
+	{name: "commandqueue", fn: tasks.CommandQueueService, interval: 15 * time.Second, timeout: 5 * time.Minute, enabled: true},
+	{name: "devicequery", fn: tasks.DeviceManagerQuery, interval: 5 * time.Second, timeout: 6 * time.Minute, enabled: true},
+	{name: "papercut", fn: tasks.PapercutService, interval: 30 * time.Minute, timeout: 25 * time.Minute, enabled: true, resources: []string{tasks.ResourcePapercut},
+		retry: &scheduler.RetryPolicy{MaxAttempts: 5, BaseDelay: 30 * time.Second, MaxDelay: 5 * time.Minute, Jitter: 10 * time.Second}},
+	{name: "edustar", fn: tasks.EduStarService, interval: 4 * time.Hour, timeout: 2 * time.Hour, resources: []string{tasks.ResourceSTMC},
+		retry: &scheduler.RetryPolicy{MaxAttempts: 3, BaseDelay: 2 * time.Minute, Jitter: 30 * time.Second}},
+	{name: "kiosklabel", fn: tasks.KioskLabelService, interval: 10 * time.Second, timeout: 2 * time.Minute, enabled: true, windowsOnly: true},
+}
+
+// resourceCapacities are the default resource lock capacities; [schedule]
+// resources in config.toml overrides them.
+var resourceCapacities = map[string]int{
+	tasks.ResourceSTMC:     2,
+	tasks.ResourcePapercut: 1,
+}
+
+// supported reports whether the task can run on this platform.
+func (d taskDef) supported() bool {
+	return !d.windowsOnly || runtime.GOOS == "windows"
+}
+
+// buildScheduler constructs the task scheduler with the default task set,
+// then applies the last good schedule manifest cached from the tenant so the
+// agent starts with the schedule it last ran, even while offline.
+func buildScheduler() *scheduler.Scheduler {
+	s := scheduler.New()
+	s.SetSpread(config.Get().Tenant.UUID, configSpread())
+	s.SetWatchdog(scheduler.Watchdog{
+		Multiple: config.Get().Schedule.StuckMultiple,
+		Abandon:  config.Get().Schedule.AbandonStuck,
+	})
+	for name, capacity := range resourceCapacities {
+		s.SetResource(name, capacity)
+	}
+	for name, capacity := range config.Get().Schedule.Resources {
+		s.SetResource(name, capacity)
+	}
+
+	for _, d := range taskDefs {
+		if d.enabled && d.supported() {
+			s.Add(&scheduler.Task{Name: d.name, Interval: d.interval, Timeout: d.timeout, Resources: d.resources, Retry: d.retry, Fn: d.fn})
+		}
+	}
+
+	addCalendarTasks(s)
+	enableHistory(s)
+	jobs.Recover()
+	// Uploads queued while the tenant was unreachable must always be
+	// delivered, so the outbox task is not manifest-managed.
+	s.Add(&scheduler.Task{Name: "outbox", Interval: 30 * time.Second, Timeout: 5 * time.Minute, Fn: outbox.Replay})
+	// The tenant relies on the capability document to decide what work to
+	// queue, so publishing it is not manifest-managed.
+	s.Add(&scheduler.Task{Name: "capabilities", Interval: 6 * time.Hour, Timeout: time.Minute, Fn: tasks.PublishCapabilities,
+		Retry: &scheduler.RetryPolicy{MaxAttempts: 5, BaseDelay: 30 * time.Second, MaxDelay: 5 * time.Minute, Jitter: 10 * time.Second}})
+	// Tasks check the connectivity state before contacting the tenant, so
+	// keeping it current is not manifest-managed.
+	s.Add(&scheduler.Task{Name: "connectivity", Interval: 15 * time.Second, Timeout: time.Minute, Fn: tasks.ConnectivityMonitor})
+	// The push channel replaces polling only while it is up, so it is not
+	// manifest-managed either. Each run is one session, which the listener
+	// ends before the timeout; the next tick starts another.
+	s.Add(&scheduler.Task{Name: "push", Interval: time.Minute, Timeout: time.Hour, Fn: tasks.PushListener})
+	enableScheduleSync(s)
+
+	return s
+}
+
+// configSpread returns the fleet spread window from [schedule] spread. An
+// invalid value is logged and disables the spread.
+func configSpread() time.Duration {
+	raw := config.Get().Schedule.Spread
+	if raw == "" {
+		return 0
+	}
+	d, err := time.ParseDuration(raw)
+	if err != nil || d < 0 {
+		slog.Error("scheduler: invalid [schedule] spread, spread disabled", "spread", raw)
+		return 0
+	}
+	return d
+}
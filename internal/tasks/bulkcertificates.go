@@ -5,11 +5,15 @@ package tasks
 import (
 	"archive/zip"
 	"bytes"
+	"context"
 	"encoding/base64"
+	"fmt"
 	"log/slog"
 	"strings"
 	"time"
 
+	"github.com/forcedesk/forcedesk-agent/internal/outbox"
+	"github.com/forcedesk/forcedesk-agent/internal/scheduler"
 	"github.com/forcedesk/forcedesk-agent/internal/tenant"
 )
 
@@ -27,41 +31,39 @@ type bulkCertUpload struct {
 // certName is the bare name (e.g. "FD-abc123"); the school prefix is prepended internally.
 // batchTotal is forwarded so the ingest endpoint can detect when all certificates in the batch
 // have arrived and write the completion log.
-func RequestBulkCertificate(certName, batchID string, batchTotal int) {
-	slog.Info("bulkcertificates: requesting certificate", "cert_name", certName, "batch_id", batchID)
+func RequestBulkCertificate(ctx context.Context, certName, batchID string, batchTotal int) error {
+	slog.InfoContext(ctx, "bulkcertificates: requesting certificate", "cert_name", certName, "batch_id", batchID)
 
 	tc := tenant.New()
-	if err := tc.TestConnectivity(); err != nil {
-		slog.Error("bulkcertificates: connectivity check failed", "err", err)
-		return
+	if err := tenant.CheckOnline(); err != nil {
+		return fmt.Errorf("connectivity check failed: %w", err)
 	}
 
-	stmc, cfg, err := initClient(tc)
+	stmc, cfg, err := initClient(ctx, tc)
 	if err != nil {
-		slog.Error("bulkcertificates: STMC init failed", "cert_name", certName, "err", err)
-		return
+		return fmt.Errorf("STMC init failed: %w", err)
 	}
 
-	slog.Info("bulkcertificates: authenticated with STMC", "mode", stmc.AuthMode, "cert_name", certName)
+	slog.InfoContext(ctx, "bulkcertificates: authenticated with STMC", "mode", stmc.AuthMode, "cert_name", certName)
 
-	if err := stmc.AddCertificate(cfg.SchoolCode, certName, "eduSTAR.NET"); err != nil {
+	if err := stmc.AddCertificate(ctx, cfg.SchoolCode, certName, "eduSTAR.NET"); err != nil {
 		if !strings.Contains(err.Error(), "already exists") {
-			slog.Error("bulkcertificates: AddCertificate failed", "cert_name", certName, "err", err)
-			return
+			return fmt.Errorf("AddCertificate failed: %w", err)
 		}
-		slog.Info("bulkcertificates: certificate already exists in STMC, proceeding to download", "cert_name", certName)
+		slog.InfoContext(ctx, "bulkcertificates: certificate already exists in STMC, proceeding to download", "cert_name", certName)
 	} else {
-		slog.Info("bulkcertificates: certificate request submitted, waiting for STMC to process", "cert_name", certName)
-		time.Sleep(5 * time.Second)
+		slog.InfoContext(ctx, "bulkcertificates: certificate request submitted, waiting for STMC to process", "cert_name", certName)
+		if err := scheduler.Sleep(ctx, 5*time.Second); err != nil {
+			return fmt.Errorf("cancelled while waiting for STMC: %w", err)
+		}
 	}
 
 	compName := cfg.SchoolCode + "-" + certName
 
 	// Verify the certificate appears in the school's list.
-	certs, err := stmc.GetCertificates(cfg.SchoolCode)
+	certs, err := stmc.GetCertificates(ctx, cfg.SchoolCode)
 	if err != nil {
-		slog.Error("bulkcertificates: GetCertificates failed", "cert_name", certName, "err", err)
-		return
+		return fmt.Errorf("GetCertificates failed: %w", err)
 	}
 
 	found := false
@@ -73,16 +75,14 @@ func RequestBulkCertificate(certName, batchID string, batchTotal int) {
 	}
 
 	if !found {
-		slog.Error("bulkcertificates: certificate not found in STMC list after creation", "cert_name", certName, "expected", compName)
-		return
+		return fmt.Errorf("certificate not found in STMC list after creation: expected %s", compName)
 	}
 
-	slog.Info("bulkcertificates: certificate verified, downloading", "comp_name", compName)
+	slog.InfoContext(ctx, "bulkcertificates: certificate verified, downloading", "comp_name", compName)
 
-	b64, err := stmc.GetCertificate(cfg.SchoolCode, compName, "eduSTAR.NET")
+	b64, err := stmc.GetCertificate(ctx, cfg.SchoolCode, compName, "eduSTAR.NET")
 	if err != nil {
-		slog.Error("bulkcertificates: GetCertificate failed", "cert_name", certName, "err", err)
-		return
+		return fmt.Errorf("GetCertificate failed: %w", err)
 	}
 
 	zipBytes, err := base64.StdEncoding.DecodeString(strings.TrimSpace(b64))
@@ -91,30 +91,26 @@ func RequestBulkCertificate(certName, batchID string, batchTotal int) {
 		if len(preview) > 100 {
 			preview = preview[:100]
 		}
-		slog.Error("bulkcertificates: base64 decode failed", "cert_name", certName, "err", err, "preview", preview)
-		return
+		return fmt.Errorf("base64 decode failed: %w", err)
 	}
 
 	if len(zipBytes) == 0 {
-		slog.Error("bulkcertificates: decoded certificate is empty", "cert_name", certName)
-		return
+		return fmt.Errorf("decoded certificate is empty")
 	}
 	if len(zipBytes) > maxCertZipSize {
-		slog.Error("bulkcertificates: certificate ZIP too large", "cert_name", certName, "size", len(zipBytes))
-		return
+		return fmt.Errorf("certificate ZIP too large: %d bytes", len(zipBytes))
 	}
 
 	zr, err := zip.NewReader(bytes.NewReader(zipBytes), int64(len(zipBytes)))
 	if err != nil {
-		slog.Error("bulkcertificates: invalid ZIP archive", "cert_name", certName, "err", err)
-		return
+		return fmt.Errorf("invalid ZIP archive: %w", err)
 	}
 
 	expiry := certExpiryFromZip(zr, certName)
 	if expiry != "" {
-		slog.Info("bulkcertificates: certificate expiry determined", "cert_name", certName, "expiry", expiry)
+		slog.InfoContext(ctx, "bulkcertificates: certificate expiry determined", "cert_name", certName, "expiry", expiry)
 	} else {
-		slog.Warn("bulkcertificates: could not determine certificate expiry", "cert_name", certName)
+		slog.WarnContext(ctx, "bulkcertificates: could not determine certificate expiry", "cert_name", certName)
 	}
 
 	payload := bulkCertUpload{
@@ -124,12 +120,15 @@ func RequestBulkCertificate(certName, batchID string, batchTotal int) {
 		BatchID:           batchID,
 		BatchTotal:        batchTotal,
 	}
-	resp, err := tc.PostJSON(tenant.URL("/api/agent/bulk-certificates/certificate"), payload)
+	queued, err := outbox.Post(ctx, tc, outbox.KindJSON, "/api/agent/bulk-certificates/certificate", payload)
 	if err != nil {
-		slog.Error("bulkcertificates: failed to post certificate to tenant", "cert_name", certName, "err", err)
-		return
+		return fmt.Errorf("failed to post certificate to tenant: %w", err)
+	}
+	if queued {
+		slog.InfoContext(ctx, "bulkcertificates: tenant unavailable, certificate queued", "cert_name", certName)
+		return nil
 	}
-	defer resp.Body.Close()
 
-	slog.Info("bulkcertificates: certificate stored on tenant", "cert_name", certName, "status", resp.StatusCode)
+	slog.InfoContext(ctx, "bulkcertificates: certificate stored on tenant", "cert_name", certName)
+	return nil
 }
@@ -0,0 +1,39 @@
+// Copyright © 2026 ForcePoint Software. All rights reserved.
+
+package tasks
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+
+	"github.com/forcedesk/forcedesk-agent/internal/scheduler"
+	"github.com/forcedesk/forcedesk-agent/internal/tenant"
+)
+
+// capabilities returns the agent's capability document, taken from the same
+// tables that dispatch commands, device backups and probe checks.
+func capabilities() *tenant.Capabilities {
+	return tenant.NewCapabilities(
+		slices.Collect(maps.Keys(commandHandlers)),
+		slices.Collect(maps.Keys(deviceProfiles)),
+		slices.Collect(maps.Keys(probeChecks)),
+	)
+}
+
+// PublishCapabilities tells the tenant which commands, device types, check
+// types and protocol versions this agent supports, and negotiates the API
+// version to use. Runs at startup and every 6 hours; the heartbeat carries
+// the same document in between.
+func PublishCapabilities(ctx context.Context) error {
+	caps := capabilities()
+	slog.Debug("capabilities: publishing", "commands", len(caps.Commands), "device_types", caps.DeviceTypes, "check_types", caps.CheckTypes)
+
+	if err := tenant.New().PublishCapabilities(ctx, caps); err != nil {
+		return fmt.Errorf("publish capabilities: %w", err)
+	}
+	scheduler.Summarize(ctx, "published %d command types, API version %d", len(caps.Commands), tenant.APIVersion())
+	return nil
+}
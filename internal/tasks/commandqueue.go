@@ -3,8 +3,15 @@
 package tasks
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"log/slog"
+	"sync/atomic"
+	"time"
 
+	"github.com/forcedesk/forcedesk-agent/internal/jobs"
+	"github.com/forcedesk/forcedesk-agent/internal/scheduler"
 	"github.com/forcedesk/forcedesk-agent/internal/tenant"
 )
 
@@ -29,88 +36,207 @@ type commandPayload struct {
 	CertName         string  `json:"cert_name"`
 	BatchID          string  `json:"batch_id"`
 	BatchTotal       int     `json:"batch_total"`
+	KeyID            string  `json:"key_id"`
+	WrappedKey       string  `json:"wrapped_key"` // base64, see tenant.UnwrapKey
 }
 
-// CommandQueueService polls the ForceDesk server for pending commands and executes them.
-// Supports commands like forcing a Papercut sync or triggering device manager queries.
-// Runs every minute.
-func CommandQueueService() {
+// jobTimeouts bounds each command type once its job starts running. Types not
+// listed use jobs.DefaultTimeout.
+var jobTimeouts = map[string]time.Duration{
+	"force-sync-papercutsvc":              25 * time.Minute,
+	"force-devicemanager-query":           6 * time.Minute,
+	"run-edustar":                         2 * time.Hour,
+	"get-papercut-shared-accounts":        10 * time.Minute,
+	"set-papercut-shared-account-balance": 2 * time.Minute,
+	"request-student-device-certificate":  5 * time.Minute,
+	"request-bulk-certificate":            5 * time.Minute,
+	"sync-det-notebooks":                  15 * time.Minute,
+	"rotate-encryption-key":               2 * time.Minute,
+}
+
+// CommandQueueService polls the ForceDesk server for pending commands and runs
+// each one as a job keyed by its request UUID (see package jobs), so it is
+// tracked, bounded by a per-type timeout and reported back to the tenant.
+// Commands that talk to STMC or PaperCut queue for the matching resource lock.
+// Also retries delivery of job results the tenant hasn't received yet. Runs
+// every 15 seconds; while the push channel is up (see PushListener) it only
+// reports job results, with a full poll every few minutes as a safety net.
+func CommandQueueService(ctx context.Context) error {
 	slog.Info("commandqueue: starting")
 
+	// The push channel delivers commands as they are queued; while it is up,
+	// a full poll only runs every pushSafetyPoll in case one was missed.
+	if tenant.PushActive() && time.Since(lastQueuePoll()) < pushSafetyPoll {
+		if err := jobs.ReportPending(ctx); err != nil {
+			slog.Warn("commandqueue: failed to report job results, will retry", "err", err)
+		}
+		scheduler.Summarize(ctx, "push channel active, poll skipped")
+		return nil
+	}
+
 	client := tenant.New()
-	if err := client.TestConnectivity(); err != nil {
-		slog.Error("commandqueue: connectivity check failed", "err", err)
-		return
+	if err := tenant.CheckOnline(); err != nil {
+		return fmt.Errorf("connectivity check failed: %w", err)
+	}
+
+	if err := jobs.ReportPending(ctx); err != nil {
+		slog.Warn("commandqueue: failed to report job results, will retry", "err", err)
 	}
 
 	url := tenant.URL("/api/agent/command-queues")
 	slog.Debug("commandqueue: GET", "url", url)
 
 	var items []commandQueueItem
-	if err := client.GetJSON(url, &items); err != nil {
-		slog.Error("commandqueue: failed to fetch queue", "err", err)
-		return
+	if err := client.GetJSON(ctx, url, &items); err != nil {
+		return fmt.Errorf("failed to fetch queue: %w", err)
 	}
+	queuePolled.Store(time.Now().UnixNano())
 
 	slog.Debug("commandqueue: items received", "count", len(items))
 
+	started := submitCommands(ctx, items)
+	scheduler.Summarize(ctx, "commands processed: %d, jobs started: %d", len(items), started)
+	return nil
+}
+
+// queuePolled is when the command queue was last fetched in full (UnixNano).
+var queuePolled atomic.Int64
+
+func lastQueuePoll() time.Time {
+	return time.Unix(0, queuePolled.Load())
+}
+
+// submitCommands starts a job for each command in items, whether it was
+// polled or pushed, and returns how many were started. A command seen before
+// is dropped by jobs.Submit.
+func submitCommands(ctx context.Context, items []commandQueueItem) int {
+	started := 0
 	for _, item := range items {
 		slog.Debug("commandqueue: processing item", "type", item.Type, "process", item.PayloadData.Process)
-		switch item.Type {
-		case "force-sync-papercutsvc":
-			if item.PayloadData.Process {
-				slog.Info("commandqueue: triggering papercut sync")
-				PapercutService()
-			}
-
-		case "force-devicemanager-query":
-			slog.Info("commandqueue: triggering device manager query loop")
-			go DeviceManagerQuery()
-
-		case "run-edustar":
-			if item.PayloadData.Process {
-				slog.Info("commandqueue: triggering edustar command", "action", item.PayloadData.Action)
-				go EduStarCommand(item.PayloadData.Action)
-			}
-
-		case "get-papercut-shared-accounts":
-			slog.Info("commandqueue: triggering papercut shared accounts fetch")
-			go PapercutGetSharedAccounts()
-
-		case "set-papercut-shared-account-balance":
-			slog.Info("commandqueue: setting papercut shared account balance",
-				"account", item.PayloadData.SharedAccount,
-				"balance", item.PayloadData.RequestedBalance)
-			go PapercutSetSharedAccountBalance(
-				item.PayloadData.SharedAccount,
-				item.PayloadData.RequestedBalance,
-				item.PayloadData.AdjustmentReason,
-			)
-
-		case "request-student-device-certificate":
-			if item.PayloadData.Snid == "" || item.PayloadData.ComputerName == "" {
-				slog.Warn("commandqueue: request-student-device-certificate missing snid or computer_name")
-			} else {
-				slog.Info("commandqueue: requesting student device certificate", "snid", item.PayloadData.Snid)
-				go RequestStudentDeviceCertificate(item.PayloadData.Snid, item.PayloadData.ComputerName, item.PayloadData.RequestUUID, item.PayloadData.DeviceType)
-			}
-
-		case "request-bulk-certificate":
-			if item.PayloadData.CertName == "" || item.PayloadData.BatchID == "" {
-				slog.Warn("commandqueue: request-bulk-certificate missing cert_name or batch_id")
-			} else {
-				slog.Info("commandqueue: requesting bulk certificate", "cert_name", item.PayloadData.CertName, "batch_id", item.PayloadData.BatchID)
-				go RequestBulkCertificate(item.PayloadData.CertName, item.PayloadData.BatchID, item.PayloadData.BatchTotal)
-			}
-
-		case "sync-det-notebooks":
-			if item.PayloadData.Process {
-				slog.Info("commandqueue: triggering DET notebooks fleet sync")
-				go SyncDETNotebooks()
-			}
-
-		default:
-			slog.Warn("commandqueue: unknown command type", "type", item.Type)
+		run, resources := commandJob(item)
+		if run == nil {
+			continue
+		}
+		accepted, err := jobs.Submit(ctx, jobs.Spec{
+			RequestUUID: item.PayloadData.RequestUUID,
+			Type:        item.Type,
+			Timeout:     jobTimeouts[item.Type],
+			Resources:   resources,
+			Run:         run,
+		})
+		if err != nil {
+			slog.Error("commandqueue: failed to start job", "type", item.Type, "err", err)
+			continue
+		}
+		if accepted {
+			started++
 		}
 	}
+	return started
+}
+
+// commandHandler returns the job that carries out a command with payload p
+// and the resource locks it needs, or nil if there is nothing to do.
+type commandHandler func(p commandPayload) (func(ctx context.Context) error, []string)
+
+// commandHandlers maps each command type the agent handles to its handler.
+// Its keys are also the command types advertised to the tenant in the
+// capability document, so the two can't disagree.
+var commandHandlers = map[string]commandHandler{
+	"force-sync-papercutsvc": func(p commandPayload) (func(ctx context.Context) error, []string) {
+		if !p.Process {
+			return nil, nil
+		}
+		slog.Info("commandqueue: triggering papercut sync")
+		return PapercutService, []string{ResourcePapercut}
+	},
+
+	"force-devicemanager-query": func(commandPayload) (func(ctx context.Context) error, []string) {
+		slog.Info("commandqueue: triggering device manager query loop")
+		return DeviceManagerQuery, nil
+	},
+
+	"run-edustar": func(p commandPayload) (func(ctx context.Context) error, []string) {
+		if !p.Process {
+			return nil, nil
+		}
+		slog.Info("commandqueue: triggering edustar command", "action", p.Action)
+		return func(ctx context.Context) error {
+			return EduStarCommand(ctx, p.Action)
+		}, []string{ResourceSTMC}
+	},
+
+	"get-papercut-shared-accounts": func(commandPayload) (func(ctx context.Context) error, []string) {
+		slog.Info("commandqueue: triggering papercut shared accounts fetch")
+		return PapercutGetSharedAccounts, []string{ResourcePapercut}
+	},
+
+	"set-papercut-shared-account-balance": func(p commandPayload) (func(ctx context.Context) error, []string) {
+		slog.Info("commandqueue: setting papercut shared account balance",
+			"account", p.SharedAccount,
+			"balance", p.RequestedBalance)
+		return func(ctx context.Context) error {
+			return PapercutSetSharedAccountBalance(ctx, p.SharedAccount, p.RequestedBalance, p.AdjustmentReason)
+		}, []string{ResourcePapercut}
+	},
+
+	"request-student-device-certificate": func(p commandPayload) (func(ctx context.Context) error, []string) {
+		if p.Snid == "" || p.ComputerName == "" {
+			slog.Warn("commandqueue: request-student-device-certificate missing snid or computer_name")
+			return failJob("missing snid or computer_name"), nil
+		}
+		slog.Info("commandqueue: requesting student device certificate", "snid", p.Snid)
+		return func(ctx context.Context) error {
+			return RequestStudentDeviceCertificate(ctx, p.Snid, p.ComputerName, p.RequestUUID, p.DeviceType)
+		}, []string{ResourceSTMC}
+	},
+
+	"request-bulk-certificate": func(p commandPayload) (func(ctx context.Context) error, []string) {
+		if p.CertName == "" || p.BatchID == "" {
+			slog.Warn("commandqueue: request-bulk-certificate missing cert_name or batch_id")
+			return failJob("missing cert_name or batch_id"), nil
+		}
+		slog.Info("commandqueue: requesting bulk certificate", "cert_name", p.CertName, "batch_id", p.BatchID)
+		return func(ctx context.Context) error {
+			return RequestBulkCertificate(ctx, p.CertName, p.BatchID, p.BatchTotal)
+		}, []string{ResourceSTMC}
+	},
+
+	"sync-det-notebooks": func(p commandPayload) (func(ctx context.Context) error, []string) {
+		if !p.Process {
+			return nil, nil
+		}
+		slog.Info("commandqueue: triggering DET notebooks fleet sync")
+		return SyncDETNotebooks, []string{ResourceSTMC}
+	},
+
+	"rotate-encryption-key": func(p commandPayload) (func(ctx context.Context) error, []string) {
+		if p.KeyID == "" || p.WrappedKey == "" {
+			slog.Warn("commandqueue: rotate-encryption-key missing key_id or wrapped_key")
+			return failJob("missing key_id or wrapped_key"), nil
+		}
+		slog.Info("commandqueue: rotating encryption key", "key_id", p.KeyID)
+		return func(ctx context.Context) error {
+			return RotateEncryptionKey(ctx, p.KeyID, p.WrappedKey)
+		}, nil
+	},
+}
+
+// commandJob returns the job that carries out item and the resource locks it
+// needs, or nil if there is nothing to do.
+func commandJob(item commandQueueItem) (func(ctx context.Context) error, []string) {
+	handler, ok := commandHandlers[item.Type]
+	if !ok {
+		slog.Warn("commandqueue: unknown command type", "type", item.Type)
+		return failJob(fmt.Sprintf("unknown command type %q", item.Type)), nil
+	}
+	return handler(item.PayloadData)
+}
+
+// failJob returns a job that fails immediately with msg, so the tenant is
+// told why a malformed command was not carried out.
+func failJob(msg string) func(ctx context.Context) error {
+	return func(context.Context) error {
+		return errors.New(msg)
+	}
 }
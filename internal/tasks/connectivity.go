@@ -0,0 +1,27 @@
+// Copyright © 2026 ForcePoint Software. All rights reserved.
+
+package tasks
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/forcedesk/forcedesk-agent/internal/scheduler"
+	"github.com/forcedesk/forcedesk-agent/internal/tenant"
+)
+
+// ConnectivityMonitor keeps the tenant connectivity state current for the
+// tasks that consult it through tenant.CheckOnline. It only contacts the
+// tenant when nothing else has for a while, or while the tenant is offline.
+func ConnectivityMonitor(ctx context.Context) error {
+	probed, err := tenant.Probe(ctx)
+	if err != nil {
+		return fmt.Errorf("connectivity probe: %w", err)
+	}
+	if !probed {
+		scheduler.Summarize(ctx, "tenant recently reachable, probe skipped")
+		return nil
+	}
+	scheduler.Summarize(ctx, "tenant reachable")
+	return nil
+}
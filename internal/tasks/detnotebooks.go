@@ -3,6 +3,8 @@
 package tasks
 
 import (
+	"context"
+	"fmt"
 	"log/slog"
 
 	"github.com/forcedesk/forcedesk-agent/internal/notebook"
@@ -12,48 +14,43 @@ import (
 // SyncDETNotebooks fetches the current notebook fleet from the DET Notebooks API
 // (apps.edustar.vic.edu.au/notebooks) and posts it to the tenant for storage.
 // Credentials are shared with the STMC integration (same eduStarConfig).
-func SyncDETNotebooks() {
-	slog.Info("detnotebooks: starting fleet sync")
+func SyncDETNotebooks(ctx context.Context) error {
+	slog.InfoContext(ctx, "detnotebooks: starting fleet sync")
 
 	tc := tenant.New()
-	if err := tc.TestConnectivity(); err != nil {
-		slog.Info("detnotebooks: connectivity check failed", "err", err)
-		return
+	if err := tenant.CheckOnline(); err != nil {
+		return fmt.Errorf("connectivity check failed: %w", err)
 	}
 
-	cfg, err := resolveConfig(tc)
+	cfg, err := resolveConfig(ctx, tc)
 	if err != nil {
-		slog.Info("detnotebooks: failed to resolve config", "err", err)
-		return
+		return fmt.Errorf("failed to resolve config: %w", err)
 	}
 
 	if cfg.Username == "" || cfg.Password == "" || cfg.SchoolCode == "" {
-		slog.Info("detnotebooks: config is incomplete (missing username, password, or school_code)")
-		return
+		return fmt.Errorf("config is incomplete (missing username, password, or school_code)")
 	}
 
 	nb := notebook.New("form")
-	if err := nb.Login(cfg.Username, cfg.Password); err != nil {
-		slog.Info("detnotebooks: login failed", "err", err)
-		return
+	if err := nb.Login(ctx, cfg.Username, cfg.Password); err != nil {
+		return fmt.Errorf("login failed: %w", err)
 	}
 
-	slog.Info("detnotebooks: authenticated", "mode", nb.AuthMode, "school", cfg.SchoolCode)
+	slog.InfoContext(ctx, "detnotebooks: authenticated", "mode", nb.AuthMode, "school", cfg.SchoolCode)
 
-	fleet, err := nb.GetCurrentFleet(cfg.SchoolCode)
+	fleet, err := nb.GetCurrentFleet(ctx, cfg.SchoolCode)
 	if err != nil {
-		slog.Info("detnotebooks: GetCurrentFleet failed", "err", err)
-		return
+		return fmt.Errorf("GetCurrentFleet failed: %w", err)
 	}
 
-	slog.Info("detnotebooks: fleet fetched", "count", len(fleet))
+	slog.InfoContext(ctx, "detnotebooks: fleet fetched", "count", len(fleet))
 
-	resp, err := tc.PostJSON(tenant.URL("/api/agent/ingest/det-notebooks/fleet"), fleet)
+	resp, err := tc.PostJSON(ctx, tenant.URL("/api/agent/ingest/det-notebooks/fleet"), fleet)
 	if err != nil {
-		slog.Info("detnotebooks: failed to post fleet data", "err", err)
-		return
+		return fmt.Errorf("failed to post fleet data: %w", err)
 	}
 	defer resp.Body.Close()
 
-	slog.Info("detnotebooks: fleet sync complete", "count", len(fleet), "status", resp.StatusCode)
+	slog.InfoContext(ctx, "detnotebooks: fleet sync complete", "count", len(fleet), "status", resp.StatusCode)
+	return nil
 }
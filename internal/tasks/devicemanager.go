@@ -3,15 +3,17 @@
 package tasks
 
 import (
+	"context"
 	"crypto/rand"
 	"encoding/json"
 	"fmt"
 	"log/slog"
-	"net/http"
 	"strings"
 	"sync"
 
 	"github.com/forcedesk/forcedesk-agent/internal/config"
+	"github.com/forcedesk/forcedesk-agent/internal/outbox"
+	"github.com/forcedesk/forcedesk-agent/internal/scheduler"
 	"github.com/forcedesk/forcedesk-agent/internal/sshconn"
 	"github.com/forcedesk/forcedesk-agent/internal/tenant"
 )
@@ -58,21 +60,19 @@ type dmBackupResult struct {
 // DeviceManagerService fetches network device backup configurations from the tenant,
 // connects to each device via SSH to capture running configurations, and reports results back.
 // Runs every minute.
-func DeviceManagerService() {
+func DeviceManagerService(ctx context.Context) error {
 	slog.Info("devicemanager: starting")
 
 	client := tenant.New()
-	if err := client.TestConnectivity(); err != nil {
-		slog.Error("devicemanager: connectivity check failed", "err", err)
-		return
+	if err := tenant.CheckOnline(); err != nil {
+		return fmt.Errorf("connectivity check failed: %w", err)
 	}
 
 	// The device payload is encrypted end-to-end; fetch the symmetric key
 	// before requesting the payload so we can decrypt it inline.
 	key, err := config.Get().Tenant.GetEncryptionKey()
 	if err != nil {
-		slog.Error("devicemanager: failed to get encryption key", "err", err)
-		return
+		return fmt.Errorf("failed to get encryption key: %w", err)
 	}
 
 	url := tenant.URL("/api/agent/devicemanager/payloads")
@@ -85,16 +85,15 @@ func DeviceManagerService() {
 			PayloadData []devicePayload `json:"payload_data"`
 		} `json:"payloads"`
 	}
-	if err := client.GetEncryptedJSON(url, &item, key); err != nil {
-		slog.Error("devicemanager: failed to fetch payloads", "err", err)
-		return
+	if err := client.GetEncryptedJSON(ctx, url, &item, key); err != nil {
+		return fmt.Errorf("failed to fetch payloads: %w", err)
 	}
 
 	slog.Debug("devicemanager: payload items received", "count", len(item.Payloads))
 
 	if len(item.Payloads) == 0 {
 		slog.Info("devicemanager: no payloads received")
-		return
+		return nil
 	}
 
 	// A single batch ID groups all backups captured in this run together on
@@ -118,7 +117,7 @@ func DeviceManagerService() {
 			slog.Info("devicemanager: dispatching backup", "device", dev.Name, "type", dev.Type, "host", dev.Hostname)
 			go func(d devicePayload) {
 				defer wg.Done()
-				runDeviceBackup(client, d, batchID, key)
+				runDeviceBackup(ctx, client, d, batchID)
 			}(dev)
 		}
 	}
@@ -127,11 +126,13 @@ func DeviceManagerService() {
 	// does not start another run while backups are still in progress.
 	wg.Wait()
 	slog.Info("devicemanager: completed", "dispatched", dispatched, "total", len(item.Payloads), "batch", batchID)
+	scheduler.Summarize(ctx, "devices dispatched: %d", dispatched)
+	return nil
 }
 
 // runDeviceBackup SSHes into a single device, captures its running config, and uploads
 // the result to the tenant. Called concurrently for each device in a batch.
-func runDeviceBackup(client *tenant.Client, dev devicePayload, batchID string, key []byte) {
+func runDeviceBackup(ctx context.Context, client *tenant.Client, dev devicePayload, batchID string) {
 	// Resolve the CLI command for this device type before opening the SSH
 	// connection; bail early if the type is unrecognised.
 	cmd := deviceCommand(dev)
@@ -152,7 +153,7 @@ func runDeviceBackup(client *tenant.Client, dev devicePayload, batchID string, k
 		Legacy: bool(dev.IsCiscoLegacy),
 	}
 
-	output, err := sshconn.RunCommand(cfg, cmd)
+	output, err := sshconn.RunCommand(ctx, cfg, cmd)
 	// Require at least 10 bytes to guard against devices that accept the
 	// connection but return empty or truncated output (e.g. auth failures
 	// that yield a short error banner instead of a config dump).
@@ -183,46 +184,51 @@ func runDeviceBackup(client *tenant.Client, dev devicePayload, batchID string, k
 	}
 
 	// Encrypt the result before transmission so credentials embedded in
-	// device configs are not exposed in transit.
-	resp, err := client.PostEncryptedJSON(tenant.URL("/api/agent/devicemanager/response"), result, key)
+	// device configs are not exposed in transit. If the tenant is down the
+	// outbox keeps it, sealed, until it can be delivered.
+	queued, err := outbox.Post(ctx, client, outbox.KindEncrypted, "/api/agent/devicemanager/response", result)
 	if err != nil {
 		slog.Error("devicemanager: failed to send backup", "device", dev.Name, "err", err)
 		return
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
-		slog.Error("devicemanager: non-success response", "device", dev.Name, "status", resp.StatusCode)
+	if queued {
+		slog.Info("devicemanager: tenant unavailable, backup queued", "device", dev.Name, "size", result.Size)
 		return
 	}
 
 	slog.Info("devicemanager: backup sent", "device", dev.Name, "size", result.Size)
 }
 
+// deviceProfile describes how to back up one type of device.
+type deviceProfile struct {
+	// command exports the running configuration.
+	command string
+	// anchor marks where the configuration starts in the command's output;
+	// everything before it (login banners, command echo) is dropped.
+	anchor string
+}
+
+// deviceProfiles maps each supported device type to its profile. Its keys
+// are also the device types advertised to the tenant in the capability
+// document.
+var deviceProfiles = map[string]deviceProfile{
+	// Keep everything from the line containing "version" onwards.
+	"cisco": {command: "show running-config view full", anchor: "version"},
+	// Keep everything from the first "/interface" onwards.
+	"mikrotik": {command: "export show-sensitive verbose", anchor: "/interface"},
+}
+
 // deviceCommand returns the SSH command used to export a device's running configuration.
 // Returns an empty string for unsupported device types.
 func deviceCommand(dev devicePayload) string {
-	switch dev.Type {
-	case "cisco":
-		return "show running-config view full"
-	case "mikrotik":
-		return "export show-sensitive verbose"
-	}
-	return ""
+	return deviceProfiles[dev.Type].command
 }
 
 // parseDeviceOutput strips device-specific preamble from SSH output, returning
 // the relevant configuration text starting at a known anchor line.
 func parseDeviceOutput(deviceType, output string) string {
-	switch deviceType {
-	case "cisco":
-		// Keep everything from the line containing "version" onwards.
-		if idx := strings.Index(output, "version"); idx >= 0 {
-			return output[idx:]
-		}
-	case "mikrotik":
-		// Keep everything from the first "/interface" onwards.
-		if idx := strings.Index(output, "/interface"); idx >= 0 {
+	if anchor := deviceProfiles[deviceType].anchor; anchor != "" {
+		if idx := strings.Index(output, anchor); idx >= 0 {
 			return output[idx:]
 		}
 	}
@@ -3,6 +3,8 @@
 package tasks
 
 import (
+	"context"
+	"fmt"
 	"io"
 	"log/slog"
 	"net/http"
@@ -10,6 +12,7 @@ import (
 	"time"
 
 	"github.com/forcedesk/forcedesk-agent/internal/config"
+	"github.com/forcedesk/forcedesk-agent/internal/scheduler"
 	"github.com/forcedesk/forcedesk-agent/internal/sshconn"
 	"github.com/forcedesk/forcedesk-agent/internal/tenant"
 )
@@ -65,16 +68,15 @@ type dqConfig struct {
 // DeviceManagerQuery polls the tenant for on-demand device query requests, executes
 // the requested SSH commands (validated against a strict allowlist), and reports results back.
 // Runs in a polling loop for 5 minutes before returning.
-func DeviceManagerQuery() {
-	slog.Info("devicequery: starting 5-minute polling loop")
+func DeviceManagerQuery(ctx context.Context) error {
+	slog.InfoContext(ctx, "devicequery: starting 5-minute polling loop")
 
 	client := tenant.New()
 
 	// Fetch the symmetric key once; it's shared across all requests in this run.
 	key, err := config.Get().Tenant.GetEncryptionKey()
 	if err != nil {
-		slog.Error("devicequery: failed to get encryption key", "err", err)
-		return
+		return fmt.Errorf("failed to get encryption key: %w", err)
 	}
 
 	// This task is triggered on-demand via the command queue. It polls every
@@ -85,72 +87,98 @@ func DeviceManagerQuery() {
 	deadline := time.Now().Add(maxRuntime)
 
 	url := tenant.URL("/api/agent/devicemanager/query-payloads")
+	processed := 0
 
 	for time.Now().Before(deadline) {
-		slog.Debug("devicequery: GET", "url", url)
+		// Queries arrive on the push channel while it is up.
+		if tenant.PushActive() {
+			if scheduler.Sleep(ctx, pollInterval) != nil {
+				break
+			}
+			continue
+		}
+
+		slog.DebugContext(ctx, "devicequery: GET", "url", url)
 
 		var result dqResponse
-		if err := client.GetEncryptedJSON(url, &result, key); err != nil {
-			slog.Error("devicequery: failed to fetch payloads", "err", err)
+		if err := client.GetEncryptedJSON(ctx, url, &result, key); err != nil {
+			slog.ErrorContext(ctx, "devicequery: failed to fetch payloads", "err", err)
 			// Back off and retry; a transient network error should not
 			// abort the entire polling session.
-			time.Sleep(pollInterval)
+			if scheduler.Sleep(ctx, pollInterval) != nil {
+				break
+			}
 			continue
 		}
 
-		slog.Debug("devicequery: poll response", "status", result.Status, "count", len(result.Payloads))
+		slog.DebugContext(ctx, "devicequery: poll response", "status", result.Status, "count", len(result.Payloads))
 
 		if result.Status != "success" || len(result.Payloads) == 0 {
 			// No work to do this tick; wait and poll again.
-			slog.Info("devicequery: no pending payloads")
-			time.Sleep(pollInterval)
+			slog.InfoContext(ctx, "devicequery: no pending payloads")
+			if scheduler.Sleep(ctx, pollInterval) != nil {
+				break
+			}
 			continue
 		}
 
-		slog.Info("devicequery: dispatching payloads", "count", len(result.Payloads))
-
-		// Run each query concurrently — SSH I/O is the bottleneck, so
-		// parallelism keeps total response latency low.
-		var wg sync.WaitGroup
-		for _, p := range result.Payloads {
-			wg.Add(1)
-			go func(payload dqPayload, legacyOpts string) {
-				defer wg.Done()
-				processDeviceQuery(client, payload, legacyOpts, key)
-			}(p, result.Config.LegacySSHOptions)
-		}
-		wg.Wait()
+		slog.InfoContext(ctx, "devicequery: dispatching payloads", "count", len(result.Payloads))
+		runDeviceQueries(ctx, client, result, key)
+		processed += len(result.Payloads)
 
 		// Even after successfully processing a batch, sleep before the next
 		// poll to give the server time to clear the completed entries.
-		time.Sleep(pollInterval)
+		if scheduler.Sleep(ctx, pollInterval) != nil {
+			break
+		}
 	}
 
-	slog.Info("devicequery: max runtime reached, exiting")
+	scheduler.Summarize(ctx, "queries processed: %d", processed)
+	if ctx.Err() != nil {
+		slog.InfoContext(ctx, "devicequery: cancelled, exiting", "err", ctx.Err())
+		return nil
+	}
+	slog.InfoContext(ctx, "devicequery: max runtime reached, exiting")
+	return nil
+}
+
+// runDeviceQueries runs each query in result concurrently and waits for them
+// all — SSH I/O is the bottleneck, so parallelism keeps total response
+// latency low.
+func runDeviceQueries(ctx context.Context, client *tenant.Client, result dqResponse, key []byte) {
+	var wg sync.WaitGroup
+	for _, p := range result.Payloads {
+		wg.Add(1)
+		go func(payload dqPayload, legacyOpts string) {
+			defer wg.Done()
+			processDeviceQuery(ctx, client, payload, legacyOpts, key)
+		}(p, result.Config.LegacySSHOptions)
+	}
+	wg.Wait()
 }
 
 // processDeviceQuery validates the command against the allowlist, executes it over SSH,
 // and posts the result (or an error) back to the tenant.
-func processDeviceQuery(client *tenant.Client, p dqPayload, legacySSHOpts string, key []byte) {
+func processDeviceQuery(ctx context.Context, client *tenant.Client, p dqPayload, legacySSHOpts string, key []byte) {
 	data := p.PayloadData
 
 	// Reject commands not in the static allowlist before making any network
 	// connection. This prevents the tenant (or anyone who compromises it) from
 	// running arbitrary commands on managed devices via the agent.
 	if !allowedCommands[data.Command] {
-		slog.Error("devicequery: command not in allowlist", "id", p.ID, "command", data.Command)
-		postQueryError(client, p.ID, "requested command is not permitted", key)
+		slog.ErrorContext(ctx, "devicequery: command not in allowlist", "id", p.ID, "command", data.Command)
+		postQueryError(ctx, client, p.ID, "requested command is not permitted", key)
 		return
 	}
 
 	// Validate that all required SSH connection fields are present; a missing
 	// field would cause a confusing SSH error rather than a clear failure.
 	if data.DeviceHostname == "" || data.Username == "" || data.Password == "" || data.Command == "" {
-		postQueryError(client, p.ID, "missing required payload fields", key)
+		postQueryError(ctx, client, p.ID, "missing required payload fields", key)
 		return
 	}
 
-	slog.Debug("devicequery: SSH command",
+	slog.DebugContext(ctx, "devicequery: SSH command",
 		"id", p.ID,
 		"host", data.DeviceHostname,
 		"port", data.Port,
@@ -167,19 +195,19 @@ func processDeviceQuery(client *tenant.Client, p dqPayload, legacySSHOpts string
 	}
 
 	// Execute the command over SSH; RunCommand enforces its own timeout.
-	output, err := sshconn.RunCommand(cfg, data.Command)
+	output, err := sshconn.RunCommand(ctx, cfg, data.Command)
 	if err != nil {
-		slog.Error("devicequery: SSH command failed", "id", p.ID, "err", err)
-		postQueryError(client, p.ID, err.Error(), key)
+		slog.ErrorContext(ctx, "devicequery: SSH command failed", "id", p.ID, "err", err)
+		postQueryError(ctx, client, p.ID, err.Error(), key)
 		return
 	}
 
-	slog.Debug("devicequery: SSH output received", "id", p.ID, "bytes", len(output))
+	slog.DebugContext(ctx, "devicequery: SSH output received", "id", p.ID, "bytes", len(output))
 
 	// Return the raw output plus metadata. Both "output" and "data" carry the
 	// same text; the duplication is intentional for compatibility with older
 	// server response handlers that expect one or the other field name.
-	postQueryResult(client, p.ID, map[string]any{
+	postQueryResult(ctx, client, p.ID, map[string]any{
 		"status":          "success",
 		"output":          output,
 		"data":            output,
@@ -190,26 +218,26 @@ func processDeviceQuery(client *tenant.Client, p dqPayload, legacySSHOpts string
 }
 
 // postQueryResult encrypts and POSTs a query response to /api/agent/devicemanager/query-response.
-func postQueryResult(client *tenant.Client, payloadID int64, responseData map[string]any, key []byte) {
+func postQueryResult(ctx context.Context, client *tenant.Client, payloadID int64, responseData map[string]any, key []byte) {
 	body := map[string]any{
 		"payload_id":    payloadID,
 		"response_data": responseData,
 	}
-	resp, err := client.PostEncryptedJSON(tenant.URL("/api/agent/devicemanager/query-response"), body, key)
+	resp, err := client.PostEncryptedJSON(ctx, tenant.URL("/api/agent/devicemanager/query-response"), body, key)
 	if err != nil {
-		slog.Error("devicequery: failed to post result", "id", payloadID, "err", err)
+		slog.ErrorContext(ctx, "devicequery: failed to post result", "id", payloadID, "err", err)
 		return
 	}
 	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
 		body, _ := io.ReadAll(resp.Body)
-		slog.Warn("devicequery: non-success response", "id", payloadID, "status", resp.StatusCode, "body", string(body))
+		slog.WarnContext(ctx, "devicequery: non-success response", "id", payloadID, "status", resp.StatusCode, "body", string(body))
 	}
 }
 
 // postQueryError posts an error result for the given payload ID back to the tenant.
-func postQueryError(client *tenant.Client, payloadID int64, message string, key []byte) {
-	postQueryResult(client, payloadID, map[string]any{
+func postQueryError(ctx context.Context, client *tenant.Client, payloadID int64, message string, key []byte) {
+	postQueryResult(ctx, client, payloadID, map[string]any{
 		"status": "error",
 		"error":  message,
 	}, key)
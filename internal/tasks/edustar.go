@@ -3,6 +3,7 @@
 package tasks
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -14,7 +15,10 @@ import (
 	"github.com/forcedesk/forcedesk-agent/internal/config"
 	"github.com/forcedesk/forcedesk-agent/internal/db"
 	"github.com/forcedesk/forcedesk-agent/internal/edustar"
+	"github.com/forcedesk/forcedesk-agent/internal/outbox"
+	"github.com/forcedesk/forcedesk-agent/internal/scheduler"
 	"github.com/forcedesk/forcedesk-agent/internal/tenant"
+	"github.com/forcedesk/forcedesk-agent/internal/transport"
 )
 
 // eduStarConfig holds STMC integration settings, sourced from either local
@@ -93,7 +97,7 @@ type EduStarCLIOpts struct {
 
 // resolveConfig returns EduStar config from local config.toml when enabled,
 // otherwise falls back to fetching from the tenant API.
-func resolveConfig(tc *tenant.Client) (*eduStarConfig, error) {
+func resolveConfig(ctx context.Context, tc *tenant.Client) (*eduStarConfig, error) {
 	local := config.Get().EduStar
 	if local.Enabled && local.Username != "" {
 		return &eduStarConfig{
@@ -107,19 +111,19 @@ func resolveConfig(tc *tenant.Client) (*eduStarConfig, error) {
 			AuthMode:                local.AuthMode,
 		}, nil
 	}
-	return fetchEduStarConfig(tc)
+	return fetchEduStarConfig(ctx, tc)
 }
 
 // fetchEduStarConfig retrieves STMC integration config from the tenant API.
 // The response is decrypted using the ChaCha20-Poly1305 key from [tenant] encryption_key in config.toml.
-func fetchEduStarConfig(tc *tenant.Client) (*eduStarConfig, error) {
+func fetchEduStarConfig(ctx context.Context, tc *tenant.Client) (*eduStarConfig, error) {
 	key, err := config.Get().Tenant.GetEncryptionKey()
 	if err != nil {
 		return nil, fmt.Errorf("encryption key: %w", err)
 	}
 
 	var cfg eduStarConfig
-	if err := tc.GetEncryptedJSON(tenant.URL("/api/agent/edustar-config"), &cfg, key); err != nil {
+	if err := tc.GetEncryptedJSON(ctx, tenant.URL("/api/agent/edustar-config"), &cfg, key); err != nil {
 		return nil, fmt.Errorf("fetch edustar config: %w", err)
 	}
 	if cfg.Username == "" || cfg.Password == "" {
@@ -129,18 +133,18 @@ func fetchEduStarConfig(tc *tenant.Client) (*eduStarConfig, error) {
 }
 
 // initClient resolves config and returns an authenticated STMC client.
-func initClient(tc *tenant.Client) (*edustar.Client, *eduStarConfig, error) {
-	cfg, err := resolveConfig(tc)
+func initClient(ctx context.Context, tc *tenant.Client) (*edustar.Client, *eduStarConfig, error) {
+	cfg, err := resolveConfig(ctx, tc)
 	if err != nil {
 		return nil, nil, err
 	}
 
 	stmc := edustar.New(cfg.AuthMode)
-	if err := stmc.Login(cfg.Username, cfg.Password); err != nil {
+	if err := stmc.Login(ctx, cfg.Username, cfg.Password); err != nil {
 		return nil, nil, fmt.Errorf("STMC login failed: %w", err)
 	}
 
-	slog.Info("edustar: authenticated", "mode", stmc.AuthMode)
+	slog.InfoContext(ctx, "edustar: authenticated", "mode", stmc.AuthMode)
 	return stmc, cfg, nil
 }
 
@@ -150,31 +154,42 @@ func initClient(tc *tenant.Client) (*edustar.Client, *eduStarConfig, error) {
 
 // EduStarService runs the full population sync: students, staff, and CRT accounts.
 // Registered in the scheduler. Only runs when EduStar is enabled in local config.
-func EduStarService() {
+func EduStarService(ctx context.Context) error {
 	if !config.Get().EduStar.Enabled {
-		slog.Info("edustar: disabled in config, skipping")
-		return
+		slog.InfoContext(ctx, "edustar: disabled in config, skipping")
+		return nil
 	}
 
-	slog.Info("edustar: starting population sync")
+	slog.InfoContext(ctx, "edustar: starting population sync")
 
 	tc := tenant.New()
-	if err := tc.TestConnectivity(); err != nil {
-		slog.Error("edustar: connectivity check failed", "err", err)
-		return
+	if err := tenant.CheckOnline(); err != nil {
+		return fmt.Errorf("connectivity check failed: %w", err)
 	}
 
-	stmc, cfg, err := initClient(tc)
+	stmc, cfg, err := initClient(ctx, tc)
 	if err != nil {
-		slog.Error("edustar: init failed", "err", err)
-		return
+		return fmt.Errorf("init failed: %w", err)
 	}
 
-	populateStudents(tc, stmc, cfg)
-	populateStaff(tc, stmc, cfg)
-	populateCRT(tc, stmc, cfg)
+	populateStudents(ctx, tc, stmc, cfg)
+	populateStaff(ctx, tc, stmc, cfg)
+	populateCRT(ctx, tc, stmc, cfg)
+
+	slog.InfoContext(ctx, "edustar: population sync complete")
+	return nil
+}
 
-	slog.Info("edustar: population sync complete")
+// EduStarEnableCRT enables CRT accounts and sets their daily passwords.
+// Registered in the scheduler when [edustar] crt_enable_schedule is set.
+func EduStarEnableCRT(ctx context.Context) error {
+	return EduStarCommand(ctx, "enable-crt-accounts")
+}
+
+// EduStarExpireCRT disables CRT accounts and scrambles their passwords.
+// Registered in the scheduler when [edustar] crt_expire_schedule is set.
+func EduStarExpireCRT(ctx context.Context) error {
+	return EduStarCommand(ctx, "expire-crt-accounts")
 }
 
 // ============================================================
@@ -182,47 +197,46 @@ func EduStarService() {
 // ============================================================
 
 // EduStarCommand runs a single named action triggered by the command queue,
-// posting results back to the tenant.
-func EduStarCommand(action string) {
+// posting results back to the tenant. The CRT actions report failures in the
+// returned error so scheduled runs are recorded accurately.
+func EduStarCommand(ctx context.Context, action string) error {
 	if action == "" {
-		slog.Error("edustar: command received with no action")
-		return
+		return fmt.Errorf("command received with no action")
 	}
 
-	slog.Info("edustar: running command", "action", action)
+	slog.InfoContext(ctx, "edustar: running command", "action", action)
 
 	tc := tenant.New()
-	if err := tc.TestConnectivity(); err != nil {
-		slog.Error("edustar: connectivity check failed", "err", err, "action", action)
-		return
+	if err := tenant.CheckOnline(); err != nil {
+		return fmt.Errorf("connectivity check failed: %w", err)
 	}
 
-	stmc, cfg, err := initClient(tc)
+	stmc, cfg, err := initClient(ctx, tc)
 	if err != nil {
-		slog.Error("edustar: init failed", "err", err, "action", action)
-		return
+		return fmt.Errorf("init failed: %w", err)
 	}
 
 	switch action {
 	case "populate-student-accounts":
-		populateStudents(tc, stmc, cfg)
+		populateStudents(ctx, tc, stmc, cfg)
 	case "populate-staff-accounts":
-		populateStaff(tc, stmc, cfg)
+		populateStaff(ctx, tc, stmc, cfg)
 	case "populate-crt-accounts":
-		populateCRT(tc, stmc, cfg)
+		populateCRT(ctx, tc, stmc, cfg)
 	case "expire-crt-accounts":
-		expireCRT(tc, stmc, cfg)
+		return expireCRT(ctx, tc, stmc, cfg)
 	case "enable-crt-accounts":
-		enableCRT(tc, stmc, cfg)
+		return enableCRT(ctx, tc, stmc, cfg)
 	case "populate-service-accounts":
-		populateServiceAccounts(tc, stmc, cfg)
+		populateServiceAccounts(ctx, tc, stmc, cfg)
 	case "expire-service-accounts":
-		expireServiceAccounts(tc, stmc, cfg)
+		expireServiceAccounts(ctx, tc, stmc, cfg)
 	case "enable-service-accounts":
-		enableServiceAccounts(tc, stmc, cfg)
+		enableServiceAccounts(ctx, tc, stmc, cfg)
 	default:
-		slog.Warn("edustar: unknown action", "action", action)
+		return fmt.Errorf("unknown action %q", action)
 	}
+	return nil
 }
 
 // ============================================================
@@ -230,112 +244,120 @@ func EduStarCommand(action string) {
 // ============================================================
 
 // populateStudents fetches all students for the configured school from STMC and posts them to the tenant.
-func populateStudents(tc *tenant.Client, stmc *edustar.Client, cfg *eduStarConfig) {
-	slog.Info("edustar: fetching students", "school", cfg.SchoolCode)
+func populateStudents(ctx context.Context, tc *tenant.Client, stmc *edustar.Client, cfg *eduStarConfig) {
+	slog.InfoContext(ctx, "edustar: fetching students", "school", cfg.SchoolCode)
 
-	students, err := stmc.GetStudents(cfg.SchoolCode)
+	students, err := stmc.GetStudents(ctx, cfg.SchoolCode)
 	if err != nil {
-		slog.Error("edustar: GetStudents failed", "err", err)
+		slog.ErrorContext(ctx, "edustar: GetStudents failed", "err", err)
 		return
 	}
 
-	resp, err := tc.PostJSON(tenant.URL("/api/agent/ingest/edustar/students"), students)
+	resp, err := tc.PostJSON(ctx, tenant.URL("/api/agent/ingest/edustar/students"), students)
 	if err != nil {
-		slog.Error("edustar: failed to post students", "err", err)
+		slog.ErrorContext(ctx, "edustar: failed to post students", "err", err)
 		return
 	}
 	defer resp.Body.Close()
 
-	slog.Info("edustar: students synced", "count", len(students), "status", resp.StatusCode)
+	slog.InfoContext(ctx, "edustar: students synced", "count", len(students), "status", resp.StatusCode)
 }
 
 // populateStaff fetches staff (and technicians) for the configured school from STMC and posts them to the tenant.
-func populateStaff(tc *tenant.Client, stmc *edustar.Client, cfg *eduStarConfig) {
-	slog.Info("edustar: fetching staff", "school", cfg.SchoolCode)
+func populateStaff(ctx context.Context, tc *tenant.Client, stmc *edustar.Client, cfg *eduStarConfig) {
+	slog.InfoContext(ctx, "edustar: fetching staff", "school", cfg.SchoolCode)
 
-	staff, err := stmc.GetStaff(cfg.SchoolCode)
+	staff, err := stmc.GetStaff(ctx, cfg.SchoolCode)
 	if err != nil {
-		slog.Error("edustar: GetStaff failed", "err", err)
+		slog.ErrorContext(ctx, "edustar: GetStaff failed", "err", err)
 		return
 	}
 
-	resp, err := tc.PostJSON(tenant.URL("/api/agent/ingest/edustar/staff"), staff)
+	resp, err := tc.PostJSON(ctx, tenant.URL("/api/agent/ingest/edustar/staff"), staff)
 	if err != nil {
-		slog.Error("edustar: failed to post staff", "err", err)
+		slog.ErrorContext(ctx, "edustar: failed to post staff", "err", err)
 		return
 	}
 	defer resp.Body.Close()
 
-	slog.Info("edustar: staff synced", "status", resp.StatusCode)
+	slog.InfoContext(ctx, "edustar: staff synced", "status", resp.StatusCode)
 }
 
 // populateCRT fetches the members of the CRT group from STMC and posts them to the tenant.
 // Skipped when CRTGroupDN or CRTGroupName is not configured.
-func populateCRT(tc *tenant.Client, stmc *edustar.Client, cfg *eduStarConfig) {
+func populateCRT(ctx context.Context, tc *tenant.Client, stmc *edustar.Client, cfg *eduStarConfig) {
 	if cfg.CRTGroupDN == "" || cfg.CRTGroupName == "" {
-		slog.Warn("edustar: CRT group DN/name not configured, skipping CRT sync")
+		slog.WarnContext(ctx, "edustar: CRT group DN/name not configured, skipping CRT sync")
 		return
 	}
 
-	slog.Info("edustar: fetching CRT group members", "group", cfg.CRTGroupName)
+	slog.InfoContext(ctx, "edustar: fetching CRT group members", "group", cfg.CRTGroupName)
 
-	members, err := stmc.GetGroup(cfg.SchoolCode, cfg.CRTGroupName, cfg.CRTGroupDN)
+	members, err := stmc.GetGroup(ctx, cfg.SchoolCode, cfg.CRTGroupName, cfg.CRTGroupDN)
 	if err != nil {
-		slog.Error("edustar: GetGroup failed", "err", err)
+		slog.ErrorContext(ctx, "edustar: GetGroup failed", "err", err)
 		return
 	}
 
-	resp, err := tc.PostJSON(tenant.URL("/api/agent/ingest/edustar/crt-accounts"), members)
+	resp, err := tc.PostJSON(ctx, tenant.URL("/api/agent/ingest/edustar/crt-accounts"), members)
 	if err != nil {
-		slog.Error("edustar: failed to post CRT accounts", "err", err)
+		slog.ErrorContext(ctx, "edustar: failed to post CRT accounts", "err", err)
 		return
 	}
 	defer resp.Body.Close()
 
-	slog.Info("edustar: CRT accounts synced", "count", len(members), "status", resp.StatusCode)
+	slog.InfoContext(ctx, "edustar: CRT accounts synced", "count", len(members), "status", resp.StatusCode)
 }
 
 // expireCRT disables each CRT account in STMC and scrambles its password so it
 // cannot be used even if re-enabled manually outside this system.
-func expireCRT(tc *tenant.Client, stmc *edustar.Client, cfg *eduStarConfig) {
-	slog.Info("edustar: expiring CRT accounts")
+func expireCRT(ctx context.Context, tc *tenant.Client, stmc *edustar.Client, cfg *eduStarConfig) error {
+	slog.InfoContext(ctx, "edustar: expiring CRT accounts")
 
 	// Fetch the current CRT account list from the tenant rather than querying
 	// STMC directly — the tenant is the authoritative source for which accounts
 	// belong to the CRT rotation on a given day.
-	accounts, err := fetchCRTAccounts(tc)
+	accounts, err := fetchCRTAccounts(ctx, tc)
 	if err != nil {
-		slog.Error("edustar: failed to fetch CRT accounts", "err", err)
-		return
+		return fmt.Errorf("failed to fetch CRT accounts: %w", err)
 	}
 
+	expired := 0
 	for _, acc := range accounts {
 		// Step 1: Disable the account in STMC to prevent login immediately.
-		if err := stmc.DisableServiceAccount(cfg.SchoolCode, acc.LdapDN); err != nil {
-			slog.Error("edustar: disable failed", "login", acc.Login, "err", err)
+		if err := stmc.DisableServiceAccount(ctx, cfg.SchoolCode, acc.LdapDN); err != nil {
+			slog.ErrorContext(ctx, "edustar: disable failed", "login", acc.Login, "err", err)
 			continue
 		}
 		// Step 2: Scramble the password with a random UUID so the account cannot be
 		// reactivated simply by re-enabling it — the credential is now unknown to anyone.
-		if err := stmc.SetStudentPassword(cfg.SchoolCode, acc.LdapDN, newUUID()); err != nil {
-			slog.Error("edustar: password scramble failed", "login", acc.Login, "err", err)
+		if err := stmc.SetStudentPassword(ctx, cfg.SchoolCode, acc.LdapDN, newUUID()); err != nil {
+			slog.ErrorContext(ctx, "edustar: password scramble failed", "login", acc.Login, "err", err)
+		}
+		slog.InfoContext(ctx, "edustar: CRT account expired", "login", acc.Login)
+		expired++
+		if scheduler.Sleep(ctx, 5*time.Second) != nil {
+			slog.WarnContext(ctx, "edustar: CRT expire cancelled", "err", ctx.Err())
+			break
 		}
-		slog.Info("edustar: CRT account expired", "login", acc.Login)
-		time.Sleep(5 * time.Second)
 	}
 
-	slog.Info("edustar: CRT expire complete", "count", len(accounts))
+	slog.InfoContext(ctx, "edustar: CRT expire complete", "count", len(accounts))
+	scheduler.Summarize(ctx, "CRT accounts expired: %d of %d", expired, len(accounts))
+	if expired < len(accounts) {
+		return fmt.Errorf("expired %d of %d CRT accounts", expired, len(accounts))
+	}
+	return nil
 }
 
 // enableCRT re-enables each CRT account in STMC, sets a fresh daily password via
 // password.ninja, and posts the updated credentials to the tenant for the daily CRT email.
-func enableCRT(tc *tenant.Client, stmc *edustar.Client, cfg *eduStarConfig) {
-	slog.Info("edustar: enabling CRT accounts")
+func enableCRT(ctx context.Context, tc *tenant.Client, stmc *edustar.Client, cfg *eduStarConfig) error {
+	slog.InfoContext(ctx, "edustar: enabling CRT accounts")
 
-	accounts, err := fetchCRTAccounts(tc)
+	accounts, err := fetchCRTAccounts(ctx, tc)
 	if err != nil {
-		slog.Error("edustar: failed to fetch CRT accounts", "err", err)
-		return
+		return fmt.Errorf("failed to fetch CRT accounts: %w", err)
 	}
 
 	type crtPassword struct {
@@ -352,62 +374,78 @@ func enableCRT(tc *tenant.Client, stmc *edustar.Client, cfg *eduStarConfig) {
 	// in the daily CRT email with a stale or unknown credential.
 	for _, acc := range accounts {
 		// Step 1: Re-enable the AD account so the CRT can log in today.
-		if err := stmc.EnableServiceAccount(cfg.SchoolCode, acc.LdapDN); err != nil {
-			slog.Error("edustar: enable failed", "login", acc.Login, "err", err)
+		if err := stmc.EnableServiceAccount(ctx, cfg.SchoolCode, acc.LdapDN); err != nil {
+			slog.ErrorContext(ctx, "edustar: enable failed", "login", acc.Login, "err", err)
 			continue
 		}
 
 		// Step 2: Generate a strong random password from password.ninja.
 		// A fresh password is created each day so that yesterday's credential
 		// becomes useless after expireCRT scrambles it tonight.
-		pwd, err := generatePassword()
+		pwd, err := generatePassword(ctx)
 		if err != nil {
-			slog.Error("edustar: password generation failed", "login", acc.Login, "err", err)
+			slog.ErrorContext(ctx, "edustar: password generation failed", "login", acc.Login, "err", err)
 			continue
 		}
 
 		// Wait for STMC to finish processing the enable before setting the password.
-		time.Sleep(5 * time.Second)
+		if scheduler.Sleep(ctx, 5*time.Second) != nil {
+			break
+		}
 
 		// Step 3: Push the new password into STMC at least three times so it takes effect immediately.
-		if err := stmc.SetStudentPassword(cfg.SchoolCode, acc.LdapDN, pwd); err != nil {
-			slog.Error("edustar: set password failed", "login", acc.Login, "err", err)
+		if err := stmc.SetStudentPassword(ctx, cfg.SchoolCode, acc.LdapDN, pwd); err != nil {
+			slog.ErrorContext(ctx, "edustar: set password failed", "login", acc.Login, "err", err)
 			continue
 		}
 
-		slog.Info("edustar: CRT account enabled", "login", acc.Login)
+		slog.InfoContext(ctx, "edustar: CRT account enabled", "login", acc.Login)
 		updated = append(updated, crtPassword{Login: acc.Login, LdapDN: acc.LdapDN, Password: pwd})
-		time.Sleep(5 * time.Second)
+		if scheduler.Sleep(ctx, 5*time.Second) != nil {
+			break
+		}
 	}
 
+	if ctx.Err() != nil {
+		slog.WarnContext(ctx, "edustar: CRT enable cancelled", "updated", len(updated), "err", ctx.Err())
+	}
+	scheduler.Summarize(ctx, "CRT accounts enabled: %d of %d", len(updated), len(accounts))
 	if len(updated) == 0 {
-		return
+		if len(accounts) > 0 {
+			return fmt.Errorf("enabled 0 of %d CRT accounts", len(accounts))
+		}
+		return nil
 	}
 
-	// Post updated passwords to the tenant so it can store them and send the daily CRT email.
-	resp, err := tc.PostJSON(tenant.URL("/api/agent/ingest/edustar/crt-passwords"), updated)
+	// Post updated passwords to the tenant so it can store them and send the
+	// daily CRT email. They are already live in STMC, so they go through the
+	// outbox, which still delivers them if the run was cancelled part-way and
+	// keeps them until the tenant is reachable.
+	queued, err := outbox.Post(ctx, tc, outbox.KindJSON, "/api/agent/ingest/edustar/crt-passwords", updated)
 	if err != nil {
-		slog.Error("edustar: failed to post CRT passwords", "err", err)
-		return
+		return fmt.Errorf("failed to post CRT passwords: %w", err)
 	}
-	defer resp.Body.Close()
 
-	slog.Info("edustar: CRT enable complete", "count", len(updated), "status", resp.StatusCode)
+	slog.InfoContext(ctx, "edustar: CRT enable complete", "count", len(updated), "queued", queued)
+	if len(updated) < len(accounts) {
+		return fmt.Errorf("enabled %d of %d CRT accounts", len(updated), len(accounts))
+	}
+	return nil
 }
 
 // fetchCRTAccounts retrieves the list of CRT accounts stored on the tenant.
-func fetchCRTAccounts(tc *tenant.Client) ([]crtAccount, error) {
+func fetchCRTAccounts(ctx context.Context, tc *tenant.Client) ([]crtAccount, error) {
 	var accounts []crtAccount
-	if err := tc.GetJSON(tenant.URL("/api/agent/edustar/crt-accounts"), &accounts); err != nil {
+	if err := tc.GetJSON(ctx, tenant.URL("/api/agent/edustar/crt-accounts"), &accounts); err != nil {
 		return nil, err
 	}
 	return accounts, nil
 }
 
 // fetchServiceAccounts retrieves the list of managed service accounts stored on the tenant.
-func fetchServiceAccounts(tc *tenant.Client) ([]serviceAccount, error) {
+func fetchServiceAccounts(ctx context.Context, tc *tenant.Client) ([]serviceAccount, error) {
 	var accounts []serviceAccount
-	if err := tc.GetJSON(tenant.URL("/api/agent/edustar/service-accounts"), &accounts); err != nil {
+	if err := tc.GetJSON(ctx, tenant.URL("/api/agent/edustar/service-accounts"), &accounts); err != nil {
 		return nil, err
 	}
 	return accounts, nil
@@ -415,72 +453,72 @@ func fetchServiceAccounts(tc *tenant.Client) ([]serviceAccount, error) {
 
 // populateServiceAccounts fetches members of the service account group from STMC and posts them to the tenant.
 // Skipped when ServiceAccountGroupDN or ServiceAccountGroupName is not configured.
-func populateServiceAccounts(tc *tenant.Client, stmc *edustar.Client, cfg *eduStarConfig) {
+func populateServiceAccounts(ctx context.Context, tc *tenant.Client, stmc *edustar.Client, cfg *eduStarConfig) {
 	if cfg.ServiceAccountGroupDN == "" || cfg.ServiceAccountGroupName == "" {
-		slog.Warn("edustar: service account group DN/name not configured, skipping service account sync")
+		slog.WarnContext(ctx, "edustar: service account group DN/name not configured, skipping service account sync")
 		return
 	}
 
-	slog.Info("edustar: fetching service account group members", "group", cfg.ServiceAccountGroupName)
+	slog.InfoContext(ctx, "edustar: fetching service account group members", "group", cfg.ServiceAccountGroupName)
 
-	members, err := stmc.GetGroup(cfg.SchoolCode, cfg.ServiceAccountGroupName, cfg.ServiceAccountGroupDN)
+	members, err := stmc.GetGroup(ctx, cfg.SchoolCode, cfg.ServiceAccountGroupName, cfg.ServiceAccountGroupDN)
 	if err != nil {
-		slog.Error("edustar: GetGroup failed", "err", err)
+		slog.ErrorContext(ctx, "edustar: GetGroup failed", "err", err)
 		return
 	}
 
-	resp, err := tc.PostJSON(tenant.URL("/api/agent/ingest/edustar/service-accounts"), members)
+	resp, err := tc.PostJSON(ctx, tenant.URL("/api/agent/ingest/edustar/service-accounts"), members)
 	if err != nil {
-		slog.Error("edustar: failed to post service accounts", "err", err)
+		slog.ErrorContext(ctx, "edustar: failed to post service accounts", "err", err)
 		return
 	}
 	defer resp.Body.Close()
 
-	slog.Info("edustar: service accounts synced", "count", len(members), "status", resp.StatusCode)
+	slog.InfoContext(ctx, "edustar: service accounts synced", "count", len(members), "status", resp.StatusCode)
 }
 
 // expireServiceAccounts disables each managed service account in STMC, sets a PasswordNinja
 // password as the scramble, and stores it locally for use by enableServiceAccounts.
-func expireServiceAccounts(tc *tenant.Client, stmc *edustar.Client, cfg *eduStarConfig) {
-	slog.Info("edustar: expiring service accounts")
+func expireServiceAccounts(ctx context.Context, tc *tenant.Client, stmc *edustar.Client, cfg *eduStarConfig) {
+	slog.InfoContext(ctx, "edustar: expiring service accounts")
 
-	accounts, err := fetchServiceAccounts(tc)
+	accounts, err := fetchServiceAccounts(ctx, tc)
 	if err != nil {
-		slog.Error("edustar: failed to fetch service accounts", "err", err)
+		slog.ErrorContext(ctx, "edustar: failed to fetch service accounts", "err", err)
 		return
 	}
 
 	for _, acc := range accounts {
-		if err := stmc.DisableServiceAccount(cfg.SchoolCode, acc.LdapDN); err != nil {
-			slog.Error("edustar: disable service account failed", "login", acc.Login, "err", err)
+		if err := stmc.DisableServiceAccount(ctx, cfg.SchoolCode, acc.LdapDN); err != nil {
+			slog.ErrorContext(ctx, "edustar: disable service account failed", "login", acc.Login, "err", err)
 			continue
 		}
-		pwd, err := generatePassword()
+		pwd, err := generatePassword(ctx)
 		if err != nil {
-			slog.Error("edustar: password generation failed", "login", acc.Login, "err", err)
+			slog.ErrorContext(ctx, "edustar: password generation failed", "login", acc.Login, "err", err)
 			continue
 		}
-		if err := stmc.SetStudentPassword(cfg.SchoolCode, acc.LdapDN, pwd); err != nil {
-			slog.Error("edustar: password scramble failed", "login", acc.Login, "err", err)
+		if err := stmc.SetStudentPassword(ctx, cfg.SchoolCode, acc.LdapDN, pwd); err != nil {
+			slog.ErrorContext(ctx, "edustar: password scramble failed", "login", acc.Login, "err", err)
 			continue
 		}
 		if err := db.UpsertServiceAccountPassword(acc.Login, acc.LdapDN, pwd); err != nil {
-			slog.Error("edustar: store service account password failed", "login", acc.Login, "err", err)
+			slog.ErrorContext(ctx, "edustar: store service account password failed", "login", acc.Login, "err", err)
 		}
-		slog.Info("edustar: service account expired", "login", acc.Login)
+		slog.InfoContext(ctx, "edustar: service account expired", "login", acc.Login)
 	}
 
-	slog.Info("edustar: service account expire complete", "count", len(accounts))
+	slog.InfoContext(ctx, "edustar: service account expire complete", "count", len(accounts))
 }
 
 // enableServiceAccounts re-enables each service account in STMC, re-applies the password stored
 // during expireServiceAccounts, and posts the updated credentials to the tenant.
-func enableServiceAccounts(tc *tenant.Client, stmc *edustar.Client, cfg *eduStarConfig) {
-	slog.Info("edustar: enabling service accounts")
+func enableServiceAccounts(ctx context.Context, tc *tenant.Client, stmc *edustar.Client, cfg *eduStarConfig) {
+	slog.InfoContext(ctx, "edustar: enabling service accounts")
 
-	accounts, err := fetchServiceAccounts(tc)
+	accounts, err := fetchServiceAccounts(ctx, tc)
 	if err != nil {
-		slog.Error("edustar: failed to fetch service accounts", "err", err)
+		slog.ErrorContext(ctx, "edustar: failed to fetch service accounts", "err", err)
 		return
 	}
 
@@ -492,50 +530,53 @@ func enableServiceAccounts(tc *tenant.Client, stmc *edustar.Client, cfg *eduStar
 	var updated []svcPassword
 
 	for _, acc := range accounts {
-		slog.Info("edustar: processing service account", "login", acc.Login, "dn", acc.LdapDN)
-		slog.Info("edustar: enabling service account in STMC", "login", acc.Login)
-		if err := stmc.EnableServiceAccount(cfg.SchoolCode, acc.LdapDN); err != nil {
-			slog.Error("edustar: enable service account failed", "login", acc.Login, "err", err)
+		slog.InfoContext(ctx, "edustar: processing service account", "login", acc.Login, "dn", acc.LdapDN)
+		slog.InfoContext(ctx, "edustar: enabling service account in STMC", "login", acc.Login)
+		if err := stmc.EnableServiceAccount(ctx, cfg.SchoolCode, acc.LdapDN); err != nil {
+			slog.ErrorContext(ctx, "edustar: enable service account failed", "login", acc.Login, "err", err)
 			continue
 		}
-		pwd, err := generatePassword()
+		pwd, err := generatePassword(ctx)
 		if err != nil {
-			slog.Error("edustar: password generation failed", "login", acc.Login, "err", err)
+			slog.ErrorContext(ctx, "edustar: password generation failed", "login", acc.Login, "err", err)
 			continue
 		}
-		slog.Info("edustar: setting service account password", "login", acc.Login, "password", pwd)
-		if err := stmc.SetStudentPassword(cfg.SchoolCode, acc.LdapDN, pwd); err != nil {
-			slog.Error("edustar: set service account password failed", "login", acc.Login, "dn", acc.LdapDN, "password", pwd, "err", err)
+		slog.InfoContext(ctx, "edustar: setting service account password", "login", acc.Login, "password", pwd)
+		if err := stmc.SetStudentPassword(ctx, cfg.SchoolCode, acc.LdapDN, pwd); err != nil {
+			slog.ErrorContext(ctx, "edustar: set service account password failed", "login", acc.Login, "dn", acc.LdapDN, "password", pwd, "err", err)
 			continue
 		}
-		slog.Info("edustar: service account enabled", "login", acc.Login)
+		slog.InfoContext(ctx, "edustar: service account enabled", "login", acc.Login)
 		updated = append(updated, svcPassword{Login: acc.Login, LdapDN: acc.LdapDN, Password: pwd})
 	}
 
-	slog.Info("edustar: service accounts processed", "total", len(accounts), "updated", len(updated))
+	slog.InfoContext(ctx, "edustar: service accounts processed", "total", len(accounts), "updated", len(updated))
 
 	if len(updated) == 0 {
 		return
 	}
 
-	slog.Info("edustar: posting service account passwords to tenant", "count", len(updated))
-	resp, err := tc.PostJSON(tenant.URL("/api/agent/ingest/edustar/service-passwords"), updated)
+	slog.InfoContext(ctx, "edustar: posting service account passwords to tenant", "count", len(updated))
+	queued, err := outbox.Post(ctx, tc, outbox.KindJSON, "/api/agent/ingest/edustar/service-passwords", updated)
 	if err != nil {
-		slog.Error("edustar: failed to post service account passwords", "err", err)
+		slog.ErrorContext(ctx, "edustar: failed to post service account passwords", "err", err)
 		return
 	}
-	defer resp.Body.Close()
 
-	slog.Info("edustar: service account enable complete", "count", len(updated), "status", resp.StatusCode)
+	slog.InfoContext(ctx, "edustar: service account enable complete", "count", len(updated), "queued", queued)
 }
 
 // generatePassword fetches a single strong password from the password.ninja API.
 // The response is a JSON-quoted string (e.g. `"abc123"`) that is unquoted before returning.
-func generatePassword() (string, error) {
+func generatePassword(ctx context.Context) (string, error) {
 	// Request one password with symbols, capitals, and numeric characters.
 	// excludeSymbols=f means "false" — symbols ARE included. The API returns a
 	// bare JSON string (not a JSON object), e.g.: `"Abc!123xyz"`.
-	resp, err := http.Get("https://password.ninja/api/password?symbols=true&capitals=true&numOfPasswords=1&excludeSymbols=f") //nolint:noctx
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "https://password.ninja/api/password?symbols=true&capitals=true&numOfPasswords=1&excludeSymbols=f", nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := transport.Client().Do(req)
 	if err != nil {
 		return "", err
 	}
@@ -566,9 +607,9 @@ func generatePassword() (string, error) {
 // RunEduStarCLI executes an EduStar action and prints the result to stdout.
 // Config is resolved from local config.toml first; if not configured locally it is
 // fetched from the tenant API (encrypted). No connectivity pre-check is performed.
-func RunEduStarCLI(action string, opts EduStarCLIOpts) {
+func RunEduStarCLI(ctx context.Context, action string, opts EduStarCLIOpts) {
 	tc := tenant.New()
-	stmc, cfg, err := initClient(tc)
+	stmc, cfg, err := initClient(ctx, tc)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "edustar: %v\n", err)
 		os.Exit(1)
@@ -586,67 +627,67 @@ func RunEduStarCLI(action string, opts EduStarCLIOpts) {
 	// ── Info / read-only ────────────────────────────────────────────────────
 
 	case "whoami":
-		result, err := stmc.WhoAmI()
+		result, err := stmc.WhoAmI(ctx)
 		cliPrint(result, err)
 
 	case "schools":
-		result, err := stmc.GetSchools()
+		result, err := stmc.GetSchools(ctx)
 		cliPrint(result, err)
 
 	case "all-schools":
-		result, err := stmc.GetAllSchools()
+		result, err := stmc.GetAllSchools(ctx)
 		cliPrint(result, err)
 
 	case "students":
-		result, err := stmc.GetStudents(school)
+		result, err := stmc.GetStudents(ctx, school)
 		cliPrint(result, err)
 
 	case "staff":
-		result, err := stmc.GetStaff(school)
+		result, err := stmc.GetStaff(ctx, school)
 		cliPrint(result, err)
 
 	case "technicians":
-		result, err := stmc.GetTechnicians(school)
+		result, err := stmc.GetTechnicians(ctx, school)
 		cliPrint(result, err)
 
 	case "groups":
-		result, err := stmc.GetGroups(school)
+		result, err := stmc.GetGroups(ctx, school)
 		cliPrint(result, err)
 
 	case "certificates":
-		result, err := stmc.GetCertificates(school)
+		result, err := stmc.GetCertificates(ctx, school)
 		cliPrint(result, err)
 
 	case "service-accounts":
-		result, err := stmc.GetServiceAccounts(school)
+		result, err := stmc.GetServiceAccounts(ctx, school)
 		cliPrint(result, err)
 
 	case "nps":
-		result, err := stmc.GetNps(school)
+		result, err := stmc.GetNps(ctx, school)
 		cliPrint(result, err)
 
 	case "user":
 		requireFlag("--dn", opts.DN)
-		result, err := stmc.GetUser(opts.DN)
+		result, err := stmc.GetUser(ctx, opts.DN)
 		cliPrint(result, err)
 
 	case "group":
 		requireFlag("--group-dn", opts.GroupDN)
 		requireFlag("--group-name", opts.GroupName)
-		result, err := stmc.GetGroup(school, opts.GroupName, opts.GroupDN)
+		result, err := stmc.GetGroup(ctx, school, opts.GroupName, opts.GroupDN)
 		cliPrint(result, err)
 
 	// ── Password operations ──────────────────────────────────────────────────
 
 	case "reset-password":
 		requireFlag("--dn", opts.DN)
-		result, err := stmc.ResetStudentPassword(school, opts.DN)
+		result, err := stmc.ResetStudentPassword(ctx, school, opts.DN)
 		cliPrint(result, err)
 
 	case "set-password":
 		requireFlag("--dn", opts.DN)
 		requireFlag("--new-password", opts.NewPassword)
-		if err := stmc.SetStudentPassword(school, opts.DN, opts.NewPassword); err != nil {
+		if err := stmc.SetStudentPassword(ctx, school, opts.DN, opts.NewPassword); err != nil {
 			cliError(err)
 		}
 		fmt.Println("Password set successfully.")
@@ -656,7 +697,7 @@ func RunEduStarCLI(action string, opts EduStarCLIOpts) {
 	case "add-to-group":
 		requireFlag("--group-dn", opts.GroupDN)
 		requireFlag("--member-dn", opts.MemberDN)
-		if err := stmc.AddToGroup(school, opts.GroupDN, opts.MemberDN); err != nil {
+		if err := stmc.AddToGroup(ctx, school, opts.GroupDN, opts.MemberDN); err != nil {
 			cliError(err)
 		}
 		fmt.Println("Member added successfully.")
@@ -664,7 +705,7 @@ func RunEduStarCLI(action string, opts EduStarCLIOpts) {
 	case "remove-from-group":
 		requireFlag("--group-dn", opts.GroupDN)
 		requireFlag("--member-dn", opts.MemberDN)
-		if err := stmc.RemoveFromGroup(school, opts.GroupDN, opts.MemberDN); err != nil {
+		if err := stmc.RemoveFromGroup(ctx, school, opts.GroupDN, opts.MemberDN); err != nil {
 			cliError(err)
 		}
 		fmt.Println("Member removed successfully.")
@@ -673,7 +714,7 @@ func RunEduStarCLI(action string, opts EduStarCLIOpts) {
 
 	case "populate-student-accounts":
 		fmt.Printf("Fetching students for school %s...\n", cfg.SchoolCode)
-		students, err := stmc.GetStudents(cfg.SchoolCode)
+		students, err := stmc.GetStudents(ctx, cfg.SchoolCode)
 		if err != nil {
 			cliError(fmt.Errorf("GetStudents: %w", err))
 		}
@@ -682,7 +723,7 @@ func RunEduStarCLI(action string, opts EduStarCLIOpts) {
 			break
 		}
 		fmt.Printf("Fetched %d students. Posting to tenant...\n", len(students))
-		resp, err := tc.PostJSON(tenant.URL("/api/agent/ingest/edustar/students"), students)
+		resp, err := tc.PostJSON(ctx, tenant.URL("/api/agent/ingest/edustar/students"), students)
 		if err != nil {
 			cliError(fmt.Errorf("post students: %w", err))
 		}
@@ -691,7 +732,7 @@ func RunEduStarCLI(action string, opts EduStarCLIOpts) {
 
 	case "populate-staff-accounts":
 		fmt.Printf("Fetching staff for school %s...\n", cfg.SchoolCode)
-		staff, err := stmc.GetStaff(cfg.SchoolCode)
+		staff, err := stmc.GetStaff(ctx, cfg.SchoolCode)
 		if err != nil {
 			cliError(fmt.Errorf("GetStaff: %w", err))
 		}
@@ -700,7 +741,7 @@ func RunEduStarCLI(action string, opts EduStarCLIOpts) {
 			break
 		}
 		fmt.Printf("Fetched %d staff. Posting to tenant...\n", len(staff))
-		resp, err := tc.PostJSON(tenant.URL("/api/agent/ingest/edustar/staff"), staff)
+		resp, err := tc.PostJSON(ctx, tenant.URL("/api/agent/ingest/edustar/staff"), staff)
 		if err != nil {
 			cliError(fmt.Errorf("post staff: %w", err))
 		}
@@ -711,7 +752,7 @@ func RunEduStarCLI(action string, opts EduStarCLIOpts) {
 		requireFlag("--group-dn", cfg.CRTGroupDN)
 		requireFlag("--group-name", cfg.CRTGroupName)
 		fmt.Printf("Fetching CRT group %q...\n", cfg.CRTGroupName)
-		members, err := stmc.GetGroup(cfg.SchoolCode, cfg.CRTGroupName, cfg.CRTGroupDN)
+		members, err := stmc.GetGroup(ctx, cfg.SchoolCode, cfg.CRTGroupName, cfg.CRTGroupDN)
 		if err != nil {
 			cliError(fmt.Errorf("GetGroup: %w", err))
 		}
@@ -720,7 +761,7 @@ func RunEduStarCLI(action string, opts EduStarCLIOpts) {
 			break
 		}
 		fmt.Printf("Fetched %d members. Posting to tenant...\n", len(members))
-		resp, err := tc.PostJSON(tenant.URL("/api/agent/ingest/edustar/crt-accounts"), members)
+		resp, err := tc.PostJSON(ctx, tenant.URL("/api/agent/ingest/edustar/crt-accounts"), members)
 		if err != nil {
 			cliError(fmt.Errorf("post CRT accounts: %w", err))
 		}
@@ -728,7 +769,7 @@ func RunEduStarCLI(action string, opts EduStarCLIOpts) {
 		fmt.Printf("Done. HTTP %d\n", resp.StatusCode)
 
 	case "expire-crt-accounts":
-		accounts, err := fetchCRTAccounts(tc)
+		accounts, err := fetchCRTAccounts(ctx, tc)
 		if err != nil {
 			cliError(fmt.Errorf("fetch CRT accounts: %w", err))
 		}
@@ -738,16 +779,16 @@ func RunEduStarCLI(action string, opts EduStarCLIOpts) {
 		}
 		fmt.Printf("Expiring %d CRT accounts...\n", len(accounts))
 		for _, acc := range accounts {
-			if err := stmc.DisableServiceAccount(cfg.SchoolCode, acc.LdapDN); err != nil {
+			if err := stmc.DisableServiceAccount(ctx, cfg.SchoolCode, acc.LdapDN); err != nil {
 				fmt.Fprintf(os.Stderr, "  disable %s: %v\n", acc.Login, err)
 				continue
 			}
-			pwd, err := generatePassword()
+			pwd, err := generatePassword(ctx)
 			if err != nil {
 				fmt.Fprintf(os.Stderr, "  generate password %s: %v\n", acc.Login, err)
 				continue
 			}
-			if err := stmc.SetStudentPassword(cfg.SchoolCode, acc.LdapDN, pwd); err != nil {
+			if err := stmc.SetStudentPassword(ctx, cfg.SchoolCode, acc.LdapDN, pwd); err != nil {
 				fmt.Fprintf(os.Stderr, "  scramble password %s: %v\n", acc.Login, err)
 				continue
 			}
@@ -760,7 +801,7 @@ func RunEduStarCLI(action string, opts EduStarCLIOpts) {
 		fmt.Printf("Done. %d accounts expired.\n", len(accounts))
 
 	case "enable-crt-accounts":
-		accounts, err := fetchCRTAccounts(tc)
+		accounts, err := fetchCRTAccounts(ctx, tc)
 		if err != nil {
 			cliError(fmt.Errorf("fetch CRT accounts: %w", err))
 		}
@@ -778,17 +819,17 @@ func RunEduStarCLI(action string, opts EduStarCLIOpts) {
 		var updated []crtPassword
 
 		for _, acc := range accounts {
-			if err := stmc.EnableServiceAccount(cfg.SchoolCode, acc.LdapDN); err != nil {
+			if err := stmc.EnableServiceAccount(ctx, cfg.SchoolCode, acc.LdapDN); err != nil {
 				fmt.Fprintf(os.Stderr, "  enable %s: %v\n", acc.Login, err)
 				continue
 			}
-			pwd, err := generatePassword()
+			pwd, err := generatePassword(ctx)
 			if err != nil {
 				fmt.Fprintf(os.Stderr, "  generate password %s: %v\n", acc.Login, err)
 				continue
 			}
 			time.Sleep(5 * time.Second)
-			if err := stmc.SetStudentPassword(cfg.SchoolCode, acc.LdapDN, pwd); err != nil {
+			if err := stmc.SetStudentPassword(ctx, cfg.SchoolCode, acc.LdapDN, pwd); err != nil {
 				fmt.Fprintf(os.Stderr, "  set password %s: %v\n", acc.Login, err)
 				continue
 			}
@@ -799,12 +840,11 @@ func RunEduStarCLI(action string, opts EduStarCLIOpts) {
 
 		if len(updated) > 0 {
 			fmt.Printf("Posting %d updated passwords to tenant...\n", len(updated))
-			resp, err := tc.PostJSON(tenant.URL("/api/agent/ingest/edustar/crt-passwords"), updated)
+			queued, err := outbox.Post(ctx, tc, outbox.KindJSON, "/api/agent/ingest/edustar/crt-passwords", updated)
 			if err != nil {
 				cliError(fmt.Errorf("post CRT passwords: %w", err))
 			}
-			resp.Body.Close()
-			fmt.Printf("Done. HTTP %d — %d accounts enabled.\n", resp.StatusCode, len(updated))
+			printPosted(queued, len(updated))
 		} else {
 			fmt.Println("No accounts were updated.")
 		}
@@ -813,7 +853,7 @@ func RunEduStarCLI(action string, opts EduStarCLIOpts) {
 		requireFlag("--group-dn", cfg.ServiceAccountGroupDN)
 		requireFlag("--group-name", cfg.ServiceAccountGroupName)
 		fmt.Printf("Fetching service account group %q...\n", cfg.ServiceAccountGroupName)
-		members, err := stmc.GetGroup(cfg.SchoolCode, cfg.ServiceAccountGroupName, cfg.ServiceAccountGroupDN)
+		members, err := stmc.GetGroup(ctx, cfg.SchoolCode, cfg.ServiceAccountGroupName, cfg.ServiceAccountGroupDN)
 		if err != nil {
 			cliError(fmt.Errorf("GetGroup: %w", err))
 		}
@@ -822,7 +862,7 @@ func RunEduStarCLI(action string, opts EduStarCLIOpts) {
 			break
 		}
 		fmt.Printf("Fetched %d members. Posting to tenant...\n", len(members))
-		resp, err := tc.PostJSON(tenant.URL("/api/agent/ingest/edustar/service-accounts"), members)
+		resp, err := tc.PostJSON(ctx, tenant.URL("/api/agent/ingest/edustar/service-accounts"), members)
 		if err != nil {
 			cliError(fmt.Errorf("post service accounts: %w", err))
 		}
@@ -830,7 +870,7 @@ func RunEduStarCLI(action string, opts EduStarCLIOpts) {
 		fmt.Printf("Done. HTTP %d\n", resp.StatusCode)
 
 	case "expire-service-accounts":
-		accounts, err := fetchServiceAccounts(tc)
+		accounts, err := fetchServiceAccounts(ctx, tc)
 		if err != nil {
 			cliError(fmt.Errorf("fetch service accounts: %w", err))
 		}
@@ -840,16 +880,16 @@ func RunEduStarCLI(action string, opts EduStarCLIOpts) {
 		}
 		fmt.Printf("Expiring %d service accounts...\n", len(accounts))
 		for _, acc := range accounts {
-			if err := stmc.DisableServiceAccount(cfg.SchoolCode, acc.LdapDN); err != nil {
+			if err := stmc.DisableServiceAccount(ctx, cfg.SchoolCode, acc.LdapDN); err != nil {
 				fmt.Fprintf(os.Stderr, "  disable %s: %v\n", acc.Login, err)
 				continue
 			}
-			pwd, err := generatePassword()
+			pwd, err := generatePassword(ctx)
 			if err != nil {
 				fmt.Fprintf(os.Stderr, "  generate password %s: %v\n", acc.Login, err)
 				continue
 			}
-			if err := stmc.SetStudentPassword(cfg.SchoolCode, acc.LdapDN, pwd); err != nil {
+			if err := stmc.SetStudentPassword(ctx, cfg.SchoolCode, acc.LdapDN, pwd); err != nil {
 				fmt.Fprintf(os.Stderr, "  scramble password %s: %v\n", acc.Login, err)
 				continue
 			}
@@ -862,7 +902,7 @@ func RunEduStarCLI(action string, opts EduStarCLIOpts) {
 		fmt.Printf("Done. %d service accounts expired.\n", len(accounts))
 
 	case "enable-service-accounts":
-		accounts, err := fetchServiceAccounts(tc)
+		accounts, err := fetchServiceAccounts(ctx, tc)
 		if err != nil {
 			cliError(fmt.Errorf("fetch service accounts: %w", err))
 		}
@@ -880,16 +920,16 @@ func RunEduStarCLI(action string, opts EduStarCLIOpts) {
 		var updated []svcPassword
 
 		for _, acc := range accounts {
-			if err := stmc.EnableServiceAccount(cfg.SchoolCode, acc.LdapDN); err != nil {
+			if err := stmc.EnableServiceAccount(ctx, cfg.SchoolCode, acc.LdapDN); err != nil {
 				fmt.Fprintf(os.Stderr, "  enable %s: %v\n", acc.Login, err)
 				continue
 			}
-			pwd, err := generatePassword()
+			pwd, err := generatePassword(ctx)
 			if err != nil {
 				fmt.Fprintf(os.Stderr, "  generate password %s: %v\n", acc.Login, err)
 				continue
 			}
-			if err := stmc.SetStudentPassword(cfg.SchoolCode, acc.LdapDN, pwd); err != nil {
+			if err := stmc.SetStudentPassword(ctx, cfg.SchoolCode, acc.LdapDN, pwd); err != nil {
 				fmt.Fprintf(os.Stderr, "  set password %s: %v\n", acc.Login, err)
 				continue
 			}
@@ -900,12 +940,11 @@ func RunEduStarCLI(action string, opts EduStarCLIOpts) {
 
 		if len(updated) > 0 {
 			fmt.Printf("Posting %d updated passwords to tenant...\n", len(updated))
-			resp, err := tc.PostJSON(tenant.URL("/api/agent/ingest/edustar/service-passwords"), updated)
+			queued, err := outbox.Post(ctx, tc, outbox.KindJSON, "/api/agent/ingest/edustar/service-passwords", updated)
 			if err != nil {
 				cliError(fmt.Errorf("post service account passwords: %w", err))
 			}
-			resp.Body.Close()
-			fmt.Printf("Done. HTTP %d — %d accounts enabled.\n", resp.StatusCode, len(updated))
+			printPosted(queued, len(updated))
 		} else {
 			fmt.Println("No accounts were updated.")
 		}
@@ -916,6 +955,16 @@ func RunEduStarCLI(action string, opts EduStarCLIOpts) {
 	}
 }
 
+// printPosted reports the outcome of posting enabled account passwords from
+// the CLI.
+func printPosted(queued bool, n int) {
+	if queued {
+		fmt.Printf("Tenant unavailable — %d accounts enabled, passwords queued; the agent service will deliver them.\n", n)
+		return
+	}
+	fmt.Printf("Done. %d accounts enabled.\n", n)
+}
+
 // requireFlag exits with an error if value is empty, used to validate required CLI flags.
 func requireFlag(name, value string) {
 	if value == "" {
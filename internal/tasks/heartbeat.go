@@ -3,37 +3,234 @@
 package tasks
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
 	"log/slog"
+	"net/http"
+	"runtime"
+	"sync"
+	"time"
 
+	"github.com/forcedesk/forcedesk-agent/internal/config"
+	"github.com/forcedesk/forcedesk-agent/internal/db"
+	"github.com/forcedesk/forcedesk-agent/internal/edustar"
+	"github.com/forcedesk/forcedesk-agent/internal/logger"
+	"github.com/forcedesk/forcedesk-agent/internal/scheduler"
 	"github.com/forcedesk/forcedesk-agent/internal/tenant"
+	"github.com/forcedesk/forcedesk-agent/internal/transport"
+	"github.com/forcedesk/forcedesk-agent/internal/update"
 )
 
+// agentStart captures the process start time for the uptime calculation.
+var agentStart = time.Now()
+
+// reachTimeout bounds each STMC/PaperCut reachability check.
+const reachTimeout = 10 * time.Second
+
 type heartbeatResponse struct {
 	Status  string `json:"status"`
 	Message string `json:"message"`
+	// APIVersion is the API version the tenant will use, if it says.
+	APIVersion int `json:"api_version"`
+}
+
+// heartbeatRequest is the agent status report sent with each heartbeat, so
+// agent health can be seen on the tenant without access to the machine.
+type heartbeatRequest struct {
+	Agent heartbeatAgent `json:"agent"`
+	Host  hostInfo       `json:"host"`
+	// Tasks is the state of every scheduled task, including its last error.
+	Tasks []scheduler.TaskState `json:"tasks"`
+	// StuckTasks lists runs the scheduler watchdog has flagged as hung,
+	// with their goroutine stacks, so they are noticed without access to the
+	// agent's logs.
+	StuckTasks []scheduler.StuckRun `json:"stuck_tasks"`
+	Outbox     heartbeatOutbox      `json:"outbox"`
+	Logs       heartbeatLogs        `json:"logs"`
+	// DBSize is the size of the agent database in bytes.
+	DBSize int64 `json:"db_size"`
+	// Services reports whether STMC and PaperCut are reachable from the
+	// agent. A service is left out when it isn't in use.
+	Services map[string]reachability `json:"services"`
+	// Update is the self-update state: a version on trial, versions rolled
+	// back and why.
+	Update update.Status `json:"update"`
+	// Capabilities is the capability document, so the tenant stays current
+	// even if it missed the one published at startup.
+	Capabilities *tenant.Capabilities `json:"capabilities"`
+}
+
+type heartbeatAgent struct {
+	Version       string    `json:"version"`
+	StartedAt     time.Time `json:"started_at"`
+	UptimeSeconds int64     `json:"uptime_seconds"`
+	OS            string    `json:"os"`
+	Arch          string    `json:"arch"`
+	GoVersion     string    `json:"go_version"`
 }
 
-// Heartbeat confirms bidirectional connectivity between the agent and ForceDesk server.
-// Runs every 5 minutes to verify the agent is acknowledged by the tenant.
-func Heartbeat() {
+type heartbeatOutbox struct {
+	Pending int `json:"pending"`
+	Failed  int `json:"failed"`
+	// OldestPending is when the oldest pending upload was queued.
+	OldestPending *time.Time `json:"oldest_pending"`
+}
+
+// heartbeatLogs counts the warnings and errors logged since the last
+// heartbeat the tenant acknowledged.
+type heartbeatLogs struct {
+	Warnings int64 `json:"warnings"`
+	Errors   int64 `json:"errors"`
+}
+
+type reachability struct {
+	Reachable bool   `json:"reachable"`
+	LatencyMS int64  `json:"latency_ms"`
+	Error     string `json:"error,omitempty"`
+}
+
+// reportedLogs holds the log counts as of the last acknowledged heartbeat.
+var reportedLogs struct {
+	sync.Mutex
+	warn, errs int64
+}
+
+// Heartbeat confirms bidirectional connectivity between the agent and ForceDesk server
+// and reports the agent's health and capabilities. Runs every 5 minutes to
+// verify the agent is acknowledged by the tenant.
+func Heartbeat(ctx context.Context) error {
 	slog.Info("heartbeat: starting")
 
 	client := tenant.New()
 
+	req, warn, errs := buildHeartbeat(ctx)
+
 	url := tenant.URL("/api/agent/heartbeat")
-	slog.Debug("heartbeat: GET", "url", url)
+	slog.Debug("heartbeat: POST", "url", url, "tasks", len(req.Tasks), "stuck_tasks", len(req.StuckTasks))
+
+	httpResp, err := client.PostJSON(ctx, url, req)
+	if err != nil {
+		return fmt.Errorf("request failed: %w", err)
+	}
+	defer httpResp.Body.Close()
+	if httpResp.StatusCode != http.StatusOK {
+		return &tenant.StatusError{StatusCode: httpResp.StatusCode, URL: url}
+	}
 
 	var resp heartbeatResponse
-	if err := client.GetJSON(url, &resp); err != nil {
-		slog.Error("heartbeat: request failed", "err", err)
-		return
+	if err := json.NewDecoder(httpResp.Body).Decode(&resp); err != nil {
+		return fmt.Errorf("decode response: %w", err)
 	}
 
 	slog.Debug("heartbeat: response", "status", resp.Status, "message", resp.Message)
 
-	if resp.Status == "ok" {
-		slog.Info("heartbeat: ok", "message", resp.Message)
+	if resp.Status != "ok" {
+		return fmt.Errorf("tenant returned failure: %s", resp.Message)
+	}
+	// Only now are the counted warnings and errors delivered.
+	reportedLogs.Lock()
+	reportedLogs.warn, reportedLogs.errs = warn, errs
+	reportedLogs.Unlock()
+
+	tenant.NoteAPIVersion(resp.APIVersion)
+	// An acknowledged heartbeat is the health check that ends an update's trial.
+	update.Confirm()
+	slog.Info("heartbeat: ok", "message", resp.Message)
+	if n := len(req.StuckTasks); n > 0 {
+		scheduler.Summarize(ctx, "tenant acknowledged, %d stuck task(s) reported", n)
 	} else {
-		slog.Error("heartbeat: tenant returned failure", "message", resp.Message)
+		scheduler.Summarize(ctx, "tenant acknowledged")
+	}
+	return nil
+}
+
+// buildHeartbeat gathers the status report. It also returns the cumulative
+// log counts it was based on, to be recorded once the tenant acknowledges
+// it. Anything that can't be read is logged and left empty rather than
+// failing the heartbeat.
+func buildHeartbeat(ctx context.Context) (req heartbeatRequest, warn, errs int64) {
+	req = heartbeatRequest{
+		Agent: heartbeatAgent{
+			Version:       tenant.AgentVersion,
+			StartedAt:     agentStart,
+			UptimeSeconds: int64(time.Since(agentStart).Seconds()),
+			OS:            runtime.GOOS,
+			Arch:          runtime.GOARCH,
+			GoVersion:     runtime.Version(),
+		},
+		Host:         collectHost(config.DataDir()),
+		Tasks:        scheduler.StatesOf(ctx),
+		StuckTasks:   scheduler.StuckRuns(ctx),
+		Services:     checkServices(ctx),
+		Update:       update.Report(),
+		Capabilities: capabilities(),
+	}
+	if req.Tasks == nil {
+		req.Tasks = []scheduler.TaskState{}
+	}
+	if req.StuckTasks == nil {
+		req.StuckTasks = []scheduler.StuckRun{}
+	}
+
+	pending, failed, oldest, err := db.OutboxDepth()
+	if err != nil {
+		slog.Warn("heartbeat: failed to read outbox depth", "err", err)
+	}
+	req.Outbox = heartbeatOutbox{Pending: pending, Failed: failed}
+	if !oldest.IsZero() {
+		req.Outbox.OldestPending = &oldest
+	}
+
+	if req.DBSize, err = db.Size(); err != nil {
+		slog.Warn("heartbeat: failed to read database size", "err", err)
+	}
+
+	warn, errs = logger.Counts()
+	reportedLogs.Lock()
+	req.Logs = heartbeatLogs{Warnings: warn - reportedLogs.warn, Errors: errs - reportedLogs.errs}
+	reportedLogs.Unlock()
+	return req, warn, errs
+}
+
+// checkServices checks that STMC, if eduSTAR is enabled, and the PaperCut
+// server, once its address is known, can be reached.
+func checkServices(ctx context.Context) map[string]reachability {
+	services := make(map[string]reachability)
+	if config.Get().EduStar.Enabled {
+		services["stmc"] = checkReach(ctx, edustar.Probe)
+	}
+	if apiURL, _ := papercutAPIURL.Load().(string); apiURL != "" {
+		services["papercut"] = checkReach(ctx, func(ctx context.Context) error {
+			return probePapercut(ctx, apiURL)
+		})
+	}
+	return services
+}
+
+// checkReach times probe.
+func checkReach(ctx context.Context, probe func(context.Context) error) reachability {
+	ctx, cancel := context.WithTimeout(ctx, reachTimeout)
+	defer cancel()
+	start := time.Now()
+	err := probe(ctx)
+	r := reachability{Reachable: err == nil, LatencyMS: time.Since(start).Milliseconds()}
+	if err != nil {
+		r.Error = err.Error()
+	}
+	return r
+}
+
+// probePapercut checks that the PaperCut server answers HTTP requests at
+// apiURL. Any response counts; the API itself needs a key and a method call.
+func probePapercut(ctx context.Context, apiURL string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, apiURL, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := transport.Client().Do(req)
+	if err != nil {
+		return err
 	}
+	return resp.Body.Close()
 }
@@ -0,0 +1,56 @@
+// Copyright © 2026 ForcePoint Software. All rights reserved.
+
+package tasks
+
+import (
+	"log/slog"
+	"runtime"
+	"sync"
+)
+
+// hostInfo is a snapshot of the host's resources for the heartbeat. Values
+// that couldn't be read are left zero.
+type hostInfo struct {
+	CPUs int `json:"cpus"`
+	// CPUPercent is the host's CPU use since the previous snapshot, or nil
+	// for the first one.
+	CPUPercent   *float64 `json:"cpu_percent"`
+	MemTotal     uint64   `json:"mem_total"`
+	MemAvailable uint64   `json:"mem_available"`
+	// DiskTotal and DiskFree are for the volume holding the data directory.
+	DiskTotal uint64 `json:"disk_total"`
+	DiskFree  uint64 `json:"disk_free"`
+}
+
+// lastCPU is the previous CPU times sample, for CPUPercent.
+var lastCPU struct {
+	sync.Mutex
+	idle, total uint64
+}
+
+// collectHost returns a snapshot of the host's resources, with disk figures
+// for the volume holding dir.
+func collectHost(dir string) hostInfo {
+	h := hostInfo{CPUs: runtime.NumCPU()}
+
+	if idle, total, err := cpuTimes(); err != nil {
+		slog.Debug("heartbeat: failed to read CPU times", "err", err)
+	} else {
+		lastCPU.Lock()
+		if dt := total - lastCPU.total; lastCPU.total != 0 && total > lastCPU.total {
+			pct := 100 * float64(dt-(idle-lastCPU.idle)) / float64(dt)
+			h.CPUPercent = &pct
+		}
+		lastCPU.idle, lastCPU.total = idle, total
+		lastCPU.Unlock()
+	}
+
+	var err error
+	if h.MemTotal, h.MemAvailable, err = memory(); err != nil {
+		slog.Debug("heartbeat: failed to read memory status", "err", err)
+	}
+	if h.DiskTotal, h.DiskFree, err = diskUsage(dir); err != nil {
+		slog.Debug("heartbeat: failed to read disk usage", "dir", dir, "err", err)
+	}
+	return h
+}
@@ -0,0 +1,61 @@
+// Copyright © 2026 ForcePoint Software. All rights reserved.
+
+package tasks
+
+import (
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+var (
+	kernel32                 = windows.NewLazySystemDLL("kernel32.dll")
+	procGetSystemTimes       = kernel32.NewProc("GetSystemTimes")
+	procGlobalMemoryStatusEx = kernel32.NewProc("GlobalMemoryStatusEx")
+)
+
+// memoryStatusEx is MEMORYSTATUSEX.
+type memoryStatusEx struct {
+	Length               uint32
+	MemoryLoad           uint32
+	TotalPhys            uint64
+	AvailPhys            uint64
+	TotalPageFile        uint64
+	AvailPageFile        uint64
+	TotalVirtual         uint64
+	AvailVirtual         uint64
+	AvailExtendedVirtual uint64
+}
+
+// cpuTimes returns the idle and total CPU time across all processors, in
+// 100 ns units. Kernel time as reported by GetSystemTimes includes idle time.
+func cpuTimes() (idle, total uint64, err error) {
+	var i, k, u windows.Filetime
+	if r, _, e := procGetSystemTimes.Call(uintptr(unsafe.Pointer(&i)), uintptr(unsafe.Pointer(&k)), uintptr(unsafe.Pointer(&u))); r == 0 {
+		return 0, 0, e
+	}
+	ft := func(f windows.Filetime) uint64 { return uint64(f.HighDateTime)<<32 | uint64(f.LowDateTime) }
+	return ft(i), ft(k) + ft(u), nil
+}
+
+// memory returns the total and available physical memory in bytes.
+func memory() (total, avail uint64, err error) {
+	ms := memoryStatusEx{Length: uint32(unsafe.Sizeof(memoryStatusEx{}))}
+	if r, _, e := procGlobalMemoryStatusEx.Call(uintptr(unsafe.Pointer(&ms))); r == 0 {
+		return 0, 0, e
+	}
+	return ms.TotalPhys, ms.AvailPhys, nil
+}
+
+// diskUsage returns the size and free space in bytes of the volume holding dir.
+func diskUsage(dir string) (total, free uint64, err error) {
+	p, err := windows.UTF16PtrFromString(dir)
+	if err != nil {
+		return 0, 0, err
+	}
+	var avail, totalFree uint64
+	if err := windows.GetDiskFreeSpaceEx(p, &avail, &total, &totalFree); err != nil {
+		return 0, 0, err
+	}
+	return total, avail, nil
+}
@@ -0,0 +1,45 @@
+// Copyright © 2026 ForcePoint Software. All rights reserved.
+
+package tasks
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/forcedesk/forcedesk-agent/internal/config"
+	"github.com/forcedesk/forcedesk-agent/internal/db"
+	"github.com/forcedesk/forcedesk-agent/internal/scheduler"
+)
+
+// Housekeeping prunes local database rows that have aged out of their retention
+// window: the task run history, reported command-queue jobs and uploads the
+// outbox gave up on. Runs every hour.
+func Housekeeping(ctx context.Context) error {
+	days := config.Get().History.RetentionDays
+	if days <= 0 {
+		slog.Debug("housekeeping: task run retention disabled")
+		return nil
+	}
+
+	cutoff := time.Now().AddDate(0, 0, -days)
+	n, err := db.PruneTaskRuns(cutoff)
+	if err != nil {
+		return fmt.Errorf("failed to prune task runs: %w", err)
+	}
+
+	jobs, err := db.PruneJobs(cutoff)
+	if err != nil {
+		return fmt.Errorf("failed to prune jobs: %w", err)
+	}
+
+	uploads, err := db.PruneOutbox(cutoff)
+	if err != nil {
+		return fmt.Errorf("failed to prune outbox: %w", err)
+	}
+
+	slog.Info("housekeeping: pruned history", "task_runs", n, "jobs", jobs, "failed_uploads", uploads, "retention_days", days)
+	scheduler.Summarize(ctx, "task runs pruned: %d, jobs pruned: %d, failed uploads pruned: %d", n, jobs, uploads)
+	return nil
+}
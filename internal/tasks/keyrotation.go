@@ -0,0 +1,78 @@
+// Copyright © 2026 ForcePoint Software. All rights reserved.
+
+package tasks
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+
+	"github.com/forcedesk/forcedesk-agent/internal/config"
+	"github.com/forcedesk/forcedesk-agent/internal/scheduler"
+	"github.com/forcedesk/forcedesk-agent/internal/tenant"
+)
+
+// keyRotationMu serialises key rotations, which replace the whole config.
+var keyRotationMu sync.Mutex
+
+// keyConfirmation is posted to /api/agent/encryption-key/confirm, sealed with
+// the new key, once the agent has switched to it.
+type keyConfirmation struct {
+	KeyID         string `json:"key_id"`
+	PreviousKeyID string `json:"previous_key_id"`
+}
+
+// RotateEncryptionKey switches the agent to a new tenant encryption key
+// delivered by the rotate-encryption-key command. The new key arrives
+// wrapped under the current one (see tenant.UnwrapKey); it becomes the
+// current key, the old one is kept as the previous key so payloads already
+// in flight still open, and config.toml is rewritten. The switch is then
+// confirmed to the tenant with a message sealed under the new key, which
+// proves the agent holds it; the tenant keeps using the old key until then.
+//
+// A command for the key that is already current only repeats the
+// confirmation, so the tenant can resend the command if it was lost.
+func RotateEncryptionKey(ctx context.Context, keyID, wrappedKey string) error {
+	keyRotationMu.Lock()
+	defer keyRotationMu.Unlock()
+
+	cfg := *config.Get()
+	if cfg.Tenant.EncryptionKeyID == keyID {
+		slog.Info("keyrotation: key already current, confirming again", "key_id", keyID)
+	} else {
+		wrapped, err := base64.StdEncoding.DecodeString(wrappedKey)
+		if err != nil {
+			return fmt.Errorf("decode wrapped key: %w", err)
+		}
+		key, err := tenant.UnwrapKey(wrapped, keyID)
+		if err != nil {
+			return err
+		}
+		cfg.Tenant.SetEncryptionKey(keyID, key)
+		if err := config.SaveConfig(&cfg); err != nil {
+			return fmt.Errorf("save new key: %w", err)
+		}
+		slog.Info("keyrotation: encryption key rotated", "key_id", keyID, "previous_key_id", cfg.Tenant.PreviousEncryptionKeyID)
+	}
+
+	key, err := cfg.Tenant.GetEncryptionKey()
+	if err != nil {
+		return err
+	}
+	confirm := keyConfirmation{KeyID: keyID, PreviousKeyID: cfg.Tenant.PreviousEncryptionKeyID}
+	resp, err := tenant.New().PostEncryptedJSON(ctx, tenant.URL("/api/agent/encryption-key/confirm"), confirm, key)
+	if err != nil {
+		return fmt.Errorf("confirm key rotation: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
+		return fmt.Errorf("confirm key rotation: %w", &tenant.StatusError{StatusCode: resp.StatusCode, URL: "/api/agent/encryption-key/confirm"})
+	}
+
+	slog.Info("keyrotation: key rotation confirmed", "key_id", keyID)
+	scheduler.Summarize(ctx, "encryption key %s confirmed", keyID)
+	return nil
+}
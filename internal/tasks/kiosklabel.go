@@ -11,6 +11,7 @@ import (
 	"path/filepath"
 	"time"
 
+	"github.com/forcedesk/forcedesk-agent/internal/scheduler"
 	"github.com/forcedesk/forcedesk-agent/internal/tenant"
 )
 
@@ -32,7 +33,7 @@ type kioskLabel struct {
 // KioskLabelService fetches pending kiosk labels from the ForceDesk server,
 // prints each one via the bundled VBScript and label template, then marks
 // them as printed. Runs on a scheduled interval.
-func KioskLabelService() {
+func KioskLabelService(ctx context.Context) error {
 	slog.Info("kiosk-label: starting")
 
 	client := tenant.New()
@@ -41,26 +42,23 @@ func KioskLabelService() {
 	slog.Debug("kiosk-label: GET", "url", url)
 
 	var pending kioskLabelsResponse
-	if err := client.GetJSON(url, &pending); err != nil {
-		slog.Error("kiosk-label: failed to fetch pending labels", "err", err)
-		return
+	if err := client.GetJSON(ctx, url, &pending); err != nil {
+		return fmt.Errorf("failed to fetch pending labels: %w", err)
 	}
 
 	if !pending.Success {
-		slog.Warn("kiosk-label: API returned success=false")
-		return
+		return fmt.Errorf("API returned success=false")
 	}
 
 	slog.Info("kiosk-label: labels received", "count", len(pending.Labels))
 
 	if len(pending.Labels) == 0 {
-		return
+		return nil
 	}
 
 	exeDir, err := executableDir()
 	if err != nil {
-		slog.Error("kiosk-label: failed to resolve exe directory", "err", err)
-		return
+		return fmt.Errorf("failed to resolve exe directory: %w", err)
 	}
 
 	// The label template and VBScript are bundled alongside the executable
@@ -70,9 +68,10 @@ func KioskLabelService() {
 
 	// Print labels sequentially. Brother printers typically queue jobs so
 	// parallel printing would cause overlapping output.
+	printed := 0
 	for _, label := range pending.Labels {
 		slog.Info("kiosk-label: printing label", "id", label.ID, "name", label.NameData)
-		if err := printKioskLabel(vbsFile, labelFile, label); err != nil {
+		if err := printKioskLabel(ctx, vbsFile, labelFile, label); err != nil {
 			slog.Error("kiosk-label: print failed", "id", label.ID, "err", err)
 			// Continue to the next label rather than aborting the whole batch.
 			continue
@@ -80,8 +79,11 @@ func KioskLabelService() {
 		slog.Info("kiosk-label: print succeeded", "id", label.ID)
 		// Notify the server only after a successful print so that a failed
 		// label is retried on the next poll cycle.
-		markKioskLabelPrinted(client, label.ID)
+		markKioskLabelPrinted(ctx, client, label.ID)
+		printed++
 	}
+	scheduler.Summarize(ctx, "labels printed: %d of %d", printed, len(pending.Labels))
+	return nil
 }
 
 // executableDir returns the directory containing the running executable,
@@ -96,7 +98,7 @@ func executableDir() (string, error) {
 
 // printKioskLabel invokes the bundled VBScript via cscript to print a label
 // on the Brother printer using the given template and label data fields.
-func printKioskLabel(vbsFile, labelFile string, label kioskLabel) error {
+func printKioskLabel(ctx context.Context, vbsFile, labelFile string, label kioskLabel) error {
 	// The VBScript expects positional arguments in this exact order:
 	//   1. label template path (.lbx)
 	//   2. QR code data
@@ -108,7 +110,7 @@ func printKioskLabel(vbsFile, labelFile string, label kioskLabel) error {
 
 	// Give the print job a generous 30 s window; slow printers or USB
 	// enumeration can add several seconds of latency.
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
 	defer cancel()
 
 	// cscript runs VBScript in a non-interactive (headless) console host,
@@ -125,11 +127,11 @@ func printKioskLabel(vbsFile, labelFile string, label kioskLabel) error {
 
 // markKioskLabelPrinted notifies the tenant that the label has been printed
 // so it is not re-queued on the next poll.
-func markKioskLabelPrinted(client *tenant.Client, id int) {
+func markKioskLabelPrinted(ctx context.Context, client *tenant.Client, id int) {
 	url := tenant.URL(fmt.Sprintf("/api/agent/remote-labels/%d/printed", id))
 	slog.Debug("kiosk-label: POST", "url", url)
 
-	resp, err := client.PostJSON(url, nil)
+	resp, err := client.PostJSON(ctx, url, nil)
 	if err != nil {
 		slog.Error("kiosk-label: failed to mark label as printed", "id", id, "err", err)
 		return
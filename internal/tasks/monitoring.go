@@ -19,9 +19,25 @@ import (
 
 	"github.com/forcedesk/forcedesk-agent/internal/config"
 	"github.com/forcedesk/forcedesk-agent/internal/graph"
+	"github.com/forcedesk/forcedesk-agent/internal/outbox"
+	"github.com/forcedesk/forcedesk-agent/internal/scheduler"
 	"github.com/forcedesk/forcedesk-agent/internal/tenant"
 )
 
+// probeChecks maps each probe check type MonitoringService performs to the
+// check, which returns "up" or "down". Its keys are also the check types
+// advertised to the tenant in the capability document.
+var probeChecks = map[string]func(ctx context.Context, probe probePayload) string{
+	// TCP check verifies that a specific service port is open, not just
+	// that the host responds to ICMP.
+	"tcp": func(ctx context.Context, probe probePayload) string {
+		return performTCPCheck(ctx, probe.Host, probe.Port)
+	},
+	"ping": func(ctx context.Context, probe probePayload) string {
+		return performPingCheck(ctx, probe.Host)
+	},
+}
+
 func isWindows() bool { return runtime.GOOS == "windows" }
 
 type monitoringPayloadItem struct {
@@ -61,7 +77,7 @@ func fpingPath() string {
 // milliseconds between each. Pass intervalMS=0 to use fping's default (1 s).
 // Returns avg, min, max RTT (ms) and packet loss. RTT pointers are nil when no
 // packets were received. All return values are nil on parse error.
-func fpingRun(host string, count, intervalMS int) (avg, minMS, maxMS *float64, loss *int) {
+func fpingRun(ctx context.Context, host string, count, intervalMS int) (avg, minMS, maxMS *float64, loss *int) {
 	// Validate the hostname before passing it to an external process to
 	// prevent command injection through crafted hostnames.
 	if !isValidHostname(host) {
@@ -83,7 +99,7 @@ func fpingRun(host string, count, intervalMS int) (avg, minMS, maxMS *float64, l
 	// The context deadline is set to the expected total ping time (count × interval)
 	// plus a 5 s buffer so a slow host does not stall the goroutine indefinitely.
 	pingDuration := time.Duration(count) * time.Duration(max(intervalMS, 1000)) * time.Millisecond
-	ctx, cancel := context.WithTimeout(context.Background(), pingDuration+5*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, pingDuration+5*time.Second)
 	defer cancel()
 
 	cmd := exec.CommandContext(ctx, fpingPath(), args...)
@@ -129,15 +145,15 @@ func fpingRun(host string, count, intervalMS int) (avg, minMS, maxMS *float64, l
 
 // generatePingMetrics runs a fast 3-ping check used for server status reporting.
 // Returns avg RTT and packet loss only; min/max are discarded.
-func generatePingMetrics(host string) (avg *float64, loss *int) {
-	a, _, _, l := fpingRun(host, 3, 0)
+func generatePingMetrics(ctx context.Context, host string) (avg *float64, loss *int) {
+	a, _, _, l := fpingRun(ctx, host, 3, 0)
 	return a, l
 }
 
 // generateGraphMetrics runs a 20-ping check at 100 ms intervals (~2 s total)
 // to capture enough jitter for a meaningful smokeping smoke band.
-func generateGraphMetrics(host string) (avg, minMS, maxMS *float64, loss *int) {
-	return fpingRun(host, 20, 100)
+func generateGraphMetrics(ctx context.Context, host string) (avg, minMS, maxMS *float64, loss *int) {
+	return fpingRun(ctx, host, 20, 100)
 }
 
 // MonitoringService fetches monitoring probe configurations from the ForceDesk
@@ -145,29 +161,27 @@ func generateGraphMetrics(host string) (avg, minMS, maxMS *float64, loss *int) {
 // separate process per probe, so goroutines have no ICMP socket contention.
 // All results are combined and reported back to the tenant in a single payload.
 // Runs every minute.
-func MonitoringService() {
+func MonitoringService(ctx context.Context) error {
 	slog.Info("monitoring: starting")
 
 	client := tenant.New()
-	if err := client.TestConnectivity(); err != nil {
-		slog.Error("monitoring: connectivity check failed", "err", err)
-		return
+	if err := tenant.CheckOnline(); err != nil {
+		return fmt.Errorf("connectivity check failed: %w", err)
 	}
 
 	url := tenant.URL("/api/agent/monitoring/getpayloads")
 	slog.Debug("monitoring: GET", "url", url)
 
 	var items []monitoringPayloadItem
-	if err := client.GetJSON(url, &items); err != nil {
-		slog.Error("monitoring: failed to fetch payloads", "err", err)
-		return
+	if err := client.GetJSON(ctx, url, &items); err != nil {
+		return fmt.Errorf("failed to fetch payloads: %w", err)
 	}
 
 	slog.Debug("monitoring: payload items received", "count", len(items))
 
 	if len(items) == 0 {
 		slog.Info("monitoring: no payloads received")
-		return
+		return nil
 	}
 
 	// Flatten the nested payload structure into a single probe list.
@@ -206,7 +220,7 @@ func MonitoringService() {
 			slog.Debug("monitoring: running probe", "probe_id", probe.ProbeID, "host", probe.Host, "check_type", probe.CheckType, "port", probe.Port)
 
 			// Fast check: 3 pings, result sent to the server for status reporting.
-			avg, loss := generatePingMetrics(probe.Host)
+			avg, loss := generatePingMetrics(ctx, probe.Host)
 			slog.Info("monitoring: ping metrics", "probe_id", probe.ProbeID, "ping_data", avg, "packet_loss_data", loss)
 
 			// Determine up/down status. If avg is nil the host returned no
@@ -214,23 +228,16 @@ func MonitoringService() {
 			var status string
 			if avg == nil {
 				status = "down"
+			} else if check, ok := probeChecks[probe.CheckType]; ok {
+				status = check(ctx, probe)
 			} else {
-				switch probe.CheckType {
-				case "tcp":
-					// TCP check verifies that a specific service port is open,
-					// not just that the host responds to ICMP.
-					status = performTCPCheck(probe.Host, probe.Port)
-				case "ping":
-					status = performPingCheck(probe.Host)
-				default:
-					slog.Error("monitoring: unknown check type", "probe_id", probe.ProbeID, "check_type", probe.CheckType)
-					status = "down"
-				}
+				slog.Error("monitoring: unknown check type", "probe_id", probe.ProbeID, "check_type", probe.CheckType)
+				status = "down"
 			}
 
 			// Thorough check: 20 pings at 100 ms intervals (~2 s total).
 			// More samples produce a wider, more accurate jitter band in the graph.
-			gAvg, gMin, gMax, gLoss := generateGraphMetrics(probe.Host)
+			gAvg, gMin, gMax, gLoss := generateGraphMetrics(ctx, probe.Host)
 			graphLoss := 0
 			if gLoss != nil {
 				graphLoss = *gLoss
@@ -261,7 +268,7 @@ func MonitoringService() {
 
 	if len(records) == 0 {
 		slog.Info("monitoring: no results to send")
-		return
+		return nil
 	}
 
 	// Extract server-facing results from the combined records and POST them
@@ -271,23 +278,25 @@ func MonitoringService() {
 		results[i] = r.result
 	}
 
-	resp, err := client.PostJSON(tenant.URL("/api/agent/monitoring/response-bulk"), results)
+	// Results go through the outbox so a tenant outage doesn't lose them.
+	queued, err := outbox.Post(ctx, client, outbox.KindJSON, "/api/agent/monitoring/response-bulk", results)
 	if err != nil {
-		slog.Error("monitoring: failed to send combined results", "err", err)
-		return
+		return fmt.Errorf("failed to send combined results: %w", err)
+	}
+	if queued {
+		slog.Info("monitoring: tenant unavailable, combined results queued", "count", len(results))
+		scheduler.Summarize(ctx, "probes checked: %d, results queued", len(results))
+	} else {
+		slog.Info("monitoring: combined results sent", "count", len(results))
+		scheduler.Summarize(ctx, "probes checked: %d", len(results))
 	}
-	defer resp.Body.Close()
-
-	slog.Debug("monitoring: POST response", "http_status", resp.StatusCode)
-	slog.Info("monitoring: combined results sent", "count", len(results))
 
 	// RRD pipeline: for each probe, create the RRD if it doesn't exist,
 	// feed in the latest measurement, render a PNG, and upload it to the tenant.
 	// Failures are per-probe and do not abort the remaining graphs.
 	graphsDir := graph.GraphDir(config.DataDir())
 	if err := os.MkdirAll(graphsDir, 0755); err != nil {
-		slog.Error("monitoring: failed to create graphs dir", "err", err)
-		return
+		return fmt.Errorf("failed to create graphs dir: %w", err)
 	}
 
 	now := time.Now()
@@ -321,7 +330,7 @@ func MonitoringService() {
 		}
 
 		uploadURL := tenant.URL(fmt.Sprintf("/api/agent/monitoring/graph/%d", id))
-		uploadResp, err := client.PostFile(uploadURL, fmt.Sprintf("probe_%d.png", id), pngData)
+		uploadResp, err := client.PostFile(ctx, uploadURL, fmt.Sprintf("probe_%d.png", id), pngData)
 		if err != nil {
 			slog.Error("monitoring: failed to upload graph", "probe_id", id, "err", err)
 			continue
@@ -329,12 +338,14 @@ func MonitoringService() {
 		uploadResp.Body.Close()
 		slog.Debug("monitoring: graph uploaded", "probe_id", id, "http_status", uploadResp.StatusCode)
 	}
+	return nil
 }
 
 // performTCPCheck attempts a TCP connection to host:port and returns "up" on success, "down" on failure.
-func performTCPCheck(host string, port int) string {
+func performTCPCheck(ctx context.Context, host string, port int) string {
 	addr := net.JoinHostPort(host, fmt.Sprintf("%d", port))
-	conn, err := net.DialTimeout("tcp", addr, 5*time.Second)
+	dialer := net.Dialer{Timeout: 5 * time.Second}
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
 	if err != nil {
 		slog.Info("monitoring: TCP check down", "host", host, "port", port, "err", err)
 		return "down"
@@ -345,13 +356,13 @@ func performTCPCheck(host string, port int) string {
 
 // performPingCheck executes a single ping check using the system ping command.
 // Returns "up" if the host responds, "down" otherwise.
-func performPingCheck(host string) string {
+func performPingCheck(ctx context.Context, host string) string {
 	if !isValidHostname(host) {
 		slog.Error("monitoring: invalid hostname in ping check", "host", host)
 		return "down"
 	}
 	// Use ping.exe on Windows; a non-zero exit code means the host is down.
-	cmd := exec.Command("ping", "-n", "1", "-w", "5000", host)
+	cmd := exec.CommandContext(ctx, "ping", "-n", "1", "-w", "5000", host)
 	if err := cmd.Run(); err != nil {
 		return "down"
 	}
@@ -10,10 +10,13 @@ import (
 	"log/slog"
 	"net/http"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/forcedesk/forcedesk-agent/internal/config"
+	"github.com/forcedesk/forcedesk-agent/internal/scheduler"
 	"github.com/forcedesk/forcedesk-agent/internal/tenant"
+	"github.com/forcedesk/forcedesk-agent/internal/transport"
 )
 
 // papercutConfig holds PaperCut connection settings fetched from the tenant API.
@@ -22,21 +25,26 @@ type papercutConfig struct {
 	APIKey string `json:"papercut_api_key"`
 }
 
+// papercutAPIURL is the PaperCut API URL last fetched from the tenant, so
+// the heartbeat can check the server is reachable without fetching it again.
+var papercutAPIURL atomic.Value // string
+
 // fetchPapercutConfig retrieves PaperCut connection config from the tenant API.
 // The response is decrypted using the ChaCha20-Poly1305 key from [tenant] encryption_key in config.toml.
-func fetchPapercutConfig(tc *tenant.Client) (*papercutConfig, error) {
+func fetchPapercutConfig(ctx context.Context, tc *tenant.Client) (*papercutConfig, error) {
 	key, err := config.Get().Tenant.GetEncryptionKey()
 	if err != nil {
 		return nil, fmt.Errorf("encryption key: %w", err)
 	}
 
 	var cfg papercutConfig
-	if err := tc.GetEncryptedJSON(tenant.URL("/api/agent/papercut-config"), &cfg, key); err != nil {
+	if err := tc.GetEncryptedJSON(ctx, tenant.URL("/api/agent/papercut-config"), &cfg, key); err != nil {
 		return nil, fmt.Errorf("fetch papercut config: %w", err)
 	}
 	if cfg.APIURL == "" || cfg.APIKey == "" {
 		return nil, fmt.Errorf("papercut config is incomplete (missing api_url or api_key)")
 	}
+	papercutAPIURL.Store(cfg.APIURL)
 	return &cfg, nil
 }
 
@@ -54,14 +62,14 @@ type pcServerPayload struct {
 
 // fetchPapercutUsers retrieves the staff and student lists from the tenant API.
 // The response is decrypted using the ChaCha20-Poly1305 key from [tenant] encryption_key in config.toml.
-func fetchPapercutUsers(tc *tenant.Client) (*pcServerPayload, error) {
+func fetchPapercutUsers(ctx context.Context, tc *tenant.Client) (*pcServerPayload, error) {
 	key, err := config.Get().Tenant.GetEncryptionKey()
 	if err != nil {
 		return nil, fmt.Errorf("encryption key: %w", err)
 	}
 
 	var payload pcServerPayload
-	if err := tc.GetEncryptedJSON(tenant.URL("/api/agent/ingest/papercut-data"), &payload, key); err != nil {
+	if err := tc.GetEncryptedJSON(ctx, tenant.URL("/api/agent/ingest/papercut-data"), &payload, key); err != nil {
 		return nil, fmt.Errorf("fetch papercut users: %w", err)
 	}
 	return &payload, nil
@@ -82,31 +90,28 @@ type pcPayload struct {
 // PapercutService queries the local PaperCut print management server via XML-RPC API
 // to retrieve user PINs and account balances for staff and students, then sends the data to the tenant.
 // Runs every 30 minutes.
-func PapercutService() {
-	slog.Info("papercut: starting")
+func PapercutService(ctx context.Context) error {
+	slog.InfoContext(ctx, "papercut: starting")
 
 	client := tenant.New()
-	if err := client.TestConnectivity(); err != nil {
-		slog.Error("papercut: connectivity check failed", "err", err)
-		return
+	if err := tenant.CheckOnline(); err != nil {
+		return fmt.Errorf("connectivity check failed: %w", err)
 	}
 
 	// Fetch the PaperCut server URL and API key from the tenant (encrypted).
 	// These may differ per site and are not stored in local config.toml.
-	pcCfg, err := fetchPapercutConfig(client)
+	pcCfg, err := fetchPapercutConfig(ctx, client)
 	if err != nil {
-		slog.Error("papercut: failed to resolve config", "err", err)
-		return
+		return fmt.Errorf("failed to resolve config: %w", err)
 	}
 
 	// Fetch the staff and student lists from the tenant so we know which
 	// usernames to query in PaperCut.
-	users, err := fetchPapercutUsers(client)
+	users, err := fetchPapercutUsers(ctx, client)
 	if err != nil {
-		slog.Error("papercut: failed to fetch users", "err", err)
-		return
+		return fmt.Errorf("failed to fetch users: %w", err)
 	}
-	slog.Debug("papercut: users received", "staff", len(users.Staff), "students", len(users.Students))
+	slog.DebugContext(ctx, "papercut: users received", "staff", len(users.Staff), "students", len(users.Students))
 
 	payload := pcPayload{}
 
@@ -114,78 +119,77 @@ func PapercutService() {
 	// account balance. Both are optional — skip the record only when both are
 	// absent, as PaperCut may not have a PIN set for every user.
 	for _, s := range users.Staff {
-		slog.Debug("papercut: querying staff member", "username", s.Username)
-		pin, err := pcGetProperty(pcCfg.APIURL, pcCfg.APIKey, s.Username, "secondary-card-number")
+		slog.DebugContext(ctx, "papercut: querying staff member", "username", s.Username)
+		pin, err := pcGetProperty(ctx, pcCfg.APIURL, pcCfg.APIKey, s.Username, "secondary-card-number")
 		if err != nil {
-			slog.Debug("papercut: PIN lookup failed", "username", s.Username, "err", err)
+			slog.DebugContext(ctx, "papercut: PIN lookup failed", "username", s.Username, "err", err)
 		}
-		bal, err := pcGetPropertyFloat(pcCfg.APIURL, pcCfg.APIKey, s.Username, "balance")
+		bal, err := pcGetPropertyFloat(ctx, pcCfg.APIURL, pcCfg.APIKey, s.Username, "balance")
 		if err != nil {
-			slog.Debug("papercut: balance lookup failed", "username", s.Username, "err", err)
+			slog.DebugContext(ctx, "papercut: balance lookup failed", "username", s.Username, "err", err)
 		}
-		slog.Debug("papercut: staff result", "username", s.Username, "has_pin", pin != nil, "has_balance", bal != nil)
+		slog.DebugContext(ctx, "papercut: staff result", "username", s.Username, "has_pin", pin != nil, "has_balance", bal != nil)
 
 		// Skip users with no data in PaperCut to keep the payload lean.
 		if pin == nil && bal == nil {
 			continue
 		}
 		payload.Staff = append(payload.Staff, pcUserRecord{Username: s.Username, PIN: pin, Balance: bal})
-		slog.Info("papercut: processed staff", "username", s.Username)
+		slog.InfoContext(ctx, "papercut: processed staff", "username", s.Username)
 	}
 
 	// Same process for students. Note: the JSON field is "login" for students
 	// vs "username" for staff to match the server's expected schema.
 	for _, s := range users.Students {
-		slog.Debug("papercut: querying student", "username", s.Username)
-		pin, err := pcGetProperty(pcCfg.APIURL, pcCfg.APIKey, s.Username, "secondary-card-number")
+		slog.DebugContext(ctx, "papercut: querying student", "username", s.Username)
+		pin, err := pcGetProperty(ctx, pcCfg.APIURL, pcCfg.APIKey, s.Username, "secondary-card-number")
 		if err != nil {
-			slog.Debug("papercut: PIN lookup failed", "username", s.Username, "err", err)
+			slog.DebugContext(ctx, "papercut: PIN lookup failed", "username", s.Username, "err", err)
 		}
-		bal, err := pcGetPropertyFloat(pcCfg.APIURL, pcCfg.APIKey, s.Username, "balance")
+		bal, err := pcGetPropertyFloat(ctx, pcCfg.APIURL, pcCfg.APIKey, s.Username, "balance")
 		if err != nil {
-			slog.Debug("papercut: balance lookup failed", "username", s.Username, "err", err)
+			slog.DebugContext(ctx, "papercut: balance lookup failed", "username", s.Username, "err", err)
 		}
-		slog.Debug("papercut: student result", "username", s.Username, "has_pin", pin != nil, "has_balance", bal != nil)
+		slog.DebugContext(ctx, "papercut: student result", "username", s.Username, "has_pin", pin != nil, "has_balance", bal != nil)
 
 		if pin == nil && bal == nil {
 			continue
 		}
 		payload.Students = append(payload.Students, pcUserRecord{Login: s.Username, PIN: pin, Balance: bal})
-		slog.Info("papercut: processed student", "username", s.Username)
+		slog.InfoContext(ctx, "papercut: processed student", "username", s.Username)
 	}
 
 	if len(payload.Staff) == 0 && len(payload.Students) == 0 {
-		slog.Info("papercut: no data to send")
-		return
+		slog.InfoContext(ctx, "papercut: no data to send")
+		return nil
 	}
 
 	// Encrypt the payload before transmission; it contains PINs and balances.
 	key, err := config.Get().Tenant.GetEncryptionKey()
 	if err != nil {
-		slog.Error("papercut: failed to get encryption key", "err", err)
-		return
+		return fmt.Errorf("failed to get encryption key: %w", err)
 	}
 
-	resp, err := client.PostEncryptedJSON(tenant.URL("/api/agent/ingest/papercut-data"), payload, key)
+	resp, err := client.PostEncryptedJSON(ctx, tenant.URL("/api/agent/ingest/papercut-data"), payload, key)
 	if err != nil {
-		slog.Error("papercut: failed to send data", "err", err)
-		return
+		return fmt.Errorf("failed to send data: %w", err)
 	}
 	defer resp.Body.Close()
 
-	slog.Info("papercut: data sent", "staff", len(payload.Staff), "students", len(payload.Students))
+	slog.InfoContext(ctx, "papercut: data sent", "staff", len(payload.Staff), "students", len(payload.Students))
+	scheduler.Summarize(ctx, "staff: %d, students: %d", len(payload.Staff), len(payload.Students))
+	return nil
 }
 
 // pcXMLRequest builds an XML-RPC getUserProperty request body for PaperCut API calls.
-// The PaperCut XML-RPC signature is: getUserProperty(authToken, username, property).
-// The first parameter (authToken) is intentionally left empty — PaperCut accepts
-// the API key via the second parameter in this calling convention.
+// The PaperCut XML-RPC signature is: getUserProperty(authToken, username, property),
+// where authToken is the server's API key.
 func pcXMLRequest(apiKey, username, property string) string {
 	return fmt.Sprintf(`<?xml version="1.0"?>
 <methodCall>
   <methodName>api.getUserProperty</methodName>
   <params>
-    <param><value><string></string></value></param>
+    <param><value><string>%s</string></value></param>
     <param><value><string>%s</string></value></param>
     <param><value><string>%s</string></value></param>
   </params>
@@ -228,12 +232,12 @@ type pcFault struct {
 
 // pcCall sends a getUserProperty XML-RPC request to the PaperCut server and returns
 // the scalar string value, unwrapping any XML-RPC type wrapper tags.
-func pcCall(apiURL, apiKey, username, property string) (string, error) {
+func pcCall(ctx context.Context, apiURL, apiKey, username, property string) (string, error) {
 	body := pcXMLRequest(apiKey, username, property)
 
 	// Use a context-bound request so a slow or unresponsive PaperCut server
 	// does not block the goroutine indefinitely during a bulk user sync.
-	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 15*time.Second)
 	defer cancel()
 
 	req, err := http.NewRequestWithContext(ctx, http.MethodPost, apiURL, strings.NewReader(body))
@@ -242,7 +246,7 @@ func pcCall(apiURL, apiKey, username, property string) (string, error) {
 	}
 	req.Header.Set("Content-Type", "text/xml; charset=UTF-8")
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := transport.Client().Do(req)
 	if err != nil {
 		return "", err
 	}
@@ -291,8 +295,8 @@ func stripXMLTag(s, tag string) string {
 }
 
 // pcGetProperty returns the property value, or nil if empty.
-func pcGetProperty(apiURL, apiKey, username, property string) (*string, error) {
-	val, err := pcCall(apiURL, apiKey, username, property)
+func pcGetProperty(ctx context.Context, apiURL, apiKey, username, property string) (*string, error) {
+	val, err := pcCall(ctx, apiURL, apiKey, username, property)
 	if err != nil {
 		return nil, err
 	}
@@ -303,8 +307,8 @@ func pcGetProperty(apiURL, apiKey, username, property string) (*string, error) {
 }
 
 // pcGetPropertyFloat returns a float64 balance, or nil if not present/numeric.
-func pcGetPropertyFloat(apiURL, apiKey, username, property string) (*float64, error) {
-	val, err := pcCall(apiURL, apiKey, username, property)
+func pcGetPropertyFloat(ctx context.Context, apiURL, apiKey, username, property string) (*float64, error) {
+	val, err := pcCall(ctx, apiURL, apiKey, username, property)
 	if err != nil {
 		return nil, err
 	}
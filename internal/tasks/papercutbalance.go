@@ -15,12 +15,13 @@ import (
 
 	"github.com/forcedesk/forcedesk-agent/internal/config"
 	"github.com/forcedesk/forcedesk-agent/internal/tenant"
+	"github.com/forcedesk/forcedesk-agent/internal/transport"
 )
 
 // pcCallWithBody sends a raw XML-RPC body to apiURL and returns the scalar string value
 // from the response, stripping any XML-RPC type wrapper tags (string, double, int, boolean).
-func pcCallWithBody(apiURL, body string) (string, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+func pcCallWithBody(ctx context.Context, apiURL, body string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, 15*time.Second)
 	defer cancel()
 
 	req, err := http.NewRequestWithContext(ctx, http.MethodPost, apiURL, strings.NewReader(body))
@@ -29,7 +30,7 @@ func pcCallWithBody(apiURL, body string) (string, error) {
 	}
 	req.Header.Set("Content-Type", "text/xml; charset=UTF-8")
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := transport.Client().Do(req)
 	if err != nil {
 		return "", err
 	}
@@ -83,7 +84,7 @@ type pcSharedAccountItem struct {
 }
 
 // pcListSharedAccounts calls api.listSharedAccounts and returns all account names.
-func pcListSharedAccounts(apiURL, apiKey string) ([]string, error) {
+func pcListSharedAccounts(ctx context.Context, apiURL, apiKey string) ([]string, error) {
 	// api.listSharedAccounts(authToken, offset, limit): offset=0, limit=9999 fetches
 	// everything in a single call. PaperCut's API is paginated but most deployments
 	// have far fewer than 9999 shared accounts, so one call is sufficient.
@@ -98,7 +99,7 @@ func pcListSharedAccounts(apiURL, apiKey string) ([]string, error) {
 </methodCall>`, xmlEscape(apiKey))
 
 	// Allow more time than a scalar call: the response array may be large.
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
 	defer cancel()
 
 	req, err := http.NewRequestWithContext(ctx, http.MethodPost, apiURL, strings.NewReader(body))
@@ -107,7 +108,7 @@ func pcListSharedAccounts(apiURL, apiKey string) ([]string, error) {
 	}
 	req.Header.Set("Content-Type", "text/xml; charset=UTF-8")
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := transport.Client().Do(req)
 	if err != nil {
 		return nil, err
 	}
@@ -148,7 +149,7 @@ func pcListSharedAccounts(apiURL, apiKey string) ([]string, error) {
 }
 
 // pcGetSharedAccountBalance calls api.getSharedAccountAccountBalance and returns the balance.
-func pcGetSharedAccountBalance(apiURL, apiKey, accountName string) (float64, error) {
+func pcGetSharedAccountBalance(ctx context.Context, apiURL, apiKey, accountName string) (float64, error) {
 	body := fmt.Sprintf(`<?xml version="1.0"?>
 <methodCall>
   <methodName>api.getSharedAccountAccountBalance</methodName>
@@ -158,7 +159,7 @@ func pcGetSharedAccountBalance(apiURL, apiKey, accountName string) (float64, err
   </params>
 </methodCall>`, xmlEscape(apiKey), xmlEscape(accountName))
 
-	val, err := pcCallWithBody(apiURL, body)
+	val, err := pcCallWithBody(ctx, apiURL, body)
 	if err != nil {
 		return 0, err
 	}
@@ -171,7 +172,7 @@ func pcGetSharedAccountBalance(apiURL, apiKey, accountName string) (float64, err
 
 // pcSetSharedAccountBalance calls api.setSharedAccountAccountBalance.
 // Returns an error if the server does not confirm success.
-func pcSetSharedAccountBalance(apiURL, apiKey, accountName string, balance float64, reason string) error {
+func pcSetSharedAccountBalance(ctx context.Context, apiURL, apiKey, accountName string, balance float64, reason string) error {
 	body := fmt.Sprintf(`<?xml version="1.0"?>
 <methodCall>
   <methodName>api.setSharedAccountAccountBalance</methodName>
@@ -183,7 +184,7 @@ func pcSetSharedAccountBalance(apiURL, apiKey, accountName string, balance float
   </params>
 </methodCall>`, xmlEscape(apiKey), xmlEscape(accountName), balance, xmlEscape(reason))
 
-	val, err := pcCallWithBody(apiURL, body)
+	val, err := pcCallWithBody(ctx, apiURL, body)
 	if err != nil {
 		return err
 	}
@@ -213,116 +214,106 @@ type pcSharedAccountBalancePayload struct {
 // PapercutGetSharedAccounts lists all PaperCut shared accounts, fetches each account's
 // balance, then POSTs the collated result to the ForceDesk server.
 // Triggered by the "get-papercut-shared-accounts" command queue entry.
-func PapercutGetSharedAccounts() {
-	slog.Info("papercut: fetching shared accounts")
+func PapercutGetSharedAccounts(ctx context.Context) error {
+	slog.InfoContext(ctx, "papercut: fetching shared accounts")
 
 	client := tenant.New()
-	if err := client.TestConnectivity(); err != nil {
-		slog.Error("papercut: connectivity check failed", "err", err)
-		return
+	if err := tenant.CheckOnline(); err != nil {
+		return fmt.Errorf("connectivity check failed: %w", err)
 	}
 
-	pcCfg, err := fetchPapercutConfig(client)
+	pcCfg, err := fetchPapercutConfig(ctx, client)
 	if err != nil {
-		slog.Error("papercut: failed to resolve config", "err", err)
-		return
+		return fmt.Errorf("failed to resolve config: %w", err)
 	}
 
-	accounts, err := pcListSharedAccounts(pcCfg.APIURL, pcCfg.APIKey)
+	accounts, err := pcListSharedAccounts(ctx, pcCfg.APIURL, pcCfg.APIKey)
 	if err != nil {
-		slog.Error("papercut: failed to list shared accounts", "err", err)
-		return
+		return fmt.Errorf("failed to list shared accounts: %w", err)
 	}
-	slog.Debug("papercut: shared accounts listed", "count", len(accounts))
+	slog.DebugContext(ctx, "papercut: shared accounts listed", "count", len(accounts))
 
 	payload := pcSharedAccountsPayload{}
 	for _, name := range accounts {
-		bal, err := pcGetSharedAccountBalance(pcCfg.APIURL, pcCfg.APIKey, name)
+		bal, err := pcGetSharedAccountBalance(ctx, pcCfg.APIURL, pcCfg.APIKey, name)
 		if err != nil {
-			slog.Warn("papercut: failed to get balance", "account", name, "err", err)
+			slog.WarnContext(ctx, "papercut: failed to get balance", "account", name, "err", err)
 			continue
 		}
 		payload.Accounts = append(payload.Accounts, pcSharedAccountRecord{Name: name, Balance: bal})
-		slog.Debug("papercut: shared account balance", "account", name, "balance", bal)
+		slog.DebugContext(ctx, "papercut: shared account balance", "account", name, "balance", bal)
 	}
 
 	key, err := config.Get().Tenant.GetEncryptionKey()
 	if err != nil {
-		slog.Error("papercut: failed to get encryption key", "err", err)
-		return
+		return fmt.Errorf("failed to get encryption key: %w", err)
 	}
 
-	resp, err := client.PostEncryptedJSON(tenant.URL("/api/agent/ingest/papercut-shared-accounts"), payload, key)
+	resp, err := client.PostEncryptedJSON(ctx, tenant.URL("/api/agent/ingest/papercut-shared-accounts"), payload, key)
 	if err != nil {
-		slog.Error("papercut: failed to send shared accounts", "err", err)
-		return
+		return fmt.Errorf("failed to send shared accounts: %w", err)
 	}
 	defer resp.Body.Close()
 
-	slog.Info("papercut: shared accounts sent", "count", len(payload.Accounts))
+	slog.InfoContext(ctx, "papercut: shared accounts sent", "count", len(payload.Accounts))
+	return nil
 }
 
 // PapercutSetSharedAccountBalance sets the balance on a PaperCut shared account,
 // then fetches the updated balance and POSTs it back to the ForceDesk server.
 // Triggered by the "set-papercut-shared-account-balance" command queue entry.
-func PapercutSetSharedAccountBalance(accountName string, requestedBalance float64, adjustmentReason string) {
-	slog.Info("papercut: setting shared account balance", "account", accountName, "balance", requestedBalance)
+func PapercutSetSharedAccountBalance(ctx context.Context, accountName string, requestedBalance float64, adjustmentReason string) error {
+	slog.InfoContext(ctx, "papercut: setting shared account balance", "account", accountName, "balance", requestedBalance)
 
 	client := tenant.New()
-	if err := client.TestConnectivity(); err != nil {
-		slog.Error("papercut: connectivity check failed", "err", err)
-		return
+	if err := tenant.CheckOnline(); err != nil {
+		return fmt.Errorf("connectivity check failed: %w", err)
 	}
 
-	pcCfg, err := fetchPapercutConfig(client)
+	pcCfg, err := fetchPapercutConfig(ctx, client)
 	if err != nil {
-		slog.Error("papercut: failed to resolve config", "err", err)
-		return
+		return fmt.Errorf("failed to resolve config: %w", err)
 	}
 
 	// Read the current balance before modifying it. The operation is a TOP-UP,
 	// not an absolute set: requestedBalance is the amount to ADD to the current
 	// balance, not the target value. Fetching first lets us compute the new total
 	// and log the delta clearly.
-	currentBalance, err := pcGetSharedAccountBalance(pcCfg.APIURL, pcCfg.APIKey, accountName)
+	currentBalance, err := pcGetSharedAccountBalance(ctx, pcCfg.APIURL, pcCfg.APIKey, accountName)
 	if err != nil {
-		slog.Error("papercut: failed to get current balance before top-up", "account", accountName, "err", err)
-		return
+		return fmt.Errorf("failed to get current balance of %s before top-up: %w", accountName, err)
 	}
-	slog.Debug("papercut: current balance before top-up", "account", accountName, "current", currentBalance, "topup", requestedBalance)
+	slog.DebugContext(ctx, "papercut: current balance before top-up", "account", accountName, "current", currentBalance, "topup", requestedBalance)
 
 	// Add the requested top-up amount to the existing balance to get the new total.
 	newBalance := currentBalance + requestedBalance
 
-	if err := pcSetSharedAccountBalance(pcCfg.APIURL, pcCfg.APIKey, accountName, newBalance, adjustmentReason); err != nil {
-		slog.Error("papercut: failed to set shared account balance", "account", accountName, "err", err)
-		return
+	if err := pcSetSharedAccountBalance(ctx, pcCfg.APIURL, pcCfg.APIKey, accountName, newBalance, adjustmentReason); err != nil {
+		return fmt.Errorf("failed to set balance of shared account %s: %w", accountName, err)
 	}
-	slog.Info("papercut: shared account balance set", "account", accountName, "old", currentBalance, "topup", requestedBalance, "new", newBalance)
+	slog.InfoContext(ctx, "papercut: shared account balance set", "account", accountName, "old", currentBalance, "topup", requestedBalance, "new", newBalance)
 
 	// Re-fetch the balance after setting it to confirm what PaperCut actually
 	// stored. PaperCut may round or cap the value; reporting the confirmed balance
 	// (rather than the computed newBalance) ensures the tenant's record is accurate.
-	bal, err := pcGetSharedAccountBalance(pcCfg.APIURL, pcCfg.APIKey, accountName)
+	bal, err := pcGetSharedAccountBalance(ctx, pcCfg.APIURL, pcCfg.APIKey, accountName)
 	if err != nil {
-		slog.Error("papercut: failed to get updated balance", "account", accountName, "err", err)
-		return
+		return fmt.Errorf("failed to get updated balance of %s: %w", accountName, err)
 	}
 
 	key, err := config.Get().Tenant.GetEncryptionKey()
 	if err != nil {
-		slog.Error("papercut: failed to get encryption key", "err", err)
-		return
+		return fmt.Errorf("failed to get encryption key: %w", err)
 	}
 
 	// Encrypt the confirmed balance before posting; balance data is financially sensitive.
 	payload := pcSharedAccountBalancePayload{SharedAccount: accountName, Balance: bal}
-	resp, err := client.PostEncryptedJSON(tenant.URL("/api/agent/ingest/papercut-shared-account-balance"), payload, key)
+	resp, err := client.PostEncryptedJSON(ctx, tenant.URL("/api/agent/ingest/papercut-shared-account-balance"), payload, key)
 	if err != nil {
-		slog.Error("papercut: failed to send updated balance", "err", err)
-		return
+		return fmt.Errorf("failed to send updated balance: %w", err)
 	}
 	defer resp.Body.Close()
 
-	slog.Info("papercut: shared account balance updated and sent", "account", accountName, "balance", bal)
+	slog.InfoContext(ctx, "papercut: shared account balance updated and sent", "account", accountName, "balance", bal)
+	return nil
 }
@@ -0,0 +1,128 @@
+// Copyright © 2026 ForcePoint Software. All rights reserved.
+
+package tasks
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"time"
+
+	"github.com/forcedesk/forcedesk-agent/internal/config"
+	"github.com/forcedesk/forcedesk-agent/internal/scheduler"
+	"github.com/forcedesk/forcedesk-agent/internal/tenant"
+)
+
+// Push listener settings.
+const (
+	// pushMinBackoff is the wait before reconnecting after a failed poll; it
+	// doubles for each further failure, up to pushMaxBackoff, plus up to 50%
+	// jitter so a fleet doesn't reconnect in lockstep after a tenant outage.
+	pushMinBackoff = 2 * time.Second
+	pushMaxBackoff = 2 * time.Minute
+	// pushSafetyPoll is how often the command queue is still polled in full
+	// while the push channel is up, in case a push was missed.
+	pushSafetyPoll = 5 * time.Minute
+	// pushSession is how long one run holds the channel before ending the
+	// session itself. It must stay under the task timeout, or every session
+	// would end as a timed-out run.
+	pushSession = 50 * time.Minute
+)
+
+// PushListener holds the tenant push channel open and acts on what arrives:
+// commands are submitted as jobs exactly as CommandQueueService would, and
+// device queries are run at once. Failed polls are retried with backoff;
+// meanwhile, and whenever the tenant has no push channel, the polling tasks
+// carry on as before. Each run is one session, which the listener ends after
+// pushSession; the next tick starts another.
+func PushListener(ctx context.Context) error {
+	if config.Get().Tenant.DisablePush {
+		scheduler.Summarize(ctx, "push channel disabled in config")
+		return nil
+	}
+	key, err := config.Get().Tenant.GetEncryptionKey()
+	if err != nil {
+		return fmt.Errorf("failed to get encryption key: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, pushSession)
+	defer cancel()
+
+	client := tenant.New()
+	cursor := ""
+	backoff := pushMinBackoff
+	delivered, failures := 0, 0
+
+	for ctx.Err() == nil {
+		events, next, err := client.Poll(ctx, cursor, key)
+		switch {
+		case errors.Is(err, tenant.ErrPushUnsupported):
+			slog.DebugContext(ctx, "push: tenant has no push channel, polling instead")
+			scheduler.Summarize(ctx, "tenant has no push channel")
+			return nil
+		case err != nil && ctx.Err() != nil:
+			continue
+		case err != nil:
+			failures++
+			// Nothing to gain by polling until an offline tenant is back.
+			if changed := tenant.ConnectivityChanged(); !tenant.Online() {
+				slog.WarnContext(ctx, "push: tenant offline, waiting for it to come back", "err", err)
+				select {
+				case <-changed:
+				case <-ctx.Done():
+				}
+				backoff = pushMinBackoff
+				continue
+			}
+			wait := backoff + rand.N(backoff/2)
+			slog.WarnContext(ctx, "push: poll failed, reconnecting", "err", err, "retry_in", wait.Round(time.Millisecond))
+			if scheduler.Sleep(ctx, wait) != nil {
+				continue
+			}
+			backoff = min(backoff*2, pushMaxBackoff)
+			continue
+		}
+
+		backoff = pushMinBackoff
+		cursor = next
+		for _, ev := range events {
+			handlePushEvent(ctx, client, ev, key)
+			delivered++
+		}
+	}
+
+	scheduler.Summarize(ctx, "push events: %d, failed polls: %d", delivered, failures)
+	return nil
+}
+
+// handlePushEvent acts on one push event. Work is started in the background
+// so the next poll goes out at once.
+func handlePushEvent(ctx context.Context, client *tenant.Client, ev tenant.PushEvent, key []byte) {
+	switch ev.Type {
+	case tenant.PushCommands:
+		var items []commandQueueItem
+		if err := json.Unmarshal(ev.Data, &items); err != nil {
+			slog.ErrorContext(ctx, "push: malformed commands event", "err", err)
+			return
+		}
+		started := submitCommands(ctx, items)
+		slog.InfoContext(ctx, "push: commands received", "count", len(items), "jobs_started", started)
+
+	case tenant.PushDeviceQueries:
+		var result dqResponse
+		if err := json.Unmarshal(ev.Data, &result); err != nil {
+			slog.ErrorContext(ctx, "push: malformed device-queries event", "err", err)
+			return
+		}
+		slog.InfoContext(ctx, "push: device queries received", "count", len(result.Payloads))
+		scheduler.Go(ctx, "devicequery", func(ctx context.Context) {
+			runDeviceQueries(ctx, client, result, key)
+		})
+
+	default:
+		slog.WarnContext(ctx, "push: unknown event type", "type", ev.Type)
+	}
+}
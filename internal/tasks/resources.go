@@ -0,0 +1,12 @@
+// Copyright © 2026 ForcePoint Software. All rights reserved.
+
+package tasks
+
+// Resource locks shared by scheduled tasks and command-queue jobs. Their
+// capacities are set when the scheduler is built.
+const (
+	// ResourceSTMC limits concurrent eduSTAR Management Console sessions.
+	ResourceSTMC = "stmc"
+	// ResourcePapercut limits concurrent PaperCut API sessions.
+	ResourcePapercut = "papercut"
+)
@@ -0,0 +1,56 @@
+// Copyright © 2026 ForcePoint Software. All rights reserved.
+
+package tasks
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+
+	"github.com/forcedesk/forcedesk-agent/internal/scheduler"
+	"github.com/forcedesk/forcedesk-agent/internal/tenant"
+	"github.com/forcedesk/forcedesk-agent/internal/update"
+)
+
+// SelfUpdate asks the tenant which agent version this agent should run and,
+// if it differs, installs it and restarts onto it (see package update). The
+// tenant answers 204 No Content when it has no update to offer. Runs every
+// 30 minutes.
+func SelfUpdate(ctx context.Context) error {
+	client := tenant.New()
+	url := tenant.URL("/api/agent/update")
+	resp, err := client.Get(ctx, url)
+	if err != nil {
+		return fmt.Errorf("fetch update offer: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNoContent, http.StatusNotFound:
+		scheduler.Summarize(ctx, "no update offered")
+		return nil
+	default:
+		return &tenant.StatusError{StatusCode: resp.StatusCode, URL: url}
+	}
+
+	var offer update.Offer
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&offer); err != nil {
+		return fmt.Errorf("decode update offer: %w", err)
+	}
+	slog.DebugContext(ctx, "selfupdate: offer received", "version", offer.Version, "rollout", offer.Rollout)
+
+	if err := update.Apply(ctx, &offer); err != nil {
+		if errors.Is(err, update.ErrSkipped) {
+			scheduler.Summarize(ctx, "%v", err)
+			return nil
+		}
+		return fmt.Errorf("update to %s: %w", offer.Version, err)
+	}
+	scheduler.Summarize(ctx, "installed %s, restarting", offer.Version)
+	return nil
+}
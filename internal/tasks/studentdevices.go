@@ -5,6 +5,7 @@ package tasks
 import (
 	"archive/zip"
 	"bytes"
+	"context"
 	"crypto/x509"
 	"encoding/base64"
 	"encoding/pem"
@@ -15,6 +16,8 @@ import (
 	"strings"
 	"time"
 
+	"github.com/forcedesk/forcedesk-agent/internal/outbox"
+	"github.com/forcedesk/forcedesk-agent/internal/scheduler"
 	"github.com/forcedesk/forcedesk-agent/internal/tenant"
 )
 
@@ -32,41 +35,39 @@ type certUpload struct {
 // certificate for the given device, downloads and validates the ZIP, extracts the expiry date
 // from the enclosed .cer file, then posts the result to the tenant. Triggered via the command queue.
 // requestUUID is passed back in the POST body so the server can correlate integration logs.
-func RequestStudentDeviceCertificate(snid, computerName, requestUUID, deviceType string) {
-	slog.Info("studentdevices: requesting certificate", "snid", snid, "computer", computerName)
+func RequestStudentDeviceCertificate(ctx context.Context, snid, computerName, requestUUID, deviceType string) error {
+	slog.InfoContext(ctx, "studentdevices: requesting certificate", "snid", snid, "computer", computerName)
 
 	tc := tenant.New()
-	if err := tc.TestConnectivity(); err != nil {
-		slog.Error("studentdevices: connectivity check failed", "err", err)
-		return
+	if err := tenant.CheckOnline(); err != nil {
+		return fmt.Errorf("connectivity check failed: %w", err)
 	}
 
-	stmc, cfg, err := initClient(tc)
+	stmc, cfg, err := initClient(ctx, tc)
 	if err != nil {
-		slog.Error("studentdevices: STMC init failed", "snid", snid, "err", err)
-		return
+		return fmt.Errorf("STMC init failed: %w", err)
 	}
 
-	slog.Info("studentdevices: authenticated with STMC", "mode", stmc.AuthMode, "snid", snid)
+	slog.InfoContext(ctx, "studentdevices: authenticated with STMC", "mode", stmc.AuthMode, "snid", snid)
 
 	// Request the certificate in STMC (stored as "{schoolcode}-{computerName}").
-	slog.Info("studentdevices: submitting certificate request to STMC", "snid", snid, "computer", computerName)
-	if err := stmc.AddCertificate(cfg.SchoolCode, computerName, "eduSTAR.NET"); err != nil {
+	slog.InfoContext(ctx, "studentdevices: submitting certificate request to STMC", "snid", snid, "computer", computerName)
+	if err := stmc.AddCertificate(ctx, cfg.SchoolCode, computerName, "eduSTAR.NET"); err != nil {
 		if !strings.Contains(err.Error(), "already exists") {
-			slog.Error("studentdevices: AddCertificate failed", "snid", snid, "err", err)
-			return
+			return fmt.Errorf("AddCertificate failed: %w", err)
 		}
-		slog.Info("studentdevices: certificate already exists in STMC, proceeding to download", "snid", snid)
+		slog.InfoContext(ctx, "studentdevices: certificate already exists in STMC, proceeding to download", "snid", snid)
 	} else {
-		slog.Info("studentdevices: certificate request submitted, waiting for STMC to process", "snid", snid)
-		time.Sleep(5 * time.Second)
+		slog.InfoContext(ctx, "studentdevices: certificate request submitted, waiting for STMC to process", "snid", snid)
+		if err := scheduler.Sleep(ctx, 5*time.Second); err != nil {
+			return fmt.Errorf("cancelled while waiting for STMC: %w", err)
+		}
 	}
 
 	// Verify the certificate appears in the school's certificate list.
-	certs, err := stmc.GetCertificates(cfg.SchoolCode)
+	certs, err := stmc.GetCertificates(ctx, cfg.SchoolCode)
 	if err != nil {
-		slog.Error("studentdevices: GetCertificates failed", "snid", snid, "err", err)
-		return
+		return fmt.Errorf("GetCertificates failed: %w", err)
 	}
 
 	expectedName := cfg.SchoolCode + "-" + computerName
@@ -80,23 +81,21 @@ func RequestStudentDeviceCertificate(snid, computerName, requestUUID, deviceType
 			}
 		}
 	}
-	slog.Info("studentdevices: certificate list retrieved", "snid", snid, "count", len(certs), "names", strings.Join(names, ", "))
+	slog.InfoContext(ctx, "studentdevices: certificate list retrieved", "snid", snid, "count", len(certs), "names", strings.Join(names, ", "))
 
 	if !found {
-		slog.Error("studentdevices: certificate not found in STMC list after creation", "snid", snid, "expected", expectedName)
-		return
+		return fmt.Errorf("certificate not found in STMC list after creation: expected %s", expectedName)
 	}
 
-	slog.Info("studentdevices: certificate verified, downloading", "snid", snid, "compName", expectedName)
+	slog.InfoContext(ctx, "studentdevices: certificate verified, downloading", "snid", snid, "compName", expectedName)
 
 	// Download the certificate as a base64-encoded ZIP.
-	b64, err := stmc.GetCertificate(cfg.SchoolCode, expectedName, "eduSTAR.NET")
+	b64, err := stmc.GetCertificate(ctx, cfg.SchoolCode, expectedName, "eduSTAR.NET")
 	if err != nil {
-		slog.Error("studentdevices: GetCertificate failed", "snid", snid, "err", err)
-		return
+		return fmt.Errorf("GetCertificate failed: %w", err)
 	}
 
-	slog.Info("studentdevices: certificate data received", "snid", snid, "b64_len", len(b64))
+	slog.InfoContext(ctx, "studentdevices: certificate data received", "snid", snid, "b64_len", len(b64))
 
 	zipBytes, err := base64.StdEncoding.DecodeString(strings.TrimSpace(b64))
 	if err != nil {
@@ -104,33 +103,29 @@ func RequestStudentDeviceCertificate(snid, computerName, requestUUID, deviceType
 		if len(preview) > 100 {
 			preview = preview[:100]
 		}
-		slog.Error("studentdevices: base64 decode failed", "snid", snid, "err", err, "preview", preview)
-		return
+		return fmt.Errorf("base64 decode failed: %w", err)
 	}
 
 	if len(zipBytes) == 0 {
-		slog.Error("studentdevices: decoded certificate is empty", "snid", snid)
-		return
+		return fmt.Errorf("decoded certificate is empty")
 	}
 	if len(zipBytes) > maxCertZipSize {
-		slog.Error("studentdevices: certificate ZIP too large", "snid", snid, "size", len(zipBytes))
-		return
+		return fmt.Errorf("certificate ZIP too large: %d bytes", len(zipBytes))
 	}
 
-	slog.Info("studentdevices: certificate decoded successfully", "snid", snid, "zip_size", len(zipBytes))
+	slog.InfoContext(ctx, "studentdevices: certificate decoded successfully", "snid", snid, "zip_size", len(zipBytes))
 
 	// Validate the ZIP structure and parse the enclosed .cer for the expiry date.
 	zr, err := zip.NewReader(bytes.NewReader(zipBytes), int64(len(zipBytes)))
 	if err != nil {
-		slog.Error("studentdevices: invalid ZIP archive", "snid", snid, "err", err)
-		return
+		return fmt.Errorf("invalid ZIP archive: %w", err)
 	}
 
 	expiry := certExpiryFromZip(zr, computerName)
 	if expiry != "" {
-		slog.Info("studentdevices: certificate expiry determined", "snid", snid, "expiry", expiry)
+		slog.InfoContext(ctx, "studentdevices: certificate expiry determined", "snid", snid, "expiry", expiry)
 	} else {
-		slog.Warn("studentdevices: could not determine certificate expiry", "snid", snid)
+		slog.WarnContext(ctx, "studentdevices: could not determine certificate expiry", "snid", snid)
 	}
 
 	// Post the ZIP and expiry to the tenant for storage.
@@ -140,14 +135,17 @@ func RequestStudentDeviceCertificate(snid, computerName, requestUUID, deviceType
 		RequestUUID:       requestUUID,
 		DeviceType:        deviceType,
 	}
-	resp, err := tc.PostJSON(tenant.URL(fmt.Sprintf("/api/agent/student-devices/%s/certificate", snid)), payload)
+	queued, err := outbox.Post(ctx, tc, outbox.KindJSON, fmt.Sprintf("/api/agent/student-devices/%s/certificate", snid), payload)
 	if err != nil {
-		slog.Error("studentdevices: failed to post certificate to tenant", "snid", snid, "err", err)
-		return
+		return fmt.Errorf("failed to post certificate to tenant: %w", err)
+	}
+	if queued {
+		slog.InfoContext(ctx, "studentdevices: tenant unavailable, certificate queued", "snid", snid)
+		return nil
 	}
-	defer resp.Body.Close()
 
-	slog.Info("studentdevices: certificate stored on tenant", "snid", snid, "status", resp.StatusCode)
+	slog.InfoContext(ctx, "studentdevices: certificate stored on tenant", "snid", snid)
+	return nil
 }
 
 // certExpiryFromZip scans a ZIP archive for a .cer file whose name contains computerName,
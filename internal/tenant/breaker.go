@@ -0,0 +1,167 @@
+// Copyright © 2026 ForcePoint Software. All rights reserved.
+
+package tenant
+
+import (
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/forcedesk/forcedesk-agent/internal/errclass"
+)
+
+// Circuit breaker settings. The breaker is process-wide, and outlives the
+// shared Client when a config reload replaces it.
+const (
+	// breakerThreshold is the number of consecutive failed attempts that
+	// opens the circuit.
+	breakerThreshold = 5
+	// breakerCooldown is how long the circuit stays open before a probe is
+	// let through. It doubles each time a probe fails, up to breakerMaxCooldown.
+	breakerCooldown    = 30 * time.Second
+	breakerMaxCooldown = 5 * time.Minute
+)
+
+// Circuit states.
+const (
+	CircuitClosed   = "closed"    // requests flow normally
+	CircuitOpen     = "open"      // requests fail fast with ErrCircuitOpen
+	CircuitHalfOpen = "half-open" // one probe request is allowed through
+)
+
+// CircuitState is a snapshot of the tenant circuit breaker, returned by
+// Circuit for the WebUI status API.
+type CircuitState struct {
+	State    string     `json:"state"`
+	Failures int        `json:"failures"`            // consecutive failed attempts
+	OpenedAt *time.Time `json:"opened_at,omitempty"` // when the circuit last opened
+	RetryAt  *time.Time `json:"retry_at,omitempty"`  // when the next probe is allowed
+	LastErr  string     `json:"last_error,omitempty"`
+}
+
+// circuitOpenError is returned while the circuit is open.
+type circuitOpenError struct{}
+
+func (circuitOpenError) Error() string {
+	return "tenant unreachable, circuit breaker open"
+}
+
+// RetryClass makes scheduler retry policies treat an open circuit like any
+// other network failure.
+func (circuitOpenError) RetryClass() errclass.Class {
+	return errclass.Network
+}
+
+// ErrCircuitOpen is returned without contacting the tenant while the circuit
+// breaker is open.
+var ErrCircuitOpen error = circuitOpenError{}
+
+// breaker stops the agent hammering a tenant that is down. Only transport
+// errors and 502, 503 or 504 answers count as failures. After
+// breakerThreshold consecutive failures it opens and fails requests fast;
+// once the cooldown has passed a single probe is let through, which closes
+// the circuit on success or reopens it for longer on failure.
+type breaker struct {
+	mu       sync.Mutex
+	state    string
+	failures int
+	cooldown time.Duration
+	openedAt time.Time
+	retryAt  time.Time
+	probing  bool // a half-open probe is in flight
+	lastErr  string
+}
+
+var circuit = &breaker{state: CircuitClosed}
+
+// Circuit returns the current state of the tenant circuit breaker.
+func Circuit() CircuitState {
+	b := circuit
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	st := CircuitState{State: b.state, Failures: b.failures, LastErr: b.lastErr}
+	if !b.openedAt.IsZero() {
+		at := b.openedAt
+		st.OpenedAt = &at
+	}
+	if b.state != CircuitClosed {
+		at := b.retryAt
+		st.RetryAt = &at
+	}
+	return st
+}
+
+// allow reports whether a request may be sent now.
+func (b *breaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case CircuitOpen:
+		if time.Now().Before(b.retryAt) {
+			return false
+		}
+		b.state = CircuitHalfOpen
+		b.probing = true
+		slog.Info("tenant: circuit half-open, probing")
+		return true
+	case CircuitHalfOpen:
+		if b.probing {
+			return false
+		}
+		b.probing = true
+		return true
+	}
+	return true
+}
+
+// isOpen reports whether requests are currently being failed fast.
+func (b *breaker) isOpen() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state == CircuitOpen
+}
+
+// success records an attempt the tenant answered normally.
+func (b *breaker) success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state != CircuitClosed {
+		slog.Info("tenant: circuit closed, tenant reachable again")
+	}
+	b.state = CircuitClosed
+	b.failures = 0
+	b.cooldown = 0
+	b.probing = false
+	b.lastErr = ""
+}
+
+// cancelled records an attempt abandoned by the caller, which says nothing
+// about the tenant. It only frees the probe slot.
+func (b *breaker) cancelled() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+}
+
+// failure records an attempt that failed because the tenant was unreachable
+// or erroring, and reports whether it opened the circuit.
+func (b *breaker) failure(reason string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures++
+	b.lastErr = reason
+	switch {
+	case b.state == CircuitHalfOpen:
+		b.cooldown = min(b.cooldown*2, breakerMaxCooldown)
+	case b.state == CircuitClosed && b.failures >= breakerThreshold:
+		b.cooldown = breakerCooldown
+	default:
+		return false
+	}
+	b.state = CircuitOpen
+	b.probing = false
+	b.openedAt = time.Now()
+	b.retryAt = b.openedAt.Add(b.cooldown)
+	slog.Warn("tenant: circuit open, failing requests fast", "failures", b.failures, "cooldown", b.cooldown, "last_error", reason)
+	return true
+}
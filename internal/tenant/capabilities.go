@@ -0,0 +1,171 @@
+// Copyright © 2026 ForcePoint Software. All rights reserved.
+
+package tenant
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/forcedesk/forcedesk-agent/internal/config"
+)
+
+// Capability advertisement. The agent posts a capability document to
+// capabilitiesPath at startup and embeds it in every heartbeat, so the tenant
+// knows which commands, device types and check types this agent handles and
+// which protocol versions it speaks, and can refuse to queue work it can't
+// do. The tenant answers with the API version it will use from those the
+// agent lists; the agent then names it in apiVersionHeader on every request.
+// A tenant that predates negotiation answers 404 and API version 1 is assumed.
+const (
+	capabilitiesPath = "/api/agent/capabilities"
+	apiVersionHeader = "x-forcedesk-api-version"
+)
+
+// apiVersions lists the tenant API versions the agent speaks, oldest first.
+var apiVersions = []int{1}
+
+// negotiatedAPI is the API version the tenant chose, or 0 before negotiation.
+var negotiatedAPI atomic.Int32
+
+// Capabilities is the capability document.
+type Capabilities struct {
+	AgentVersion string `json:"agent_version"`
+	OS           string `json:"os"`
+	Arch         string `json:"arch"`
+	APIVersions  []int  `json:"api_versions"`
+	// Commands, DeviceTypes and CheckTypes are the command queue types,
+	// device manager device types and monitoring check types handled.
+	Commands    []string  `json:"commands"`
+	DeviceTypes []string  `json:"device_types"`
+	CheckTypes  []string  `json:"check_types"`
+	Protocols   Protocols `json:"protocols"`
+}
+
+// Protocols lists the wire protocol features the agent will use, as limited
+// by its configuration.
+type Protocols struct {
+	// Envelopes are the encrypted envelope versions accepted.
+	Envelopes []int `json:"envelopes"`
+	// Compression lists the request body codings the agent can send.
+	Compression []string `json:"compression"`
+	// Push reports whether the agent listens on the push channel, and
+	// PushEvents the event types it acts on.
+	Push       bool     `json:"push"`
+	PushEvents []string `json:"push_events"`
+}
+
+// capabilitiesAck is the tenant's answer to a capability document.
+type capabilitiesAck struct {
+	APIVersion int `json:"api_version"`
+}
+
+// NewCapabilities returns a capability document for this agent with the
+// given command, device and check types filled in.
+func NewCapabilities(commands, deviceTypes, checkTypes []string) *Capabilities {
+	return &Capabilities{
+		AgentVersion: AgentVersion,
+		OS:           runtime.GOOS,
+		Arch:         runtime.GOARCH,
+		APIVersions:  apiVersions,
+		Commands:     sorted(commands),
+		DeviceTypes:  sorted(deviceTypes),
+		CheckTypes:   sorted(checkTypes),
+		Protocols:    protocols(),
+	}
+}
+
+// protocols describes the protocol features the current config allows.
+func protocols() Protocols {
+	var p Protocols
+	for _, v := range strings.Split(acceptedEnvelopes(), ",") {
+		if n, err := strconv.Atoi(strings.TrimSpace(v)); err == nil {
+			p.Envelopes = append(p.Envelopes, n)
+		}
+	}
+	switch m := strings.ToLower(config.Get().Tenant.Compression); m {
+	case CompressionOff:
+		p.Compression = []string{}
+	case encodingGzip, encodingZstd:
+		p.Compression = []string{m}
+	default:
+		p.Compression = []string{encodingZstd, encodingGzip}
+	}
+	if !config.Get().Tenant.DisablePush {
+		p.Push = true
+		p.PushEvents = []string{PushCommands, PushDeviceQueries}
+	} else {
+		p.PushEvents = []string{}
+	}
+	return p
+}
+
+func sorted(s []string) []string {
+	s = slices.Clone(s)
+	if s == nil {
+		s = []string{}
+	}
+	slices.Sort(s)
+	return s
+}
+
+// APIVersion returns the API version negotiated with the tenant, or 0 if
+// none has been.
+func APIVersion() int {
+	return int(negotiatedAPI.Load())
+}
+
+// NoteAPIVersion records the API version the tenant says it will use. A
+// version the agent doesn't speak is ignored, as is 0 (not stated).
+func NoteAPIVersion(v int) {
+	if v == 0 {
+		return
+	}
+	if !slices.Contains(apiVersions, v) {
+		slog.Warn("tenant: tenant chose an API version the agent does not speak, ignored", "version", v, "supported", apiVersions)
+		return
+	}
+	if prev := negotiatedAPI.Swap(int32(v)); prev != int32(v) {
+		slog.Info("tenant: API version negotiated", "version", v, "previous", prev)
+	}
+}
+
+// PublishCapabilities posts caps to the tenant and records the API version
+// it chooses.
+func (c *Client) PublishCapabilities(ctx context.Context, caps *Capabilities) error {
+	url := URL(capabilitiesPath)
+	resp, err := c.PostJSON(ctx, url, caps)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+		slog.Debug("tenant: capability advertisement not supported, assuming API version 1")
+		NoteAPIVersion(apiVersions[0])
+		return nil
+	default:
+		return &StatusError{StatusCode: resp.StatusCode, URL: url}
+	}
+
+	var ack capabilitiesAck
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&ack); err != nil {
+		return fmt.Errorf("decode capabilities response: %w", err)
+	}
+	if ack.APIVersion == 0 {
+		ack.APIVersion = apiVersions[0]
+	}
+	NoteAPIVersion(ack.APIVersion)
+	return nil
+}
@@ -4,20 +4,21 @@ package tenant
 
 import (
 	"bytes"
-	"crypto/rand"
-	"crypto/tls"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"log/slog"
 	"mime/multipart"
 	"net/http"
+	"strconv"
+	"sync"
 	"time"
 
-	"golang.org/x/crypto/chacha20poly1305"
-
 	"github.com/forcedesk/forcedesk-agent/internal/config"
+	"github.com/forcedesk/forcedesk-agent/internal/errclass"
 	"github.com/forcedesk/forcedesk-agent/internal/ratelimit"
+	"github.com/forcedesk/forcedesk-agent/internal/transport"
 )
 
 const AgentVersion = "2.2.0-win-amd64"
@@ -28,34 +29,87 @@ const AgentVersion = "2.2.0-win-amd64"
 type Client struct {
 	http    *http.Client
 	limiter *ratelimit.Limiter
+	// err is set if the client couldn't be configured; every request fails
+	// with it.
+	err error
 }
 
-// New creates a Client using the current agent configuration.
-// SSL verification can be disabled via the VerifySSL config option.
+var (
+	sharedMu  sync.Mutex
+	sharedCfg *config.Config
+	shared    *Client
+)
+
+// New returns the process-wide Client for the current agent configuration.
+// Every caller shares its connection pool and rate limiter; it is rebuilt
+// only when the config is reloaded.
+// TLS trust comes from TLSConfig; if it can't be built, for example because
+// the configured CA bundle is missing, requests fail rather than fall back
+// to weaker trust.
 func New() *Client {
 	cfg := config.Get()
+	sharedMu.Lock()
+	defer sharedMu.Unlock()
+	if shared == nil || sharedCfg != cfg {
+		shared = newClient(cfg)
+		sharedCfg = cfg
+	}
+	return shared
+}
 
+func newClient(cfg *config.Config) *Client {
 	// Warn if SSL verification is disabled.
 	if !cfg.Tenant.VerifySSL {
-		slog.Warn("SSL certificate verification is DISABLED - connections are vulnerable to MITM attacks",
-			"tenant_url", cfg.Tenant.URL)
+		if len(cfg.Tenant.SPKIPins) > 0 {
+			slog.Warn("SSL certificate verification is DISABLED - relying on SPKI pins alone",
+				"tenant_url", cfg.Tenant.URL)
+		} else {
+			slog.Warn("SSL certificate verification is DISABLED - connections are vulnerable to MITM attacks",
+				"tenant_url", cfg.Tenant.URL)
+		}
 	}
 
-	transport := &http.Transport{
-		TLSClientConfig: &tls.Config{
-			InsecureSkipVerify: !cfg.Tenant.VerifySSL, //nolint:gosec
-		},
+	tlsCfg, err := TLSConfig()
+	if err != nil {
+		slog.Error("tenant: invalid TLS configuration, requests will fail", "err", err)
+		err = fmt.Errorf("tenant TLS configuration: %w", err)
 	}
+	rt := transport.New(tlsCfg)
 
 	// Rate limiter: max 100 requests, refill 1 token every 100ms (600/min max).
 	limiter := ratelimit.NewLimiter(100, 100*time.Millisecond)
 
 	return &Client{
 		http: &http.Client{
-			Transport: transport,
+			Transport: rt,
 			Timeout:   30 * time.Second,
 		},
 		limiter: limiter,
+		err:     err,
+	}
+}
+
+// StatusError is returned when the tenant answers with an unexpected HTTP
+// status.
+type StatusError struct {
+	StatusCode int
+	URL        string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("unexpected status %d from %s", e.StatusCode, e.URL)
+}
+
+// RetryClass classifies the status for scheduler retry policies: 5xx and
+// 429 are transient, other statuses mean the request itself was rejected.
+func (e *StatusError) RetryClass() errclass.Class {
+	switch {
+	case e.StatusCode == http.StatusTooManyRequests:
+		return errclass.Throttled
+	case e.StatusCode >= 500:
+		return errclass.Server
+	default:
+		return errclass.Client
 	}
 }
 
@@ -72,56 +126,85 @@ func (c *Client) applyHeaders(req *http.Request) {
 	req.Header.Set("x-forcedesk-agent", cfg.Tenant.UUID)
 	req.Header.Set("x-forcedesk-agentversion", AgentVersion)
 	req.Header.Set("Accept", "application/json")
+	req.Header.Set(envelopesHeader, acceptedEnvelopes())
+	setRequestID(req)
+	if v := APIVersion(); v != 0 {
+		req.Header.Set(apiVersionHeader, strconv.Itoa(v))
+	}
 }
 
 // Get performs an authenticated GET request to the given URL.
-func (c *Client) Get(url string) (*http.Response, error) {
+func (c *Client) Get(ctx context.Context, url string) (*http.Response, error) {
 	// Apply rate limiting.
 	if !c.limiter.Allow() {
 		slog.Warn("rate limit reached, throttling request", "url", url)
-		c.limiter.Wait()
+		if err := c.limiter.Wait(ctx); err != nil {
+			return nil, err
+		}
 	}
 
-	req, err := http.NewRequest(http.MethodGet, url, nil)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
 	if err != nil {
 		return nil, err
 	}
 	c.applyHeaders(req)
-	return c.http.Do(req)
+	return c.do(req)
 }
 
 // PostJSON performs an authenticated POST request with the provided value serialized as JSON in the request body.
-func (c *Client) PostJSON(url string, v any) (*http.Response, error) {
+// A sensitive endpoint (see policy.go) is never posted in plaintext: v goes to
+// the endpoint's encrypted counterpart through PostEncryptedJSON, or the post
+// fails if there is no usable encryption key.
+func (c *Client) PostJSON(ctx context.Context, url string, v any) (*http.Response, error) {
+	if target, ok := encryptedCounterpart(url); ok {
+		key, err := config.Get().Tenant.GetEncryptionKey()
+		if err != nil {
+			return nil, fmt.Errorf("%w to %s: %w", errPlaintextSensitive, url, err)
+		}
+		slog.Debug("tenant: sensitive upload, sending encrypted", "url", url, "encrypted_url", target)
+		return c.PostEncryptedJSON(ctx, target, v, key)
+	}
+
 	// Apply rate limiting.
 	if !c.limiter.Allow() {
 		slog.Warn("rate limit reached, throttling request", "url", url)
-		c.limiter.Wait()
+		if err := c.limiter.Wait(ctx); err != nil {
+			return nil, err
+		}
 	}
 
-	body, err := json.Marshal(v)
-	if err != nil {
-		return nil, fmt.Errorf("marshal body: %w", err)
-	}
 	// Log request details without exposing sensitive data.
-	slog.Debug("tenant: POST request", "url", url, "body_size", len(body))
-	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
-	if err != nil {
-		return nil, err
-	}
-	c.applyHeaders(req)
-	return c.http.Do(req)
+	slog.Debug("tenant: POST request", "url", url)
+	// The body is encoded, and compressed if the tenant accepts it, in
+	// memory; one too big for that is streamed as it is sent.
+	return c.doCompressed(func(enc string) (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, nil)
+		if err != nil {
+			return nil, err
+		}
+		c.applyHeaders(req)
+		if enc != "" {
+			req.Header.Set("Content-Encoding", enc)
+		}
+		if err := setBody(req, enc, func(w io.Writer) error {
+			return writeJSON(w, v)
+		}); err != nil {
+			return nil, err
+		}
+		return req, nil
+	})
 }
 
 // GetJSON performs an authenticated GET request and unmarshals the JSON response body into dst.
-func (c *Client) GetJSON(url string, dst any) error {
-	resp, err := c.Get(url)
+func (c *Client) GetJSON(ctx context.Context, url string, dst any) error {
+	resp, err := c.Get(ctx, url)
 	if err != nil {
 		return err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("unexpected status %d from %s", resp.StatusCode, url)
+		return &StatusError{StatusCode: resp.StatusCode, URL: url}
 	}
 
 	body, err := io.ReadAll(resp.Body)
@@ -132,166 +215,129 @@ func (c *Client) GetJSON(url string, dst any) error {
 }
 
 // GetEncryptedJSON performs an authenticated GET request whose response body is encrypted
-// with ChaCha20-Poly1305 using the provided 32-byte mutual key.
-// Expected wire format: nonce (12 bytes) || ciphertext+tag — the decrypted payload is JSON
-// which is unmarshalled into dst.
-func (c *Client) GetEncryptedJSON(url string, dst any, key []byte) error {
-	resp, err := c.Get(url)
+// with ChaCha20-Poly1305 using the provided 32-byte mutual key, and unmarshals the
+// decrypted JSON into dst. See envelope.go for the wire formats.
+func (c *Client) GetEncryptedJSON(ctx context.Context, url string, dst any, key []byte) error {
+	plaintext, err := c.GetEncryptedBytes(ctx, url, key)
 	if err != nil {
 		return err
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("unexpected status %d from %s", resp.StatusCode, url)
-	}
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return fmt.Errorf("read encrypted response: %w", err)
-	}
-
-	// Initialise the AEAD cipher with the shared key (always 32 bytes for ChaCha20-Poly1305).
-	aead, err := chacha20poly1305.New(key)
-	if err != nil {
-		return fmt.Errorf("create cipher: %w", err)
-	}
-
-	// Wire format: first NonceSize (12) bytes are the nonce; the rest is ciphertext+Poly1305 tag.
-	// Verify minimum length before slicing to avoid a panic.
-	ns := aead.NonceSize()
-	if len(body) < ns {
-		return fmt.Errorf("encrypted response too short (%d bytes)", len(body))
-	}
-
-	// aead.Open authenticates and decrypts in one step. A wrong key or tampered
-	// ciphertext produces an error here rather than silently returning garbage.
-	plaintext, err := aead.Open(nil, body[:ns], body[ns:], nil)
-	if err != nil {
-		return fmt.Errorf("decrypt response: %w", err)
-	}
-
 	return json.Unmarshal(plaintext, dst)
 }
 
 // GetEncryptedBytes performs an authenticated GET, decrypts the response body
 // with ChaCha20-Poly1305, and returns the raw plaintext bytes.
 // Useful for logging or custom unmarshalling.
-func (c *Client) GetEncryptedBytes(url string, key []byte) ([]byte, error) {
-	resp, err := c.Get(url)
+func (c *Client) GetEncryptedBytes(ctx context.Context, url string, key []byte) ([]byte, error) {
+	resp, err := c.Get(ctx, url)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("unexpected status %d from %s", resp.StatusCode, url)
+		return nil, &StatusError{StatusCode: resp.StatusCode, URL: url}
 	}
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
 		return nil, fmt.Errorf("read encrypted response: %w", err)
 	}
-
-	// Same nonce||ciphertext+tag wire format as GetEncryptedJSON.
-	aead, err := chacha20poly1305.New(key)
-	if err != nil {
-		return nil, fmt.Errorf("create cipher: %w", err)
-	}
-
-	ns := aead.NonceSize()
-	if len(body) < ns {
-		return nil, fmt.Errorf("encrypted response too short (%d bytes)", len(body))
-	}
-
-	plaintext, err := aead.Open(nil, body[:ns], body[ns:], nil)
-	if err != nil {
-		return nil, fmt.Errorf("decrypt response: %w", err)
-	}
-
-	return plaintext, nil
+	return openResponse(resp, body, key)
 }
 
 // PostEncryptedJSON marshals v as JSON, encrypts it with ChaCha20-Poly1305 using
-// the provided 32-byte key, and POSTs the result as application/octet-stream.
-// Wire format: nonce (12 bytes) || ciphertext+tag — the inverse of GetEncryptedJSON.
-func (c *Client) PostEncryptedJSON(url string, v any, key []byte) (*http.Response, error) {
+// the provided 32-byte key, and POSTs the result as application/octet-stream, in
+// the envelope format negotiated with the tenant (see envelope.go).
+func (c *Client) PostEncryptedJSON(ctx context.Context, url string, v any, key []byte) (*http.Response, error) {
 	if !c.limiter.Allow() {
 		slog.Warn("rate limit reached, throttling request", "url", url)
-		c.limiter.Wait()
-	}
-
-	plaintext, err := json.Marshal(v)
-	if err != nil {
-		return nil, fmt.Errorf("marshal payload: %w", err)
-	}
-
-	aead, err := chacha20poly1305.New(key)
-	if err != nil {
-		return nil, fmt.Errorf("create cipher: %w", err)
-	}
-
-	// Generate a fresh cryptographically random nonce for every request.
-	// Reusing a nonce with the same key would completely break ChaCha20-Poly1305 security.
-	nonce := make([]byte, aead.NonceSize())
-	if _, err := rand.Read(nonce); err != nil {
-		return nil, fmt.Errorf("generate nonce: %w", err)
-	}
-
-	// aead.Seal(dst, nonce, plaintext, aad): passing nonce as dst prepends it to
-	// the ciphertext+tag in a single allocation, producing the nonce||ciphertext+tag
-	// wire format expected by the server's decrypt routine.
-	ciphertext := aead.Seal(nonce, nonce, plaintext, nil)
-
-	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(ciphertext))
-	if err != nil {
-		return nil, err
-	}
-	c.applyHeaders(req)
-	// Override Content-Type: the body is raw binary, not JSON.
-	req.Header.Set("Content-Type", "application/octet-stream")
-	return c.http.Do(req)
+		if err := c.limiter.Wait(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	// Compress before sealing; ciphertext doesn't compress. Only the
+	// compressed plaintext is held in memory.
+	return c.doCompressed(func(enc string) (*http.Request, error) {
+		var plaintext bytes.Buffer
+		if err := encodeTo(&plaintext, enc, func(w io.Writer) error { return writeJSON(w, v) }); err != nil {
+			return nil, fmt.Errorf("marshal payload: %w", err)
+		}
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, nil)
+		if err != nil {
+			return nil, err
+		}
+		c.applyHeaders(req)
+		// Override Content-Type: the body is raw binary, not JSON.
+		req.Header.Set("Content-Type", "application/octet-stream")
+		if enc != "" {
+			req.Header.Set(payloadEncodingHeader, enc)
+		}
+		// The v2 envelope binds the ciphertext to the request path, so the
+		// request is built before the body is sealed.
+		if err := sealRequest(req, plaintext.Bytes(), key); err != nil {
+			return nil, err
+		}
+		return req, nil
+	})
 }
 
 // PostFile uploads raw bytes as a multipart/form-data POST. The file is sent
 // under the field name "file" with the supplied filename.
-func (c *Client) PostFile(url, filename string, data []byte) (*http.Response, error) {
+func (c *Client) PostFile(ctx context.Context, url, filename string, data []byte) (*http.Response, error) {
 	if !c.limiter.Allow() {
 		slog.Warn("rate limit reached, throttling request", "url", url)
-		c.limiter.Wait()
-	}
-
-	// Build the multipart body in memory. The field name "file" is the convention
-	// expected by the server's multipart parser (matches the Laravel/PHP side).
-	var buf bytes.Buffer
-	mw := multipart.NewWriter(&buf)
-	fw, err := mw.CreateFormFile("file", filename)
-	if err != nil {
-		return nil, fmt.Errorf("create form file: %w", err)
-	}
-	if _, err := fw.Write(data); err != nil {
-		return nil, fmt.Errorf("write file data: %w", err)
+		if err := c.limiter.Wait(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	// Stream the multipart body rather than building it in memory. The field
+	// name "file" is the convention expected by the server's multipart parser
+	// (matches the Laravel/PHP side). The boundary is fixed up front so a
+	// retry re-streams an identical body, and its length can be worked out
+	// from a dry run.
+	boundary := multipart.NewWriter(io.Discard).Boundary()
+	write := func(w io.Writer) error {
+		mw := multipart.NewWriter(w)
+		if err := mw.SetBoundary(boundary); err != nil {
+			return err
+		}
+		fw, err := mw.CreateFormFile("file", filename)
+		if err != nil {
+			return fmt.Errorf("create form file: %w", err)
+		}
+		if _, err := fw.Write(data); err != nil {
+			return fmt.Errorf("write file data: %w", err)
+		}
+		// Close writes the closing boundary.
+		return mw.Close()
+	}
+	var size countWriter
+	if err := write(&size); err != nil {
+		return nil, err
 	}
-	// Close must be called before reading buf; it writes the closing boundary.
-	mw.Close()
 
-	req, err := http.NewRequest(http.MethodPost, url, &buf)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, nil)
 	if err != nil {
 		return nil, err
 	}
 	// applyHeaders sets Content-Type to application/json; override it with the
 	// multipart boundary that the server needs to parse the form fields correctly.
 	c.applyHeaders(req)
-	req.Header.Set("Content-Type", mw.FormDataContentType())
-	return c.http.Do(req)
+	req.Header.Set("Content-Type", "multipart/form-data; boundary="+boundary)
+	setStreamBody(req, streamBody("", write), int64(size))
+	return c.do(req)
 }
 
 // TestConnectivity verifies that the agent can successfully reach the tenant API server.
-func (c *Client) TestConnectivity() error {
+func (c *Client) TestConnectivity(ctx context.Context) error {
 	var result struct {
 		Status string `json:"status"`
 	}
-	if err := c.GetJSON(URL("/api/agent/test"), &result); err != nil {
+	if err := c.GetJSON(ctx, URL("/api/agent/test"), &result); err != nil {
 		return fmt.Errorf("connectivity test: %w", err)
 	}
 	if result.Status != "ok" {
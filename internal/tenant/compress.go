@@ -0,0 +1,266 @@
+// Copyright © 2026 ForcePoint Software. All rights reserved.
+
+package tenant
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync/atomic"
+
+	"github.com/klauspost/compress/zstd"
+
+	"github.com/forcedesk/forcedesk-agent/internal/config"
+)
+
+// Request body compression. A tenant that accepts compressed uploads says so
+// with Accept-Encoding on its responses (RFC 7694); until it does, uploads go
+// out uncompressed. Plain bodies are sent with Content-Encoding. Encrypted
+// bodies are compressed before sealing, since ciphertext doesn't compress, and
+// name the coding in payloadEncodingHeader: a Content-Encoding on the
+// ciphertext would have proxies and middleware try to decode it.
+const (
+	encodingGzip = "gzip"
+	encodingZstd = "zstd"
+
+	payloadEncodingHeader = "x-forcedesk-payload-encoding"
+)
+
+// Compression modes, set by [tenant] compression in config.toml.
+const (
+	CompressionAuto = "auto" // the best coding the tenant advertises
+	CompressionOff  = "off"
+)
+
+// acceptedEncoding is the best request coding the tenant has advertised, or "".
+var acceptedEncoding atomic.Value // string
+
+// refusedEncoding is a coding the tenant refused with 415 and hasn't
+// advertised since, or "". A coding forced in the config is not used while
+// refused.
+var refusedEncoding atomic.Value // string
+
+// requestEncoding returns the coding to compress request bodies with, or ""
+// for none.
+func requestEncoding() string {
+	switch m := strings.ToLower(config.Get().Tenant.Compression); m {
+	case CompressionOff:
+		return ""
+	case encodingGzip, encodingZstd:
+		if refused, _ := refusedEncoding.Load().(string); refused == m {
+			return ""
+		}
+		return m
+	}
+	enc, _ := acceptedEncoding.Load().(string)
+	return enc
+}
+
+// noteEncodings records the request codings the tenant advertises in a response.
+func noteEncodings(resp *http.Response) {
+	adv := resp.Header.Values("Accept-Encoding")
+	if len(adv) == 0 {
+		return
+	}
+	best := ""
+	for _, v := range strings.Split(strings.Join(adv, ","), ",") {
+		// Drop any ";q=" weight; the agent picks by its own preference.
+		name, _, _ := strings.Cut(strings.TrimSpace(strings.ToLower(v)), ";")
+		switch {
+		case name == encodingZstd:
+			best = encodingZstd
+		case name == encodingGzip && best == "":
+			best = encodingGzip
+		}
+		if name != "" && refusedEncoding.CompareAndSwap(name, "") {
+			slog.Info("tenant: previously refused request compression advertised again", "encoding", name)
+		}
+	}
+	if prev, _ := acceptedEncoding.Swap(best).(string); prev != best {
+		slog.Info("tenant: request compression negotiated", "encoding", best, "previous", prev)
+	}
+}
+
+// rejectEncoding forgets a coding the tenant refused with 415 Unsupported
+// Media Type, so later uploads go out uncompressed until it is advertised
+// again. That holds for a coding forced in the config too.
+func rejectEncoding(enc string) {
+	accepted := acceptedEncoding.CompareAndSwap(enc, "")
+	if prev, _ := refusedEncoding.Swap(enc).(string); accepted || prev != enc {
+		slog.Warn("tenant: tenant refused compressed upload, compression disabled", "encoding", enc)
+	}
+}
+
+// doCompressed sends the request built by build, compressed with the
+// negotiated coding. If the tenant refuses the coding with 415 Unsupported
+// Media Type, the request is rebuilt and sent once more uncompressed.
+func (c *Client) doCompressed(build func(enc string) (*http.Request, error)) (*http.Response, error) {
+	enc := requestEncoding()
+	req, err := build(enc)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.do(req)
+	if err != nil || enc == "" || resp.StatusCode != http.StatusUnsupportedMediaType {
+		return resp, err
+	}
+	rejectEncoding(enc)
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	resp.Body.Close()
+
+	if req, err = build(""); err != nil {
+		return nil, err
+	}
+	return c.do(req)
+}
+
+// encodeError marks a failure producing a request body, as opposed to
+// sending it, so it isn't blamed on the tenant.
+type encodeError struct{ err error }
+
+func (e *encodeError) Error() string { return "encode request body: " + e.err.Error() }
+func (e *encodeError) Unwrap() error { return e.err }
+
+// streamBody returns a GetBody-style function producing the body written by
+// write, compressed with enc (none if ""). Each call re-runs write into a
+// fresh pipe, so the body is never held in memory whole and can be replayed
+// for a retry.
+func streamBody(enc string, write func(io.Writer) error) func() (io.ReadCloser, error) {
+	return func() (io.ReadCloser, error) {
+		pr, pw := io.Pipe()
+		go func() {
+			if err := encodeTo(pw, enc, write); err != nil {
+				pw.CloseWithError(&encodeError{err})
+				return
+			}
+			pw.Close()
+		}()
+		return pr, nil
+	}
+}
+
+// setStreamBody makes body the request body. size is its length in bytes,
+// or -1 if that isn't known, in which case the request is sent chunked.
+func setStreamBody(req *http.Request, body func() (io.ReadCloser, error), size int64) {
+	req.Body, _ = body()
+	req.GetBody = body
+	req.ContentLength = size
+}
+
+// maxBufferedBody is the largest request body setBody builds in memory to
+// send with a Content-Length. Bigger bodies are streamed chunked.
+const maxBufferedBody = 1 << 20
+
+// setBody makes the body written by write, compressed with enc, the request
+// body. Most bodies fit in maxBufferedBody and are sent with a
+// Content-Length, which some proxies and tenant front ends require; a bigger
+// one is abandoned part way and streamed instead.
+func setBody(req *http.Request, enc string, write func(io.Writer) error) error {
+	buf := &capBuffer{max: maxBufferedBody}
+	if err := encodeTo(buf, enc, write); err != nil {
+		if !buf.full {
+			return &encodeError{err}
+		}
+		setStreamBody(req, streamBody(enc, write), -1)
+		return nil
+	}
+	raw := buf.Bytes()
+	setStreamBody(req, func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(raw)), nil
+	}, int64(len(raw)))
+	return nil
+}
+
+// errBufferFull is returned by a capBuffer asked to grow past its max.
+var errBufferFull = errors.New("request body too large to buffer")
+
+// capBuffer is a bytes.Buffer that holds at most max bytes.
+type capBuffer struct {
+	bytes.Buffer
+	max  int
+	full bool
+}
+
+func (b *capBuffer) Write(p []byte) (int, error) {
+	if b.Len()+len(p) > b.max {
+		b.full = true
+		return 0, errBufferFull
+	}
+	return b.Buffer.Write(p)
+}
+
+// countWriter counts the bytes written to it and discards them.
+type countWriter int64
+
+func (n *countWriter) Write(p []byte) (int, error) {
+	*n += countWriter(len(p))
+	return len(p), nil
+}
+
+// encodeTo runs write through an enc compressor into w.
+func encodeTo(w io.Writer, enc string, write func(io.Writer) error) error {
+	var zw io.WriteCloser
+	switch enc {
+	case "":
+		return write(w)
+	case encodingGzip:
+		zw = gzip.NewWriter(w)
+	case encodingZstd:
+		var err error
+		if zw, err = zstd.NewWriter(w, zstd.WithEncoderConcurrency(1)); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unsupported encoding %q", enc)
+	}
+	if err := write(zw); err != nil {
+		zw.Close()
+		return err
+	}
+	return zw.Close()
+}
+
+// writeJSON encodes v as JSON to w. Slices and arrays are written one element
+// at a time, so a large upload such as a full student list is never
+// marshalled into one buffer.
+func writeJSON(w io.Writer, v any) error {
+	rv := reflect.ValueOf(v)
+	if _, ok := v.(json.Marshaler); ok || !rv.IsValid() ||
+		(rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array) ||
+		rv.Type().Elem().Kind() == reflect.Uint8 || (rv.Kind() == reflect.Slice && rv.IsNil()) {
+		return json.NewEncoder(w).Encode(v)
+	}
+
+	if _, err := io.WriteString(w, "["); err != nil {
+		return err
+	}
+	for i := range rv.Len() {
+		if i > 0 {
+			if _, err := io.WriteString(w, ","); err != nil {
+				return err
+			}
+		}
+		b, err := json.Marshal(rv.Index(i).Interface())
+		if err != nil {
+			return err
+		}
+		if _, err := w.Write(b); err != nil {
+			return err
+		}
+	}
+	_, err := io.WriteString(w, "]")
+	return err
+}
+
+// isEncodeError reports whether err came from producing a request body.
+func isEncodeError(err error) bool {
+	var e *encodeError
+	return errors.As(err, &e)
+}
@@ -0,0 +1,170 @@
+// Copyright © 2026 ForcePoint Software. All rights reserved.
+
+package tenant
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/forcedesk/forcedesk-agent/internal/errclass"
+)
+
+// Connectivity states.
+const (
+	ConnUnknown = "unknown" // nothing has been heard from the tenant yet
+	ConnOnline  = "online"
+	ConnOffline = "offline"
+)
+
+// probeIdle is how long the tenant may go unheard from while online before
+// Probe contacts it. Any request the tenant answers counts, so a busy agent
+// rarely probes at all.
+const probeIdle = time.Minute
+
+// ConnectivityState is a snapshot of the connection to the tenant, returned
+// by Connectivity for the WebUI status API.
+type ConnectivityState struct {
+	State    string     `json:"state"`
+	Since    *time.Time `json:"since,omitempty"`     // when the state last changed
+	LastSeen *time.Time `json:"last_seen,omitempty"` // when the tenant last answered
+	LastErr  string     `json:"last_error,omitempty"`
+}
+
+// offlineError is returned by CheckOnline while the tenant is offline.
+type offlineError struct{}
+
+func (offlineError) Error() string {
+	return "tenant offline"
+}
+
+// RetryClass makes scheduler retry policies treat an offline tenant like any
+// other network failure.
+func (offlineError) RetryClass() errclass.Class {
+	return errclass.Network
+}
+
+// ErrOffline is returned by CheckOnline, wrapped with the last failure,
+// while the tenant is known to be unreachable.
+var ErrOffline error = offlineError{}
+
+// monitor tracks whether the tenant is reachable. Every request feeds it:
+// an answer from the tenant marks it online, and the circuit breaker
+// opening marks it offline. Probe fills the gaps when nothing else is
+// talking to the tenant.
+type monitor struct {
+	mu       sync.Mutex
+	state    string
+	since    time.Time
+	lastSeen time.Time
+	lastErr  string
+	// changed is closed and replaced on every state change.
+	changed chan struct{}
+}
+
+var conn = &monitor{state: ConnUnknown, changed: make(chan struct{})}
+
+// Connectivity returns the current state of the connection to the tenant.
+func Connectivity() ConnectivityState {
+	m := conn
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	st := ConnectivityState{State: m.state, LastErr: m.lastErr}
+	if !m.since.IsZero() {
+		at := m.since
+		st.Since = &at
+	}
+	if !m.lastSeen.IsZero() {
+		at := m.lastSeen
+		st.LastSeen = &at
+	}
+	return st
+}
+
+// Online reports whether the tenant is believed reachable. Until the first
+// request or probe settles it, the tenant is assumed to be.
+func Online() bool {
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+	return conn.state != ConnOffline
+}
+
+// CheckOnline returns nil unless the tenant is known to be offline, in which
+// case it returns ErrOffline with the failure that took it offline. Tasks
+// call it before starting work that needs the tenant.
+func CheckOnline() error {
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+	if conn.state != ConnOffline {
+		return nil
+	}
+	return fmt.Errorf("%w since %s: %s", ErrOffline, conn.since.Format(time.TimeOnly), conn.lastErr)
+}
+
+// ConnectivityChanged returns a channel that is closed the next time the
+// tenant goes online or offline; call Connectivity for the new state.
+func ConnectivityChanged() <-chan struct{} {
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+	return conn.changed
+}
+
+// seen records that the tenant answered a request.
+func (m *monitor) seen() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.lastSeen = time.Now()
+	m.lastErr = ""
+	m.set(ConnOnline)
+}
+
+// lost records that the tenant can't be reached.
+func (m *monitor) lost(reason string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.lastErr = reason
+	m.set(ConnOffline)
+}
+
+// set moves to state, announcing the change. m.mu must be held.
+func (m *monitor) set(state string) {
+	if m.state == state {
+		return
+	}
+	prev := m.state
+	m.state = state
+	m.since = time.Now()
+	close(m.changed)
+	m.changed = make(chan struct{})
+
+	switch {
+	case state == ConnOffline:
+		slog.Warn("tenant: offline", "err", m.lastErr)
+	case prev == ConnOffline:
+		slog.Info("tenant: online again")
+	default:
+		slog.Info("tenant: online")
+	}
+}
+
+// Probe checks that the tenant is reachable, unless it answered a request
+// within probeIdle, and records the result. It reports whether the tenant
+// was contacted.
+func Probe(ctx context.Context) (bool, error) {
+	conn.mu.Lock()
+	fresh := conn.state == ConnOnline && time.Since(conn.lastSeen) < probeIdle
+	conn.mu.Unlock()
+	if fresh {
+		return false, nil
+	}
+
+	err := New().TestConnectivity(ctx)
+	// An open circuit took the tenant offline already, with the real error.
+	if err != nil && ctx.Err() == nil && !errors.Is(err, ErrCircuitOpen) {
+		conn.lost(err.Error())
+	}
+	return true, err
+}
@@ -0,0 +1,188 @@
+// Copyright © 2026 ForcePoint Software. All rights reserved.
+
+package tenant
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdh"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+// Enrollment exchanges a one-time enrollment token for the agent's
+// credentials. The token itself never leaves the agent: the request names it
+// by hash, and the tenant seals the credentials under a key derived from an
+// ephemeral X25519 exchange salted with the token. Whoever sees the exchange
+// can't open the credentials without the token, and a party that doesn't
+// know it can't forge them, so the tenant is authenticated even behind an
+// intercepting proxy.
+//
+//	token_id   = base64url(SHA-256("forcedesk-enroll-token\x00" || token))
+//	shared     = X25519(agent private, tenant public)
+//	key        = HKDF-SHA256(shared, salt = token, info = enrollInfo || agent public || tenant public)
+//	ciphertext = ChaCha20-Poly1305(key, nonce, credentials JSON, ad = "forcedesk-enroll\x00" || token_id)
+const (
+	enrollPath = "/api/agent/enroll"
+	enrollInfo = "forcedesk-enroll v1\x00"
+)
+
+// enrollRequest is posted to enrollPath.
+type enrollRequest struct {
+	TokenID      string `json:"token_id"`
+	PublicKey    string `json:"public_key"` // base64 X25519 public key
+	Hostname     string `json:"hostname"`
+	AgentVersion string `json:"agent_version"`
+}
+
+// enrollResponse is the tenant's answer: its ephemeral public key and the
+// sealed credentials.
+type enrollResponse struct {
+	PublicKey  string `json:"public_key"`
+	Nonce      string `json:"nonce"`
+	Ciphertext string `json:"ciphertext"`
+}
+
+// Enrollment is the identity the tenant issued.
+type Enrollment struct {
+	UUID            string `json:"uuid"`
+	APIKey          string `json:"api_key"`
+	EncryptionKey   string `json:"encryption_key"` // hex
+	EncryptionKeyID string `json:"encryption_key_id"`
+}
+
+// Key decodes the issued encryption key.
+func (e *Enrollment) Key() ([]byte, error) {
+	key, err := hex.DecodeString(e.EncryptionKey)
+	if err != nil || len(key) != chacha20poly1305.KeySize {
+		return nil, errors.New("tenant issued an invalid encryption key")
+	}
+	return key, nil
+}
+
+// Enroll redeems token with the tenant at baseURL. The connection uses the
+// TLS and proxy settings already configured, if any.
+func (c *Client) Enroll(ctx context.Context, baseURL, token string) (*Enrollment, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid tenant url %q", baseURL)
+	}
+	if u.Scheme != "https" {
+		return nil, fmt.Errorf("tenant url %q must use https", baseURL)
+	}
+	token = strings.TrimSpace(token)
+	if token == "" {
+		return nil, errors.New("enrollment token is empty")
+	}
+
+	priv, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("generate key pair: %w", err)
+	}
+	hostname, _ := os.Hostname()
+	tokenID := enrollTokenID(token)
+	body, err := json.Marshal(enrollRequest{
+		TokenID:      tokenID,
+		PublicKey:    base64.StdEncoding.EncodeToString(priv.PublicKey().Bytes()),
+		Hostname:     hostname,
+		AgentVersion: AgentVersion,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	endpoint := strings.TrimRight(baseURL, "/") + enrollPath
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	// No credentials yet; the token is the only proof of identity.
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", "ForceDeskAgent\\v"+AgentVersion)
+	req.Header.Set("x-forcedesk-agentversion", AgentVersion)
+
+	resp, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+		if resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone || resp.StatusCode == http.StatusUnauthorized {
+			return nil, fmt.Errorf("enrollment token was rejected (unknown, expired or already used): %w", &StatusError{StatusCode: resp.StatusCode, URL: enrollPath})
+		}
+		return nil, &StatusError{StatusCode: resp.StatusCode, URL: enrollPath}
+	}
+
+	var er enrollResponse
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&er); err != nil {
+		return nil, fmt.Errorf("decode enrollment response: %w", err)
+	}
+	return openEnrollment(priv, token, tokenID, &er)
+}
+
+// openEnrollment derives the enrollment key and opens the credentials.
+func openEnrollment(priv *ecdh.PrivateKey, token, tokenID string, er *enrollResponse) (*Enrollment, error) {
+	peerRaw, err1 := base64.StdEncoding.DecodeString(er.PublicKey)
+	nonce, err2 := base64.StdEncoding.DecodeString(er.Nonce)
+	ct, err3 := base64.StdEncoding.DecodeString(er.Ciphertext)
+	if err := errors.Join(err1, err2, err3); err != nil || len(nonce) != chacha20poly1305.NonceSize {
+		return nil, errors.New("malformed enrollment response")
+	}
+	peer, err := ecdh.X25519().NewPublicKey(peerRaw)
+	if err != nil {
+		return nil, fmt.Errorf("tenant public key: %w", err)
+	}
+	shared, err := priv.ECDH(peer)
+	if err != nil {
+		return nil, fmt.Errorf("key exchange: %w", err)
+	}
+
+	info := enrollInfo + string(priv.PublicKey().Bytes()) + string(peerRaw)
+	key, err := hkdf.Key(sha256.New, shared, []byte(token), info, chacha20poly1305.KeySize)
+	if err != nil {
+		return nil, fmt.Errorf("derive key: %w", err)
+	}
+	aead, err := chacha20poly1305.New(key)
+	if err != nil {
+		return nil, fmt.Errorf("create cipher: %w", err)
+	}
+	plaintext, err := aead.Open(nil, nonce, ct, []byte("forcedesk-enroll\x00"+tokenID))
+	if err != nil {
+		// Either the response was tampered with or it came from a party that
+		// doesn't know the token.
+		return nil, errors.New("enrollment response failed authentication; the tenant could not prove it knows the token")
+	}
+
+	var e Enrollment
+	if err := json.Unmarshal(plaintext, &e); err != nil {
+		return nil, fmt.Errorf("decode credentials: %w", err)
+	}
+	if e.UUID == "" || e.APIKey == "" {
+		return nil, errors.New("tenant issued incomplete credentials")
+	}
+	if _, err := e.Key(); err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+// enrollTokenID returns the handle by which the tenant looks up token.
+func enrollTokenID(token string) string {
+	sum := sha256.Sum256([]byte("forcedesk-enroll-token\x00" + token))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
@@ -0,0 +1,328 @@
+// Copyright © 2026 ForcePoint Software. All rights reserved.
+
+package tenant
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/crypto/chacha20poly1305"
+
+	"github.com/forcedesk/forcedesk-agent/internal/config"
+)
+
+// Encrypted bodies come in two envelope formats:
+//
+//	v1: nonce (12) || ciphertext+tag
+//	v2: version (1, = 2) || message ID (16) || timestamp (8, Unix ms, big-endian) || nonce (12) || ciphertext+tag
+//
+// v1 authenticates only the plaintext, so a captured body can be replayed
+// later or to another endpoint. v2 passes the direction, agent UUID and
+// endpoint path as AEAD associated data along with its own header, so a body
+// only opens for the message it was sealed for, and the receiver can reject
+// it when stale or already seen. A v2 response also binds the random ID the
+// agent sent in requestIDHeader, so it only opens as the answer to that one
+// request; a captured response can't be replayed to a later request, even
+// after a restart has emptied the in-memory replay cache.
+//
+// In auto mode, once the tenant has advertised v2 the agent rejects v1
+// responses until it restarts, so dropping the headers from a captured v1
+// body can't get round the v2 checks.
+const (
+	envelopeV1 = 1
+	envelopeV2 = 2
+)
+
+// Envelope headers. envelopeHeader gives the format of a message's encrypted
+// body. envelopesHeader lists the formats a party accepts: the agent sends it
+// on every request, and a tenant that supports v2 answers with it.
+// requestIDHeader carries a random ID, fresh for every request, that a v2
+// response binds into its associated data.
+const (
+	envelopeHeader  = "x-forcedesk-envelope"
+	envelopesHeader = "x-forcedesk-envelopes"
+	requestIDHeader = "x-forcedesk-request-id"
+)
+
+// Envelope modes, set by [tenant] envelope in config.toml.
+const (
+	EnvelopeAuto = "auto" // v2 once the tenant advertises it, v1 until then
+	EnvelopeV1   = "v1"   // legacy only, for tenants that mishandle v2
+	EnvelopeV2   = "v2"   // v2 only; legacy responses are rejected
+)
+
+const (
+	msgIDSize    = 16
+	v2HeaderSize = 1 + msgIDSize + 8
+	// envelopeMaxSkew is how far a v2 timestamp may be from the agent's
+	// clock. Older messages are rejected as stale, and message IDs only need
+	// remembering this long.
+	envelopeMaxSkew = 5 * time.Minute
+)
+
+// Directions, bound into the associated data so a request body can't be
+// reflected back to the agent as a response.
+const (
+	dirRequest  = "request"
+	dirResponse = "response"
+)
+
+var (
+	// ErrStaleEnvelope is returned for a v2 response whose timestamp is
+	// outside envelopeMaxSkew of the agent's clock.
+	ErrStaleEnvelope = errors.New("encrypted response is stale")
+	// ErrReplayedEnvelope is returned for a v2 response whose message ID has
+	// already been seen.
+	ErrReplayedEnvelope = errors.New("encrypted response was replayed")
+)
+
+// negotiated is the highest envelope version the tenant has advertised. It
+// never goes down: a tenant that stops advertising v2 is not believed.
+var negotiated atomic.Int32
+
+// envelopeMode returns the configured envelope mode.
+func envelopeMode() string {
+	switch m := strings.ToLower(config.Get().Tenant.Envelope); m {
+	case EnvelopeV1, EnvelopeV2:
+		return m
+	}
+	return EnvelopeAuto
+}
+
+// acceptedEnvelopes returns the envelopesHeader value the agent sends.
+func acceptedEnvelopes() string {
+	switch envelopeMode() {
+	case EnvelopeV1:
+		return "1"
+	case EnvelopeV2:
+		return "2"
+	}
+	return "1, 2"
+}
+
+// requestEnvelope returns the format to seal request bodies in.
+func requestEnvelope() int {
+	switch envelopeMode() {
+	case EnvelopeV1:
+		return envelopeV1
+	case EnvelopeV2:
+		return envelopeV2
+	}
+	if negotiated.Load() >= envelopeV2 {
+		return envelopeV2
+	}
+	return envelopeV1
+}
+
+// noteEnvelopes records the formats the tenant advertises in a response.
+func noteEnvelopes(resp *http.Response) {
+	adv := resp.Header.Get(envelopesHeader)
+	if adv == "" {
+		return
+	}
+	best := 0
+	for _, v := range strings.Split(adv, ",") {
+		if n, err := strconv.Atoi(strings.TrimSpace(v)); err == nil && n <= envelopeV2 {
+			best = max(best, n)
+		}
+	}
+	for {
+		prev := negotiated.Load()
+		if int32(best) <= prev {
+			if int32(best) < prev {
+				slog.Debug("tenant: ignoring lower envelope version advertised", "advertised", best, "negotiated", prev)
+			}
+			return
+		}
+		if negotiated.CompareAndSwap(prev, int32(best)) {
+			slog.Info("tenant: encrypted envelope negotiated", "version", best, "previous", prev)
+			return
+		}
+	}
+}
+
+// setRequestID gives req a fresh random ID for a v2 response to bind.
+func setRequestID(req *http.Request) {
+	id := make([]byte, msgIDSize)
+	rand.Read(id)
+	req.Header.Set(requestIDHeader, hex.EncodeToString(id))
+}
+
+// sealRequest encrypts plaintext as the body of req in the negotiated
+// envelope format.
+func sealRequest(req *http.Request, plaintext, key []byte) error {
+	aead, err := chacha20poly1305.New(key)
+	if err != nil {
+		return fmt.Errorf("create cipher: %w", err)
+	}
+
+	version := requestEnvelope()
+	var out []byte
+	if version == envelopeV2 {
+		out = make([]byte, v2HeaderSize, v2HeaderSize+aead.NonceSize()+len(plaintext)+aead.Overhead())
+		out[0] = envelopeV2
+		if _, err := rand.Read(out[1 : 1+msgIDSize]); err != nil {
+			return fmt.Errorf("generate message ID: %w", err)
+		}
+		binary.BigEndian.PutUint64(out[1+msgIDSize:], uint64(time.Now().UnixMilli()))
+	}
+
+	// Generate a fresh cryptographically random nonce for every request.
+	// Reusing a nonce with the same key would completely break ChaCha20-Poly1305 security.
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return fmt.Errorf("generate nonce: %w", err)
+	}
+	out = append(out, nonce...)
+
+	var ad []byte
+	if version == envelopeV2 {
+		ad = associatedData(dirRequest, req.URL.Path, "", out[:v2HeaderSize])
+	}
+	// aead.Seal appends ciphertext+tag to out, after the header and nonce.
+	out = aead.Seal(out, nonce, plaintext, ad)
+
+	req.Header.Set(envelopeHeader, strconv.Itoa(version))
+	if id := keyID(key); id != "" {
+		req.Header.Set(keyIDHeader, id)
+	}
+	req.ContentLength = int64(len(out))
+	req.Body = io.NopCloser(bytes.NewReader(out))
+	req.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(out)), nil
+	}
+	return nil
+}
+
+// openResponse decrypts an encrypted response body. The format is taken
+// from the response's envelopeHeader; without one the body is legacy v1,
+// which is refused in v2 mode and, in auto mode, once v2 has been
+// negotiated. The key is chosen by the response's keyIDHeader, so responses
+// sealed before a key rotation still open.
+func openResponse(resp *http.Response, body, key []byte) ([]byte, error) {
+	keys, err := responseKeys(resp.Header.Get(keyIDHeader), key)
+	if err != nil {
+		return nil, err
+	}
+	ns := chacha20poly1305.NonceSize
+
+	switch v := resp.Header.Get(envelopeHeader); v {
+	case "", "1":
+		switch mode := envelopeMode(); {
+		case mode == EnvelopeV2:
+			return nil, errors.New("tenant sent a legacy v1 encrypted response; [tenant] envelope = \"v2\" requires v2")
+		case mode == EnvelopeAuto && negotiated.Load() >= envelopeV2:
+			return nil, errors.New("tenant sent a legacy v1 encrypted response after negotiating v2")
+		}
+		if len(body) < ns {
+			return nil, fmt.Errorf("encrypted response too short (%d bytes)", len(body))
+		}
+		return open(keys, body[:ns], body[ns:], nil)
+
+	case "2":
+		if envelopeMode() == EnvelopeV1 {
+			return nil, errors.New("tenant sent a v2 encrypted response; [tenant] envelope = \"v1\" accepts only v1")
+		}
+		if len(body) < v2HeaderSize+ns || body[0] != envelopeV2 {
+			return nil, fmt.Errorf("malformed v2 encrypted response (%d bytes)", len(body))
+		}
+		hdr := body[:v2HeaderSize]
+		sent := time.UnixMilli(int64(binary.BigEndian.Uint64(hdr[1+msgIDSize:])))
+		if skew := time.Since(sent); skew > envelopeMaxSkew || skew < -envelopeMaxSkew {
+			return nil, fmt.Errorf("%w: sent %s, clock skew %s", ErrStaleEnvelope, sent.Format(time.RFC3339), skew.Round(time.Second))
+		}
+		ad := associatedData(dirResponse, resp.Request.URL.Path, resp.Request.Header.Get(requestIDHeader), hdr)
+		plaintext, err := open(keys, body[v2HeaderSize:v2HeaderSize+ns], body[v2HeaderSize+ns:], ad)
+		if err != nil {
+			return nil, err
+		}
+		// Only authenticated IDs are remembered, so forged bodies can't fill the cache.
+		if !seenIDs.add([msgIDSize]byte(hdr[1:1+msgIDSize]), sent) {
+			return nil, ErrReplayedEnvelope
+		}
+		return plaintext, nil
+
+	default:
+		return nil, fmt.Errorf("unsupported encrypted envelope version %q", v)
+	}
+}
+
+// open authenticates and decrypts ciphertext with the first of keys that
+// fits. A wrong key or tampered ciphertext produces an error here rather
+// than silently returning garbage.
+func open(keys [][]byte, nonce, ciphertext, ad []byte) ([]byte, error) {
+	var err error
+	for _, key := range keys {
+		aead, cerr := chacha20poly1305.New(key)
+		if cerr != nil {
+			return nil, fmt.Errorf("create cipher: %w", cerr)
+		}
+		var plaintext []byte
+		if plaintext, err = aead.Open(nil, nonce, ciphertext, ad); err == nil {
+			return plaintext, nil
+		}
+	}
+	return nil, fmt.Errorf("decrypt response: %w", err)
+}
+
+// associatedData returns the v2 AEAD associated data for a message: its
+// direction, the agent UUID, the endpoint path, for a response the ID of the
+// request it answers, and the envelope header.
+func associatedData(dir, path, requestID string, hdr []byte) []byte {
+	var b bytes.Buffer
+	b.WriteString("forcedesk-envelope\x00")
+	b.WriteString(dir)
+	b.WriteByte(0)
+	b.WriteString(config.Get().Tenant.UUID)
+	b.WriteByte(0)
+	b.WriteString(path)
+	b.WriteByte(0)
+	if dir == dirResponse {
+		b.WriteString(requestID)
+		b.WriteByte(0)
+	}
+	b.Write(hdr)
+	return b.Bytes()
+}
+
+// replayCache remembers the message IDs of v2 responses until they would be
+// rejected as stale anyway.
+type replayCache struct {
+	mu        sync.Mutex
+	seen      map[[msgIDSize]byte]time.Time // message ID -> when it goes stale
+	nextPrune time.Time
+}
+
+var seenIDs = &replayCache{seen: make(map[[msgIDSize]byte]time.Time)}
+
+// add records id and reports whether it was new.
+func (rc *replayCache) add(id [msgIDSize]byte, sent time.Time) bool {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	now := time.Now()
+	if now.After(rc.nextPrune) {
+		for k, stale := range rc.seen {
+			if now.After(stale) {
+				delete(rc.seen, k)
+			}
+		}
+		rc.nextPrune = now.Add(time.Minute)
+	}
+	if _, ok := rc.seen[id]; ok {
+		return false
+	}
+	rc.seen[id] = sent.Add(envelopeMaxSkew)
+	return true
+}
@@ -0,0 +1,193 @@
+// Copyright © 2026 ForcePoint Software. All rights reserved.
+
+package tenant
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/chacha20poly1305"
+
+	"github.com/forcedesk/forcedesk-agent/internal/config"
+)
+
+const testPath = "/api/agent/test"
+
+// setupEnvelope loads a config with the given envelope mode and forgets any
+// negotiated version.
+func setupEnvelope(t *testing.T, mode string) {
+	t.Helper()
+	t.Setenv("ProgramData", t.TempDir())
+	if err := os.MkdirAll(config.DataDir(), 0755); err != nil {
+		t.Fatal(err)
+	}
+	cfg := "[tenant]\nuuid = \"test-agent\"\nenvelope = \"" + mode + "\"\n"
+	if err := os.WriteFile(filepath.Join(config.DataDir(), "config.toml"), []byte(cfg), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := config.Load(); err != nil {
+		t.Fatal(err)
+	}
+	negotiated.Store(0)
+	t.Cleanup(func() { negotiated.Store(0) })
+}
+
+func testKey(t *testing.T) []byte {
+	t.Helper()
+	key := make([]byte, chacha20poly1305.KeySize)
+	rand.Read(key)
+	return key
+}
+
+// sealV2Response seals plaintext as the tenant would answer the request
+// with the given ID.
+func sealV2Response(t *testing.T, key []byte, requestID string, plaintext []byte) []byte {
+	t.Helper()
+	aead, err := chacha20poly1305.New(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hdr := make([]byte, v2HeaderSize)
+	hdr[0] = envelopeV2
+	rand.Read(hdr[1 : 1+msgIDSize])
+	binary.BigEndian.PutUint64(hdr[1+msgIDSize:], uint64(time.Now().UnixMilli()))
+	nonce := make([]byte, aead.NonceSize())
+	rand.Read(nonce)
+	out := append(hdr, nonce...)
+	return aead.Seal(out, nonce, plaintext, associatedData(dirResponse, testPath, requestID, hdr))
+}
+
+// sealV1Response seals plaintext in the legacy format.
+func sealV1Response(t *testing.T, key, plaintext []byte) []byte {
+	t.Helper()
+	aead, err := chacha20poly1305.New(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nonce := make([]byte, aead.NonceSize())
+	rand.Read(nonce)
+	return aead.Seal(nonce, nonce, plaintext, nil)
+}
+
+// testResponse returns a response to a request carrying requestID, with the
+// given envelope version header.
+func testResponse(requestID, version string) *http.Response {
+	req := &http.Request{URL: &url.URL{Path: testPath}, Header: http.Header{}}
+	req.Header.Set(requestIDHeader, requestID)
+	resp := &http.Response{Header: http.Header{}, Request: req}
+	if version != "" {
+		resp.Header.Set(envelopeHeader, version)
+	}
+	return resp
+}
+
+// advertise feeds noteEnvelopes a response advertising the given formats.
+func advertise(formats string) {
+	resp := &http.Response{Header: http.Header{}}
+	resp.Header.Set(envelopesHeader, formats)
+	noteEnvelopes(resp)
+}
+
+func TestOpenResponseV2(t *testing.T) {
+	setupEnvelope(t, EnvelopeAuto)
+	key := testKey(t)
+	body := sealV2Response(t, key, "req-1", []byte("hello"))
+
+	got, err := openResponse(testResponse("req-1", "2"), body, key)
+	if err != nil {
+		t.Fatalf("openResponse: %v", err)
+	}
+	if string(got) != "hello" {
+		t.Fatalf("openResponse = %q, want %q", got, "hello")
+	}
+}
+
+func TestOpenResponseRejectsOtherRequest(t *testing.T) {
+	setupEnvelope(t, EnvelopeAuto)
+	key := testKey(t)
+	body := sealV2Response(t, key, "req-1", []byte("hello"))
+
+	if _, err := openResponse(testResponse("req-2", "2"), body, key); err == nil {
+		t.Fatal("response sealed for another request opened")
+	}
+	if _, err := openResponse(testResponse("", "2"), body, key); err == nil {
+		t.Fatal("response opened for a request without an ID")
+	}
+}
+
+func TestOpenResponseRejectsReplay(t *testing.T) {
+	setupEnvelope(t, EnvelopeAuto)
+	key := testKey(t)
+	body := sealV2Response(t, key, "req-1", []byte("hello"))
+
+	if _, err := openResponse(testResponse("req-1", "2"), body, key); err != nil {
+		t.Fatalf("first open: %v", err)
+	}
+	_, err := openResponse(testResponse("req-1", "2"), body, key)
+	if !errors.Is(err, ErrReplayedEnvelope) {
+		t.Fatalf("replayed open: err = %v, want %v", err, ErrReplayedEnvelope)
+	}
+}
+
+func TestOpenResponseRejectsDowngrade(t *testing.T) {
+	setupEnvelope(t, EnvelopeAuto)
+	key := testKey(t)
+
+	// Before the tenant advertises v2, legacy responses are accepted.
+	if _, err := openResponse(testResponse("req-1", ""), sealV1Response(t, key, []byte("hello")), key); err != nil {
+		t.Fatalf("v1 before negotiation: %v", err)
+	}
+
+	advertise("1, 2")
+	if _, err := openResponse(testResponse("req-2", ""), sealV1Response(t, key, []byte("hello")), key); err == nil {
+		t.Fatal("v1 response accepted after v2 was negotiated")
+	}
+	if _, err := openResponse(testResponse("req-3", "1"), sealV1Response(t, key, []byte("hello")), key); err == nil {
+		t.Fatal("explicit v1 response accepted after v2 was negotiated")
+	}
+
+	// A later response advertising only v1 doesn't lower the negotiated version.
+	advertise("1")
+	if got := negotiated.Load(); got != envelopeV2 {
+		t.Fatalf("negotiated = %d after a v1-only advertisement, want %d", got, envelopeV2)
+	}
+	if _, err := openResponse(testResponse("req-4", ""), sealV1Response(t, key, []byte("hello")), key); err == nil {
+		t.Fatal("v1 response accepted after a v1-only advertisement")
+	}
+}
+
+func TestOpenResponseV2ModeRejectsV1(t *testing.T) {
+	setupEnvelope(t, EnvelopeV2)
+	key := testKey(t)
+	if _, err := openResponse(testResponse("req-1", ""), sealV1Response(t, key, []byte("hello")), key); err == nil {
+		t.Fatal("v1 response accepted in v2 mode")
+	}
+}
+
+func TestAssociatedData(t *testing.T) {
+	setupEnvelope(t, EnvelopeAuto)
+	hdr := []byte{envelopeV2, 1, 2, 3}
+
+	if bytes.Equal(associatedData(dirResponse, testPath, "req-1", hdr), associatedData(dirResponse, testPath, "req-2", hdr)) {
+		t.Error("response associated data doesn't depend on the request ID")
+	}
+	if bytes.Equal(associatedData(dirResponse, testPath, "req-1", hdr), associatedData(dirRequest, testPath, "req-1", hdr)) {
+		t.Error("associated data doesn't depend on the direction")
+	}
+	if bytes.Equal(associatedData(dirResponse, testPath, "req-1", hdr), associatedData(dirResponse, testPath+"x", "req-1", hdr)) {
+		t.Error("associated data doesn't depend on the path")
+	}
+	// Requests carry no request ID in their associated data; the tenant
+	// binds its response to the header instead.
+	if !bytes.Equal(associatedData(dirRequest, testPath, "req-1", hdr), associatedData(dirRequest, testPath, "", hdr)) {
+		t.Error("request associated data depends on the request ID")
+	}
+}
@@ -0,0 +1,112 @@
+// Copyright © 2026 ForcePoint Software. All rights reserved.
+
+package tenant
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+
+	"golang.org/x/crypto/chacha20poly1305"
+
+	"github.com/forcedesk/forcedesk-agent/internal/config"
+)
+
+// keyIDHeader names the key an encrypted body was sealed with. The agent sets
+// it on encrypted requests once its key has an ID; the tenant sets it on
+// encrypted responses so the agent can pick the right key while a rotation
+// is in flight. Responses without it are tried with the current key, then
+// the previous one.
+const keyIDHeader = "x-forcedesk-key-id"
+
+// keyEntry is one key of the agent's key ring.
+type keyEntry struct {
+	id  string
+	key []byte
+}
+
+// keyRing returns the current key and, if the key has been rotated, the
+// previous one.
+func keyRing() (current keyEntry, previous *keyEntry, err error) {
+	t := &config.Get().Tenant
+	key, err := t.GetEncryptionKey()
+	if err != nil {
+		return keyEntry{}, nil, err
+	}
+	current = keyEntry{id: t.EncryptionKeyID, key: key}
+	prev, err := t.GetPreviousEncryptionKey()
+	if err != nil {
+		return keyEntry{}, nil, err
+	}
+	if prev != nil {
+		previous = &keyEntry{id: t.PreviousEncryptionKeyID, key: prev}
+	}
+	return current, previous, nil
+}
+
+// keyID returns the ID of key if it is in the key ring, or "".
+func keyID(key []byte) string {
+	current, previous, err := keyRing()
+	if err != nil {
+		return ""
+	}
+	switch {
+	case subtle.ConstantTimeCompare(key, current.key) == 1:
+		return current.id
+	case previous != nil && subtle.ConstantTimeCompare(key, previous.key) == 1:
+		return previous.id
+	}
+	return ""
+}
+
+// responseKeys returns the keys to try, in order, for a response sealed with
+// the key named id. The caller's key comes first when the tenant doesn't say.
+func responseKeys(id string, key []byte) ([][]byte, error) {
+	current, previous, err := keyRing()
+	if err != nil {
+		// No usable key ring; the caller's key is all there is.
+		return [][]byte{key}, nil
+	}
+	if id == "" {
+		keys := [][]byte{key}
+		if previous != nil && subtle.ConstantTimeCompare(key, previous.key) == 0 {
+			keys = append(keys, previous.key)
+		}
+		return keys, nil
+	}
+	switch {
+	case id == current.id:
+		return [][]byte{current.key}, nil
+	case previous != nil && id == previous.id:
+		return [][]byte{previous.key}, nil
+	}
+	return nil, fmt.Errorf("encrypted response uses unknown key %q", id)
+}
+
+// UnwrapKey opens a new encryption key delivered by a key rotation command.
+// wrapped is nonce (12) || ciphertext+tag, sealed with the current key over
+// the 32-byte new key, with the associated data binding it to this agent and
+// the new key's ID.
+func UnwrapKey(wrapped []byte, id string) ([]byte, error) {
+	current, _, err := keyRing()
+	if err != nil {
+		return nil, err
+	}
+	aead, err := chacha20poly1305.New(current.key)
+	if err != nil {
+		return nil, fmt.Errorf("create cipher: %w", err)
+	}
+	ns := aead.NonceSize()
+	if len(wrapped) < ns {
+		return nil, fmt.Errorf("wrapped key too short (%d bytes)", len(wrapped))
+	}
+	ad := []byte("forcedesk-key-rotation\x00" + config.Get().Tenant.UUID + "\x00" + id)
+	key, err := aead.Open(nil, wrapped[:ns], wrapped[ns:], ad)
+	if err != nil {
+		return nil, fmt.Errorf("unwrap key: %w", err)
+	}
+	if len(key) != chacha20poly1305.KeySize {
+		return nil, errors.New("unwrapped key is not 32 bytes")
+	}
+	return key, nil
+}
@@ -0,0 +1,112 @@
+// Copyright © 2026 ForcePoint Software. All rights reserved.
+
+package tenant
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/forcedesk/forcedesk-agent/internal/config"
+)
+
+// sensitiveEndpoint is an upload endpoint whose payload must never leave the
+// agent in plaintext: passwords, student and staff PII, certificates with
+// private keys. PostJSON sends anything posted to pattern to its encrypted
+// counterpart instead, through PostEncryptedJSON.
+type sensitiveEndpoint struct {
+	// pattern is the plaintext path. A "{name}" segment matches any one
+	// path segment, even an empty one.
+	pattern string
+	// encrypted is the path of the encrypted counterpart; "{name}" segments
+	// are filled in from the matching segments of pattern.
+	encrypted string
+}
+
+// sensitiveEndpoints is the upload policy. Every entry must name an
+// encrypted counterpart; CheckPolicy enforces it.
+var sensitiveEndpoints = []sensitiveEndpoint{
+	{"/api/agent/ingest/edustar/crt-passwords", "/api/agent/ingest/edustar/crt-passwords/encrypted"},
+	{"/api/agent/ingest/edustar/service-passwords", "/api/agent/ingest/edustar/service-passwords/encrypted"},
+	{"/api/agent/ingest/edustar/students", "/api/agent/ingest/edustar/students/encrypted"},
+	{"/api/agent/ingest/edustar/staff", "/api/agent/ingest/edustar/staff/encrypted"},
+	{"/api/agent/student-devices/{snid}/certificate", "/api/agent/student-devices/{snid}/certificate/encrypted"},
+	{"/api/agent/bulk-certificates/certificate", "/api/agent/bulk-certificates/certificate/encrypted"},
+}
+
+// errPlaintextSensitive is wrapped by PostJSON when a sensitive upload can't
+// be encrypted; the upload is refused rather than sent in plaintext.
+var errPlaintextSensitive = errors.New("refusing to send sensitive upload unencrypted")
+
+// encryptedCounterpart returns the URL of the encrypted counterpart of
+// rawURL if its path is a sensitive endpoint.
+func encryptedCounterpart(rawURL string) (string, bool) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", false
+	}
+	for _, ep := range sensitiveEndpoints {
+		if vars, ok := matchPath(ep.pattern, u.Path); ok {
+			u.Path = fillPath(ep.encrypted, vars)
+			u.RawPath = ""
+			return u.String(), true
+		}
+	}
+	return "", false
+}
+
+// matchPath matches path against pattern and returns the values of its
+// "{name}" segments.
+func matchPath(pattern, path string) (map[string]string, bool) {
+	ps := strings.Split(strings.Trim(pattern, "/"), "/")
+	segs := strings.Split(strings.Trim(path, "/"), "/")
+	if len(ps) != len(segs) {
+		return nil, false
+	}
+	vars := make(map[string]string)
+	for i, p := range ps {
+		// A placeholder matches even an empty segment, so a malformed path
+		// errs on the side of encrypting.
+		if strings.HasPrefix(p, "{") && strings.HasSuffix(p, "}") {
+			vars[p] = segs[i]
+			continue
+		}
+		if p != segs[i] {
+			return nil, false
+		}
+	}
+	return vars, true
+}
+
+// fillPath substitutes vars into the "{name}" segments of pattern.
+func fillPath(pattern string, vars map[string]string) string {
+	ps := strings.Split(pattern, "/")
+	for i, p := range ps {
+		if v, ok := vars[p]; ok {
+			ps[i] = v
+		}
+	}
+	return strings.Join(ps, "/")
+}
+
+// CheckPolicy verifies at startup that sensitive uploads can't go out in
+// plaintext: every sensitive endpoint has a distinct encrypted counterpart
+// that is not itself sensitive, and a valid encryption key is configured.
+// The agent refuses to start if it fails.
+func CheckPolicy() error {
+	for _, ep := range sensitiveEndpoints {
+		if ep.encrypted == "" || ep.encrypted == ep.pattern {
+			return fmt.Errorf("sensitive endpoint %s has no encrypted counterpart", ep.pattern)
+		}
+		for _, other := range sensitiveEndpoints {
+			if _, ok := matchPath(other.pattern, ep.encrypted); ok {
+				return fmt.Errorf("encrypted counterpart %s of %s is itself listed as sensitive", ep.encrypted, ep.pattern)
+			}
+		}
+	}
+	if _, err := config.Get().Tenant.GetEncryptionKey(); err != nil {
+		return fmt.Errorf("sensitive uploads can't be encrypted: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,145 @@
+// Copyright © 2026 ForcePoint Software. All rights reserved.
+
+package tenant
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// Push channel. Rather than the agent polling each queue on a timer, it holds
+// a long poll open on pushPath and the tenant answers as soon as it has
+// commands or device queries for the agent, or with 204 No Content after
+// pushWait. Each answer carries a cursor; sending it back on the next poll
+// acknowledges everything delivered so far, so an answer lost in transit is
+// delivered again. Answers are encrypted, since device queries carry device
+// credentials.
+//
+// While the channel is up (PushActive), the polling tasks stand down. A
+// tenant without the endpoint answers 404 and the agent keeps polling,
+// checking again every pushRecheck.
+const (
+	pushPath = "/api/agent/push"
+	// pushWait is how long the tenant may hold a poll; it must stay well
+	// under the client's 30-second request timeout.
+	pushWait = 20 * time.Second
+	// pushGrace is how long after the last completed poll the channel still
+	// counts as up: one full wait plus time to reconnect.
+	pushGrace   = pushWait + 15*time.Second
+	pushRecheck = 10 * time.Minute
+)
+
+// Push event types.
+const (
+	PushCommands      = "commands"       // Data is the /api/agent/command-queues list
+	PushDeviceQueries = "device-queries" // Data is the query-payloads response
+)
+
+// ErrPushUnsupported is returned by Poll when the tenant has no push channel.
+var ErrPushUnsupported = errors.New("tenant does not support the push channel")
+
+// PushEvent is one delivery on the push channel.
+type PushEvent struct {
+	Type string          `json:"type"`
+	Data json.RawMessage `json:"data"`
+}
+
+// pushBatch is the decrypted body of a push answer.
+type pushBatch struct {
+	Cursor string      `json:"cursor"`
+	Events []PushEvent `json:"events"`
+}
+
+var (
+	// pushSeen is when a poll last completed (UnixNano), 0 after a failure.
+	pushSeen atomic.Int64
+	// pushUnsupportedUntil is when to next try a tenant that answered 404.
+	pushUnsupportedUntil atomic.Int64
+)
+
+// PushActive reports whether the push channel is up, so polling can stand down.
+func PushActive() bool {
+	seen := pushSeen.Load()
+	return seen != 0 && time.Since(time.Unix(0, seen)) < pushGrace
+}
+
+// notePush records the outcome of a poll and logs when the channel comes up
+// or goes down.
+func notePush(ok bool) {
+	var now int64
+	if ok {
+		now = time.Now().UnixNano()
+	}
+	switch prev := pushSeen.Swap(now); {
+	case ok && prev == 0:
+		slog.Info("tenant: push channel connected")
+	case !ok && prev != 0:
+		slog.Warn("tenant: push channel lost, falling back to polling")
+	}
+}
+
+// Poll waits up to pushWait for push events, acknowledging everything up to
+// cursor. It returns the events and the cursor to send next time.
+func (c *Client) Poll(ctx context.Context, cursor string, key []byte) ([]PushEvent, string, error) {
+	if until := pushUnsupportedUntil.Load(); until != 0 && time.Now().UnixNano() < until {
+		return nil, cursor, ErrPushUnsupported
+	}
+
+	q := url.Values{"wait": {strconv.Itoa(int(pushWait / time.Second))}}
+	if cursor != "" {
+		q.Set("cursor", cursor)
+	}
+	resp, err := c.Get(ctx, URL(pushPath)+"?"+q.Encode())
+	if err != nil {
+		// A poll cut short by the listener stopping says nothing about the channel.
+		if ctx.Err() == nil {
+			notePush(false)
+		}
+		return nil, cursor, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNoContent:
+		notePush(true)
+		return nil, cursor, nil
+	case http.StatusNotFound, http.StatusNotImplemented:
+		notePush(false)
+		pushUnsupportedUntil.Store(time.Now().Add(pushRecheck).UnixNano())
+		return nil, cursor, ErrPushUnsupported
+	default:
+		notePush(false)
+		return nil, cursor, &StatusError{StatusCode: resp.StatusCode, URL: pushPath}
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		notePush(false)
+		return nil, cursor, fmt.Errorf("read push events: %w", err)
+	}
+	plaintext, err := openResponse(resp, body, key)
+	if err != nil {
+		notePush(false)
+		return nil, cursor, err
+	}
+	var batch pushBatch
+	if err := json.Unmarshal(plaintext, &batch); err != nil {
+		notePush(false)
+		return nil, cursor, fmt.Errorf("decode push events: %w", err)
+	}
+	notePush(true)
+	if batch.Cursor == "" {
+		batch.Cursor = cursor
+	}
+	return batch.Events, batch.Cursor, nil
+}
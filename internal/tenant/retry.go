@@ -0,0 +1,185 @@
+// Copyright © 2026 ForcePoint Software. All rights reserved.
+
+package tenant
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Request retry settings.
+const (
+	// maxAttempts is the total number of attempts per request.
+	maxAttempts = 4
+	// retryBaseDelay is the wait before the first retry; it doubles for each
+	// further retry, up to retryMaxDelay, plus up to 50% jitter.
+	retryBaseDelay = 500 * time.Millisecond
+	retryMaxDelay  = 10 * time.Second
+	// maxRetryAfter caps how long a Retry-After header can make a request
+	// wait; a longer wait fails the request instead.
+	maxRetryAfter = 2 * time.Minute
+)
+
+// do sends req through the circuit breaker, retrying on failure.
+//
+// Idempotent requests (GET, HEAD) are retried on network errors and 5xx
+// answers. Any request, including a POST, is retried when it provably never
+// reached the tenant's handler: the connection could not be made, or the
+// tenant answered 429 or 503. Those two statuses honor Retry-After.
+func (c *Client) do(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	idempotent := req.Method == http.MethodGet || req.Method == http.MethodHead
+	if c.err != nil {
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, c.err
+	}
+
+	for attempt := 1; ; attempt++ {
+		if !circuit.allow() {
+			if req.Body != nil {
+				// Never sent; close it so a streamed body's writer exits.
+				req.Body.Close()
+			}
+			return nil, ErrCircuitOpen
+		}
+		if attempt > 1 && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				circuit.cancelled()
+				return nil, fmt.Errorf("rewind request body: %w", err)
+			}
+			req.Body = body
+		}
+
+		resp, err := c.http.Do(req)
+		if err == nil {
+			noteEnvelopes(resp)
+			noteEncodings(resp)
+		}
+
+		var retry bool
+		var wait time.Duration
+		switch {
+		case err != nil && (ctx.Err() != nil || isEncodeError(err)):
+			// The caller gave up, or the body couldn't be produced; that says
+			// nothing about the tenant.
+			circuit.cancelled()
+			return nil, err
+		case err != nil:
+			if circuit.failure(err.Error()) {
+				conn.lost(err.Error())
+			}
+			retry = idempotent || notSent(err)
+		case resp.StatusCode == http.StatusTooManyRequests:
+			// The tenant is up, just busy.
+			circuit.success()
+			conn.seen()
+			retry = true
+			wait = retryAfter(resp)
+		case resp.StatusCode >= 500:
+			if gatewayStatus(resp.StatusCode) {
+				if circuit.failure(resp.Status) {
+					conn.lost(resp.Status)
+				}
+			} else {
+				// Any other 5xx is one endpoint failing on a tenant that is
+				// up; it mustn't cut the agent off from the rest.
+				circuit.success()
+				conn.seen()
+			}
+			retry = idempotent || resp.StatusCode == http.StatusServiceUnavailable
+			if resp.StatusCode == http.StatusServiceUnavailable {
+				wait = retryAfter(resp)
+			}
+		default:
+			circuit.success()
+			conn.seen()
+			return resp, nil
+		}
+
+		// Once the circuit has opened there is no point retrying; return the
+		// real failure rather than ErrCircuitOpen.
+		if !retry || attempt == maxAttempts || circuit.isOpen() || (req.Body != nil && req.GetBody == nil) {
+			return resp, err
+		}
+		if wait == 0 {
+			wait = backoff(attempt)
+		}
+		if wait > maxRetryAfter {
+			slog.Warn("tenant: Retry-After too long, not retrying", "url", req.URL.Redacted(), "retry_after", wait)
+			return resp, err
+		}
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < wait {
+			return resp, err
+		}
+
+		if resp != nil {
+			slog.Warn("tenant: request failed, retrying", "method", req.Method, "url", req.URL.Redacted(), "status", resp.StatusCode, "attempt", attempt, "wait", wait)
+			// Drain so the connection can be reused.
+			io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+			resp.Body.Close()
+		} else {
+			slog.Warn("tenant: request failed, retrying", "method", req.Method, "url", req.URL.Redacted(), "err", err, "attempt", attempt, "wait", wait)
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// backoff returns the wait after the given failed attempt (1-based).
+func backoff(attempt int) time.Duration {
+	d := min(retryBaseDelay<<(attempt-1), retryMaxDelay)
+	return d + rand.N(d/2+1)
+}
+
+// retryAfter parses the Retry-After header as seconds or an HTTP date.
+// Zero means absent or invalid.
+func retryAfter(resp *http.Response) time.Duration {
+	v := resp.Header.Get("Retry-After")
+	if v == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(v); err == nil && secs >= 0 {
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return max(time.Until(t), 0)
+	}
+	return 0
+}
+
+// gatewayStatus reports whether status means the tenant itself is down or
+// unreachable, as opposed to one of its handlers failing.
+func gatewayStatus(status int) bool {
+	switch status {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// notSent reports whether err shows the request never left the agent, so
+// retrying it can't apply it twice.
+func notSent(err error) bool {
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return true
+	}
+	var dnsErr *net.DNSError
+	return errors.As(err, &dnsErr)
+}
@@ -0,0 +1,285 @@
+// Copyright © 2026 ForcePoint Software. All rights reserved.
+
+package tenant
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/forcedesk/forcedesk-agent/internal/config"
+	"github.com/forcedesk/forcedesk-agent/internal/transport"
+)
+
+// TLS trust for the tenant connection. The tenant certificate is verified
+// against the system roots plus any [tenant] ca_bundle, so a site behind an
+// SSL-inspecting firewall can trust the firewall's CA instead of turning
+// verify_ssl off. spki_pins additionally ties the connection to known public
+// keys, and client_cert/client_key present a certificate for mutual TLS.
+
+// spkiPinPrefix names the hash of a pin, as in HPKP and curl's --pinnedpubkey.
+const spkiPinPrefix = "sha256/"
+
+// ErrPinMismatch is returned when the tenant presents no certificate whose
+// public key is in [tenant] spki_pins.
+var ErrPinMismatch = errors.New("tenant certificate does not match any pinned key")
+
+// TLSConfig builds the TLS configuration for the tenant connection from the
+// [tenant] config. It fails if a configured CA bundle, pin or client
+// certificate can't be used, rather than falling back to weaker trust.
+func TLSConfig() (*tls.Config, error) {
+	t := &config.Get().Tenant
+	cfg := &tls.Config{
+		InsecureSkipVerify: !t.VerifySSL, //nolint:gosec // pins, if any, are still enforced
+	}
+
+	roots, err := rootPool(t.CABundle)
+	if err != nil {
+		return nil, err
+	}
+	cfg.RootCAs = roots
+
+	if t.ClientCert != "" || t.ClientKey != "" {
+		if t.ClientCert == "" || t.ClientKey == "" {
+			return nil, errors.New("client_cert and client_key must be set together")
+		}
+		cert, err := tls.LoadX509KeyPair(dataPath(t.ClientCert), dataPath(t.ClientKey))
+		if err != nil {
+			return nil, fmt.Errorf("load client certificate: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+
+	pins, err := parsePins(t.SPKIPins)
+	if err != nil {
+		return nil, err
+	}
+	if len(pins) > 0 {
+		verified := t.VerifySSL
+		cfg.VerifyConnection = func(cs tls.ConnectionState) error {
+			return checkPins(cs, pins, verified)
+		}
+	}
+	return cfg, nil
+}
+
+// rootPool returns the system roots plus the certificates in the PEM file at
+// path, or nil (the system roots) if path is empty.
+func rootPool(path string) (*x509.CertPool, error) {
+	if path == "" {
+		return nil, nil
+	}
+	pem, err := os.ReadFile(dataPath(path))
+	if err != nil {
+		return nil, fmt.Errorf("read ca_bundle: %w", err)
+	}
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		slog.Warn("tenant: system roots unavailable, trusting ca_bundle only", "err", err)
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("ca_bundle %s contains no PEM certificates", path)
+	}
+	return pool, nil
+}
+
+// dataPath resolves a configured file path against the data directory.
+func dataPath(p string) string {
+	if filepath.IsAbs(p) {
+		return p
+	}
+	return filepath.Join(config.DataDir(), p)
+}
+
+// parsePins decodes "sha256/<base64>" SPKI pins.
+func parsePins(pins []string) (map[[sha256.Size]byte]bool, error) {
+	set := make(map[[sha256.Size]byte]bool, len(pins))
+	for _, p := range pins {
+		b64, ok := strings.CutPrefix(strings.TrimSpace(p), spkiPinPrefix)
+		if !ok {
+			return nil, fmt.Errorf("spki pin %q: must start with %q", p, spkiPinPrefix)
+		}
+		// curl writes the prefix as "sha256//".
+		sum, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(b64, "/"))
+		if err != nil || len(sum) != sha256.Size {
+			return nil, fmt.Errorf("spki pin %q: not a base64 SHA-256 hash", p)
+		}
+		set[[sha256.Size]byte(sum)] = true
+	}
+	return set, nil
+}
+
+// SPKIPin returns the pin of cert's public key in spki_pins format.
+func SPKIPin(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return spkiPinPrefix + base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// checkPins requires a pinned key in the verified chains. Without
+// verification only the leaf counts: the handshake proves the tenant holds
+// its key, but anyone can append a copy of a pinned CA certificate.
+func checkPins(cs tls.ConnectionState, pins map[[sha256.Size]byte]bool, verified bool) error {
+	if len(cs.PeerCertificates) == 0 {
+		return ErrPinMismatch
+	}
+	if verified {
+		for _, chain := range cs.VerifiedChains {
+			for _, cert := range chain {
+				if pins[sha256.Sum256(cert.RawSubjectPublicKeyInfo)] {
+					return nil
+				}
+			}
+		}
+	} else if pins[sha256.Sum256(cs.PeerCertificates[0].RawSubjectPublicKeyInfo)] {
+		return nil
+	}
+	return fmt.Errorf("%w (leaf key %s)", ErrPinMismatch, SPKIPin(cs.PeerCertificates[0]))
+}
+
+// CertInfo describes one certificate the tenant presented.
+type CertInfo struct {
+	Subject   string
+	Issuer    string
+	NotBefore time.Time
+	NotAfter  time.Time
+	IsCA      bool
+	// SHA256 is the fingerprint of the whole certificate.
+	SHA256 string
+	// SPKIPin is the certificate's key in spki_pins format; Pinned reports
+	// whether it is one of the configured pins.
+	SPKIPin string
+	Pinned  bool
+}
+
+// TLSReport is what InspectTLS saw of the tenant connection.
+type TLSReport struct {
+	Address string
+	// Route is "direct" or the proxy the connection went through.
+	Route       string
+	Version     string
+	CipherSuite string
+	// Chain is the certificates as the tenant presented them, leaf first.
+	Chain []CertInfo
+	// SystemErr is the result of verifying the chain against the system
+	// roots alone; ConfiguredErr against the system roots plus ca_bundle.
+	SystemErr     error
+	ConfiguredErr error
+	// Pins is the number of configured SPKI pins.
+	Pins int
+	// ClientCertRequested reports whether the tenant asked for a client
+	// certificate, and ClientCertSent whether the agent had one to send.
+	ClientCertRequested bool
+	ClientCertSent      bool
+	// HandshakeErr is the result of a handshake with the agent's actual TLS
+	// configuration: nil if the agent would connect.
+	HandshakeErr error
+}
+
+// InspectTLS connects to the tenant and reports the certificate chain the
+// agent sees and how each layer of the configured trust judges it. It is
+// meant for diagnosing interception: the chain is captured without
+// verification, then checked separately.
+func InspectTLS(ctx context.Context) (*TLSReport, error) {
+	t := &config.Get().Tenant
+	u, err := url.Parse(t.URL)
+	if err != nil {
+		return nil, fmt.Errorf("parse tenant url: %w", err)
+	}
+	if u.Scheme != "https" {
+		return nil, fmt.Errorf("tenant url %q is not https", t.URL)
+	}
+	host, port := u.Hostname(), u.Port()
+	if port == "" {
+		port = "443"
+	}
+	addr := net.JoinHostPort(host, port)
+
+	cfg, err := TLSConfig()
+	if err != nil {
+		return nil, err
+	}
+	pins, _ := parsePins(t.SPKIPins)
+	route, err := transport.Describe(u)
+	if err != nil {
+		return nil, err
+	}
+	rep := &TLSReport{Address: addr, Route: route, Pins: len(pins)}
+
+	probe := cfg.Clone()
+	probe.ServerName = host
+	probe.InsecureSkipVerify = true //nolint:gosec // the chain is verified below
+	probe.VerifyConnection = nil
+	probe.Certificates = nil
+	probe.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+		rep.ClientCertRequested = true
+		if len(cfg.Certificates) > 0 {
+			rep.ClientCertSent = true
+			return &cfg.Certificates[0], nil
+		}
+		return &tls.Certificate{}, nil
+	}
+	cs, err := handshake(ctx, u, probe)
+	if err != nil {
+		return nil, fmt.Errorf("connect to %s: %w", addr, err)
+	}
+	rep.Version = tls.VersionName(cs.Version)
+	rep.CipherSuite = tls.CipherSuiteName(cs.CipherSuite)
+
+	certs := cs.PeerCertificates
+	for _, c := range certs {
+		fp := sha256.Sum256(c.Raw)
+		rep.Chain = append(rep.Chain, CertInfo{
+			Subject:   c.Subject.String(),
+			Issuer:    c.Issuer.String(),
+			NotBefore: c.NotBefore,
+			NotAfter:  c.NotAfter,
+			IsCA:      c.IsCA,
+			SHA256:    fmt.Sprintf("%X", fp[:]),
+			SPKIPin:   SPKIPin(c),
+			Pinned:    pins[sha256.Sum256(c.RawSubjectPublicKeyInfo)],
+		})
+	}
+	if len(certs) > 0 {
+		opts := x509.VerifyOptions{DNSName: host, Intermediates: x509.NewCertPool()}
+		for _, c := range certs[1:] {
+			opts.Intermediates.AddCert(c)
+		}
+		_, rep.SystemErr = certs[0].Verify(opts)
+		opts.Roots = cfg.RootCAs
+		_, rep.ConfiguredErr = certs[0].Verify(opts)
+	}
+
+	real := cfg.Clone()
+	real.ServerName = host
+	_, rep.HandshakeErr = handshake(ctx, u, real)
+	return rep, nil
+}
+
+// handshake connects to target the way the agent's transport would, through
+// any proxy, and completes a TLS handshake with cfg.
+func handshake(ctx context.Context, target *url.URL, cfg *tls.Config) (tls.ConnectionState, error) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	conn, err := transport.Dial(ctx, target)
+	if err != nil {
+		return tls.ConnectionState{}, err
+	}
+	defer conn.Close()
+	tc := tls.Client(conn, cfg)
+	if err := tc.HandshakeContext(ctx); err != nil {
+		return tls.ConnectionState{}, err
+	}
+	return tc.ConnectionState(), nil
+}
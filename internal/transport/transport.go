@@ -0,0 +1,287 @@
+// Copyright © 2026 ForcePoint Software. All rights reserved.
+
+// Package transport builds the HTTP transports behind every outbound client
+// (tenant, STMC, notebooks, PaperCut), so they all reach the network the same
+// way: through the proxy configured in [proxy] or the environment, with
+// basic or NTLM proxy authentication, except for destinations on the bypass
+// list.
+package transport
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/forcedesk/forcedesk-agent/internal/config"
+)
+
+// Proxy modes, set by [proxy] mode in config.toml.
+const (
+	ModeEnv    = "env"    // HTTPS_PROXY, HTTP_PROXY and NO_PROXY
+	ModeManual = "manual" // [proxy] url
+	ModeOff    = "off"
+)
+
+// Proxy authentication schemes, set by [proxy] auth in config.toml.
+const (
+	AuthBasic = "basic"
+	AuthNTLM  = "ntlm"
+)
+
+var dialer = &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+
+// New returns a transport with TLS settings tlsCfg (nil for the defaults)
+// that routes connections according to the current proxy configuration.
+//
+// Basic-authenticated and unauthenticated proxies are handled by
+// http.Transport itself. NTLM authenticates the connection rather than the
+// request, so with NTLM every proxied connection, plain HTTP included, is
+// tunnelled with CONNECT and the handshake is done on the tunnel.
+func New(tlsCfg *tls.Config) http.RoundTripper {
+	p := &config.Get().Proxy
+	t := &http.Transport{
+		TLSClientConfig:       tlsCfg,
+		DialContext:           dialer.DialContext,
+		MaxIdleConns:          100,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: time.Second,
+	}
+	if !strings.EqualFold(p.Auth, AuthNTLM) {
+		t.Proxy = func(req *http.Request) (*url.URL, error) {
+			return proxyFor(p, req.URL)
+		}
+		return t
+	}
+	t.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		if proxy, _ := ctx.Value(tunnelKey{}).(*url.URL); proxy != nil {
+			return tunnel(ctx, p, proxy, addr)
+		}
+		return dialer.DialContext(ctx, network, addr)
+	}
+	return &ntlmTransport{Transport: t, proxy: p}
+}
+
+// tunnelKey carries the proxy chosen for a request to the transport's dialer,
+// which only sees the destination address.
+type tunnelKey struct{}
+
+// ntlmTransport picks the proxy for each request and leaves it in the request
+// context for the dialer.
+type ntlmTransport struct {
+	*http.Transport
+	proxy *config.Proxy
+}
+
+func (t *ntlmTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	proxy, err := proxyFor(t.proxy, req.URL)
+	if err != nil {
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, err
+	}
+	if proxy != nil {
+		req = req.WithContext(context.WithValue(req.Context(), tunnelKey{}, proxy))
+	}
+	return t.Transport.RoundTrip(req)
+}
+
+var (
+	sharedMu  sync.Mutex
+	sharedCfg *config.Config
+	shared    *http.Client
+)
+
+// Client returns an http.Client for callers without a client of their own,
+// such as PaperCut XML-RPC calls. It shares one transport, so connections
+// are reused, until the config is reloaded. Requests should carry their own
+// deadline.
+func Client() *http.Client {
+	cfg := config.Get()
+	sharedMu.Lock()
+	defer sharedMu.Unlock()
+	if shared == nil || sharedCfg != cfg {
+		shared = &http.Client{Transport: New(nil)}
+		sharedCfg = cfg
+	}
+	return shared
+}
+
+// Dial opens a TCP connection to target's host and port the way the agent's
+// transports would: directly, or tunnelled through the proxy.
+func Dial(ctx context.Context, target *url.URL) (net.Conn, error) {
+	p := &config.Get().Proxy
+	addr := net.JoinHostPort(target.Hostname(), port(target))
+	proxy, err := proxyFor(p, target)
+	if err != nil {
+		return nil, err
+	}
+	if proxy == nil {
+		return dialer.DialContext(ctx, "tcp", addr)
+	}
+	return tunnel(ctx, p, proxy, addr)
+}
+
+// Describe returns how a request to target would be routed, for diagnostics:
+// "direct" or the proxy URL without credentials.
+func Describe(target *url.URL) (string, error) {
+	proxy, err := proxyFor(&config.Get().Proxy, target)
+	if err != nil || proxy == nil {
+		return "direct", err
+	}
+	return proxy.Redacted(), nil
+}
+
+// Check validates the [proxy] configuration.
+func Check() error {
+	return check(&config.Get().Proxy)
+}
+
+func check(p *config.Proxy) error {
+	switch strings.ToLower(p.Mode) {
+	case "", ModeEnv, ModeOff:
+	case ModeManual:
+		if _, err := parseProxyURL(p.URL); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown proxy mode %q", p.Mode)
+	}
+	switch strings.ToLower(p.Auth) {
+	case "":
+	case AuthBasic, AuthNTLM:
+		if p.Username == "" {
+			return fmt.Errorf("proxy auth %q requires a username", p.Auth)
+		}
+	default:
+		return fmt.Errorf("unknown proxy auth %q", p.Auth)
+	}
+	for _, rule := range p.Bypass {
+		if strings.Contains(rule, "/") {
+			if _, _, err := net.ParseCIDR(strings.TrimSpace(rule)); err != nil {
+				return fmt.Errorf("proxy bypass rule %q: %w", rule, err)
+			}
+		}
+	}
+	return nil
+}
+
+// proxyFor returns the proxy for a request to target, or nil to connect
+// directly.
+func proxyFor(p *config.Proxy, target *url.URL) (*url.URL, error) {
+	if err := check(p); err != nil {
+		return nil, err
+	}
+	mode := strings.ToLower(p.Mode)
+	if mode == ModeOff || bypassed(p.Bypass, target) {
+		return nil, nil
+	}
+
+	var proxy *url.URL
+	var err error
+	if mode == ModeManual {
+		proxy, err = parseProxyURL(p.URL)
+	} else {
+		proxy, err = http.ProxyFromEnvironment(&http.Request{URL: target})
+	}
+	if err != nil || proxy == nil {
+		return nil, err
+	}
+	if p.Username != "" && strings.EqualFold(p.Auth, AuthBasic) {
+		u := *proxy
+		u.User = url.UserPassword(p.Username, p.GetPassword())
+		proxy = &u
+	}
+	return proxy, nil
+}
+
+// parseProxyURL parses a proxy URL; a bare "host:port" means an HTTP proxy.
+func parseProxyURL(raw string) (*url.URL, error) {
+	if raw == "" {
+		return nil, errors.New("proxy mode \"manual\" requires a proxy url")
+	}
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+		if u2, err2 := url.Parse("http://" + raw); err2 == nil && u2.Host != "" {
+			return u2, nil
+		}
+		return nil, fmt.Errorf("invalid proxy url %q", raw)
+	}
+	return u, nil
+}
+
+// port returns the port of u, defaulting by scheme.
+func port(u *url.URL) string {
+	if p := u.Port(); p != "" {
+		return p
+	}
+	if u.Scheme == "http" {
+		return "80"
+	}
+	return "443"
+}
+
+// bypassed reports whether target is reached directly under rules, which use
+// NO_PROXY syntax (see config.Proxy). Loopback destinations always are.
+func bypassed(rules []string, target *url.URL) bool {
+	host := strings.ToLower(target.Hostname())
+	ip := net.ParseIP(host)
+	if host == "localhost" || (ip != nil && ip.IsLoopback()) {
+		return true
+	}
+	tport := port(target)
+
+	for _, rule := range rules {
+		rule = strings.ToLower(strings.TrimSpace(rule))
+		switch {
+		case rule == "":
+			continue
+		case rule == "*":
+			return true
+		case rule == "<local>":
+			if ip == nil && !strings.Contains(host, ".") {
+				return true
+			}
+			continue
+		case strings.Contains(rule, "/"):
+			if _, n, err := net.ParseCIDR(rule); err == nil && ip != nil && n.Contains(ip) {
+				return true
+			}
+			continue
+		}
+
+		rhost := rule
+		if h, p, err := net.SplitHostPort(rule); err == nil {
+			if p != tport {
+				continue
+			}
+			rhost = h
+		}
+		rhost = strings.Trim(rhost, "[]")
+		if rip := net.ParseIP(rhost); rip != nil {
+			if ip != nil && rip.Equal(ip) {
+				return true
+			}
+			continue
+		}
+		rhost = strings.TrimPrefix(rhost, "*")
+		if strings.HasPrefix(rhost, ".") {
+			if strings.HasSuffix(host, rhost) {
+				return true
+			}
+			continue
+		}
+		if host == rhost || strings.HasSuffix(host, "."+rhost) {
+			return true
+		}
+	}
+	return false
+}
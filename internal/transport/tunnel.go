@@ -0,0 +1,146 @@
+// Copyright © 2026 ForcePoint Software. All rights reserved.
+
+package transport
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/Azure/go-ntlmssp"
+
+	"github.com/forcedesk/forcedesk-agent/internal/config"
+)
+
+// tunnel opens a CONNECT tunnel to addr through proxy, authenticating with
+// the credentials in the proxy URL (basic) or, for NTLM, with a
+// negotiate/challenge/authenticate exchange on the proxy connection.
+func tunnel(ctx context.Context, p *config.Proxy, proxy *url.URL, addr string) (net.Conn, error) {
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(proxy.Hostname(), port(proxy)))
+	if err != nil {
+		return nil, fmt.Errorf("dial proxy %s: %w", proxy.Host, err)
+	}
+	if proxy.Scheme == "https" {
+		tc := tls.Client(conn, &tls.Config{ServerName: proxy.Hostname()})
+		if err := tc.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("proxy %s TLS handshake: %w", proxy.Host, err)
+		}
+		conn = tc
+	}
+
+	// Abort the exchange if ctx ends; the deadline is cleared on success.
+	stop := context.AfterFunc(ctx, func() { conn.SetDeadline(time.Unix(1, 0)) })
+	defer stop()
+
+	br := bufio.NewReader(conn)
+	if err := connect(p, conn, br, proxy, addr); err != nil {
+		conn.Close()
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, err
+	}
+	if !stop() {
+		conn.Close()
+		return nil, ctx.Err()
+	}
+	if br.Buffered() > 0 {
+		return &bufferedConn{Conn: conn, r: br}, nil
+	}
+	return conn, nil
+}
+
+// connect performs the CONNECT exchange on conn.
+func connect(p *config.Proxy, conn net.Conn, br *bufio.Reader, proxy *url.URL, addr string) error {
+	ntlm := strings.EqualFold(p.Auth, AuthNTLM)
+	var auth string
+	switch {
+	case ntlm:
+		neg, err := ntlmssp.NewNegotiateMessage("", "")
+		if err != nil {
+			return fmt.Errorf("ntlm negotiate: %w", err)
+		}
+		auth = "NTLM " + base64.StdEncoding.EncodeToString(neg)
+	case proxy.User != nil:
+		pw, _ := proxy.User.Password()
+		auth = "Basic " + base64.StdEncoding.EncodeToString([]byte(proxy.User.Username()+":"+pw))
+	}
+
+	resp, err := roundTrip(conn, br, addr, auth)
+	if err != nil {
+		return fmt.Errorf("proxy %s: %w", proxy.Host, err)
+	}
+	if ntlm && resp.StatusCode == http.StatusProxyAuthRequired {
+		challenge, err := ntlmChallenge(resp.Header.Values("Proxy-Authenticate"))
+		if err != nil {
+			return fmt.Errorf("proxy %s: %w", proxy.Host, err)
+		}
+		msg, err := ntlmssp.NewAuthenticateMessage(challenge, p.Username, p.GetPassword(), nil)
+		if err != nil {
+			return fmt.Errorf("ntlm authenticate: %w", err)
+		}
+		if resp, err = roundTrip(conn, br, addr, "NTLM "+base64.StdEncoding.EncodeToString(msg)); err != nil {
+			return fmt.Errorf("proxy %s: %w", proxy.Host, err)
+		}
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("proxy %s refused CONNECT to %s: %s", proxy.Host, addr, resp.Status)
+	}
+	return nil
+}
+
+// roundTrip sends one CONNECT request and reads the answer, draining any
+// body so the connection can carry the next step of an NTLM exchange.
+func roundTrip(conn net.Conn, br *bufio.Reader, addr, auth string) (*http.Response, error) {
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: addr},
+		Host:   addr,
+		Header: http.Header{"Proxy-Connection": {"Keep-Alive"}},
+	}
+	if auth != "" {
+		req.Header.Set("Proxy-Authorization", auth)
+	}
+	if err := req.Write(conn); err != nil {
+		return nil, err
+	}
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+		resp.Body.Close()
+	}
+	return resp, nil
+}
+
+// ntlmChallenge extracts the NTLM challenge from Proxy-Authenticate headers.
+func ntlmChallenge(headers []string) ([]byte, error) {
+	for _, h := range headers {
+		scheme, token, _ := strings.Cut(strings.TrimSpace(h), " ")
+		if !strings.EqualFold(scheme, "NTLM") || token == "" {
+			continue
+		}
+		return base64.StdEncoding.DecodeString(strings.TrimSpace(token))
+	}
+	return nil, errors.New("proxy did not send an NTLM challenge (check [proxy] auth and credentials)")
+}
+
+// bufferedConn is a tunnel whose first bytes were already read into r.
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *bufferedConn) Read(b []byte) (int, error) { return c.r.Read(b) }
@@ -0,0 +1,330 @@
+// Copyright © 2026 ForcePoint Software. All rights reserved.
+
+package update
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/forcedesk/forcedesk-agent/internal/config"
+	"github.com/forcedesk/forcedesk-agent/internal/tenant"
+)
+
+const (
+	// stateFile holds the update state in the data directory. It is kept out
+	// of the database so that a new version whose database fails to open or
+	// migrate can still count its starts and be rolled back.
+	stateFile = "update.json"
+	// maxTrialBoots is how many times a new version may start without
+	// reporting healthy before it is rolled back.
+	maxTrialBoots = 3
+	// defaultTrialPeriod applies when [update] trial_period is unset or invalid.
+	defaultTrialPeriod = 15 * time.Minute
+	// trialExtension is how long the trial is extended while the tenant is
+	// offline, and once more after it comes back, since a new version can't
+	// report healthy to a tenant it can't reach. A start after the trial
+	// period has run out gets this long too. It spans two default heartbeats.
+	trialExtension = 10 * time.Minute
+)
+
+// state is the update state kept in stateFile across restarts.
+type state struct {
+	// Pending is the update on trial, if any.
+	Pending *pending `json:"pending,omitempty"`
+	// Failed lists versions that were rolled back; they are not offered again.
+	Failed []string `json:"failed,omitempty"`
+	// LastError is why the last update failed or was rolled back.
+	LastError string `json:"last_error,omitempty"`
+}
+
+// pending is an installed update that hasn't yet proved healthy.
+type pending struct {
+	From      string    `json:"from"`
+	To        string    `json:"to"`
+	Exe       string    `json:"exe"`
+	SwappedAt time.Time `json:"swapped_at"`
+	// Boots counts starts of the new version; TrialStart is the first.
+	Boots      int       `json:"boots"`
+	TrialStart time.Time `json:"trial_start"`
+}
+
+var (
+	// mu serializes changes to the state and the executable.
+	mu sync.Mutex
+	// onTrial is set while this process is an update on trial, so Confirm
+	// is cheap otherwise.
+	onTrial    atomic.Bool
+	trialTimer *time.Timer
+	// trialOffline is set when the trial was last extended because the
+	// tenant was offline.
+	trialOffline bool
+	// restart is signalled when the agent should restart onto the
+	// executable now on disk.
+	restart = make(chan struct{}, 1)
+)
+
+// RestartRequested is signalled when an update has been installed or rolled
+// back and the agent must restart to run it. Whatever runs the agent stops
+// the scheduler and restarts the process its own way: a Windows service exits
+// for the service manager to restart it, a foreground agent re-executes itself.
+func RestartRequested() <-chan struct{} {
+	return restart
+}
+
+func requestRestart() {
+	select {
+	case restart <- struct{}{}:
+	default:
+	}
+}
+
+// Status is the update state reported in the heartbeat.
+type Status struct {
+	// Trying is the version on trial, if any.
+	Trying    string   `json:"trying,omitempty"`
+	Failed    []string `json:"failed,omitempty"`
+	LastError string   `json:"last_error,omitempty"`
+}
+
+// Report returns the update state for the heartbeat.
+func Report() Status {
+	mu.Lock()
+	defer mu.Unlock()
+	st := load()
+	s := Status{Failed: st.Failed, LastError: st.LastError}
+	if st.Pending != nil {
+		s.Trying = st.Pending.To
+	}
+	return s
+}
+
+// Resume picks up an update in progress when the agent starts: a new version
+// has its start counted, or is rolled back if it has already used up its
+// starts or isn't the version that was installed. Call it first thing when
+// the agent runs, before anything that can stop it starting, so a version
+// that can't start still uses up its starts. It reports whether it rolled
+// back, in which case the agent must restart straight away without running.
+func Resume() bool {
+	mu.Lock()
+	defer mu.Unlock()
+
+	exe, err := Executable()
+	if err == nil {
+		// Leftovers of an earlier download or rollback.
+		os.Remove(exe + ".new")
+		os.Remove(exe + ".failed")
+	}
+
+	st := load()
+	p := st.Pending
+	if p == nil {
+		return false
+	}
+	switch tenant.AgentVersion {
+	case p.To:
+	case p.From:
+		// The new executable never ran, e.g. it was replaced by hand.
+		slog.Warn("update: agent restarted on the previous version, update abandoned", "version", p.To)
+		st.Pending = nil
+		st.LastError = fmt.Sprintf("agent restarted on %s instead of %s", p.From, p.To)
+		st.Failed = append(st.Failed, p.To)
+		save(st)
+		return false
+	default:
+		return rollback(st, fmt.Sprintf("installed executable reports %s, not %s", tenant.AgentVersion, p.To))
+	}
+
+	p.Boots++
+	if p.TrialStart.IsZero() {
+		p.TrialStart = time.Now()
+	}
+	if p.Boots > maxTrialBoots {
+		return rollback(st, fmt.Sprintf("restarted %d times without reporting healthy", maxTrialBoots))
+	}
+	if err := save(st); err != nil {
+		slog.Error("update: failed to record trial start", "err", err)
+	}
+	onTrial.Store(true)
+	return false
+}
+
+// StartTrial starts the trial period of a new version once the agent has
+// started, rolling it back if no healthy heartbeat ends the trial in time.
+// Call it once, after Resume and before the scheduler starts.
+func StartTrial() {
+	mu.Lock()
+	defer mu.Unlock()
+	if !onTrial.Load() {
+		return
+	}
+	st := load()
+	p := st.Pending
+	if p == nil {
+		onTrial.Store(false)
+		return
+	}
+
+	// A restart after the trial period ran out, e.g. during a long tenant
+	// outage, still gets a chance to report healthy. Starts are capped by
+	// maxTrialBoots.
+	remaining := max(time.Until(p.TrialStart.Add(trialPeriod())), trialExtension)
+	slog.Info("update: new version on trial", "version", p.To, "previous", p.From, "boot", p.Boots, "remaining", remaining.Round(time.Second).String())
+	trialTimer = time.AfterFunc(remaining, trialExpired)
+}
+
+// trialExpired rolls back the version on trial when its trial period ends
+// without a healthy heartbeat. If the tenant is offline, or was at the last
+// check, the trial is extended instead: a working version mustn't be rolled
+// back, and never offered again, because of a tenant outage.
+func trialExpired() {
+	mu.Lock()
+	defer mu.Unlock()
+	st := load()
+	if st.Pending == nil || !onTrial.Load() {
+		return
+	}
+	if online := tenant.Online(); !online || trialOffline {
+		trialOffline = !online
+		slog.Warn("update: no healthy heartbeat yet but the tenant has been offline, extending trial", "version", st.Pending.To, "extension", trialExtension.String())
+		trialTimer.Reset(trialExtension)
+		return
+	}
+	rollback(st, "no healthy heartbeat within the trial period")
+}
+
+// Abort rolls back a new version on trial that failed to start, so the
+// restart that follows runs the previous version instead of failing the same
+// way until its starts run out. It reports whether it rolled back. Startup
+// failures call it before exiting; otherwise it does nothing.
+func Abort(reason string) bool {
+	if !onTrial.Load() {
+		return false
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	st := load()
+	if st.Pending == nil {
+		return false
+	}
+	return rollback(st, "failed to start: "+reason)
+}
+
+// Confirm ends the trial of a new version after a healthy heartbeat: the
+// previous executable is removed and the update is final.
+func Confirm() {
+	if !onTrial.Load() {
+		return
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if !onTrial.Swap(false) {
+		return
+	}
+	if trialTimer != nil {
+		trialTimer.Stop()
+	}
+
+	st := load()
+	p := st.Pending
+	if p == nil {
+		return
+	}
+	st.Pending = nil
+	if err := save(st); err != nil {
+		slog.Error("update: failed to record update as healthy", "err", err)
+	}
+	if err := os.Remove(p.Exe + ".old"); err != nil && !os.IsNotExist(err) {
+		slog.Warn("update: failed to remove previous executable", "err", err)
+	}
+	slog.Info("update: new version healthy, update complete", "version", p.To, "previous", p.From)
+}
+
+// rollback puts the previous executable back, records p.To as failed and
+// requests a restart. It reports whether the previous executable is back in
+// place. Called with mu held.
+func rollback(st *state, reason string) bool {
+	p := st.Pending
+	onTrial.Store(false)
+	slog.Error("update: rolling back", "version", p.To, "to", p.From, "reason", reason)
+
+	failed := p.Exe + ".failed"
+	os.Remove(failed)
+	restored := false
+	if err := os.Rename(p.Exe, failed); err != nil {
+		slog.Error("update: rollback failed, cannot move new executable aside", "err", err)
+		reason += "; rollback failed: " + err.Error()
+	} else if err := os.Rename(p.Exe+".old", p.Exe); err != nil {
+		slog.Error("update: rollback failed, cannot restore previous executable", "err", err)
+		os.Rename(failed, p.Exe)
+		reason += "; rollback failed: " + err.Error()
+	} else {
+		restored = true
+		requestRestart()
+	}
+
+	st.Pending = nil
+	st.LastError = fmt.Sprintf("%s rolled back: %s", p.To, reason)
+	st.Failed = append(st.Failed, p.To)
+	if err := save(st); err != nil {
+		slog.Error("update: failed to record rollback", "err", err)
+	}
+	return restored
+}
+
+// trialPeriod returns [update] trial_period.
+func trialPeriod() time.Duration {
+	raw := config.Get().Update.TrialPeriod
+	if raw == "" {
+		return defaultTrialPeriod
+	}
+	d, err := time.ParseDuration(raw)
+	if err != nil || d <= 0 {
+		slog.Warn("update: invalid [update] trial_period, using default", "trial_period", raw, "default", defaultTrialPeriod)
+		return defaultTrialPeriod
+	}
+	return d
+}
+
+// load reads the update state. A missing or unreadable state is empty.
+func load() *state {
+	var st state
+	raw, err := os.ReadFile(statePath())
+	if err != nil {
+		if !os.IsNotExist(err) {
+			slog.Error("update: failed to read update state", "err", err)
+		}
+		return &st
+	}
+	if err := json.Unmarshal(raw, &st); err != nil {
+		slog.Error("update: discarding unreadable update state", "err", err)
+		return &state{}
+	}
+	return &st
+}
+
+// save writes the update state, replacing the file in one step so a crash
+// can't leave it half written.
+func save(st *state) error {
+	raw, err := json.Marshal(st)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(config.DataDir(), 0755); err != nil {
+		return fmt.Errorf("create data dir: %w", err)
+	}
+	path := statePath()
+	if err := os.WriteFile(path+".tmp", raw, 0600); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+func statePath() string {
+	return filepath.Join(config.DataDir(), stateFile)
+}
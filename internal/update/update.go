@@ -0,0 +1,325 @@
+// Copyright © 2026 ForcePoint Software. All rights reserved.
+
+// Package update installs new agent versions offered by the tenant.
+//
+// The tenant offers a target version with the URL, SHA-256 and ed25519
+// signature of its executable. The agent downloads the executable next to its
+// own, checks the hash and the signature against the key built into the
+// binary, makes sure it runs, then swaps it in (keeping the current one as
+// <exe>.old) and asks to be restarted. The new version is on trial until it
+// reports a healthy heartbeat; if it doesn't within the trial period (which
+// is extended while the tenant is offline), fails to start, or keeps
+// restarting, it puts the old executable back and restarts again, and that
+// version is not tried again.
+//
+// The logic here is the same on every platform. How the agent restarts is up
+// to whatever runs it: see RestartRequested.
+package update
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/forcedesk/forcedesk-agent/internal/config"
+	"github.com/forcedesk/forcedesk-agent/internal/tenant"
+	"github.com/forcedesk/forcedesk-agent/internal/transport"
+)
+
+// signingKey is the hex ed25519 public key updates must be signed with. It
+// is set at build time from UPDATE_SIGNING_KEY in the Makefile:
+//
+//	go build -ldflags "-X github.com/forcedesk/forcedesk-agent/internal/update.signingKey=<hex>"
+//
+// A build without it skips every offer.
+var signingKey string
+
+// signContext prefixes the signed message, which binds the executable's
+// hash to its version and platform so a signed build can't be offered under
+// another version or to another platform:
+//
+//	signContext || version || 0x00 || GOOS "/" GOARCH || 0x00 || SHA-256(executable)
+const signContext = "forcedesk-agent-update v1\x00"
+
+const (
+	// maxSize bounds the download.
+	maxSize = 256 << 20
+	// downloadTimeout bounds the download and selfTestTimeout the trial run
+	// of the new executable.
+	downloadTimeout = 15 * time.Minute
+	selfTestTimeout = 30 * time.Second
+)
+
+// ErrSkipped wraps the reasons an offer is not installed that are not
+// failures: the agent is already on that version, isn't in the rollout yet,
+// already rolled that version back, or was built without a signing key.
+var ErrSkipped = errors.New("update skipped")
+
+// Offer is the tenant's update offer.
+type Offer struct {
+	Version string `json:"version"`
+	URL     string `json:"url"`
+	// SHA256 is the hex hash and Signature the base64 ed25519 signature of
+	// the executable; see signContext.
+	SHA256    string `json:"sha256"`
+	Signature string `json:"signature"`
+	// Rollout is the percentage of agents, 1-100, that should take the
+	// update now; 0 means all of them. Agents are picked by a stable hash of
+	// their UUID and the version, so raising it only adds agents.
+	Rollout int `json:"rollout"`
+}
+
+// applying is set, under mu, while an Apply downloads and tests a new
+// version, which it does without holding mu so Report isn't held up.
+var applying bool
+
+// Apply installs the offered version and requests a restart onto it. Offers
+// that don't apply to this agent return an error wrapping ErrSkipped.
+func Apply(ctx context.Context, o *Offer) error {
+	mu.Lock()
+	if applying {
+		mu.Unlock()
+		return fmt.Errorf("%w: another update is being installed", ErrSkipped)
+	}
+	if err := check(o); err != nil {
+		mu.Unlock()
+		return err
+	}
+	applying = true
+	mu.Unlock()
+	defer func() {
+		mu.Lock()
+		applying = false
+		mu.Unlock()
+	}()
+
+	staged, err := fetch(ctx, o)
+	if err != nil {
+		return err
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	// The config or the state may have changed during the download.
+	if err := check(o); err != nil {
+		os.Remove(staged)
+		return err
+	}
+	exe, err := Executable()
+	if err != nil {
+		os.Remove(staged)
+		return err
+	}
+	old := exe + ".old"
+	os.Remove(old)
+	if err := os.Rename(exe, old); err != nil {
+		os.Remove(staged)
+		return fmt.Errorf("move current executable aside: %w", err)
+	}
+	if err := os.Rename(staged, exe); err != nil {
+		if rerr := os.Rename(old, exe); rerr != nil {
+			slog.Error("update: failed to restore executable after failed swap", "exe", exe, "err", rerr)
+		}
+		return fmt.Errorf("install new executable: %w", err)
+	}
+
+	st := load()
+	st.Pending = &pending{From: tenant.AgentVersion, To: o.Version, Exe: exe, SwappedAt: time.Now()}
+	st.LastError = ""
+	if err := save(st); err != nil {
+		// Without the record there would be no trial and no rollback.
+		slog.Error("update: failed to record update, reverting", "err", err)
+		os.Rename(exe, staged)
+		os.Rename(old, exe)
+		os.Remove(staged)
+		return fmt.Errorf("record update: %w", err)
+	}
+
+	slog.Info("update: installed, restarting", "from", tenant.AgentVersion, "to", o.Version)
+	requestRestart()
+	return nil
+}
+
+// fetch verifies the offer's signature, then downloads and self-tests the
+// offered executable next to the current one. It returns the staged path.
+func fetch(ctx context.Context, o *Offer) (string, error) {
+	key, err := publicKey()
+	if err != nil {
+		return "", err
+	}
+	sum, err := hex.DecodeString(o.SHA256)
+	if err != nil || len(sum) != sha256.Size {
+		return "", fmt.Errorf("offer for %s has an invalid sha256", o.Version)
+	}
+	sig, err := base64.StdEncoding.DecodeString(o.Signature)
+	if err != nil || len(sig) != ed25519.SignatureSize {
+		return "", fmt.Errorf("offer for %s has an invalid signature", o.Version)
+	}
+	// Check the signature over the offered hash before downloading anything.
+	if !ed25519.Verify(key, signedMessage(o.Version, sum), sig) {
+		return "", fmt.Errorf("offer for %s is not signed with the update key", o.Version)
+	}
+
+	exe, err := Executable()
+	if err != nil {
+		return "", err
+	}
+	staged := exe + ".new"
+	slog.Info("update: downloading", "version", o.Version, "url", o.URL)
+	if err := download(ctx, o.URL, staged, sum); err != nil {
+		os.Remove(staged)
+		return "", err
+	}
+	if err := selfTest(ctx, staged, o.Version); err != nil {
+		os.Remove(staged)
+		return "", err
+	}
+	return staged, nil
+}
+
+// check returns why o should not be installed, if it shouldn't.
+func check(o *Offer) error {
+	if !config.Get().Update.Enabled {
+		return fmt.Errorf("%w: disabled in config", ErrSkipped)
+	}
+	if signingKey == "" {
+		return fmt.Errorf("%w: this build has no update signing key, updates must be installed by hand", ErrSkipped)
+	}
+	if o.Version == "" || o.Version == tenant.AgentVersion {
+		return fmt.Errorf("%w: already on %s", ErrSkipped, tenant.AgentVersion)
+	}
+	u, err := url.Parse(o.URL)
+	if err != nil || u.Host == "" || u.Scheme != "https" {
+		return fmt.Errorf("offer for %s has an invalid url %q (https required)", o.Version, o.URL)
+	}
+	st := load()
+	if st.Pending != nil {
+		return fmt.Errorf("%w: %s is still on trial", ErrSkipped, st.Pending.To)
+	}
+	if slices.Contains(st.Failed, o.Version) {
+		return fmt.Errorf("%w: %s was rolled back", ErrSkipped, o.Version)
+	}
+	if !inRollout(config.Get().Tenant.UUID, o) {
+		return fmt.Errorf("%w: not in the %d%% rollout of %s yet", ErrSkipped, o.Rollout, o.Version)
+	}
+	return nil
+}
+
+// inRollout reports whether the agent with uuid is among the first
+// o.Rollout percent for o.Version.
+func inRollout(uuid string, o *Offer) bool {
+	if o.Rollout <= 0 || o.Rollout >= 100 {
+		return true
+	}
+	h := fnv.New32a()
+	h.Write([]byte(uuid))
+	h.Write([]byte{0})
+	h.Write([]byte(o.Version))
+	return int(h.Sum32()%100) < o.Rollout
+}
+
+// publicKey decodes the built-in signing key.
+func publicKey() (ed25519.PublicKey, error) {
+	key, err := hex.DecodeString(strings.TrimSpace(signingKey))
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return nil, errors.New("built-in update signing key is invalid")
+	}
+	return ed25519.PublicKey(key), nil
+}
+
+// signedMessage returns the message signed for version with executable hash sum.
+func signedMessage(version string, sum []byte) []byte {
+	msg := signContext + version + "\x00" + runtime.GOOS + "/" + runtime.GOARCH + "\x00"
+	return append([]byte(msg), sum...)
+}
+
+// exePath is the agent executable, resolved at startup: once the file has
+// been swapped, the OS may report the running executable under its new name.
+var exePath, exeErr = locateExecutable()
+
+// Executable returns the path of the agent executable as it was at startup,
+// which is where an update installs the new version. Restart onto this path.
+func Executable() (string, error) {
+	return exePath, exeErr
+}
+
+func locateExecutable() (string, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return "", fmt.Errorf("locate executable: %w", err)
+	}
+	if resolved, err := filepath.EvalSymlinks(exe); err == nil {
+		exe = resolved
+	}
+	return exe, nil
+}
+
+// download fetches rawURL to path and checks it hashes to sum.
+func download(ctx context.Context, rawURL, path string, sum []byte) error {
+	ctx, cancel := context.WithTimeout(ctx, downloadTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := transport.Client().Do(req)
+	if err != nil {
+		return fmt.Errorf("download: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("download: unexpected status %s", resp.Status)
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o755)
+	if err != nil {
+		return fmt.Errorf("create %s: %w", path, err)
+	}
+	h := sha256.New()
+	n, err := io.Copy(io.MultiWriter(f, h), io.LimitReader(resp.Body, maxSize+1))
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("download: %w", err)
+	}
+	if n > maxSize {
+		return fmt.Errorf("download exceeds %d MiB", maxSize>>20)
+	}
+	if got := h.Sum(nil); !slices.Equal(got, sum) {
+		return fmt.Errorf("downloaded executable hash %x does not match the signed hash", got)
+	}
+	return nil
+}
+
+// selfTest runs the executable at path with "version" and checks it reports
+// the expected version, so a build that can't run on this machine is never
+// swapped in.
+func selfTest(ctx context.Context, path, version string) error {
+	ctx, cancel := context.WithTimeout(ctx, selfTestTimeout)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, path, "version").Output()
+	if err != nil {
+		return fmt.Errorf("new executable failed to run: %w", err)
+	}
+	if got := strings.TrimSpace(string(out)); got != version {
+		return fmt.Errorf("new executable reports version %q, offered as %q", got, version)
+	}
+	return nil
+}
@@ -12,9 +12,12 @@ import (
 	"os"
 	"path/filepath"
 	"runtime"
+	"strconv"
 	"time"
 
 	"github.com/forcedesk/forcedesk-agent/internal/config"
+	"github.com/forcedesk/forcedesk-agent/internal/control"
+	"github.com/forcedesk/forcedesk-agent/internal/db"
 	"github.com/forcedesk/forcedesk-agent/internal/scheduler"
 	"github.com/forcedesk/forcedesk-agent/internal/tenant"
 )
@@ -27,7 +30,8 @@ var agentStart = time.Now()
 
 // Start launches the WebUI HTTP server in a background goroutine.
 // addr should be a "host:port" string; defaults to "127.0.0.1:8888" if empty.
-func Start(addr string, sched *scheduler.Scheduler) {
+// controlToken authenticates the task control endpoints under /api/tasks.
+func Start(addr string, sched *scheduler.Scheduler, controlToken string) {
 	if addr == "" {
 		addr = "127.0.0.1:8888"
 	}
@@ -35,6 +39,14 @@ func Start(addr string, sched *scheduler.Scheduler) {
 	mux := http.NewServeMux()
 	mux.HandleFunc("GET /", handleIndex)
 	mux.HandleFunc("GET /api/status", handleStatus(sched))
+	mux.HandleFunc("GET /api/task-runs", handleTaskRuns)
+	mux.HandleFunc("GET /api/jobs", handleJobs)
+	mux.HandleFunc("GET /api/outbox", handleOutbox)
+
+	// Task control shares its handler (and token check) with the local control socket.
+	ctl := control.Handler(sched, controlToken)
+	mux.Handle("GET /api/tasks", ctl)
+	mux.Handle("POST /api/tasks/", ctl)
 
 	srv := &http.Server{
 		Addr:         addr,
@@ -75,9 +87,12 @@ type agentInfo struct {
 }
 
 type statusResponse struct {
-	Agent agentInfo             `json:"agent"`
-	Tasks []scheduler.TaskState `json:"tasks"`
-	Logs  []map[string]any      `json:"logs"`
+	Agent        agentInfo                 `json:"agent"`
+	Tasks        []scheduler.TaskState     `json:"tasks"`
+	Resources    []scheduler.ResourceState `json:"resources"`
+	Circuit      tenant.CircuitState       `json:"tenant_circuit"`
+	Connectivity tenant.ConnectivityState  `json:"tenant_connectivity"`
+	Logs         []map[string]any          `json:"logs"`
 }
 
 // handleStatus returns JSON with agent info, task states, and recent log lines.
@@ -94,8 +109,11 @@ func handleStatus(sched *scheduler.Scheduler) http.HandlerFunc {
 				TenantURL: config.Get().Tenant.URL,
 				DataDir:   config.DataDir(),
 			},
-			Tasks: sched.States(),
-			Logs:  readRecentLogs(200),
+			Tasks:        sched.States(),
+			Resources:    sched.Resources(),
+			Circuit:      tenant.Circuit(),
+			Connectivity: tenant.Connectivity(),
+			Logs:         readRecentLogs(200),
 		}
 		w.Header().Set("Content-Type", "application/json")
 		w.Header().Set("Cache-Control", "no-store")
@@ -103,6 +121,221 @@ func handleStatus(sched *scheduler.Scheduler) http.HandlerFunc {
 	}
 }
 
+// Paging limits for /api/task-runs.
+const (
+	defaultRunsPerPage = 50
+	maxRunsPerPage     = 200
+)
+
+// taskRun is the JSON form of a row from the task run history.
+type taskRun struct {
+	ID         int64     `json:"id"`
+	Task       string    `json:"task"`
+	StartedAt  time.Time `json:"started_at"`
+	EndedAt    time.Time `json:"ended_at"`
+	Duration   string    `json:"duration"`
+	DurationMS int64     `json:"duration_ms"`
+	Outcome    string    `json:"outcome"`
+	Error      string    `json:"error"`
+	Summary    string    `json:"summary"`
+	// Runs is how many successful runs the row stands for, from StartedAt
+	// to EndedAt; Duration is the longest of them.
+	Runs int `json:"runs"`
+}
+
+type taskRunsResponse struct {
+	Runs    []taskRun `json:"runs"`
+	Page    int       `json:"page"`
+	PerPage int       `json:"per_page"`
+	Total   int       `json:"total"`
+}
+
+// handleTaskRuns returns one page of the persisted task run history, newest
+// first. Query parameters: task (optional filter), page (1-based), per_page.
+func handleTaskRuns(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	page := queryInt(q.Get("page"), 1)
+	if page < 1 {
+		page = 1
+	}
+	perPage := queryInt(q.Get("per_page"), defaultRunsPerPage)
+	if perPage < 1 || perPage > maxRunsPerPage {
+		perPage = defaultRunsPerPage
+	}
+
+	rows, total, err := db.ListTaskRuns(q.Get("task"), perPage, (page-1)*perPage)
+	if err != nil {
+		slog.Error("webui: failed to list task runs", "err", err)
+		http.Error(w, "failed to list task runs", http.StatusInternalServerError)
+		return
+	}
+
+	resp := taskRunsResponse{Runs: make([]taskRun, len(rows)), Page: page, PerPage: perPage, Total: total}
+	for i, row := range rows {
+		resp.Runs[i] = taskRun{
+			ID:         row.ID,
+			Task:       row.Task,
+			StartedAt:  row.StartedAt,
+			EndedAt:    row.EndedAt,
+			Duration:   row.Duration.String(),
+			DurationMS: row.Duration.Milliseconds(),
+			Outcome:    row.Outcome,
+			Error:      row.Error,
+			Summary:    row.Summary,
+			Runs:       row.Runs,
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// job is the JSON form of a row from the jobs table.
+type job struct {
+	RequestUUID string     `json:"request_uuid"`
+	Type        string     `json:"type"`
+	State       string     `json:"state"`
+	QueuedAt    time.Time  `json:"queued_at"`
+	StartedAt   *time.Time `json:"started_at"`
+	EndedAt     *time.Time `json:"ended_at"`
+	Duration    string     `json:"duration"`
+	Error       string     `json:"error"`
+	Output      string     `json:"output"`
+	Reported    bool       `json:"reported"`
+	ReportError string     `json:"report_error,omitempty"`
+}
+
+type jobsResponse struct {
+	Jobs    []job `json:"jobs"`
+	Page    int   `json:"page"`
+	PerPage int   `json:"per_page"`
+	Total   int   `json:"total"`
+}
+
+// handleJobs returns one page of command-queue jobs, newest first. Query
+// parameters: page (1-based), per_page.
+func handleJobs(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	page := queryInt(q.Get("page"), 1)
+	if page < 1 {
+		page = 1
+	}
+	perPage := queryInt(q.Get("per_page"), defaultRunsPerPage)
+	if perPage < 1 || perPage > maxRunsPerPage {
+		perPage = defaultRunsPerPage
+	}
+
+	rows, total, err := db.ListJobs(perPage, (page-1)*perPage)
+	if err != nil {
+		slog.Error("webui: failed to list jobs", "err", err)
+		http.Error(w, "failed to list jobs", http.StatusInternalServerError)
+		return
+	}
+
+	resp := jobsResponse{Jobs: make([]job, len(rows)), Page: page, PerPage: perPage, Total: total}
+	for i, row := range rows {
+		j := job{
+			RequestUUID: row.RequestUUID,
+			Type:        row.Type,
+			State:       row.State,
+			QueuedAt:    row.QueuedAt,
+			Error:       row.Error,
+			Output:      row.Output,
+			Reported:    row.Reported,
+			ReportError: row.ReportError,
+		}
+		if !row.StartedAt.IsZero() {
+			j.StartedAt = &row.StartedAt
+		}
+		if !row.EndedAt.IsZero() {
+			j.EndedAt = &row.EndedAt
+			if j.StartedAt != nil {
+				j.Duration = row.EndedAt.Sub(row.StartedAt).Round(time.Millisecond).String()
+			}
+		}
+		resp.Jobs[i] = j
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// outboxItem is the JSON form of a row from the outbox table. The payload
+// itself is never exposed.
+type outboxItem struct {
+	ID            int64      `json:"id"`
+	Endpoint      string     `json:"endpoint"`
+	Kind          string     `json:"kind"`
+	Size          int        `json:"size"`
+	State         string     `json:"state"`
+	CreatedAt     time.Time  `json:"created_at"`
+	Age           string     `json:"age"`
+	Attempts      int        `json:"attempts"`
+	LastAttemptAt *time.Time `json:"last_attempt_at"`
+	LastError     string     `json:"last_error"`
+}
+
+type outboxResponse struct {
+	Items   []outboxItem `json:"items"`
+	Page    int          `json:"page"`
+	PerPage int          `json:"per_page"`
+	Total   int          `json:"total"`
+	Pending int          `json:"pending"`
+}
+
+// handleOutbox returns one page of queued tenant uploads in delivery order.
+// Query parameters: page (1-based), per_page.
+func handleOutbox(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	page := queryInt(q.Get("page"), 1)
+	if page < 1 {
+		page = 1
+	}
+	perPage := queryInt(q.Get("per_page"), defaultRunsPerPage)
+	if perPage < 1 || perPage > maxRunsPerPage {
+		perPage = defaultRunsPerPage
+	}
+
+	rows, total, pending, err := db.ListOutbox(perPage, (page-1)*perPage)
+	if err != nil {
+		slog.Error("webui: failed to list outbox", "err", err)
+		http.Error(w, "failed to list outbox", http.StatusInternalServerError)
+		return
+	}
+
+	now := time.Now()
+	resp := outboxResponse{Items: make([]outboxItem, len(rows)), Page: page, PerPage: perPage, Total: total, Pending: pending}
+	for i, row := range rows {
+		it := outboxItem{
+			ID:        row.ID,
+			Endpoint:  row.Endpoint,
+			Kind:      row.Kind,
+			Size:      row.Size,
+			State:     row.State,
+			CreatedAt: row.CreatedAt,
+			Age:       now.Sub(row.CreatedAt).Round(time.Second).String(),
+			Attempts:  row.Attempts,
+			LastError: row.LastError,
+		}
+		if !row.LastAttemptAt.IsZero() {
+			it.LastAttemptAt = &row.LastAttemptAt
+		}
+		resp.Items[i] = it
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// queryInt parses a query parameter as an int, returning def if it is absent or invalid.
+func queryInt(v string, def int) int {
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return def
+	}
+	return n
+}
+
 func formatUptime(d time.Duration) string {
 	h := int(d.Hours())
 	m := int(d.Minutes()) % 60
@@ -3,22 +3,52 @@
 package main
 
 import (
+	"context"
+	"crypto/rand"
 	"flag"
 	"fmt"
 	"log"
 	"log/slog"
+	"net/http"
 	"os"
+	"os/signal"
+	"path/filepath"
 	"runtime"
+	"strings"
+	"text/tabwriter"
+	"time"
 
 	"github.com/forcedesk/forcedesk-agent/internal/config"
+	"github.com/forcedesk/forcedesk-agent/internal/control"
 	"github.com/forcedesk/forcedesk-agent/internal/db"
 	"github.com/forcedesk/forcedesk-agent/internal/logger"
+	"github.com/forcedesk/forcedesk-agent/internal/mocktenant"
 	"github.com/forcedesk/forcedesk-agent/internal/svc"
 	"github.com/forcedesk/forcedesk-agent/internal/tasks"
+	"github.com/forcedesk/forcedesk-agent/internal/tenant"
+	"github.com/forcedesk/forcedesk-agent/internal/transport"
+	"github.com/forcedesk/forcedesk-agent/internal/update"
 	"github.com/getsentry/sentry-go"
 )
 
 func main() {
+	// The updater runs a downloaded executable with "version" to check it
+	// works before installing it; answer before touching config or data.
+	if len(os.Args) == 2 && os.Args[1] == "version" {
+		fmt.Println(tenant.AgentVersion)
+		return
+	}
+
+	// Running the agent itself, rather than one of its commands.
+	isService := svc.IsWindowsService()
+	running := isService || len(os.Args) < 2 || os.Args[1] == "debug"
+
+	// Count this start of a freshly installed update before anything that can
+	// stop the agent starting; see startupFailed.
+	if running && update.Resume() {
+		restartRolledBack(isService)
+	}
+
 	err := sentry.Init(sentry.ClientOptions{
 		Dsn: "https://eac401e19518f044be2cb1251abef2c8@sentry.forcedesk.io/11",
 	})
@@ -29,16 +59,26 @@ func main() {
 	cfg, err := config.Load()
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "failed to load config: %v\n", err)
-		os.Exit(1)
+		startupFailed(isService, fmt.Sprintf("load config: %v", err))
+	}
+
+	// The mock tenant runs next to an agent under test, usually sharing its
+	// config. It needs none of the agent's setup and must not share its log
+	// files or database.
+	if len(os.Args) > 1 && os.Args[1] == "mock-tenant" {
+		runMockTenant(os.Args[0], os.Args[2:])
+		return
 	}
 
 	// First-run setup: prompt for configuration values interactively on all platforms.
-	// Skip interactive setup if running as a Windows Service.
-	if !config.Exists() && !svc.IsWindowsService() {
+	// Skip interactive setup if running as a Windows Service, or when enrolling,
+	// which writes the config itself.
+	enrolling := len(os.Args) > 1 && os.Args[1] == "enroll"
+	if !config.Exists() && !isService && !enrolling {
 		cfg, err = config.Setup()
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "setup failed: %v\n", err)
-			os.Exit(1)
+			startupFailed(isService, fmt.Sprintf("setup: %v", err))
 		}
 	}
 
@@ -48,13 +88,12 @@ func main() {
 	// Console logging is enabled when running interactively (not as a service).
 	// Non-Windows platforms always use verbose logging for development convenience.
 	nonWindows := runtime.GOOS != "windows"
-	isService := svc.IsWindowsService()
 	consoleMode := nonWindows || !isService
 	verbose := nonWindows || (!isService && len(os.Args) > 1 && os.Args[1] == "debug")
 
 	if err := logger.Init(dataDir, consoleMode, verbose); err != nil {
 		fmt.Fprintf(os.Stderr, "failed to init logger: %v\n", err)
-		os.Exit(1)
+		startupFailed(isService, fmt.Sprintf("init logger: %v", err))
 	}
 
 	slog.Info("forcedesk-agent starting",
@@ -65,7 +104,27 @@ func main() {
 
 	if err := db.Open(dataDir); err != nil {
 		slog.Error("failed to open database", "err", err)
-		os.Exit(1)
+		startupFailed(isService, fmt.Sprintf("open database: %v", err))
+	}
+
+	// The scheduler posts sensitive uploads (passwords, PII, certificates);
+	// refuse to run it at all if they could not be encrypted.
+	if running {
+		if err := tenant.CheckPolicy(); err != nil {
+			slog.Error("sensitive upload policy check failed, not starting", "err", err)
+			startupFailed(isService, fmt.Sprintf("sensitive upload policy: %v", err))
+		}
+		if _, err := tenant.TLSConfig(); err != nil {
+			slog.Error("tenant TLS configuration is invalid, not starting", "err", err)
+			startupFailed(isService, fmt.Sprintf("tenant TLS configuration: %v", err))
+		}
+		if err := transport.Check(); err != nil {
+			slog.Error("proxy configuration is invalid, not starting", "err", err)
+			startupFailed(isService, fmt.Sprintf("proxy configuration: %v", err))
+		}
+		// The agent has started; a freshly installed update now has its
+		// trial period to report healthy.
+		update.StartTrial()
 	}
 
 	// If running as a Windows Service, hand off control to the Service Control Manager.
@@ -140,7 +199,9 @@ func main() {
 			os.Exit(1)
 		}
 
-		tasks.RunEduStarCLI(action, tasks.EduStarCLIOpts{
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+		tasks.RunEduStarCLI(ctx, action, tasks.EduStarCLIOpts{
 			School:      *school,
 			DN:          *dn,
 			GroupDN:     *groupDN,
@@ -150,16 +211,34 @@ func main() {
 			Dump:        *dump,
 		})
 
+	case "task":
+		runTaskCommand(os.Args[0], os.Args[2:])
+
+	case "enroll":
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+		runEnrollCommand(ctx, os.Args[0], os.Args[2:])
+
+	case "tls-inspect":
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+		runTLSInspect(ctx)
+
 	default:
-		fmt.Printf("Usage: %s [install|uninstall|start|stop|status|debug|edustar]\n", os.Args[0])
+		fmt.Printf("Usage: %s [install|uninstall|start|stop|status|debug|edustar|task|enroll|tls-inspect|mock-tenant|version]\n", os.Args[0])
 		fmt.Println()
-		fmt.Println("  install    Register as a Windows Service (auto-start)")
-		fmt.Println("  uninstall  Remove the Windows Service")
-		fmt.Println("  start      Start the service")
-		fmt.Println("  stop       Stop the service")
-		fmt.Println("  status     Print the current service status")
-		fmt.Println("  debug      Run the scheduler in the foreground with verbose logging")
-		fmt.Println("  edustar    Run an EduStar STMC action and print the output")
+		fmt.Println("  install      Register as a Windows Service (auto-start)")
+		fmt.Println("  uninstall    Remove the Windows Service")
+		fmt.Println("  start        Start the service")
+		fmt.Println("  stop         Stop the service")
+		fmt.Println("  status       Print the current service status")
+		fmt.Println("  debug        Run the scheduler in the foreground with verbose logging")
+		fmt.Println("  edustar      Run an EduStar STMC action and print the output")
+		fmt.Println("  task         List, run, pause or resume tasks in the running agent")
+		fmt.Println("  enroll       Register this agent with a tenant using an enrollment token")
+		fmt.Println("  tls-inspect  Print the certificate chain the agent sees for the tenant")
+		fmt.Println("  mock-tenant  Run a local mock tenant to test the agent against")
+		fmt.Println("  version      Print the agent version")
 		fmt.Println()
 		fmt.Println("Running without arguments starts the scheduler in the foreground.")
 		os.Exit(1)
@@ -202,3 +281,394 @@ func printEduStarUsage(exe string) {
 	fmt.Fprintln(os.Stderr, "  --new-password <pw>  New password for set-password")
 	fmt.Fprintln(os.Stderr, "  --dump               Print the JSON payload instead of sending to tenant")
 }
+
+// runTaskCommand implements "task <verb>", which controls tasks in the running
+// agent over the local control socket.
+func runTaskCommand(exe string, args []string) {
+	if len(args) < 1 {
+		printTaskUsage(exe)
+		os.Exit(1)
+	}
+
+	client, err := control.NewClient()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "task: %v\n", err)
+		os.Exit(1)
+	}
+
+	ctx := context.Background()
+	var resp control.Response
+	switch verb := args[0]; {
+	case verb == "list" && len(args) == 1:
+		resp, err = client.Tasks(ctx)
+	case verb == "run" && len(args) == 2:
+		resp, err = client.Run(ctx, args[1])
+	case verb == "pause" && len(args) == 2:
+		resp, err = client.Pause(ctx, args[1])
+	case verb == "resume" && len(args) == 2:
+		resp, err = client.Resume(ctx, args[1])
+	case verb == "interval" && len(args) == 3:
+		resp, err = client.SetInterval(ctx, args[1], args[2])
+	default:
+		printTaskUsage(exe)
+		os.Exit(1)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "task: %v\n", err)
+		os.Exit(1)
+	}
+
+	if resp.Message != "" {
+		fmt.Println(resp.Message)
+	}
+	if len(resp.Tasks) > 0 {
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "TASK\tSCHEDULE\tSTATE\tLAST OUTCOME\tNEXT RUN")
+		for _, t := range resp.Tasks {
+			sched := t.Interval
+			if t.Schedule != "" {
+				sched = t.Schedule
+			}
+			state := "idle"
+			switch {
+			case t.Stuck:
+				state = "stuck"
+			case t.Waiting != "":
+				state = "waiting for " + t.Waiting
+			case t.Running && t.Attempt > 0:
+				state = fmt.Sprintf("running (attempt %d)", t.Attempt)
+			case t.Running:
+				state = "running"
+			case t.Retry != nil && !t.Paused:
+				state = fmt.Sprintf("retrying (%d/%d) at %s", t.Retry.Attempt, t.Retry.MaxAttempts, t.Retry.At.Local().Format("15:04:05"))
+			case t.Paused:
+				state = "paused"
+			}
+			next := "-"
+			if t.NextRun != nil {
+				next = t.NextRun.Local().Format("2006-01-02 15:04:05")
+			}
+			outcome := string(t.LastOutcome)
+			if outcome == "" {
+				outcome = "-"
+			}
+			if t.Abandoned > 0 {
+				outcome += fmt.Sprintf(" (%d abandoned run(s) still alive)", t.Abandoned)
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", t.Name, sched, state, outcome, next)
+		}
+		w.Flush()
+	}
+	if len(resp.Resources) > 0 {
+		fmt.Println()
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "RESOURCE	IN USE	HOLDERS	WAITING")
+		for _, r := range resp.Resources {
+			holders, waiting := strings.Join(r.Holders, ", "), strings.Join(r.Waiting, ", ")
+			if holders == "" {
+				holders = "-"
+			}
+			if waiting == "" {
+				waiting = "-"
+			}
+			fmt.Fprintf(w, "%s\t%d/%d\t%s\t%s\n", r.Name, len(r.Holders), r.Capacity, holders, waiting)
+		}
+		w.Flush()
+	}
+}
+
+func printTaskUsage(exe string) {
+	fmt.Fprintf(os.Stderr, "Usage: %s task <verb> [args]\n", exe)
+	fmt.Fprintln(os.Stderr, "")
+	fmt.Fprintln(os.Stderr, "Verbs:")
+	fmt.Fprintln(os.Stderr, "  list                     Show every task and its current state")
+	fmt.Fprintln(os.Stderr, "  run <name>               Run a task now (fails if it is already running)")
+	fmt.Fprintln(os.Stderr, "  pause <name>             Stop a task from running on its schedule")
+	fmt.Fprintln(os.Stderr, "  resume <name>            Resume a paused task")
+	fmt.Fprintln(os.Stderr, "  interval <name> <dur>    Change an interval task's interval, e.g. 10m")
+	fmt.Fprintln(os.Stderr, "")
+	fmt.Fprintln(os.Stderr, "Changes apply to the running agent only and reset when it restarts.")
+}
+
+// runEnrollCommand implements "enroll", which redeems a one-time enrollment
+// token for the agent's UUID, API key and encryption key, saves them to
+// config.toml and checks that the tenant accepts them. The credentials are
+// never shown; the token is read without echo unless given on the command
+// line or in FORCEDESK_ENROLL_TOKEN.
+func runEnrollCommand(ctx context.Context, exe string, args []string) {
+	fs := flag.NewFlagSet("enroll", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s enroll --url <tenant url> [--token <token>]\n", exe)
+		fmt.Fprintln(os.Stderr, "")
+		fmt.Fprintln(os.Stderr, "Flags:")
+		fmt.Fprintln(os.Stderr, "  --url <url>      Tenant URL, e.g. https://tenant.schooldesk.io")
+		fmt.Fprintln(os.Stderr, "  --token <token>  One-time enrollment token. Omit it to be prompted without")
+		fmt.Fprintln(os.Stderr, "                   echo, or set FORCEDESK_ENROLL_TOKEN for unattended installs.")
+	}
+	tenantURL := fs.String("url", "", "Tenant URL")
+	token := fs.String("token", "", "One-time enrollment token")
+	if err := fs.Parse(args); err != nil {
+		os.Exit(1)
+	}
+	if *tenantURL == "" || fs.NArg() > 0 {
+		fs.Usage()
+		os.Exit(1)
+	}
+	if *token == "" {
+		*token = os.Getenv("FORCEDESK_ENROLL_TOKEN")
+	}
+	if *token == "" {
+		*token = config.PromptSecret("Enrollment token")
+	}
+
+	e, err := tenant.New().Enroll(ctx, *tenantURL, *token)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "enroll: %v\n", err)
+		os.Exit(1)
+	}
+	key, err := e.Key()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "enroll: %v\n", err)
+		os.Exit(1)
+	}
+
+	cfg := *config.Get()
+	cfg.Tenant.URL = strings.TrimRight(*tenantURL, "/")
+	cfg.Tenant.SetCredentials(e.UUID, e.APIKey, e.EncryptionKeyID, key)
+	if err := config.SaveConfig(&cfg); err != nil {
+		fmt.Fprintf(os.Stderr, "enroll: save config: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Enrolled as agent %s; credentials saved to %s\n", e.UUID, config.ConfigPath())
+
+	if err := tenant.New().TestConnectivity(ctx); err != nil {
+		fmt.Fprintf(os.Stderr, "enroll: the tenant did not accept the new credentials: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Println("Connectivity test passed.")
+}
+
+// runTLSInspect implements "tls-inspect", which prints the certificate chain
+// the agent sees when it connects to the tenant and how the configured trust
+// judges it, so a technician can spot an SSL-inspecting firewall.
+func runTLSInspect(ctx context.Context) {
+	cfg := config.Get()
+	rep, err := tenant.InspectTLS(ctx)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "tls-inspect: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Tenant:    %s\n", rep.Address)
+	fmt.Printf("Route:     %s\n", rep.Route)
+	fmt.Printf("Protocol:  %s, %s\n", rep.Version, rep.CipherSuite)
+	fmt.Println()
+	fmt.Println("Certificate chain as presented, leaf first:")
+	now := time.Now()
+	for i, c := range rep.Chain {
+		validity := fmt.Sprintf("%s to %s", c.NotBefore.Local().Format("2006-01-02"), c.NotAfter.Local().Format("2006-01-02"))
+		switch {
+		case now.After(c.NotAfter):
+			validity += " (EXPIRED)"
+		case now.Before(c.NotBefore):
+			validity += " (NOT YET VALID)"
+		}
+		pin := c.SPKIPin
+		if c.Pinned {
+			pin += " (pinned)"
+		}
+		fmt.Printf("  [%d] Subject:  %s\n", i, c.Subject)
+		fmt.Printf("      Issuer:   %s\n", c.Issuer)
+		fmt.Printf("      Valid:    %s\n", validity)
+		fmt.Printf("      CA:       %t\n", c.IsCA)
+		fmt.Printf("      SHA-256:  %s\n", c.SHA256)
+		fmt.Printf("      SPKI pin: %s\n", pin)
+	}
+	fmt.Println()
+
+	verdict := func(err error) string {
+		if err == nil {
+			return "trusted"
+		}
+		return "NOT trusted: " + err.Error()
+	}
+	fmt.Printf("System roots:        %s\n", verdict(rep.SystemErr))
+	if cfg.Tenant.CABundle != "" {
+		fmt.Printf("System + ca_bundle:  %s\n", verdict(rep.ConfiguredErr))
+	}
+	if !cfg.Tenant.VerifySSL {
+		fmt.Println("verify_ssl:          off (chain trust is not enforced)")
+	}
+	if rep.Pins > 0 {
+		fmt.Printf("SPKI pins:           %d configured\n", rep.Pins)
+	}
+	switch {
+	case rep.ClientCertRequested && rep.ClientCertSent:
+		fmt.Println("Client certificate:  requested by the tenant, sent")
+	case rep.ClientCertRequested:
+		fmt.Println("Client certificate:  requested by the tenant, none configured")
+	case cfg.Tenant.ClientCert != "":
+		fmt.Println("Client certificate:  configured, not requested by the tenant")
+	}
+	fmt.Println()
+
+	// ConfiguredErr is SystemErr when there is no ca_bundle.
+	if rep.ConfiguredErr != nil && len(rep.Chain) > 0 {
+		top := rep.Chain[len(rep.Chain)-1]
+		fmt.Println("The chain is not trusted by the system roots. If the issuer below is your")
+		fmt.Println("firewall or proxy, the connection is being intercepted; add its CA")
+		fmt.Println("certificate to [tenant] ca_bundle rather than turning verify_ssl off.")
+		fmt.Printf("  Top issuer: %s\n", top.Issuer)
+		fmt.Println()
+	}
+	if rep.HandshakeErr != nil {
+		fmt.Printf("Result: the agent would REFUSE this connection: %v\n", rep.HandshakeErr)
+		os.Exit(1)
+	}
+	fmt.Println("Result: the agent would accept this connection.")
+}
+
+// startupFailed exits an agent that failed to start. A freshly installed
+// update on trial is rolled back first, so the agent restarts on the previous
+// version instead of failing the same way until its starts run out.
+func startupFailed(isService bool, reason string) {
+	if update.Abort(reason) {
+		restartRolledBack(isService)
+	}
+	os.Exit(1)
+}
+
+// restartRolledBack restarts the agent on the previous version after an
+// update was rolled back at startup: a service exits for the SCM's recovery
+// actions to start it again, a foreground agent runs the previous executable
+// in its place.
+func restartRolledBack(isService bool) {
+	if isService {
+		os.Exit(1)
+	}
+	svc.Restart()
+}
+
+// runMockTenant implements "mock-tenant", which serves a mock tenant for the
+// agent to run against. It accepts the identity in config.toml, so an agent
+// sharing that config only needs [tenant] url pointed at it, and can enroll
+// agents with its own token. Runs until interrupted.
+func runMockTenant(exe string, args []string) {
+	fs := flag.NewFlagSet("mock-tenant", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s mock-tenant [flags]\n", exe)
+		fmt.Fprintln(os.Stderr, "")
+		fmt.Fprintln(os.Stderr, "Flags:")
+		fmt.Fprintln(os.Stderr, "  --addr <host:port>     Address to listen on (default 127.0.0.1:8787)")
+		fmt.Fprintln(os.Stderr, "  --fixtures <dir>       JSON files answering the agent's reads, by endpoint path,")
+		fmt.Fprintln(os.Stderr, "                         e.g. papercut-config.json, devicemanager/payloads.json")
+		fmt.Fprintln(os.Stderr, "  --script <file>        JSON array of steps queueing commands, device queries and")
+		fmt.Fprintln(os.Stderr, "                         key rotations, e.g. [{\"after\": \"30s\", \"command\": {...}}]")
+		fmt.Fprintln(os.Stderr, "  --record <dir>         Write every upload to this directory")
+		fmt.Fprintln(os.Stderr, "  --tls                  Serve HTTPS with a self-signed certificate, written to")
+		fmt.Fprintln(os.Stderr, "                         mock-tenant.pem in the data directory for [tenant] ca_bundle")
+		fmt.Fprintln(os.Stderr, "  --enroll-token <token> Enrollment token to accept (default: generated)")
+		fmt.Fprintln(os.Stderr, "  --legacy               Behave like a tenant without v2 envelopes, compression,")
+		fmt.Fprintln(os.Stderr, "                         push, schedule manifests or updates")
+		fmt.Fprintln(os.Stderr, "  --no-push              Turn off the push channel")
+		fmt.Fprintln(os.Stderr, "")
+		fmt.Fprintln(os.Stderr, "While it runs, POST /mock/commands, /mock/device-queries and /mock/rotate-key")
+		fmt.Fprintln(os.Stderr, "queue work for the agent, and GET /mock/uploads lists what it has sent.")
+	}
+	addr := fs.String("addr", "127.0.0.1:8787", "Address to listen on")
+	fixtures := fs.String("fixtures", "", "Fixtures directory")
+	script := fs.String("script", "", "Script file")
+	record := fs.String("record", "", "Upload record directory")
+	useTLS := fs.Bool("tls", false, "Serve HTTPS")
+	token := fs.String("enroll-token", "", "Enrollment token")
+	legacy := fs.Bool("legacy", false, "Behave like a legacy tenant")
+	noPush := fs.Bool("no-push", false, "Turn off the push channel")
+	if err := fs.Parse(args); err != nil {
+		os.Exit(1)
+	}
+	if fs.NArg() > 0 {
+		fs.Usage()
+		os.Exit(1)
+	}
+	slog.SetDefault(slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelDebug})))
+
+	var steps []mocktenant.Step
+	if *script != "" {
+		var err error
+		if steps, err = mocktenant.LoadScript(*script); err != nil {
+			fmt.Fprintf(os.Stderr, "mock-tenant: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if *record != "" {
+		if err := os.MkdirAll(*record, 0o700); err != nil {
+			fmt.Fprintf(os.Stderr, "mock-tenant: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if *token == "" {
+		*token = rand.Text()
+	}
+
+	t := &config.Get().Tenant
+	agent := mocktenant.Identity{UUID: t.UUID, APIKey: t.GetAPIKey(), KeyID: t.EncryptionKeyID, PreviousKeyID: t.PreviousEncryptionKeyID}
+	if key, err := t.GetEncryptionKey(); err == nil {
+		agent.Key = key
+	}
+	if prev, err := t.GetPreviousEncryptionKey(); err == nil {
+		agent.PreviousKey = prev
+	}
+
+	mock := mocktenant.New(mocktenant.Options{
+		Agent:       agent,
+		EnrollToken: *token,
+		Fixtures:    *fixtures,
+		Record:      *record,
+		Legacy:      *legacy,
+		DisablePush: *noPush,
+	})
+	// No write timeout: push polls are held open.
+	srv := &http.Server{Addr: *addr, Handler: mock, ReadHeaderTimeout: 10 * time.Second}
+
+	scheme := "http"
+	if *useTLS {
+		certPath := filepath.Join(config.DataDir(), "mock-tenant.pem")
+		tlsCfg, err := mocktenant.SelfSignedTLS(certPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "mock-tenant: %v\n", err)
+			os.Exit(1)
+		}
+		srv.TLSConfig = tlsCfg
+		scheme = "https"
+		fmt.Printf("Certificate:       %s (set [tenant] ca_bundle to trust it)\n", certPath)
+	}
+	fmt.Printf("Mock tenant:       %s://%s\n", scheme, *addr)
+	if agent.UUID != "" {
+		fmt.Printf("Accepting agent:   %s (from %s)\n", agent.UUID, config.ConfigPath())
+	}
+	fmt.Printf("Enrollment token:  %s\n", *token)
+	fmt.Println()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	if len(steps) > 0 {
+		go mock.RunScript(ctx, steps)
+	}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		srv.Shutdown(shutdownCtx)
+	}()
+
+	var err error
+	if *useTLS {
+		err = srv.ListenAndServeTLS("", "")
+	} else {
+		err = srv.ListenAndServe()
+	}
+	if err != nil && err != http.ErrServerClosed {
+		fmt.Fprintf(os.Stderr, "mock-tenant: %v\n", err)
+		os.Exit(1)
+	}
+}